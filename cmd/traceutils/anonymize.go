@@ -7,26 +7,99 @@ import (
 	"github.com/felixge/traceutils/pkg/anonymize"
 )
 
-func AnonymizeCommand(args []string) error {
+// AnonymizeFlags are the flags of the anonymize command.
+type AnonymizeFlags struct {
+	Keep           string
+	Policy         string
+	Pseudonymize   bool
+	KeyFile        string
+	Mapping        string
+	MappingKeyFile string
+	Compress       string
+}
+
+func AnonymizeCommand(args []string, flags AnonymizeFlags) error {
 	// Check the number of arguments
 	if len(args) != 2 {
 		return fmt.Errorf("expected 2 arguments, got %d", len(args))
 	}
 
+	// Load the policy and add the packages to keep
+	policy := &anonymize.Policy{}
+	if flags.Policy != "" {
+		f, err := os.Open(flags.Policy)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if policy, err = anonymize.ParsePolicy(f); err != nil {
+			return fmt.Errorf("%s: %w", flags.Policy, err)
+		}
+	}
+	policy.Keep = append(policy.Keep, splitList(flags.Keep)...)
+	opts := anonymize.Options{Policy: policy, Pseudonymize: flags.Pseudonymize}
+
+	// Read the key for the pseudonyms
+	if flags.KeyFile != "" {
+		if !flags.Pseudonymize {
+			return fmt.Errorf("-key-file requires -pseudonymize")
+		}
+		key, err := os.ReadFile(flags.KeyFile)
+		if err != nil {
+			return err
+		}
+		opts.Key = key
+	}
+
+	// Create the mapping file and read the key to encrypt it
+	if flags.MappingKeyFile != "" {
+		if flags.Mapping == "" {
+			return fmt.Errorf("-mapping-key-file requires -mapping")
+		}
+		key, err := os.ReadFile(flags.MappingKeyFile)
+		if err != nil {
+			return err
+		}
+		opts.MappingKey = key
+	}
+	var mappingFile *os.File
+	if flags.Mapping != "" {
+		var err error
+		if mappingFile, err = os.Create(flags.Mapping); err != nil {
+			return err
+		}
+		defer mappingFile.Close()
+		opts.Mapping = mappingFile
+	}
+
+	// Determine the compression of the output file
+	compression, err := outputCompression(flags.Compress, args[1])
+	if err != nil {
+		return err
+	}
+
 	// Open the input file
-	inFile, err := os.Open(args[0])
+	inFile, err := openInput(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return err
 	}
 	defer inFile.Close()
 
 	// Open the output file
-	outFile, err := os.Create(args[1])
+	outFile, err := createOutput(args[1], compression)
 	if err != nil {
-		return fmt.Errorf("failed to open output file: %w", err)
+		return err
 	}
 	defer outFile.Close()
 
 	// Anonymize the trace file
-	return anonymize.AnonymizeTrace(inFile, outFile)
+	if err := anonymize.Anonymize(inFile, outFile, opts); err != nil {
+		return err
+	}
+	if mappingFile != nil {
+		if err := mappingFile.Close(); err != nil {
+			return err
+		}
+	}
+	return outFile.Close()
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"runtime"
 	"sort"
 
 	"github.com/felixge/traceutils/pkg/breakdown"
@@ -25,14 +26,20 @@ func BreakdownCommand(flavor BreakdownFlavor, args []string) error {
 	}
 
 	// Open the input file
-	inFile, err := os.Open(args[0])
+	inFile, err := openInputFile(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return err
 	}
 	defer inFile.Close()
 
-	// Break down the trace file by event type
-	bd, err := breakdown.ByEventType(inFile)
+	// Break down the trace file by event type. Splitting the trace into
+	// frames only pays off if they can be decoded in parallel.
+	var bd breakdown.EventTypeBreakdown
+	if runtime.GOMAXPROCS(0) == 1 {
+		bd, err = breakdown.ByEventType(inFile)
+	} else {
+		bd, err = breakdown.ByEventTypeParallel(inFile, inFile.Size)
+	}
 	if err != nil {
 		return err
 	}
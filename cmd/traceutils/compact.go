@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/felixge/traceutils/pkg/filter"
+)
+
+func CompactCommand(args []string, compress string) error {
+	// Check the number of arguments
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	// Determine the compression of the output file
+	compression, err := outputCompression(compress, args[1])
+	if err != nil {
+		return err
+	}
+
+	// Open the input file
+	inFile, err := openInputFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	// Open the output file
+	outFile, err := createOutput(args[1], compression)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// Compact the trace and count the uncompressed bytes written
+	out := &countingWriter{w: outFile}
+	removed, err := filter.Compact(inFile, out)
+	if err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+
+	// Report the removed strings and stacks and the size before and after
+	report := reportOutput(args[1])
+	printRemoved(report, removed, inFile.Size)
+	_, err = fmt.Fprintf(report, "Before: %s, After: %s (%.2f%%)\n", humanBytes(inFile.Size), humanBytes(out.n), float64(out.n)/float64(inFile.Size)*100)
+	return err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to w.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
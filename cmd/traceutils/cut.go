@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/felixge/traceutils/pkg/cut"
+)
+
+func CutCommand(args []string, opts cut.Options, useIndex bool, compress string) error {
+	// Check the number of arguments
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	// Determine the compression of the output file
+	compression, err := outputCompression(compress, args[1])
+	if err != nil {
+		return err
+	}
+
+	// Open the input file
+	inFile, err := openInputFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+	if useIndex {
+		if opts.Index, err = readIndex(args[0], inFile.Size); err != nil {
+			return err
+		}
+	}
+
+	// Open the output file
+	outFile, err := createOutput(args[1], compression)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// Cut the time window out of the trace
+	if err := cut.Cut(inFile, outFile, opts); err != nil {
+		return err
+	}
+	return outFile.Close()
+}
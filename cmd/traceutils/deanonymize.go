@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/felixge/traceutils/pkg/anonymize"
+	"github.com/google/pprof/profile"
+)
+
+// Input formats of the deanonymize command.
+const (
+	formatTrace = "trace"
+	formatPprof = "pprof"
+	formatText  = "text"
+)
+
+func DeanonymizeCommand(args []string, keyFile, format string) error {
+	// Check the number of arguments, the output defaults to stdout
+	if len(args) != 2 && len(args) != 3 {
+		return fmt.Errorf("expected 2 or 3 arguments, got %d", len(args))
+	}
+	output := stdio
+	if len(args) == 3 {
+		output = args[2]
+	}
+
+	// Read the mapping
+	var key []byte
+	if keyFile != "" {
+		var err error
+		if key, err = os.ReadFile(keyFile); err != nil {
+			return err
+		}
+	}
+	mappingFile, err := openInput(args[1])
+	if err != nil {
+		return err
+	}
+	defer mappingFile.Close()
+	mapping, err := anonymize.ReadMapping(mappingFile, key)
+	if err != nil {
+		return err
+	}
+
+	// Read the input, it's a trace, a pprof profile or text. The input
+	// is read as it is first, because its compression tells profiles apart.
+	inFile, err := openFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer inFile.Close()
+	raw, err := io.ReadAll(inFile)
+	if err != nil {
+		return err
+	}
+	inputCompression := detectCompression(raw)
+	r, err := decompress(bytes.NewReader(raw), inputCompression)
+	if err != nil {
+		return fmt.Errorf("failed to decompress input file: %w", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to decompress input file: %w", err)
+	}
+
+	// Detect the format of the input unless it's given. Traces start with
+	// their header and pprof profiles are always gzip compressed.
+	switch format {
+	case "":
+		switch {
+		case bytes.HasPrefix(data, []byte("go 1.")):
+			format = formatTrace
+		case inputCompression == CompressionGzip:
+			format = formatPprof
+		default:
+			format = formatText
+		}
+	case formatTrace, formatPprof, formatText:
+	default:
+		return fmt.Errorf("unsupported input format: %q", format)
+	}
+	var prof *profile.Profile
+	if format == formatPprof {
+		if prof, err = profile.ParseUncompressed(data); err != nil {
+			return fmt.Errorf("failed to parse pprof profile, use -format=text for other gzip compressed inputs: %w", err)
+		}
+	}
+	compression, err := outputCompression("", output)
+	if err != nil {
+		return err
+	} else if prof != nil {
+		compression = CompressionNone
+	}
+
+	// Open the output file
+	outFile, err := createOutput(output, compression)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// Restore the original strings
+	switch format {
+	case formatTrace:
+		err = anonymize.DeanonymizeTrace(bytes.NewReader(data), outFile, mapping)
+	case formatPprof:
+		anonymize.DeanonymizeProfile(prof, mapping)
+		err = prof.Write(outFile)
+	default:
+		err = anonymize.DeanonymizeText(bytes.NewReader(data), outFile, mapping)
+	}
+	if err != nil {
+		return err
+	}
+	return outFile.Close()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/felixge/traceutils/pkg/diff"
+)
+
+func DiffRawCommand(args []string) error {
+	// Check the number of arguments
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	// Open the input files
+	aFile, err := openInput(args[0])
+	if err != nil {
+		return err
+	}
+	defer aFile.Close()
+	bFile, err := openInput(args[1])
+	if err != nil {
+		return err
+	}
+	defer bFile.Close()
+
+	// Compare the events and print the differences and a summary
+	res, err := diff.Raw(aFile, bFile)
+	if err != nil {
+		return err
+	}
+	stdout := bufio.NewWriter(os.Stdout)
+	for _, d := range res.Diffs {
+		fmt.Fprintln(stdout, d)
+	}
+	fmt.Fprintf(stdout, "%d changed, %d removed, %d inserted, %d equal events\n", res.Changed, res.Removed, res.Inserted, res.Equal)
+	if err := stdout.Flush(); err != nil {
+		return err
+	}
+	if len(res.Diffs) > 0 {
+		return fmt.Errorf("found %d differences", len(res.Diffs))
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/felixge/traceutils/pkg/dump"
+)
+
+func DumpCommand(args []string, start, end int64, types string) error {
+	// Check the number of arguments
+	if len(args) != 1 {
+		return fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	// Parse the event types to print
+	opts := dump.Options{Start: start, End: end}
+	var err error
+	if opts.Types, err = parseEventTypes(types); err != nil {
+		return err
+	}
+
+	// Open the input file
+	inFile, err := openInputFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	// Print the annotated bytes of the events to stdout
+	return dump.Dump(inFile, inFile.Size, os.Stdout, opts)
+}
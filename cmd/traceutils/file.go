@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression format of an input or output file.
+type Compression string
+
+const (
+	CompressionNone  Compression = "none"
+	CompressionGzip  Compression = "gzip"
+	CompressionZstd  Compression = "zstd"
+	CompressionBzip2 Compression = "bzip2"
+)
+
+// stdio is the path that refers to stdin for inputs and stdout for outputs.
+const stdio = "-"
+
+// magics maps the magic bytes at the start of a file to its compression.
+var magics = []struct {
+	magic       []byte
+	compression Compression
+}{
+	{[]byte{0x1f, 0x8b}, CompressionGzip},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, CompressionZstd},
+	{[]byte("BZh"), CompressionBzip2},
+}
+
+// detectCompression returns the compression of a file starting with the
+// given bytes.
+func detectCompression(start []byte) Compression {
+	for _, m := range magics {
+		if bytes.HasPrefix(start, m.magic) {
+			return m.compression
+		}
+	}
+	return CompressionNone
+}
+
+// openInput opens the file at path, or stdin if path is "-", and
+// transparently decompresses gzip, zstd and bzip2 files.
+func openInput(path string) (io.ReadCloser, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	br := bufio.NewReader(file)
+	start, _ := br.Peek(4)
+	r, err := decompress(br, detectCompression(start))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decompress input file: %w", err)
+	}
+	return &inputReader{Reader: r, file: file}, nil
+}
+
+// openFile opens the file at path or returns stdin if path is "-".
+func openFile(path string) (*os.File, error) {
+	if path == stdio {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+// decompress returns a reader that decompresses r.
+func decompress(r io.Reader, c Compression) (io.Reader, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case CompressionBzip2:
+		return bzip2.NewReader(r), nil
+	default:
+		return r, nil
+	}
+}
+
+// inputReader is an input returned by openInput.
+type inputReader struct {
+	io.Reader
+	file *os.File
+}
+
+// Close closes the decompressor and the file.
+func (r *inputReader) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	if r.file == os.Stdin {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// inputFile is a seekable input returned by openInputFile.
+type inputFile struct {
+	*os.File
+	// Size is the size of the uncompressed trace.
+	Size int64
+	// temp is true if File is a temporary file holding the uncompressed
+	// trace.
+	temp bool
+}
+
+// openInputFile is like openInput, but returns a file that supports random
+// access. Compressed files and stdin are decompressed into a temporary file
+// that is removed by Close.
+func openInputFile(path string) (*inputFile, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+
+	// Use regular uncompressed files directly
+	var start [4]byte
+	n, _ := file.ReadAt(start[:], 0)
+	if info, err := file.Stat(); err == nil && info.Mode().IsRegular() &&
+		detectCompression(start[:n]) == CompressionNone {
+		return &inputFile{File: file, Size: info.Size()}, nil
+	}
+	if file != os.Stdin {
+		file.Close()
+	}
+
+	// Decompress everything else into a temporary file
+	in, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp("", "traceutils-*.trace")
+	if err != nil {
+		return nil, err
+	}
+	f := &inputFile{File: tmp, temp: true}
+	if f.Size, err = io.Copy(tmp, in); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to decompress input file: %w", err)
+	} else if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close closes the file and removes it if it's temporary.
+func (f *inputFile) Close() error {
+	if f.File == os.Stdin {
+		return nil
+	}
+	err := f.File.Close()
+	if f.temp {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// outputCompression returns the compression for the output file at path. If
+// flag is empty, the compression is determined by the extension of path.
+func outputCompression(flag, path string) (Compression, error) {
+	switch c := Compression(flag); c {
+	case "":
+		switch filepath.Ext(path) {
+		case ".gz":
+			return CompressionGzip, nil
+		case ".zst":
+			return CompressionZstd, nil
+		default:
+			return CompressionNone, nil
+		}
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unsupported output compression: %q", flag)
+	}
+}
+
+// createOutput creates the file at path, or uses stdout if path is "-", and
+// compresses everything written to it with c. Close must be called to flush
+// the compressed data.
+func createOutput(path string, c Compression) (io.WriteCloser, error) {
+	var (
+		file *os.File
+		err  error
+	)
+	if path == stdio {
+		file = os.Stdout
+	} else if file, err = os.Create(path); err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+
+	out := &outputWriter{file: file}
+	out.buf = bufio.NewWriter(file)
+	switch c {
+	case CompressionGzip:
+		out.compressor = gzip.NewWriter(out.buf)
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(out.buf)
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		out.compressor = enc
+	}
+	return out, nil
+}
+
+// outputWriter is an output returned by createOutput.
+type outputWriter struct {
+	file       *os.File
+	buf        *bufio.Writer
+	compressor io.WriteCloser // nil if uncompressed
+	closed     bool
+}
+
+// Write writes p to the output.
+func (w *outputWriter) Write(p []byte) (int, error) {
+	if w.compressor != nil {
+		return w.compressor.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// Close flushes the compressor and the buffer and closes the file. It's safe
+// to call Close more than once.
+func (w *outputWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var err error
+	if w.compressor != nil {
+		err = w.compressor.Close()
+	}
+	if flushErr := w.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if w.file != os.Stdout {
+		if closeErr := w.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
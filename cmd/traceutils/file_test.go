@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestCompression tests that files written by createOutput are decompressed
+// by openInput and openInputFile.
+func TestCompression(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name  string
+		Flag  string
+		Want  Compression
+		Input bool // only supported for inputs
+	}{
+		{"trace.bin", "", CompressionNone, false},
+		{"trace.gz", "", CompressionGzip, false},
+		{"trace.zst", "", CompressionZstd, false},
+		{"trace.gz", "none", CompressionNone, false},
+		{"trace", "zstd", CompressionZstd, false},
+		{"trace.bz2", "", CompressionBzip2, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name+"/"+test.Flag, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.Name)
+			if test.Input {
+				writeBzip2(t, path, data)
+			} else {
+				c, err := outputCompression(test.Flag, path)
+				require.NoError(t, err)
+				require.Equal(t, test.Want, c)
+				out, err := createOutput(path, c)
+				require.NoError(t, err)
+				_, err = out.Write(data)
+				require.NoError(t, err)
+				require.NoError(t, out.Close())
+			}
+
+			// Check the compression of the file
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, test.Want, detectCompression(raw))
+
+			// Read the file sequentially
+			in, err := openInput(path)
+			require.NoError(t, err)
+			got, err := io.ReadAll(in)
+			require.NoError(t, err)
+			require.NoError(t, in.Close())
+			require.Equal(t, data, got)
+
+			// Read the file with random access
+			f, err := openInputFile(path)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(data)), f.Size)
+			got = make([]byte, len(data))
+			_, err = f.ReadAt(got, 0)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			require.Equal(t, data, got)
+			if test.Want != CompressionNone {
+				_, err := os.Stat(f.Name())
+				require.True(t, os.IsNotExist(err), "temporary file not removed")
+			}
+		})
+	}
+
+	_, err = outputCompression("bzip2", "trace")
+	require.Error(t, err)
+}
+
+// writeBzip2 writes data compressed with the bzip2 command to path. The test
+// is skipped if bzip2 isn't installed, compress/bzip2 can only decompress.
+func writeBzip2(t *testing.T, path string, data []byte) {
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		t.Skip("bzip2 not installed")
+	}
+	cmd := exec.Command("bzip2", "-c")
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, out, 0o644))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/felixge/traceutils/pkg/breakdown"
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/filter"
+	"github.com/olekukonko/tablewriter"
+)
+
+func FilterCommand(args []string, types, ps, gs, compress string) error {
+	// Check the number of arguments
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	// Parse the events to remove
+	var opts filter.Options
+	var err error
+	if opts.Types, err = parseEventTypes(types); err != nil {
+		return err
+	}
+	for _, s := range splitList(ps) {
+		p, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		opts.Ps = append(opts.Ps, p)
+	}
+	for _, s := range splitList(gs) {
+		g, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		opts.Gs = append(opts.Gs, g)
+	}
+
+	// Determine the compression of the output file
+	compression, err := outputCompression(compress, args[1])
+	if err != nil {
+		return err
+	}
+
+	// Open the input file
+	inFile, err := openInputFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	// Open the output file
+	outFile, err := createOutput(args[1], compression)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// Filter the trace
+	removed, err := filter.Filter(inFile, outFile, opts)
+	if err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+
+	// Report the removed events, to stderr if the trace is written to
+	// stdout
+	printRemoved(reportOutput(args[1]), removed, inFile.Size)
+	return nil
+}
+
+// reportOutput returns the writer for reports about a trace written to the
+// output path, which is stderr if the trace is written to stdout.
+func reportOutput(outPath string) io.Writer {
+	if outPath == "-" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printRemoved prints a table of the events removed from a trace of the
+// given size.
+func printRemoved(w io.Writer, removed breakdown.EventTypeBreakdown, inputSize int64) {
+	summaries := make([]breakdown.EventTypeSummary, 0, len(removed))
+	var totalCount, totalBytes int64
+	for _, ets := range removed {
+		summaries = append(summaries, ets)
+		totalCount += ets.Count
+		totalBytes += ets.Bytes
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Bytes > summaries[j].Bytes
+	})
+	var rows [][]string
+	for _, s := range summaries {
+		rows = append(rows, []string{
+			s.EventType.String(),
+			fmt.Sprintf("%d", s.Count),
+			humanBytes(s.Bytes),
+			fmt.Sprintf("%.2f%%", float64(s.Bytes)/float64(inputSize)*100),
+		})
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Event Type", "Removed", "Bytes", "% of Input"})
+	table.AppendBulk(rows)
+	table.SetFooter([]string{"Total", fmt.Sprintf("%d", totalCount), humanBytes(totalBytes), fmt.Sprintf("%.2f%%", float64(totalBytes)/float64(inputSize)*100)})
+	table.Render()
+}
+
+// parseEventTypes parses a comma separated list of event type names. A name
+// can be given with or without the "Event" prefix, e.g. HeapAlloc, and then
+// refers to the event types of all trace versions, e.g. EventHeapAlloc and
+// EventV2HeapAlloc.
+func parseEventTypes(names string) ([]encoding.EventType, error) {
+	var types []encoding.EventType
+	for _, name := range splitList(names) {
+		n := len(types)
+		for i := 0; i < 256; i++ {
+			t := encoding.EventType(i)
+			if s := t.String(); s == name || s == "Event"+name || s == "EventV2"+name {
+				types = append(types, t)
+			}
+		}
+		if len(types) == n {
+			return nil, fmt.Errorf("unknown event type %q", name)
+		}
+	}
+	return types, nil
+}
+
+// splitList splits a comma separated list and drops empty elements.
+func splitList(list string) []string {
+	var elems []string
+	for _, elem := range strings.Split(list, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
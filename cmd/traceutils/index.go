@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+// indexPath returns the path of the index of the trace at tracePath.
+func indexPath(tracePath string) string {
+	return tracePath + ".idx"
+}
+
+func IndexCommand(args []string) error {
+	// Check the number of arguments
+	if len(args) != 1 {
+		return fmt.Errorf("expected 1 argument, got %d", len(args))
+	} else if args[0] == stdio {
+		return fmt.Errorf("can't index stdin, the index is written next to the input file")
+	}
+
+	// Open the input file
+	inFile, err := openInputFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	// Build the index
+	idx, err := encoding.BuildIndex(inFile)
+	if err != nil {
+		return err
+	}
+
+	// Write the index next to the input file
+	outFile, err := os.Create(indexPath(args[0]))
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer outFile.Close()
+	if err := idx.Write(outFile); err != nil {
+		return err
+	}
+	return outFile.Close()
+}
+
+// readIndex reads the index of the trace at tracePath with the given
+// uncompressed size and returns an error if it doesn't exist or belongs to a
+// different trace.
+func readIndex(tracePath string, size int64) (*encoding.Index, error) {
+	file, err := os.Open(indexPath(tracePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file, create it with traceutils index: %w", err)
+	}
+	defer file.Close()
+
+	idx, err := encoding.ReadIndex(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index file: %w", err)
+	}
+	if size != idx.Size {
+		return nil, fmt.Errorf("index file doesn't match the trace, recreate it with traceutils index")
+	}
+	return idx, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/felixge/traceutils/pkg/jsonl"
+)
+
+type JSONDirection string
+
+const (
+	JSONExport JSONDirection = "export"
+	JSONImport JSONDirection = "import"
+)
+
+func JSONCommand(direction JSONDirection, args []string, compress string) error {
+	// Check the number of arguments
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	// Determine the compression of the output file
+	compression, err := outputCompression(compress, args[1])
+	if err != nil {
+		return err
+	}
+
+	// Open the input file
+	inFile, err := openInput(args[0])
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	// Open the output file
+	outFile, err := createOutput(args[1], compression)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// Convert the trace to JSON Lines or back
+	switch direction {
+	case JSONExport:
+		err = jsonl.Export(inFile, outFile)
+	case JSONImport:
+		err = jsonl.Import(inFile, outFile)
+	}
+	if err != nil {
+		return err
+	}
+	return outFile.Close()
+}
@@ -12,8 +12,10 @@ import (
 
 	gt "honnef.co/go/gotraceui/trace"
 
+	cutpkg "github.com/felixge/traceutils/pkg/cut"
 	"github.com/felixge/traceutils/pkg/pprof"
 	"github.com/felixge/traceutils/pkg/print"
+	repairpkg "github.com/felixge/traceutils/pkg/repair"
 	"github.com/peterbourgon/ff/v3/ffcli"
 )
 
@@ -31,10 +33,58 @@ func realMain() error {
 		cpuProfileF = rootFlagSet.String("cpuprofile", "", "write cpu profile to file")
 		traceF      = rootFlagSet.String("trace", "", "write trace to file")
 
+		anonymizeFlagSet  = flag.NewFlagSet("traceutils anonymize", flag.ExitOnError)
+		anonymizeKeep     = anonymizeFlagSet.String("keep", "", "comma separated module or package paths that are kept in addition to the go stdlib")
+		anonymizePolicy   = anonymizeFlagSet.String("policy", "", "file with keep and scrub rules, see the README")
+		anonymizePseudo   = anonymizeFlagSet.Bool("pseudonymize", false, "replace names with stable pseudonyms instead of XXX")
+		anonymizeKeyFile  = anonymizeFlagSet.String("key-file", "", "file with the secret key for -pseudonymize, a random key is used by default")
+		anonymizeMapping  = anonymizeFlagSet.String("mapping", "", "write the mapping from the anonymized to the original strings to this file")
+		anonymizeMapKey   = anonymizeFlagSet.String("mapping-key-file", "", "file with the key to encrypt the mapping, it's not encrypted by default")
+		anonymizeCompress = anonymizeFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+
+		deanonymizeFlagSet = flag.NewFlagSet("traceutils deanonymize", flag.ExitOnError)
+		deanonymizeKeyFile = deanonymizeFlagSet.String("key-file", "", "file with the key of an encrypted mapping")
+		deanonymizeFormat  = deanonymizeFlagSet.String("format", "", "format of <input>: trace, pprof or text, by default traces are detected by their header and other gzip compressed inputs are pprof profiles")
+
 		breakdownFlagSet = flag.NewFlagSet("traceutils breakdown", flag.ExitOnError)
 
-		pprofFlagSet     = flag.NewFlagSet("traceutils pprof", flag.ExitOnError)
-		pprofWallFlagSet = flag.NewFlagSet("traceutils pprof wall", flag.ExitOnError)
+		compactFlagSet  = flag.NewFlagSet("traceutils compact", flag.ExitOnError)
+		compactCompress = compactFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+
+		cutFlagSet  = flag.NewFlagSet("traceutils cut", flag.ExitOnError)
+		cutStart    = cutFlagSet.Duration("start", 0, "start of the time window relative to the start of the trace")
+		cutEnd      = cutFlagSet.Duration("end", 0, "end of the time window relative to the start of the trace, 0 means the end of the trace")
+		cutIndex    = cutFlagSet.Bool("index", false, "use the index created by traceutils index instead of building it")
+		cutCompress = cutFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+
+		diffFlagSet = flag.NewFlagSet("traceutils diff", flag.ExitOnError)
+
+		dumpFlagSet = flag.NewFlagSet("traceutils dump", flag.ExitOnError)
+		dumpStart   = dumpFlagSet.Int64("start", 0, "print events starting at or after this byte offset")
+		dumpEnd     = dumpFlagSet.Int64("end", 0, "print events starting before this byte offset, 0 means the end of the trace")
+		dumpTypes   = dumpFlagSet.String("types", "", "only print events of these types, comma separated, e.g. Batch,Stack,String")
+
+		filterFlagSet  = flag.NewFlagSet("traceutils filter", flag.ExitOnError)
+		filterTypes    = filterFlagSet.String("types", "", "remove events of these types, comma separated, e.g. HeapAlloc,CPUSample,UserLog")
+		filterP        = filterFlagSet.String("p", "", "remove events of these procs, comma separated")
+		filterG        = filterFlagSet.String("g", "", "remove events of these goroutines, comma separated")
+		filterCompress = filterFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+
+		flamescopeFlagSet  = flag.NewFlagSet("traceutils flamescope", flag.ExitOnError)
+		flamescopeCompress = flamescopeFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+
+		jsonFlagSet        = flag.NewFlagSet("traceutils json", flag.ExitOnError)
+		jsonExportFlagSet  = flag.NewFlagSet("traceutils json export", flag.ExitOnError)
+		jsonExportCompress = jsonExportFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+		jsonImportFlagSet  = flag.NewFlagSet("traceutils json import", flag.ExitOnError)
+		jsonImportCompress = jsonImportFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+
+		mergeFlagSet  = flag.NewFlagSet("traceutils merge", flag.ExitOnError)
+		mergeCompress = mergeFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+
+		pprofFlagSet      = flag.NewFlagSet("traceutils pprof", flag.ExitOnError)
+		pprofWallFlagSet  = flag.NewFlagSet("traceutils pprof wall", flag.ExitOnError)
+		pprofWallCompress = pprofWallFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default it's only compressed with zstd if <output> ends with .zst")
 
 		printFlagSet       = flag.NewFlagSet("traceutils print", flag.ExitOnError)
 		printEventsFlagSet = flag.NewFlagSet("traceutils print events", flag.ExitOnError)
@@ -43,9 +93,14 @@ func realMain() error {
 		printMinTs         = printEventsFlagSet.Int64("minTs", 0, "print events with a timestamp >= minTs")
 		printMaxTs         = printEventsFlagSet.Int64("maxTs", -1, "print events with a timestamp <= maxTs, -1 means no upper limit")
 		printVerbose       = printEventsFlagSet.Bool("v", false, "print stack traces for all events")
+		printIndex         = printEventsFlagSet.Bool("index", false, "only decode the batches matching -minTs, -maxTs and -p using the index created by traceutils index")
 		printStacksFlagSet = flag.NewFlagSet("traceutils print stacks", flag.ExitOnError)
 		printStackIDs      = printStacksFlagSet.String("ids", "", "print stacks with these ids, comma separated")
 
+		repairFlagSet   = flag.NewFlagSet("traceutils repair", flag.ExitOnError)
+		repairFrequency = repairFlagSet.Uint64("frequency", repairpkg.DefaultFrequency, "ticks per second of the frequency event added to go 1.21 and older traces without one")
+		repairCompress  = repairFlagSet.String("compress", "", "compress the output with gzip, zstd or none, by default the extension of <output> decides")
+
 		stwFlagSet = flag.NewFlagSet("traceutils stw", flag.ExitOnError)
 	)
 
@@ -53,7 +108,28 @@ func realMain() error {
 		Name:       "anonymize",
 		ShortUsage: "traceutils anonymize <input> <output>",
 		ShortHelp:  "Anonymizes a trace file.",
-		Exec:       func(_ context.Context, args []string) error { return AnonymizeCommand(args) },
+		FlagSet:    anonymizeFlagSet,
+		Exec: func(_ context.Context, args []string) error {
+			return AnonymizeCommand(args, AnonymizeFlags{
+				Keep:           *anonymizeKeep,
+				Policy:         *anonymizePolicy,
+				Pseudonymize:   *anonymizePseudo,
+				KeyFile:        *anonymizeKeyFile,
+				Mapping:        *anonymizeMapping,
+				MappingKeyFile: *anonymizeMapKey,
+				Compress:       *anonymizeCompress,
+			})
+		},
+	}
+
+	deanonymize := &ffcli.Command{
+		Name:       "deanonymize",
+		ShortUsage: "traceutils deanonymize <input> <mapping> [<output>]",
+		ShortHelp:  "Restores the original strings of an anonymized trace, pprof profile or text.",
+		FlagSet:    deanonymizeFlagSet,
+		Exec: func(_ context.Context, args []string) error {
+			return DeanonymizeCommand(args, *deanonymizeKeyFile, *deanonymizeFormat)
+		},
 	}
 
 	breakdownCSV := &ffcli.Command{
@@ -89,20 +165,119 @@ func realMain() error {
 		},
 	}
 
+	compact := &ffcli.Command{
+		Name:       "compact",
+		ShortUsage: "traceutils compact [flags] <input> <output>",
+		ShortHelp:  "Merge identical strings and stacks and remove unreferenced ones.",
+		FlagSet:    compactFlagSet,
+		Exec:       func(_ context.Context, args []string) error { return CompactCommand(args, *compactCompress) },
+	}
+
+	cut := &ffcli.Command{
+		Name:       "cut",
+		ShortUsage: "traceutils cut [flags] <input> <output>",
+		ShortHelp:  "Extract the events of a time window into a new trace.",
+		FlagSet:    cutFlagSet,
+		Exec: func(_ context.Context, args []string) error {
+			opts := cutpkg.Options{Start: *cutStart, End: *cutEnd}
+			return CutCommand(args, opts, *cutIndex, *cutCompress)
+		},
+	}
+
+	diffRaw := &ffcli.Command{
+		Name:       "raw",
+		ShortUsage: "traceutils diff raw <a> <b>",
+		ShortHelp:  "Report the events that were removed, inserted or changed in trace b compared to trace a.",
+		Exec:       func(_ context.Context, args []string) error { return DiffRawCommand(args) },
+	}
+
+	diff := &ffcli.Command{
+		Name:        "diff",
+		ShortUsage:  "traceutils diff <subcommand> <a> <b>",
+		ShortHelp:   "Compare two traces.",
+		FlagSet:     diffFlagSet,
+		Subcommands: []*ffcli.Command{diffRaw},
+		Exec: func(_ context.Context, _ []string) error {
+			diffFlagSet.Usage()
+			return nil
+		},
+	}
+
+	dump := &ffcli.Command{
+		Name:       "dump",
+		ShortUsage: "traceutils dump [flags] <input>",
+		ShortHelp:  "Print the raw bytes of the events in a trace annotated with their decoded fields.",
+		FlagSet:    dumpFlagSet,
+		Exec: func(_ context.Context, args []string) error {
+			return DumpCommand(args, *dumpStart, *dumpEnd, *dumpTypes)
+		},
+	}
+
+	filter := &ffcli.Command{
+		Name:       "filter",
+		ShortUsage: "traceutils filter [flags] <input> <output>",
+		ShortHelp:  "Remove events from a trace along with the strings and stacks only they use.",
+		FlagSet:    filterFlagSet,
+		Exec: func(_ context.Context, args []string) error {
+			return FilterCommand(args, *filterTypes, *filterP, *filterG, *filterCompress)
+		},
+	}
+
 	flamescope := &ffcli.Command{
 		Name:       "flamescope",
 		ShortUsage: "traceutils flamescope <input> <output>",
 		ShortHelp:  "Extract CPU samples from a trace and convert them to a format suitable for FlameScope.",
-		Exec:       func(_ context.Context, args []string) error { return FlameScopeCommand(args) },
+		FlagSet:    flamescopeFlagSet,
+		Exec:       func(_ context.Context, args []string) error { return FlameScopeCommand(args, *flamescopeCompress) },
+	}
+
+	jsonExport := &ffcli.Command{
+		Name:       "export",
+		ShortUsage: "traceutils json export [flags] <input> <output>",
+		ShortHelp:  "Convert the events of a trace to JSON Lines.",
+		FlagSet:    jsonExportFlagSet,
+		Exec: func(_ context.Context, args []string) error {
+			return JSONCommand(JSONExport, args, *jsonExportCompress)
+		},
+	}
+
+	jsonImport := &ffcli.Command{
+		Name:       "import",
+		ShortUsage: "traceutils json import [flags] <input> <output>",
+		ShortHelp:  "Convert JSON Lines created by json export back to a trace.",
+		FlagSet:    jsonImportFlagSet,
+		Exec: func(_ context.Context, args []string) error {
+			return JSONCommand(JSONImport, args, *jsonImportCompress)
+		},
+	}
+
+	json := &ffcli.Command{
+		Name:        "json",
+		ShortUsage:  "traceutils json <subcommand> <input> <output>",
+		ShortHelp:   "Convert traces to JSON Lines and back.",
+		FlagSet:     jsonFlagSet,
+		Subcommands: []*ffcli.Command{jsonExport, jsonImport},
+		Exec: func(_ context.Context, _ []string) error {
+			jsonFlagSet.Usage()
+			return nil
+		},
+	}
+
+	merge := &ffcli.Command{
+		Name:       "merge",
+		ShortUsage: "traceutils merge [flags] <input>... <output>",
+		ShortHelp:  "Merge consecutive traces of the same process into one trace.",
+		FlagSet:    mergeFlagSet,
+		Exec:       func(_ context.Context, args []string) error { return MergeCommand(args, *mergeCompress) },
 	}
 
 	pprofWall := &ffcli.Command{
 		Name:       "wall",
-		ShortUsage: "traceutils pprof wall <input>",
+		ShortUsage: "traceutils pprof wall <input> <output>",
 		ShortHelp:  "Convert a trace to a pprof wall-clock profile.",
 		FlagSet:    pprofWallFlagSet,
 		Exec: func(_ context.Context, args []string) error {
-			return PPROF(args, pprof.Options{})
+			return PPROF(args, pprof.Options{}, *pprofWallCompress)
 		},
 	}
 
@@ -130,7 +305,7 @@ func realMain() error {
 			filter.G = *printG
 			filter.P = *printP
 			filter.Verbose = *printVerbose
-			return PrintEvents(args, filter)
+			return PrintEvents(args, filter, *printIndex)
 		},
 	}
 
@@ -168,6 +343,23 @@ func realMain() error {
 		},
 	}
 
+	index := &ffcli.Command{
+		Name:       "index",
+		ShortUsage: "traceutils index <input>",
+		ShortHelp:  "Create an index of the batches of a trace in <input>.idx.",
+		Exec:       func(_ context.Context, args []string) error { return IndexCommand(args) },
+	}
+
+	repair := &ffcli.Command{
+		Name:       "repair",
+		ShortUsage: "traceutils repair [flags] <input> <output>",
+		ShortHelp:  "Write the parts of a truncated or corrupted trace that can be decoded to a new trace.",
+		FlagSet:    repairFlagSet,
+		Exec: func(_ context.Context, args []string) error {
+			return RepairCommand(args, repairpkg.Options{Frequency: *repairFrequency}, *repairCompress)
+		},
+	}
+
 	strings := &ffcli.Command{
 		Name:       "strings",
 		ShortUsage: "traceutils strings <input>",
@@ -201,10 +393,18 @@ func realMain() error {
 		},
 	}
 
+	validate := &ffcli.Command{
+		Name:       "validate",
+		ShortUsage: "traceutils validate <input>",
+		ShortHelp:  "Check a trace for structural and semantic problems.",
+		Exec:       func(_ context.Context, args []string) error { return ValidateCommand(args) },
+	}
+
 	root := &ffcli.Command{
 		ShortUsage:  "traceutils [flags] <subcommand>",
+		LongHelp:    "Compressed gzip, zstd and bzip2 inputs are decompressed transparently. An <input> or <output> of - means stdin or stdout.",
 		FlagSet:     rootFlagSet,
-		Subcommands: []*ffcli.Command{anonymize, breakdown, pprof, print, flamescope, strings, stw},
+		Subcommands: []*ffcli.Command{anonymize, breakdown, compact, cut, deanonymize, diff, dump, filter, json, merge, pprof, print, flamescope, index, repair, strings, stw, validate},
 		Exec: func(_ context.Context, _ []string) error {
 			rootFlagSet.Usage()
 			return nil
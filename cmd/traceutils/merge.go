@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/felixge/traceutils/pkg/merge"
+)
+
+func MergeCommand(args []string, compress string) error {
+	// Check the number of arguments
+	if len(args) < 3 {
+		return fmt.Errorf("expected at least 3 arguments, got %d", len(args))
+	}
+	inPaths, outPath := args[:len(args)-1], args[len(args)-1]
+
+	// Determine the compression of the output file
+	compression, err := outputCompression(compress, outPath)
+	if err != nil {
+		return err
+	}
+
+	// Open the input files
+	var inputs []io.ReadSeeker
+	for _, path := range inPaths {
+		inFile, err := openInputFile(path)
+		if err != nil {
+			return err
+		}
+		defer inFile.Close()
+		inputs = append(inputs, inFile)
+	}
+
+	// Open the output file
+	outFile, err := createOutput(outPath, compression)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// Merge the traces
+	if err := merge.Merge(inputs, outFile); err != nil {
+		return err
+	}
+	return outFile.Close()
+}
@@ -2,31 +2,43 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/felixge/traceutils/pkg/pprof"
 )
 
-func PPROF(args []string, opt pprof.Options) error {
+func PPROF(args []string, opt pprof.Options, compress string) error {
 	// Check the number of arguments
 	if len(args) != 2 {
-		return fmt.Errorf("expected 1 argument, got %d", len(args))
+		return fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	// Determine the compression of the output file
+	compression, err := outputCompression(compress, args[1])
+	if err != nil {
+		return err
+	}
+	if compress == "" && compression == CompressionGzip {
+		// pprof profiles are gzip compressed already
+		compression = CompressionNone
 	}
 
 	// Open the input file
-	inFile, err := os.Open(args[0])
+	inFile, err := openInput(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return err
 	}
 	defer inFile.Close()
 
 	// Open the output file
-	outFile, err := os.Create(args[1])
+	outFile, err := createOutput(args[1], compression)
 	if err != nil {
-		return fmt.Errorf("failed to open output file: %w", err)
+		return err
 	}
 	defer outFile.Close()
 
 	// Convert trace to pprof
-	return pprof.Convert(inFile, outFile, opt)
+	if err := pprof.Convert(inFile, outFile, opt); err != nil {
+		return err
+	}
+	return outFile.Close()
 }
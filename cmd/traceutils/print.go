@@ -8,22 +8,36 @@ import (
 	"github.com/felixge/traceutils/pkg/print"
 )
 
-func PrintEvents(args []string, filter print.EventFilter) error {
+func PrintEvents(args []string, filter print.EventFilter, useIndex bool) error {
 	// Check the number of arguments
 	if len(args) != 1 {
 		return fmt.Errorf("expected 1 argument, got %d", len(args))
 	}
 
+	// Print the events of the batches matching the filter to stdout
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	if useIndex {
+		inFile, err := openInputFile(args[0])
+		if err != nil {
+			return err
+		}
+		defer inFile.Close()
+		idx, err := readIndex(args[0], inFile.Size)
+		if err != nil {
+			return err
+		}
+		return print.IndexedEvents(inFile, idx, stdout, filter)
+	}
+
 	// Open the input file
-	inFile, err := os.Open(args[0])
+	inFile, err := openInput(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return err
 	}
 	defer inFile.Close()
 
 	// Print all events to stdout
-	stdout := bufio.NewWriter(os.Stdout)
-	defer stdout.Flush()
 	return print.Events(inFile, stdout, filter)
 }
 
@@ -34,9 +48,9 @@ func PrintStacks(args []string, filter print.StackFilter) error {
 	}
 
 	// Open the input file
-	inFile, err := os.Open(args[0])
+	inFile, err := openInput(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return err
 	}
 	defer inFile.Close()
 
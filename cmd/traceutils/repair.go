@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/felixge/traceutils/pkg/repair"
+	"github.com/olekukonko/tablewriter"
+)
+
+func RepairCommand(args []string, opts repair.Options, compress string) error {
+	// Check the number of arguments
+	if len(args) != 2 {
+		return fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	// Determine the compression of the output file
+	compression, err := outputCompression(compress, args[1])
+	if err != nil {
+		return err
+	}
+
+	// Open the input file
+	inFile, err := openInputFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	// Open the output file
+	outFile, err := createOutput(args[1], compression)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// Repair the trace
+	report, err := repair.Repair(inFile, inFile.Size, outFile, opts)
+	if err != nil {
+		return err
+	}
+	if err := outFile.Close(); err != nil {
+		return err
+	}
+
+	// Report the discarded parts of the input and the other changes
+	w := reportOutput(args[1])
+	if len(report.Discarded) > 0 {
+		var rows [][]string
+		var total int64
+		for _, d := range report.Discarded {
+			rows = append(rows, []string{fmt.Sprintf("%d", d.Offset), humanBytes(d.Size), d.Reason})
+			total += d.Size
+		}
+		table := tablewriter.NewWriter(w)
+		table.SetAutoWrapText(false)
+		table.SetHeader([]string{"Offset", "Bytes", "Reason"})
+		table.AppendBulk(rows)
+		table.Render()
+		fmt.Fprintf(w, "Discarded %s of %s (%.2f%%)\n", humanBytes(total), humanBytes(inFile.Size), float64(total)/float64(inFile.Size)*100)
+	}
+	if report.Frequency != 0 {
+		fmt.Fprintf(w, "Added missing frequency event with %d ticks per second, durations are off if the actual frequency differs\n", report.Frequency)
+	}
+	if report.Refs != 0 {
+		fmt.Fprintf(w, "Replaced %d references to missing strings and stacks\n", report.Refs)
+	}
+	if len(report.Discarded) == 0 && report.Frequency == 0 && report.Refs == 0 {
+		fmt.Fprintf(w, "Nothing to repair\n")
+	}
+	return nil
+}
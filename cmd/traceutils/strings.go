@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
 
 	"github.com/felixge/traceutils/pkg/encoding"
 )
@@ -15,15 +18,47 @@ func StringsCommand(args []string) error {
 	}
 
 	// Open the input file
-	inFile, err := os.Open(args[0])
+	inFile, err := openInputFile(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return err
 	}
 	defer inFile.Close()
 
-	dec := encoding.NewDecoder(inFile)
+	stdout := bufio.NewWriter(os.Stdout)
+	defer stdout.Flush()
+	printString := func(str []byte) error {
+		stdout.Write(str)
+		return stdout.WriteByte('\n')
+	}
+
+	// Print the strings as they are decoded if there is only one CPU,
+	// splitting the trace into frames only pays off if they can be decoded
+	// in parallel.
+	if runtime.GOMAXPROCS(0) == 1 {
+		return decodeStrings(encoding.NewDecoder(inFile), printString)
+	}
+
+	// Collect the strings of each batch in parallel and print them in order
+	return encoding.DecodeParallel(inFile, inFile.Size, 0, func(dec *encoding.Decoder, _ bool) ([][]byte, error) {
+		var strs [][]byte
+		err := decodeStrings(dec, func(str []byte) error {
+			strs = append(strs, bytes.Clone(str))
+			return nil
+		})
+		return strs, err
+	}, func(strs [][]byte) error {
+		for _, str := range strs {
+			if err := printString(str); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	// Obfuscate all string events
+// decodeStrings calls fn for the string of every event decoded by dec. The
+// string is only valid until fn returns.
+func decodeStrings(dec *encoding.Decoder, fn func(str []byte) error) error {
 	var ev encoding.Event
 	for {
 		// Decode event
@@ -34,9 +69,16 @@ func StringsCommand(args []string) error {
 			return err
 		}
 
-		// Print the string
+		// Skip the opaque data of experimental batches
+		if ev.Type == encoding.EventV2ExperimentalBatch {
+			continue
+		}
+
+		// Collect the string
 		if len(ev.Str) > 0 {
-			fmt.Println(string(ev.Str))
+			if err := fn(ev.Str); err != nil {
+				return err
+			}
 		}
 	}
 }
@@ -24,9 +24,9 @@ func STWCommand(flavor STWFlavor, args []string) error {
 	}
 
 	// Open the input file
-	inFile, err := os.Open(args[0])
+	inFile, err := openInput(args[0])
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return err
 	}
 	defer inFile.Close()
 
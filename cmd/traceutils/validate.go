@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/felixge/traceutils/pkg/validate"
+)
+
+func ValidateCommand(args []string) error {
+	// Check the number of arguments
+	if len(args) != 1 {
+		return fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	// Open the input file
+	inFile, err := openInputFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	// Validate the trace and print its problems
+	problems, err := validate.Validate(inFile, inFile.Size)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	return nil
+}
@@ -5,11 +5,11 @@ go 1.24.9
 require (
 	github.com/gkampitakis/go-snaps v0.4.2
 	github.com/google/pprof v0.0.0-20230926050212-f7f687d19a98
+	github.com/klauspost/compress v1.18.0
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/peterbourgon/ff/v3 v3.3.0
 	github.com/stretchr/testify v1.8.1
 	golang.org/x/exp v0.0.0-20251023183803-a4bb9ffd2546
-	golang.org/x/tools v0.38.0
 	honnef.co/go/gotraceui v0.3.0
 )
 
@@ -26,7 +26,5 @@ require (
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.0 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
-	golang.org/x/mod v0.29.0 // indirect
-	golang.org/x/sync v0.17.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
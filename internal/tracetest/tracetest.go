@@ -0,0 +1,28 @@
+// Package tracetest contains helpers for the tests of go 1.22+ traces.
+package tracetest
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	exptrace "golang.org/x/exp/trace"
+)
+
+// ReadEvents parses a go 1.22+ trace with x/exp/trace and returns its events.
+// It fails the test if the trace can't be parsed.
+func ReadEvents(t testing.TB, data []byte) []exptrace.Event {
+	t.Helper()
+	r, err := exptrace.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	var events []exptrace.Event
+	for {
+		ev, err := r.ReadEvent()
+		if err == io.EOF {
+			return events
+		}
+		require.NoError(t, err)
+		events = append(events, ev)
+	}
+}
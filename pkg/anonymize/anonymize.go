@@ -1,15 +1,13 @@
 package anonymize
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/rand"
 	"io"
-	"os"
-	"path/filepath"
-	"runtime"
+	"path"
+	"slices"
 
 	"github.com/felixge/traceutils/pkg/encoding"
-	"golang.org/x/tools/go/packages"
 )
 
 // replacement returns a string that is used to obfuscate file paths and
@@ -17,39 +15,152 @@ import (
 // slice won't be overwritten by the caller.
 var replacement = func() []byte { return []byte("XXX") }
 
-// AnonymizeTrace reads a runtime/trace file from r and writes an obfuscated
-// version of it to w. The obfuscation is done by replacing all references to
-// file paths and packages not found Go's standard library with obfuscated
-// versions. The obfuscation is done by replacing all letters that need
-// obfuscation with "XXX". Additionally it keeps any ".go" suffixes and special
-// GC strings intact. For file paths ending in a stdlib package name, only the
-// prefix of the path is obfuscated. On success AnonymizeTrace returns nil. If
-// an error occurs, AnonymizeTrace returns the
-// error.
+// Options configures Anonymize.
+type Options struct {
+	// Policy decides which functions and files are kept. Only the go stdlib
+	// is kept if it's nil.
+	Policy *Policy
+	// Pseudonymize replaces the names that aren't kept with pseudonyms
+	// instead of "XXX", e.g. "pkg1d0c5e2a.func52e9d1a7" for a function. The
+	// pseudonyms keep the package of functions and files, so the anonymized
+	// trace still has its structure.
+	Pseudonymize bool
+	// Key is the secret the pseudonyms are derived from. The same key results
+	// in the same pseudonyms for every trace. A random key is used if it's
+	// empty.
+	Key []byte
+	// Mapping receives the mapping from the anonymized strings to the
+	// original ones if it's not nil, see Mapping. It can only restore the
+	// strings that aren't ambiguous, so it's most useful with Pseudonymize.
+	Mapping io.Writer
+	// MappingKey encrypts the mapping if it's not empty.
+	MappingKey []byte
+}
+
+// AnonymizeTrace anonymizes the trace read from r and writes it to w using
+// the default options, see Anonymize.
 func AnonymizeTrace(r io.Reader, w io.Writer) error {
-	// Initialize encoder and decoder
-	buf := bufio.NewWriter(w)
-	enc := encoding.NewEncoder(buf)
+	return Anonymize(r, w, Options{})
+}
+
+// Anonymize reads a runtime/trace file from r and writes an obfuscated
+// version of it to w. The obfuscation is done by replacing all references to
+// file paths and packages not found Go's standard library or kept by
+// opts.Policy with obfuscated versions. The obfuscation is done by replacing
+// all letters that need obfuscation with "XXX". Additionally it keeps any
+// ".go" suffixes and special GC strings intact. For file paths ending in a
+// kept package, only the prefix of the path is obfuscated. The standard
+// library is the embedded one of the Go version that wrote the trace, so the
+// output doesn't depend on the local Go installation. On success Anonymize
+// returns nil. If an error occurs, Anonymize returns the error.
+func Anonymize(r io.Reader, w io.Writer, opts Options) error {
+	a, err := newAnonymizer(opts)
+	if err != nil {
+		return err
+	}
+
+	// Obfuscate all strings
+	err = rewriteStrings(r, w, func(version int, s []byte) []byte {
+		if a.stdlib == nil {
+			a.stdlib = stdlibFor(version)
+		}
+		original := string(s)
+		s = a.anonymizeString(s)
+		if opts.Mapping != nil {
+			a.record(string(s), original)
+		}
+		return s
+	})
+	if err != nil {
+		return err
+	} else if opts.Mapping != nil {
+		return a.mapping().Write(opts.Mapping, opts.MappingKey)
+	}
+	return nil
+}
+
+// rewriteStrings copies the trace read from r to w and replaces the strings
+// of its events with the result of fn, which also gets the version of the
+// trace. The output has the same version as the input. The lengths of go
+// 1.22+ batches are updated to match the new strings, and experimental
+// batches are dropped because their data is opaque and may contain names,
+// e.g. the types of the allocation experiment.
+func rewriteStrings(r io.Reader, w io.Writer, fn func(version int, s []byte) []byte) error {
 	dec := encoding.NewDecoder(r)
+	enc := encoding.NewEncoderFor(w, dec)
+
+	// The header and events of the current go 1.22+ batch
+	var (
+		header *encoding.Event
+		events []encoding.Event
+	)
+	flush := func() error {
+		if header == nil {
+			return nil
+		}
+		var length int
+		for i := range events {
+			length += encoding.EncodedSize(dec.Version(), &events[i])
+		}
+		header.Args[3] = uint64(length)
+		if err := enc.Encode(header); err != nil {
+			return err
+		}
+		for i := range events {
+			if err := enc.Encode(&events[i]); err != nil {
+				return err
+			}
+		}
+		header, events = nil, events[:0]
+		return nil
+	}
 
-	// Obfuscate all string events
 	var ev encoding.Event
 	for {
 		// Decode event
-		if err := dec.Decode(&ev); err != nil {
-			if err == io.EOF {
-				// We're done
-				return buf.Flush()
+		if err := dec.Decode(&ev); err == io.EOF {
+			// We're done
+			if err := flush(); err != nil {
+				return err
 			}
+			return enc.Close()
+		} else if err != nil {
 			return err
 		}
 
-		// Obfuscate string
-		ev.Str = anonymizeString(ev.Str)
+		// Rewrite string
+		if len(ev.Str) > 0 && ev.Type != encoding.EventV2ExperimentalBatch {
+			ev.Str = fn(dec.Version(), ev.Str)
+		}
 
-		// Encode the obfuscated event
-		if err := enc.Encode(&ev); err != nil {
-			return err
+		// Encode the event of an old trace right away, new ones once the
+		// length of their batch is known
+		if dec.Version() < 1022 {
+			if err := enc.Encode(&ev); err != nil {
+				return err
+			}
+			continue
+		}
+		cp := encoding.Event{Type: ev.Type, Args: slices.Clone(ev.Args), Str: slices.Clone(ev.Str)}
+		switch ev.Type {
+		case encoding.EventV2Batch:
+			if err := flush(); err != nil {
+				return err
+			}
+			header = &cp
+		case encoding.EventV2ExperimentalBatch:
+			if err := flush(); err != nil {
+				return err
+			}
+		case encoding.EventV2EndOfGeneration:
+			// The end of a generation isn't part of a batch
+			if err := flush(); err != nil {
+				return err
+			} else if err := enc.Encode(&cp); err != nil {
+				return err
+			}
+		default:
+			events = append(events, cp)
 		}
 	}
 }
@@ -64,49 +175,198 @@ var gcMarkWorkerModeStrings = map[string]bool{
 	"GC (idle)":       true,
 }
 
-// anonymizeString obfuscates the given string and returns the obfuscated
-// version.
-func anonymizeString(s []byte) []byte {
+// runtimeStrings are the reasons for blocking and stopping goroutines and
+// stopping the world that go 1.22+ traces store in their string table. They
+// are copied from runtime/traceruntime.go and runtime/proc.go in the Go
+// source tree.
+var runtimeStrings = map[string]bool{
+	"unspecified":                  true,
+	"forever":                      true,
+	"network":                      true,
+	"select":                       true,
+	"sync":                         true,
+	"chan send":                    true,
+	"chan receive":                 true,
+	"GC mark assist wait for work": true,
+	"GC background sweeper wait":   true,
+	"system goroutine wait":        true,
+	"preempted":                    true,
+	"wait for debug call":          true,
+	"wait until GC ends":           true,
+	"sleep":                        true,
+	"GC weak to strong wait":       true,
+	"synctest":                     true,
+	"unknown":                      true,
+	"GC mark termination":          true,
+	"GC sweep termination":         true,
+	"write heap dump":              true,
+	"goroutine profile":            true,
+	"goroutine profile cleanup":    true,
+	"all goroutines stack trace":   true,
+	"read mem stats":               true,
+	"AllThreadsSyscall":            true,
+	"GOMAXPROCS":                   true,
+	"start trace":                  true,
+	"stop trace":                   true,
+	"CountPagesInUse (test)":       true,
+	"ReadMetricsSlow (test)":       true,
+	"ReadMemStatsSlow (test)":      true,
+	"PageCachePagesLeaked (test)":  true,
+	"ResetDebugLog (test)":         true,
+}
+
+// anonymizer anonymizes the strings of a trace.
+type anonymizer struct {
+	policy *Policy
+	// stdlib is the standard library of the Go version of the trace.
+	stdlib *stdlib
+	// pseudonyms is nil unless names are replaced by pseudonyms.
+	pseudonyms *pseudonyms
+	// originals maps the anonymized strings to the original ones, or to
+	// ambiguous if more than one string was anonymized the same way.
+	originals map[string]*string
+}
+
+// ambiguous marks anonymized strings in anonymizer.originals that can't be
+// mapped back to their original.
+var ambiguous = new(string)
+
+// newAnonymizer returns an anonymizer for opts.
+func newAnonymizer(opts Options) (*anonymizer, error) {
+	a := &anonymizer{policy: opts.Policy}
+	if a.policy == nil {
+		a.policy = &Policy{}
+	}
+	if opts.Pseudonymize {
+		key := opts.Key
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, err
+			}
+		}
+		a.pseudonyms = newPseudonyms(key)
+	}
+	return a, nil
+}
+
+// record remembers that original was anonymized as anonymized.
+func (a *anonymizer) record(anonymized, original string) {
+	if anonymized == original {
+		return
+	}
+	if a.originals == nil {
+		a.originals = map[string]*string{}
+	}
+	if prev, ok := a.originals[anonymized]; !ok {
+		a.originals[anonymized] = &original
+	} else if *prev != original {
+		a.originals[anonymized] = ambiguous
+	}
+}
+
+// mapping returns the mapping of the recorded strings and the tokens of the
+// pseudonyms.
+func (a *anonymizer) mapping() Mapping {
+	m := Mapping{}
+	if a.pseudonyms != nil {
+		a.pseudonyms.addTo(m)
+	}
+	for anonymized, original := range a.originals {
+		if original != ambiguous {
+			m[anonymized] = *original
+		}
+	}
+	return m
+}
+
+// anonymizeString obfuscates the given string unless the policy keeps it and
+// returns the obfuscated version.
+func (a *anonymizer) anonymizeString(s []byte) []byte {
 	if len(s) == 0 {
 		return s
 	}
 
-	// Don't obfuscate the gcMarkWorkerModeStrings found in every trace
-	if _, ok := gcMarkWorkerModeStrings[string(s)]; ok {
+	// Don't obfuscate the gcMarkWorkerModeStrings found in every trace and
+	// the runtimeStrings of go 1.22+ traces
+	if gcMarkWorkerModeStrings[string(s)] || runtimeStrings[string(s)] {
 		return s
 	}
 
 	if s[0] != '/' {
 		// s is probably a pkg.func
-		return anonymizeFunc(s)
+		return a.anonymizeFunc(s)
 	}
 	// s is probably a file path
-	return anonymizePath(s)
+	return a.anonymizePath(s)
 }
 
-func anonymizeFunc(s []byte) []byte {
-	// s is probably a pkg.func
-	pkg, _, found := bytes.Cut(s, []byte("."))
-	if !found {
-		return replacement()
-	}
-	for _, stdlibPkg := range stdlibPkgs {
-		if bytes.Equal(pkg, []byte(stdlibPkg)) {
-			return s
-		}
+func (a *anonymizer) anonymizeFunc(s []byte) []byte {
+	if a.policy.keepFunc(a.stdlib, string(s)) {
+		return s
+	} else if a.pseudonyms != nil {
+		return []byte(a.pseudonyms.function(string(s)))
 	}
 	return replacement()
 }
 
-func anonymizePath(s []byte) []byte {
+// anonymizePath obfuscates the part of a file path before the directory of
+// its package if the package is kept, e.g. the GOROOT of stdlib files and the
+// GOMODCACHE of dependencies.
+func (a *anonymizer) anonymizePath(s []byte) []byte {
+	p := a.policy
+	file := string(s)
+	if p.scrubFile(file) {
+		return a.scrubPath(s, "")
+	} else if p.keepFile(file) {
+		return s
+	}
+
+	// Directories don't belong to a package
+	if bytes.HasSuffix(s, []byte("/")) {
+		return a.scrubPath(s, "")
+	}
+
+	// Files of dependencies in the module cache or a vendor directory
+	for _, sep := range []string{"/pkg/mod/", "/vendor/"} {
+		head, tail := bytesLastSplit(s, []byte(sep))
+		if head == nil || tail == nil {
+			continue
+		}
+		pkg := path.Dir(string(tail))
+		if sep == "/pkg/mod/" {
+			pkg = modulePackage(string(tail))
+		}
+		if pkg != "" && p.keepPackage(a.stdlib, pkg) {
+			return append(append(replacement(), sep...), tail...)
+		} else if pkg != "" && a.pseudonyms != nil {
+			return a.scrubPath(s, pkg)
+		}
+	}
+
+	// Files in GOROOT or GOPATH
 	var srcSep = []byte("/src/")
 	head, tail := bytesLastSplit(s, srcSep)
 	if head == nil || tail == nil {
+		if a.pseudonyms != nil {
+			return a.scrubPath(s, "")
+		}
 		return replacement()
 	}
-	if pathInStdLib(string(tail)) {
+	pkg := path.Dir(string(tail))
+	if (a.stdlib.hasFile(string(tail)) && !matchPath(p.Scrub, pkg)) || p.keepPackage(a.stdlib, pkg) {
 		return append(append(replacement(), srcSep...), tail...)
 	}
+	return a.scrubPath(s, pkg)
+}
+
+// scrubPath obfuscates the complete path, but keeps its ".go" suffix. The
+// pseudonym of the path uses the one of pkg as its directory if pkg isn't
+// empty.
+func (a *anonymizer) scrubPath(s []byte, pkg string) []byte {
+	if a.pseudonyms != nil {
+		return []byte(a.pseudonyms.file(string(s), pkg))
+	}
 	if bytes.HasSuffix(s, []byte(".go")) {
 		return append(replacement(), []byte(".go")...)
 	}
@@ -122,24 +382,3 @@ func bytesLastSplit(s, sep []byte) (head, tail []byte) {
 	}
 	return nil, s
 }
-
-var stdlibPkgs = func() [][]byte {
-	// Determine stdlib packages
-	pkgs, err := packages.Load(nil, "std")
-	if err != nil {
-		panic(err)
-	}
-	var stdlibPkgs [][]byte
-	for _, pkg := range pkgs {
-		stdlibPkgs = append(stdlibPkgs, []byte(pkg.PkgPath))
-	}
-	return stdlibPkgs
-}()
-
-// pathInStdLib returns true if the given path is in Go's standard
-// library.
-func pathInStdLib(path string) bool {
-	srcPath := filepath.Join(runtime.GOROOT(), "src", path)
-	stat, err := os.Stat(srcPath)
-	return err == nil && !stat.IsDir()
-}
@@ -2,11 +2,16 @@ package anonymize
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/felixge/traceutils/internal/tracetest"
 	"github.com/felixge/traceutils/pkg/encoding"
 	"github.com/stretchr/testify/require"
 )
@@ -67,6 +72,115 @@ func TestAnonymizeTrace(t *testing.T) {
 	// it in the testdata directory and then use this trace here.
 }
 
+// TestAnonymizeTraceVersion tests that the anonymized trace has the same
+// version as the input trace.
+func TestAnonymizeTraceVersion(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+		Version   int
+	}{
+		{"1.11", "simple.trace", 1011},
+		{"1.19", "trace.bin", 1019},
+		{"1.21", "task.trace", 1021},
+		{"1.25", "test-encoding-json.trace", 1025},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion, func(t *testing.T) {
+			// Read the test trace.
+			inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+
+			// Anonymize the trace and write it to outTrace.
+			var outTrace bytes.Buffer
+			require.NoError(t, AnonymizeTrace(bytes.NewReader(inTrace), &outTrace))
+
+			// Decode the first event to read the header of the anonymized
+			// trace.
+			dec := encoding.NewDecoder(bytes.NewReader(outTrace.Bytes()))
+			require.NoError(t, dec.Decode(&encoding.Event{}))
+			require.Equal(t, test.Version, dec.Version())
+		})
+	}
+}
+
+// TestAnonymizeTraceV2 tests that only stdlib names and runtime strings
+// remain in an anonymized go 1.22+ trace, and that x/exp/trace can parse it.
+func TestAnonymizeTraceV2(t *testing.T) {
+	inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.25", "test-encoding-json.trace"))
+	require.NoError(t, err)
+
+	var outTrace bytes.Buffer
+	require.NoError(t, AnonymizeTrace(bytes.NewReader(inTrace), &outTrace))
+
+	tracetest.ReadEvents(t, outTrace.Bytes())
+
+	// Only the strings change
+	want, wantStrings := decodeV2(t, inTrace)
+	got, gotStrings := decodeV2(t, outTrace.Bytes())
+	require.Equal(t, want, got)
+	require.Len(t, gotStrings, len(wantStrings))
+
+	var scrubbed int
+	for _, s := range gotStrings {
+		switch {
+		case s == "" || gcMarkWorkerModeStrings[s] || runtimeStrings[s]:
+		case s == "XXX" || s == "XXX.go":
+			scrubbed++
+		case strings.HasPrefix(s, "XXX/src/"):
+			require.True(t, stdlibFor(1025).hasPackage(path.Dir(strings.TrimPrefix(s, "XXX/src/"))), s)
+		default:
+			require.True(t, stdlibFor(1025).hasPackage(funcPackage(s)), s)
+		}
+	}
+	require.NotZero(t, scrubbed)
+}
+
+// decodeV2 decodes a go 1.22+ trace and returns its events without the
+// strings and batch lengths, as well as the strings.
+func decodeV2(t *testing.T, data []byte) ([]string, []string) {
+	var events, strs []string
+	dec := encoding.NewDecoder(bytes.NewReader(data))
+	for {
+		var ev encoding.Event
+		if err := dec.Decode(&ev); err == io.EOF {
+			return events, strs
+		} else {
+			require.NoError(t, err)
+		}
+		switch ev.Type {
+		case encoding.EventV2String:
+			strs = append(strs, string(ev.Str))
+			ev.Str = nil
+		case encoding.EventV2Batch:
+			ev.Args[3] = 0
+		}
+		events = append(events, fmt.Sprint(ev.Type, ev.Args, ev.Str))
+	}
+}
+
+// TestAnonymizeTraceV2Experimental tests that experimental batches are
+// dropped from a go 1.26 trace, and that x/exp/trace can parse the result.
+func TestAnonymizeTraceV2Experimental(t *testing.T) {
+	inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.26", "experimental.trace"))
+	require.NoError(t, err)
+	require.Contains(t, string(inTrace), "main.secretType")
+
+	var outTrace bytes.Buffer
+	require.NoError(t, AnonymizeTrace(bytes.NewReader(inTrace), &outTrace))
+	require.NotContains(t, outTrace.String(), "main.secretType")
+	tracetest.ReadEvents(t, outTrace.Bytes())
+
+	// Apart from the strings, the trace is the one that the experimental
+	// batches were added to.
+	original, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.26", "generations.trace"))
+	require.NoError(t, err)
+	want, _ := decodeV2(t, original)
+	got, _ := decodeV2(t, outTrace.Bytes())
+	require.Equal(t, want, got)
+}
+
 // Test_anonymizeString tests the anonymizeString function.
 func Test_anonymizeString(t *testing.T) {
 	tests := []struct {
@@ -130,7 +244,7 @@ func Test_anonymizeString(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := string(anonymizeString(tt.s))
+			got := string((&anonymizer{policy: &Policy{}, stdlib: stdlibFor(1025)}).anonymizeString(tt.s))
 			if got != tt.want {
 				t.Errorf("got=%q want=%q", got, tt.want)
 			}
@@ -164,10 +278,200 @@ func Test_stdlibPaths(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.Path, func(t *testing.T) {
-			got := pathInStdLib(tt.Path)
+			got := stdlibFor(1025).hasFile(tt.Path)
 			if got != tt.Want {
 				t.Errorf("got=%v want=%v", got, tt.Want)
 			}
 		})
 	}
 }
+
+// Test_stdlibFor tests that the standard library of a trace covers the
+// embedded ones of all releases that write its version, and that other
+// traces get the newest embedded one that isn't newer than the trace.
+func Test_stdlibFor(t *testing.T) {
+	libs := stdlibs()
+	require.NotEmpty(t, libs)
+	for i, lib := range libs {
+		require.True(t, lib.hasPackage("runtime"), "go1.%d", lib.version-1000)
+		require.True(t, lib.hasFile("runtime/proc.go"), "go1.%d", lib.version-1000)
+		require.False(t, lib.hasPackage("cmd/go"), "go1.%d", lib.version-1000)
+		if i > 0 {
+			require.Less(t, libs[i-1].version, lib.version)
+		}
+	}
+	for version, releases := range traceReleases {
+		lib := stdlibFor(version)
+		for _, l := range libs {
+			if l.version < releases[0] || l.version > releases[1] {
+				continue
+			}
+			for pkg := range l.pkgs {
+				require.True(t, lib.hasPackage(pkg), "%s of go1.%d in %d traces", pkg, l.version-1000, version)
+			}
+		}
+	}
+	require.Same(t, libs[0], stdlibFor(1005))
+	require.Same(t, libs[0], stdlibFor(1011))
+	require.Same(t, libs[len(libs)-1], stdlibFor(1999))
+}
+
+// Test_stdlibForSharedVersions tests that the packages of the standard
+// library of the newer release that writes a trace version are kept.
+func Test_stdlibForSharedVersions(t *testing.T) {
+	tests := []struct {
+		Version int
+		S       string
+		Want    string
+	}{
+		{1023, "crypto/mlkem.GenerateKey768", "crypto/mlkem.GenerateKey768"},
+		{1023, "weak.Make[...]", "weak.Make[...]"},
+		{1023, "/usr/local/go/src/crypto/mlkem/mlkem.go", "XXX/src/crypto/mlkem/mlkem.go"},
+		{1022, "crypto/mlkem.GenerateKey768", "XXX"},
+		{1026, "crypto/mldsa.GenerateKey", "crypto/mldsa.GenerateKey"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/%s", tt.Version, tt.S), func(t *testing.T) {
+			got := string((&anonymizer{policy: &Policy{}, stdlib: stdlibFor(tt.Version)}).anonymizeString([]byte(tt.S)))
+			require.Equal(t, tt.Want, got)
+		})
+	}
+}
+
+// Test_stdlibForRemovedPackages tests that the packages of the standard
+// library that were removed in later releases are kept for the traces of the
+// releases that have them.
+func Test_stdlibForRemovedPackages(t *testing.T) {
+	tests := []struct {
+		Version int
+		S       string
+		Want    string
+	}{
+		{1021, "go/internal/typeparams.PackIndexExpr", "go/internal/typeparams.PackIndexExpr"},
+		{1021, "/usr/local/go/src/go/internal/typeparams/typeparams.go", "XXX/src/go/internal/typeparams/typeparams.go"},
+		{1026, "go/internal/typeparams.PackIndexExpr", "XXX"},
+		{1026, "/usr/local/go/src/go/internal/typeparams/typeparams.go", "XXX.go"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/%s", tt.Version, tt.S), func(t *testing.T) {
+			got := string((&anonymizer{policy: &Policy{}, stdlib: stdlibFor(tt.Version)}).anonymizeString([]byte(tt.S)))
+			require.Equal(t, tt.Want, got)
+		})
+	}
+}
+
+// TestAnonymizePolicy tests that a policy keeps the functions and files of
+// third-party modules while the first-party ones are still anonymized.
+func TestAnonymizePolicy(t *testing.T) {
+	inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "staticcheck.trace"))
+	require.NoError(t, err)
+
+	var outTrace bytes.Buffer
+	opts := Options{Policy: &Policy{Keep: []string{"golang.org/x/tools"}}}
+	require.NoError(t, Anonymize(bytes.NewReader(inTrace), &outTrace, opts))
+
+	gotWantedStrings := map[string]bool{
+		"golang.org/x/tools/go/types/typeutil.(*MethodSetCache).lookupNamed":                                      false,
+		"XXX/pkg/mod/golang.org/x/tools@v0.4.1-0.20221208213631-3f74d914ae6d/go/types/typeutil/methodsetcache.go": false,
+		"XXX/src/runtime/proc.go": false,
+	}
+	dec := encoding.NewDecoder(bytes.NewReader(outTrace.Bytes()))
+	for {
+		var ev encoding.Event
+		if err := dec.Decode(&ev); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+		require.NotContains(t, string(ev.Str), "honnef.co")
+		require.NotContains(t, string(ev.Str), "dominikh")
+		if _, ok := gotWantedStrings[string(ev.Str)]; ok {
+			gotWantedStrings[string(ev.Str)] = true
+		}
+	}
+	for k, v := range gotWantedStrings {
+		require.True(t, v, "did not get string %q", k)
+	}
+}
+
+// Test_anonymizeStringPolicy tests the anonymizeString function with a policy.
+func Test_anonymizeStringPolicy(t *testing.T) {
+	policy := &Policy{
+		Keep:       []string{"github.com/BurntSushi/toml", "github.com/acme/oss", "gopkg.in/yaml.v3"},
+		Scrub:      []string{"github.com/acme/oss/internal", "net/http"},
+		KeepFuncs:  []*regexp.Regexp{regexp.MustCompile(`^main\.`)},
+		ScrubFuncs: []*regexp.Regexp{regexp.MustCompile(`\.secret`)},
+		KeepFiles:  []*regexp.Regexp{regexp.MustCompile(`^/public/`)},
+		ScrubFiles: []*regexp.Regexp{regexp.MustCompile(`/testdata/`)},
+	}
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"func: stdlib", "encoding/json.Marshal", "encoding/json.Marshal"},
+		{"func: scrubbed stdlib", "net/http.(*Server).Serve", "XXX"},
+		{"func: kept module", "github.com/BurntSushi/toml.Decode", "github.com/BurntSushi/toml.Decode"},
+		{"func: kept package with a dot", "gopkg.in/yaml.v3.Unmarshal", "gopkg.in/yaml.v3.Unmarshal"},
+		{"func: kept method of package with a dot", "gopkg.in/yaml.v3.(*decoder).unmarshal", "gopkg.in/yaml.v3.(*decoder).unmarshal"},
+		{"func: kept subpackage", "github.com/acme/oss/log.(*Logger).Print", "github.com/acme/oss/log.(*Logger).Print"},
+		{"func: scrubbed subpackage", "github.com/acme/oss/internal/db.Open", "XXX"},
+		{"func: prefix isn't a path", "github.com/acme/ossfork.Open", "XXX"},
+		{"func: generic", "github.com/acme/app.Map[go.shape.int,github.com/acme/oss.T]", "XXX"},
+		{"func: kept generic", "github.com/acme/oss.Map[go.shape.int,github.com/acme/app.T]", "github.com/acme/oss.Map[go.shape.int,github.com/acme/app.T]"},
+		{"func: kept regexp", "main.main", "main.main"},
+		{"func: scrubbed regexp", "github.com/acme/oss.secretKey", "XXX"},
+		{"func: first-party", "github.com/acme/app.Run", "XXX"},
+		{"path: module cache", "/home/bob/go/pkg/mod/github.com/!burnt!sushi/toml@v1.2.0/internal/tz.go", "XXX/pkg/mod/github.com/!burnt!sushi/toml@v1.2.0/internal/tz.go"},
+		{"path: module cache package with a dot", "/home/bob/go/pkg/mod/gopkg.in/yaml.v3@v3.0.1/decode.go", "XXX/pkg/mod/gopkg.in/yaml.v3@v3.0.1/decode.go"},
+		{"path: module cache first-party", "/home/bob/go/pkg/mod/github.com/acme/app@v1.0.0/main.go", "XXX"},
+		{"path: module cache scrubbed", "/home/bob/go/pkg/mod/github.com/acme/oss@v1.0.0/internal/x.go", "XXX"},
+		{"path: vendor", "/home/bob/app/vendor/github.com/acme/oss/log/log.go", "XXX/vendor/github.com/acme/oss/log/log.go"},
+		{"path: gopath", "/home/bob/go/src/github.com/acme/oss/log.go", "XXX/src/github.com/acme/oss/log.go"},
+		{"path: gopath first-party", "/home/bob/go/src/github.com/acme/app/main.go", "XXX.go"},
+		{"path: scrubbed stdlib", "/usr/local/go/src/net/http/server.go", "XXX.go"},
+		{"path: stdlib", "/usr/local/go/src/runtime/proc.go", "XXX/src/runtime/proc.go"},
+		{"path: kept regexp", "/public/main.go", "/public/main.go"},
+		{"path: scrubbed regexp", "/home/bob/go/src/github.com/acme/oss/testdata/x.go", "XXX.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string((&anonymizer{policy: policy, stdlib: stdlibFor(1025)}).anonymizeString([]byte(tt.s)))
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestParsePolicy tests that policies are parsed and invalid ones rejected.
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader(`
+# Dependencies
+keep golang.org/x/tools
+keep   google.golang.org/grpc
+scrub google.golang.org/grpc/internal
+
+keep-func ^main\.
+scrub-func secret
+keep-file ^/public/
+scrub-file /testdata/
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"golang.org/x/tools", "google.golang.org/grpc"}, policy.Keep)
+	require.Equal(t, []string{"google.golang.org/grpc/internal"}, policy.Scrub)
+	require.Equal(t, `^main\.`, policy.KeepFuncs[0].String())
+	require.Equal(t, "secret", policy.ScrubFuncs[0].String())
+	require.Equal(t, "^/public/", policy.KeepFiles[0].String())
+	require.Equal(t, "/testdata/", policy.ScrubFiles[0].String())
+
+	errTests := []struct {
+		policy string
+		err    string
+	}{
+		{"keep", `line 1: missing argument for "keep"`},
+		{"\nallow foo", `line 2: unknown directive "allow"`},
+		{"keep-func (", "line 1: error parsing regexp: missing closing ): `(`"},
+	}
+	for _, tt := range errTests {
+		_, err := ParsePolicy(strings.NewReader(tt.policy))
+		require.EqualError(t, err, tt.err)
+	}
+}
@@ -0,0 +1,67 @@
+package anonymize
+
+import (
+	"io"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// deanonymizer restores the original strings of a mapping.
+type deanonymizer struct {
+	m        Mapping
+	replacer *strings.Replacer
+}
+
+func newDeanonymizer(m Mapping) *deanonymizer {
+	return &deanonymizer{m: m, replacer: m.Replacer()}
+}
+
+// restore returns the original of the anonymized string s. Strings that aren't
+// in the mapping get the tokens of their pseudonyms replaced.
+func (d *deanonymizer) restore(s string) string {
+	if original, ok := d.m[s]; ok {
+		return original
+	}
+	return d.replacer.Replace(s)
+}
+
+// DeanonymizeTrace reads a trace anonymized by Anonymize from r and writes it
+// to w with the original strings restored by m.
+func DeanonymizeTrace(r io.Reader, w io.Writer, m Mapping) error {
+	d := newDeanonymizer(m)
+	return rewriteStrings(r, w, func(_ int, s []byte) []byte {
+		return []byte(d.restore(string(s)))
+	})
+}
+
+// DeanonymizeProfile restores the original function and file names as well as
+// the string labels of the pprof profile p, e.g. one created from an
+// anonymized trace by traceutils pprof.
+func DeanonymizeProfile(p *profile.Profile, m Mapping) {
+	d := newDeanonymizer(m)
+	for _, fn := range p.Function {
+		fn.Name = d.restore(fn.Name)
+		fn.SystemName = d.restore(fn.SystemName)
+		fn.Filename = d.restore(fn.Filename)
+	}
+	for _, s := range p.Sample {
+		for _, values := range s.Label {
+			for i, v := range values {
+				values[i] = d.restore(v)
+			}
+		}
+	}
+}
+
+// DeanonymizeText copies the text read from r to w with all anonymized
+// strings and tokens in it replaced by their originals, e.g. the output of
+// traceutils print for an anonymized trace.
+func DeanonymizeText(r io.Reader, w io.Writer, m Mapping) error {
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = m.Replacer().WriteString(w, string(text))
+	return err
+}
@@ -0,0 +1,137 @@
+package anonymize
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+// anonymizeWithMapping anonymizes a test trace and returns the original and
+// anonymized traces along with the mapping.
+func anonymizeWithMapping(t *testing.T, goVersion, name string, opts Options) ([]byte, []byte, Mapping) {
+	inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", goVersion, name))
+	require.NoError(t, err)
+
+	var outTrace, mapping bytes.Buffer
+	opts.Mapping = &mapping
+	require.NoError(t, Anonymize(bytes.NewReader(inTrace), &outTrace, opts))
+	m, err := ReadMapping(&mapping, opts.MappingKey)
+	require.NoError(t, err)
+	return inTrace, outTrace.Bytes(), m
+}
+
+// TestDeanonymizeTrace tests that a trace anonymized with pseudonyms can be
+// restored completely.
+func TestDeanonymizeTrace(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.19", "staticcheck.trace"},
+		{"1.25", "test-encoding-json.trace"},
+	}
+	for _, test := range tests {
+		t.Run(test.GoVersion, func(t *testing.T) {
+			inTrace, outTrace, m := anonymizeWithMapping(t, test.GoVersion, test.Trace, Options{Pseudonymize: true})
+			require.NotEqual(t, inTrace, outTrace)
+
+			var restored bytes.Buffer
+			require.NoError(t, DeanonymizeTrace(bytes.NewReader(outTrace), &restored, m))
+			require.Equal(t, inTrace, restored.Bytes())
+		})
+	}
+}
+
+// TestDeanonymizeTraceReplacement tests that the mapping of a trace anonymized
+// with "XXX" only restores the strings that aren't ambiguous.
+func TestDeanonymizeTraceReplacement(t *testing.T) {
+	_, _, m := anonymizeWithMapping(t, "1.19", "staticcheck.trace", Options{})
+	require.NotContains(t, m, "XXX")
+	require.NotContains(t, m, "XXX.go")
+	require.Equal(t, "/home/dominikh/prj/go/src/runtime/mgc.go", m["XXX/src/runtime/mgc.go"])
+}
+
+// TestMapping tests that mappings can be written and read, with and without
+// encryption.
+func TestMapping(t *testing.T) {
+	m := Mapping{"pkg1d0c5e2a": "github.com/acme/app", "XXX/src/runtime/proc.go": "/usr/local/go/src/runtime/proc.go"}
+
+	var plain bytes.Buffer
+	require.NoError(t, m.Write(&plain, nil))
+	require.Contains(t, plain.String(), "github.com/acme/app")
+	got, err := ReadMapping(&plain, nil)
+	require.NoError(t, err)
+	require.Equal(t, m, got)
+
+	var encrypted bytes.Buffer
+	require.NoError(t, m.Write(&encrypted, []byte("secret")))
+	require.NotContains(t, encrypted.String(), "github.com/acme/app")
+	data := encrypted.Bytes()
+
+	got, err = ReadMapping(bytes.NewReader(data), []byte("secret"))
+	require.NoError(t, err)
+	require.Equal(t, m, got)
+
+	_, err = ReadMapping(bytes.NewReader(data), nil)
+	require.EqualError(t, err, "mapping is encrypted, but no key was given")
+	_, err = ReadMapping(bytes.NewReader(data), []byte("wrong"))
+	require.ErrorContains(t, err, "failed to decrypt mapping")
+	_, err = ReadMapping(strings.NewReader("XXX"), nil)
+	require.ErrorContains(t, err, "invalid mapping")
+}
+
+// TestDeanonymizeProfile tests that the names in pprof profiles are restored.
+func TestDeanonymizeProfile(t *testing.T) {
+	_, outTrace, m := anonymizeWithMapping(t, "1.19", "staticcheck.trace", Options{Pseudonymize: true})
+	var original, pseudonym string
+	for k, v := range m {
+		if strings.HasPrefix(v, "honnef.co/go/tools/go/ir.(*builder).") {
+			original, pseudonym = v, k
+			break
+		}
+	}
+	require.NotEmpty(t, pseudonym)
+	require.NotContains(t, string(outTrace), original)
+
+	p := &profile.Profile{
+		Function: []*profile.Function{
+			{ID: 1, Name: pseudonym, SystemName: pseudonym},
+			{ID: 2, Name: "runtime.main", Filename: "XXX/src/runtime/proc.go"},
+		},
+		Sample: []*profile.Sample{
+			{Label: map[string][]string{"fn": {pseudonym}}},
+		},
+	}
+	DeanonymizeProfile(p, m)
+	require.Equal(t, original, p.Function[0].Name)
+	require.Equal(t, original, p.Function[0].SystemName)
+	require.Equal(t, "runtime.main", p.Function[1].Name)
+	require.Equal(t, "/home/dominikh/prj/go/src/runtime/proc.go", p.Function[1].Filename)
+	require.Equal(t, []string{original}, p.Sample[0].Label["fn"])
+}
+
+// TestDeanonymizeText tests that pseudonyms in text are restored, including
+// names that aren't in the trace, but consist of its tokens.
+func TestDeanonymizeText(t *testing.T) {
+	p := newPseudonyms([]byte("key"))
+	a := &anonymizer{policy: &Policy{}, stdlib: stdlibFor(1025), pseudonyms: p}
+	file := "/home/bob/go/src/github.com/acme/app/server.go"
+	for _, s := range []string{"github.com/acme/app.(*Server).Serve", file} {
+		a.record(string(a.anonymizeString([]byte(s))), s)
+	}
+	m := a.mapping()
+
+	text := p.function("github.com/acme/app.(*Server).Serve") + " is slow\n" +
+		p.function("github.com/acme/app.(*Server).Serve.func1") + "\n" +
+		p.file(file, "github.com/acme/app") + ":42\n"
+	var out bytes.Buffer
+	require.NoError(t, DeanonymizeText(strings.NewReader(text), &out, m))
+	require.Equal(t, "github.com/acme/app.(*Server).Serve is slow\n"+
+		"github.com/acme/app.(*Server).Serve.func1\n"+
+		file+":42\n", out.String())
+}
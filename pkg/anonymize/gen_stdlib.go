@@ -0,0 +1,89 @@
+//go:build ignore
+
+// gen_stdlib writes the list of the source files of Go's standard library to
+// stdlib/go1.N.txt.gz. By default it lists the GOROOT of the go command,
+// lists for other versions can be generated from their source trees:
+//
+//	go run gen_stdlib.go -goroot ~/sdk/go1.22.12
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	goroot := flag.String("goroot", "", "GOROOT to list, defaults to the one of the go command")
+	flag.Parse()
+
+	if *goroot == "" {
+		out, err := exec.Command("go", "env", "GOROOT").Output()
+		if err != nil {
+			return fmt.Errorf("go env GOROOT: %w", err)
+		}
+		*goroot = strings.TrimSpace(string(out))
+	}
+
+	// Determine the go1.N version of the GOROOT
+	data, err := os.ReadFile(filepath.Join(*goroot, "VERSION"))
+	if err != nil {
+		return err
+	}
+	version := regexp.MustCompile(`^go1\.[0-9]+`).FindString(string(data))
+	if version == "" {
+		return fmt.Errorf("unknown version in %s", filepath.Join(*goroot, "VERSION"))
+	}
+
+	// List the .go and .s files of all packages except for the commands,
+	// tests and test data. All GOOS and GOARCH specific files are included.
+	src := filepath.Join(*goroot, "src")
+	var files []string
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(p, src+string(filepath.Separator)))
+		if d.IsDir() {
+			if rel == "cmd" || d.Name() == "testdata" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := path.Ext(rel); (ext == ".go" || ext == ".s") && !strings.HasSuffix(rel, "_test.go") && strings.Contains(rel, "/") {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.Sort(files)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	fmt.Fprintf(gz, "# Code generated by \"go run gen_stdlib.go\" from %s; DO NOT EDIT.\n", version)
+	for _, file := range files {
+		fmt.Fprintln(gz, file)
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join("stdlib", version+".txt.gz"), buf.Bytes(), 0o644)
+}
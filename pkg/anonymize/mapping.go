@@ -0,0 +1,108 @@
+package anonymize
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Mapping maps the anonymized strings of a trace and the tokens of its
+// pseudonyms to the original strings. Strings that were anonymized the same
+// way, e.g. all the strings replaced by "XXX", aren't part of it.
+type Mapping map[string]string
+
+// encryptedMagic starts encrypted mappings. It's followed by the nonce and
+// the JSON encoded mapping sealed with AES-256-GCM.
+const encryptedMagic = "traceutils encrypted mapping\n"
+
+// Write writes the mapping as JSON to w. If key isn't empty, the mapping is
+// encrypted with the SHA-256 hash of key.
+func (m Mapping) Write(w io.Writer, key []byte) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if len(key) > 0 {
+		aead, err := newMappingCipher(key)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		data = aead.Seal(append([]byte(encryptedMagic), nonce...), nonce, data, nil)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadMapping reads a mapping written by Mapping.Write. The key is required
+// if the mapping is encrypted.
+func ReadMapping(r io.Reader, key []byte) (Mapping, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if sealed, ok := bytes.CutPrefix(data, []byte(encryptedMagic)); ok {
+		if len(key) == 0 {
+			return nil, errors.New("mapping is encrypted, but no key was given")
+		}
+		aead, err := newMappingCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return nil, errors.New("encrypted mapping is truncated")
+		}
+		nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if data, err = aead.Open(nil, nonce, sealed, nil); err != nil {
+			return nil, fmt.Errorf("failed to decrypt mapping: %w", err)
+		}
+	}
+	var m Mapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %w", err)
+	}
+	return m, nil
+}
+
+// newMappingCipher returns the cipher for encrypting mappings with key.
+func newMappingCipher(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Replacer returns a replacer that restores the original strings of all
+// anonymized strings and tokens in a text. Longer strings are replaced
+// first, so complete file pseudonyms take precedence over their tokens.
+func (m Mapping) Replacer() *strings.Replacer {
+	olds := make([]string, 0, len(m))
+	for old := range m {
+		olds = append(olds, old)
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+		return olds[i] < olds[j]
+	})
+	oldnew := make([]string, 0, 2*len(olds))
+	for _, old := range olds {
+		oldnew = append(oldnew, old, m[old])
+	}
+	return strings.NewReplacer(oldnew...)
+}
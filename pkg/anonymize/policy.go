@@ -0,0 +1,197 @@
+package anonymize
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Policy decides which function names and file paths are kept by
+// AnonymizeTrace. The go stdlib is always kept unless it's scrubbed
+// explicitly. Scrub rules take precedence over keep rules, and everything
+// that matches neither is anonymized.
+type Policy struct {
+	// Keep lists module or package paths whose functions and files are kept,
+	// e.g. "google.golang.org/grpc". A path also matches the packages below
+	// it.
+	Keep []string
+	// Scrub lists module or package paths that are anonymized even if they
+	// are in the stdlib or match Keep.
+	Scrub []string
+	// KeepFuncs and ScrubFuncs match complete function names, e.g.
+	// "github.com/acme/app.(*Server).Handle".
+	KeepFuncs  []*regexp.Regexp
+	ScrubFuncs []*regexp.Regexp
+	// KeepFiles and ScrubFiles match complete file paths. Files matching
+	// KeepFiles are kept as they are, including their directory.
+	KeepFiles  []*regexp.Regexp
+	ScrubFiles []*regexp.Regexp
+}
+
+// ParsePolicy parses a policy with one rule per line. Empty lines and lines
+// starting with # are ignored. Rules consist of a directive and its
+// argument:
+//
+//	# Keep open source dependencies, but not our fork of grpc
+//	keep google.golang.org/protobuf
+//	keep google.golang.org/grpc
+//	scrub google.golang.org/grpc/internal/acme
+//	keep-func ^github\.com/acme/oss/
+//	scrub-func \.secret[A-Z]
+//	keep-file ^/usr/local/go/
+//	scrub-file /internal/
+//
+// The argument of keep and scrub is a module or package path, the one of the
+// other directives a regular expression.
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	p := &Policy{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		directive, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			return nil, fmt.Errorf("line %d: missing argument for %q", n, directive)
+		}
+
+		var regexps *[]*regexp.Regexp
+		switch directive {
+		case "keep":
+			p.Keep = append(p.Keep, arg)
+			continue
+		case "scrub":
+			p.Scrub = append(p.Scrub, arg)
+			continue
+		case "keep-func":
+			regexps = &p.KeepFuncs
+		case "scrub-func":
+			regexps = &p.ScrubFuncs
+		case "keep-file":
+			regexps = &p.KeepFiles
+		case "scrub-file":
+			regexps = &p.ScrubFiles
+		default:
+			return nil, fmt.Errorf("line %d: unknown directive %q", n, directive)
+		}
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		*regexps = append(*regexps, re)
+	}
+	return p, scanner.Err()
+}
+
+// keepPackage returns true if the functions and files of the package with
+// the given import path are kept, std is the standard library of the trace.
+func (p *Policy) keepPackage(std *stdlib, pkg string) bool {
+	if matchPath(p.Scrub, pkg) {
+		return false
+	}
+	return std.hasPackage(pkg) || matchPath(p.Keep, pkg)
+}
+
+// keepFunc returns true if the function with the given name is kept. The
+// paths of Keep and Scrub are matched against the name directly, because the
+// package of a function can't be told apart from its name if the last
+// element of the import path contains a dot, e.g. "gopkg.in/yaml.v3.Unmarshal".
+func (p *Policy) keepFunc(std *stdlib, fn string) bool {
+	if matchAny(p.ScrubFuncs, fn) || matchFunc(p.Scrub, fn) {
+		return false
+	} else if matchAny(p.KeepFuncs, fn) || matchFunc(p.Keep, fn) {
+		return true
+	}
+	pkg := funcPackage(fn)
+	return pkg != "" && std.hasPackage(pkg)
+}
+
+// scrubFile returns true if the file with the given path is anonymized
+// regardless of its package, and keepFile returns true if it's kept as it
+// is.
+func (p *Policy) scrubFile(file string) bool { return matchAny(p.ScrubFiles, file) }
+func (p *Policy) keepFile(file string) bool  { return matchAny(p.KeepFiles, file) }
+
+// funcPackage returns the import path of the package of the function with the
+// given name, e.g. "encoding/json" for "encoding/json.(*Decoder).Decode". It
+// returns "" if the name has no package.
+func funcPackage(fn string) string {
+	// Type arguments of generic functions may contain other import paths
+	if i := strings.IndexByte(fn, '['); i >= 0 {
+		fn = fn[:i]
+	}
+	slash := strings.LastIndexByte(fn, '/')
+	dot := strings.IndexByte(fn[slash+1:], '.')
+	if dot < 0 {
+		return ""
+	}
+	return fn[:slash+1+dot]
+}
+
+// matchPath returns true if pkg is one of the paths or below one of them.
+func matchPath(paths []string, pkg string) bool {
+	for _, p := range paths {
+		if pkg == p || strings.HasPrefix(pkg, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFunc returns true if the function with the given name is in the
+// package of one of the paths or below one of them.
+func matchFunc(paths []string, fn string) bool {
+	for _, p := range paths {
+		p = strings.TrimSuffix(p, "/")
+		if fn == p || strings.HasPrefix(fn, p+".") || strings.HasPrefix(fn, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny returns true if s matches any of the regexps.
+func matchAny(regexps []*regexp.Regexp, s string) bool {
+	for _, re := range regexps {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// modulePackage returns the import path of the package of a file in the
+// module cache, e.g. "github.com/BurntSushi/toml/internal" for
+// "github.com/!burnt!sushi/toml@v1.2.0/internal/tz.go".
+func modulePackage(file string) string {
+	mod, rest, ok := strings.Cut(file, "@")
+	if !ok {
+		return ""
+	}
+	_, dir, _ := strings.Cut(path.Dir(rest), "/")
+	return path.Join(unescapeModulePath(mod), dir)
+}
+
+// unescapeModulePath reverts the escaping of upper case letters in module
+// cache paths, e.g. "!burnt!sushi" becomes "BurntSushi".
+func unescapeModulePath(mod string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range mod {
+		if r == '!' {
+			upper = true
+			continue
+		}
+		if upper && r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
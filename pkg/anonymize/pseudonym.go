@@ -0,0 +1,168 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pseudonyms maps names to stable tokens derived from a keyed HMAC, so the
+// same name gets the same token in every trace anonymized with the same key,
+// but the names can't be guessed without the key.
+type pseudonyms struct {
+	mac hash.Hash
+	// names maps the tokens to the kinds and names they were derived from to
+	// detect collisions.
+	names map[string][2]string
+	// tokens caches the tokens of the names by kind and name.
+	tokens map[[2]string]string
+}
+
+// newPseudonyms returns pseudonyms derived from key.
+func newPseudonyms(key []byte) *pseudonyms {
+	return &pseudonyms{
+		mac:    hmac.New(sha256.New, key),
+		names:  map[string][2]string{},
+		tokens: map[[2]string]string{},
+	}
+}
+
+// token returns the token for the name of the given kind, e.g. "pkg3fa07c1e"
+// for a package. The kind prefixes the token.
+func (p *pseudonyms) token(kind, name string) string {
+	if token, ok := p.tokens[[2]string{kind, name}]; ok {
+		return token
+	}
+
+	p.mac.Reset()
+	p.mac.Write([]byte(kind))
+	p.mac.Write([]byte{0})
+	p.mac.Write([]byte(name))
+	sum := hex.EncodeToString(p.mac.Sum(nil))
+
+	// Use 8 hex digits unless they collide with another name, which makes the
+	// token depend on the order of the names.
+	var token string
+	for n := 8; n <= len(sum); n++ {
+		token = kind + sum[:n]
+		if other, ok := p.names[token]; !ok || other == [2]string{kind, name} {
+			break
+		}
+	}
+	p.names[token] = [2]string{kind, name}
+	p.tokens[[2]string{kind, name}] = token
+	return token
+}
+
+// pkg returns the token of the package with the given import path.
+func (p *pseudonyms) pkg(pkg string) string {
+	return p.token("pkg", pkg)
+}
+
+// closureName matches the identifiers of closures and wrappers generated by
+// the compiler, they are kept as they don't reveal anything.
+var closureName = regexp.MustCompile(`^(func|gowrap|deferwrap)[0-9]+$|^[0-9]+$`)
+
+// function returns the pseudonym of a function name, e.g.
+// "pkg1d0c5e2a.(*type8f33a0b2).func52e9d1a7.func1" for
+// "github.com/acme/app.(*Server).handle.func1". The package, receiver type
+// and function identifiers are replaced by their tokens, and the tokens of
+// identifiers are scoped to their package. Type arguments are replaced by
+// "...". Names without a package are replaced by a "str" token.
+func (p *pseudonyms) function(fn string) string {
+	pkg := funcPackage(fn)
+	if pkg == "" {
+		return p.token("str", fn)
+	}
+
+	var b strings.Builder
+	b.WriteString(p.pkg(pkg))
+	rest := fn[len(pkg):]
+	inParens := false
+	for len(rest) > 0 {
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case r == '[':
+			// Type arguments may contain arbitrary import paths
+			depth, end := 0, 0
+			for ; end < len(rest); end++ {
+				if rest[end] == '[' {
+					depth++
+				} else if rest[end] == ']' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			b.WriteString("[...]")
+			rest = rest[min(end+1, len(rest)):]
+			continue
+		case r == '(':
+			inParens = true
+		case r == ')':
+			inParens = false
+		case isIdentRune(r):
+			end := strings.IndexFunc(rest, func(r rune) bool { return !isIdentRune(r) })
+			if end < 0 {
+				end = len(rest)
+			}
+			ident := rest[:end]
+			switch {
+			case closureName.MatchString(ident):
+				b.WriteString(ident)
+			case inParens:
+				b.WriteString(p.token("type", pkg+"."+ident))
+			default:
+				b.WriteString(p.token("func", pkg+"."+ident))
+			}
+			rest = rest[end:]
+			continue
+		}
+		b.WriteRune(r)
+		rest = rest[size:]
+	}
+	return b.String()
+}
+
+// isIdentRune returns true if r can be part of a Go identifier.
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// file returns the pseudonym of a file path, e.g.
+// "pkg1d0c5e2a/file0b7e95d3.go". The directory is replaced by the token of
+// the package if pkg isn't empty and by a "dir" token otherwise, so the files
+// of a package share the token of its functions. The ".go" suffix is kept.
+func (p *pseudonyms) file(file, pkg string) string {
+	dir := p.token("dir", path.Dir(file))
+	if pkg != "" {
+		dir = p.pkg(pkg)
+	}
+	name := p.token("file", file)
+	if strings.HasSuffix(file, ".go") {
+		name += ".go"
+	}
+	return dir + "/" + name
+}
+
+// addTo adds the tokens to m, mapped to the part of the name they replace.
+// Functions and types map to their identifiers, and files to their base name
+// without the ".go" suffix, which is kept by their pseudonyms.
+func (p *pseudonyms) addTo(m Mapping) {
+	for token, kindName := range p.names {
+		kind, name := kindName[0], kindName[1]
+		switch kind {
+		case "func", "type":
+			name = name[strings.LastIndexByte(name, '.')+1:]
+		case "file":
+			name = strings.TrimSuffix(path.Base(name), ".go")
+		}
+		m[token] = name
+	}
+}
@@ -0,0 +1,125 @@
+package anonymize
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnonymizePseudonyms tests that pseudonyms keep the structure of a trace
+// without revealing its names, and that they only depend on the key.
+func TestAnonymizePseudonyms(t *testing.T) {
+	inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "staticcheck.trace"))
+	require.NoError(t, err)
+
+	anonymize := func(key string) (*bytes.Buffer, []string) {
+		var outTrace bytes.Buffer
+		opts := Options{Pseudonymize: true, Key: []byte(key)}
+		require.NoError(t, Anonymize(bytes.NewReader(inTrace), &outTrace, opts))
+
+		var strs []string
+		dec := encoding.NewDecoder(bytes.NewReader(outTrace.Bytes()))
+		for {
+			var ev encoding.Event
+			if err := dec.Decode(&ev); err != nil {
+				require.Equal(t, io.EOF, err)
+				break
+			}
+			if ev.Type == encoding.EventString {
+				strs = append(strs, string(ev.Str))
+			}
+		}
+		return &outTrace, strs
+	}
+
+	out, strs := anonymize("secret")
+	unique := map[string]bool{}
+	for _, s := range strs {
+		require.NotContains(t, s, "honnef.co")
+		require.NotContains(t, s, "dominikh")
+		unique[s] = true
+	}
+	require.Len(t, unique, len(strs), "distinct names must get distinct pseudonyms")
+
+	again, _ := anonymize("secret")
+	require.Equal(t, out.Bytes(), again.Bytes())
+	other, _ := anonymize("other")
+	require.NotEqual(t, out.Bytes(), other.Bytes())
+}
+
+// Test_pseudonymsFunction tests the structure of function pseudonyms.
+func Test_pseudonymsFunction(t *testing.T) {
+	p := newPseudonyms([]byte("key"))
+	pkg := p.pkg("github.com/acme/app")
+	token := `[0-9a-f]{8}`
+
+	tests := []struct {
+		fn   string
+		want string
+	}{
+		{"github.com/acme/app.Run", `^` + pkg + `\.func` + token + `$`},
+		{"github.com/acme/app.(*Server).handle.func1.2", `^` + pkg + `\.\(\*type` + token + `\)\.func` + token + `\.func1\.2$`},
+		{"github.com/acme/app.Map[go.shape.[]github.com/acme/secret.T].gowrap1", `^` + pkg + `\.func` + token + `\[\.\.\.\]\.gowrap1$`},
+		{"github.com/acme/app/internal/db.Open", `^pkg` + token + `\.func` + token + `$`},
+		{"main.main", `^pkg` + token + `\.func` + token + `$`},
+		{"my task", `^str` + token + `$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fn, func(t *testing.T) {
+			got := p.function(tt.fn)
+			require.Regexp(t, regexp.MustCompile(tt.want), got)
+			require.Equal(t, got, p.function(tt.fn))
+		})
+	}
+
+	// Identifiers are scoped to their package
+	a := p.function("github.com/acme/app.Run")
+	b := p.function("github.com/acme/app/internal/db.Run")
+	require.NotEqual(t, strings.Split(a, ".")[1], strings.Split(b, ".")[1])
+	require.NotEqual(t, p.function("github.com/acme/app.Run"), p.function("github.com/acme/app.Stop"))
+}
+
+// Test_pseudonymsFile tests that files share the pseudonyms of their
+// packages.
+func Test_pseudonymsFile(t *testing.T) {
+	p := newPseudonyms([]byte("key"))
+	a := &anonymizer{policy: &Policy{}, stdlib: stdlibFor(1025), pseudonyms: p}
+	pkg := p.pkg("github.com/acme/app")
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"/home/bob/go/src/github.com/acme/app/main.go", `^` + pkg + `/file[0-9a-f]{8}\.go$`},
+		{"/home/bob/go/pkg/mod/github.com/acme/app@v1.0.0/main.go", `^` + pkg + `/file[0-9a-f]{8}\.go$`},
+		{"/home/bob/app/vendor/github.com/acme/app/main.go", `^` + pkg + `/file[0-9a-f]{8}\.go$`},
+		{"/home/bob/app/main.go", `^dir[0-9a-f]{8}/file[0-9a-f]{8}\.go$`},
+		{"/home/bob/app/main.s", `^dir[0-9a-f]{8}/file[0-9a-f]{8}$`},
+		{"/usr/local/go/src/runtime/proc.go", `^XXX/src/runtime/proc\.go$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got := string(a.anonymizeString([]byte(tt.file)))
+			require.Regexp(t, regexp.MustCompile(tt.want), got)
+		})
+	}
+}
+
+// Test_pseudonymsCollision tests that colliding tokens are made longer.
+func Test_pseudonymsCollision(t *testing.T) {
+	p := newPseudonyms([]byte("key"))
+	token := p.token("pkg", "a")
+
+	q := newPseudonyms([]byte("key"))
+	q.names[token] = [2]string{"pkg", "b"}
+	got := q.token("pkg", "a")
+	require.Len(t, got, len(token)+1)
+	require.True(t, strings.HasPrefix(got, token))
+}
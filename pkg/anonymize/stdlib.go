@@ -0,0 +1,138 @@
+package anonymize
+
+import (
+	"bufio"
+	"compress/gzip"
+	"embed"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+//go:generate go run gen_stdlib.go
+
+// stdlibFS holds the lists of the source files of Go's standard library
+// written by gen_stdlib.go, one per go1.N version.
+//
+//go:embed stdlib/*.txt.gz
+var stdlibFS embed.FS
+
+// stdlib is the standard library of a Go version.
+type stdlib struct {
+	// version is the version in the format of trace versions, e.g. 1022 for
+	// go1.22.
+	version int
+	pkgs    map[string]bool
+	files   map[string]bool
+}
+
+// hasPackage returns true if pkg is a package of the standard library.
+func (s *stdlib) hasPackage(pkg string) bool {
+	return s.pkgs[pkg]
+}
+
+// hasFile returns true if file is the path of a source file of the standard
+// library relative to GOROOT/src, e.g. "runtime/proc.go".
+func (s *stdlib) hasFile(file string) bool {
+	return s.files[file]
+}
+
+// stdlibs returns the embedded standard libraries ordered by version. They
+// are only parsed when they are needed.
+var stdlibs = sync.OnceValue(func() []*stdlib {
+	entries, err := stdlibFS.ReadDir("stdlib")
+	if err != nil {
+		panic(err)
+	}
+	var libs []*stdlib
+	for _, entry := range entries {
+		lib, err := readStdlib(entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("stdlib/%s: %v", entry.Name(), err))
+		}
+		libs = append(libs, lib)
+	}
+	slices.SortFunc(libs, func(a, b *stdlib) int { return a.version - b.version })
+	return libs
+})
+
+// readStdlib reads the embedded list with the given file name.
+func readStdlib(name string) (*stdlib, error) {
+	lib := &stdlib{pkgs: map[string]bool{}, files: map[string]bool{}}
+	var minor int
+	if _, err := fmt.Sscanf(name, "go1.%d.txt.gz", &minor); err != nil {
+		return nil, fmt.Errorf("unknown version: %w", err)
+	}
+	lib.version = 1000 + minor
+
+	f, err := stdlibFS.Open("stdlib/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		file := scanner.Text()
+		if file == "" || strings.HasPrefix(file, "#") {
+			continue
+		}
+		lib.files[file] = true
+		lib.pkgs[path.Dir(file)] = true
+	}
+	return lib, scanner.Err()
+}
+
+// traceReleases maps the versions of traces to the oldest and newest Go
+// release that write them, because the header of a trace doesn't name the
+// release, e.g. go1.23 and go1.24 both write "go 1.23 trace".
+var traceReleases = map[int][2]int{
+	1005: {1005, 1006},
+	1011: {1011, 1018},
+	1019: {1019, 1020},
+	1023: {1023, 1024},
+	1026: {1026, 1027},
+}
+
+// stdlibFor returns the standard library of the Go releases that write traces
+// of the given version. If more than one of them is embedded, it's the union
+// of their standard libraries. If none is, it's the newest one that isn't
+// newer than the releases, or the oldest one if all of them are newer.
+func stdlibFor(version int) *stdlib {
+	releases, ok := traceReleases[version]
+	if !ok {
+		releases = [2]int{version, version}
+	}
+	libs := stdlibs()
+	var matching []*stdlib
+	for _, l := range libs {
+		if l.version >= releases[0] && l.version <= releases[1] {
+			matching = append(matching, l)
+		}
+	}
+	switch len(matching) {
+	case 0:
+		lib := libs[0]
+		for _, l := range libs[1:] {
+			if l.version <= releases[1] {
+				lib = l
+			}
+		}
+		return lib
+	case 1:
+		return matching[0]
+	}
+
+	union := &stdlib{version: matching[len(matching)-1].version, pkgs: map[string]bool{}, files: map[string]bool{}}
+	for _, l := range matching {
+		maps.Copy(union.pkgs, l.pkgs)
+		maps.Copy(union.files, l.files)
+	}
+	return union
+}
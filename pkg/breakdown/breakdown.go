@@ -8,30 +8,64 @@ import (
 
 // ByEventType reads a trace from r and return a breakdown of it by event type.
 func ByEventType(r io.Reader) (EventTypeBreakdown, error) {
-	dec := encoding.NewDecoder(r)
 	breakdown := make(EventTypeBreakdown)
+	if err := addEvents(breakdown, encoding.NewDecoder(r), true); err != nil {
+		return nil, err
+	}
+	return breakdown, nil
+}
 
+// ByEventTypeParallel is like ByEventType, but decodes the trace of the given
+// size read from r on multiple goroutines.
+func ByEventTypeParallel(r io.ReaderAt, size int64) (EventTypeBreakdown, error) {
+	breakdown := make(EventTypeBreakdown)
+	err := encoding.DecodeParallel(r, size, 0, func(dec *encoding.Decoder, first bool) (EventTypeBreakdown, error) {
+		frame := make(EventTypeBreakdown)
+		return frame, addEvents(frame, dec, first)
+	}, func(frame EventTypeBreakdown) error {
+		for typ, summary := range frame {
+			breakdown[typ] = EventTypeSummary{
+				EventType: typ,
+				Count:     breakdown[typ].Count + summary.Count,
+				Bytes:     breakdown[typ].Bytes + summary.Bytes,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return breakdown, nil
+}
+
+// addEvents adds the events decoded by dec to breakdown. If first is true,
+// dec starts with the first event of the trace and the header is added to
+// the size of that event, so that the sizes add up to the size of the trace.
+// Only the types and sizes of the events are needed, so their arguments
+// aren't accessed through the typed views of encoding.Event.
+func addEvents(breakdown EventTypeBreakdown, dec *encoding.Decoder, first bool) error {
 	var ev encoding.Event
 	for {
 		start := dec.Offset()
+		if first {
+			// A Decoder created by NewDecoder starts at the header, one
+			// created by encoding.DecodeParallel after it.
+			start, first = 0, false
+		}
 		err := dec.Decode(&ev)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, err
+			return err
 		}
 		breakdown[ev.Type] = EventTypeSummary{
 			EventType: ev.Type,
 			Count:     breakdown[ev.Type].Count + 1,
-			// BUG: For the first event we're including the size of the header
-			// in the sum here. But that's not a big deal since the header is
-			// very small.
-			Bytes: breakdown[ev.Type].Bytes + dec.Offset() - start,
+			Bytes:     breakdown[ev.Type].Bytes + dec.Offset() - start,
 		}
 	}
-
-	return breakdown, nil
+	return nil
 }
 
 // EventTypeBreakdown breaks down the size of a trace by event type.
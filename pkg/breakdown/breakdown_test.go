@@ -32,3 +32,23 @@ func TestByEventType(t *testing.T) {
 	require.Equal(t, breakdown[encoding.EventString].Count, int64(41))
 	require.Equal(t, breakdown[encoding.EventString].Bytes, int64(1694))
 }
+
+func TestByEventTypeParallel(t *testing.T) {
+	// Read the test trace.
+	inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "staticcheck.trace"))
+	require.NoError(t, err)
+
+	// Break down the trace sequentially and in parallel.
+	want, err := ByEventType(bytes.NewReader(inTrace))
+	require.NoError(t, err)
+	got, err := ByEventTypeParallel(bytes.NewReader(inTrace), int64(len(inTrace)))
+	require.NoError(t, err)
+
+	// Assert that both breakdowns are the same and include the header.
+	require.Equal(t, want, got)
+	var size int64
+	for _, summary := range got {
+		size += summary.Bytes
+	}
+	require.Equal(t, int64(len(inTrace)), size)
+}
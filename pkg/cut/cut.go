@@ -0,0 +1,355 @@
+package cut
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/state"
+)
+
+// Options configures Cut.
+type Options struct {
+	// Start is the start of the time window relative to the first event of
+	// the trace.
+	Start time.Duration
+	// End is the end of the time window relative to the first event of the
+	// trace. The event at End is not included. If End is 0, the window ends
+	// at the end of the trace.
+	End time.Duration
+	// Index is the index of the trace. If it's nil, Cut builds it.
+	Index *encoding.Index
+}
+
+// Cut reads a trace from r and writes a trace to w that only contains the
+// events in the time window of opts. All strings and stacks are kept. The
+// goroutines, Ps, GC and STW phases that are active at the start of the
+// window are recreated with state events at the start of the window, just
+// like the runtime does at the start of a trace, so that the new trace can be
+// read by go tool trace and gotraceui. In go 1.22+ traces the strings and
+// stacks of every generation in the window are kept, and the state is
+// recreated with GoStatus and ProcStatus events instead. Traces before go 1.11
+// are not supported.
+func Cut(r io.ReadSeeker, w io.Writer, opts Options) error {
+	// Build the index to find the batches of the window
+	idx := opts.Index
+	if idx == nil {
+		start, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		} else if idx, err = encoding.BuildIndex(r); err != nil {
+			return err
+		} else if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if idx.Version < 1011 {
+		return fmt.Errorf("unsupported trace file version %d, only go 1.11+ traces can be cut", idx.Version)
+	}
+	start, end := idx.MinTs+int64(opts.Start), int64(math.MaxInt64)
+	if opts.End > 0 {
+		end = idx.MinTs + int64(opts.End)
+	}
+	var maxTs int64
+	for _, b := range idx.Batches {
+		maxTs = max(maxTs, b.MaxTs)
+	}
+	if start > maxTs {
+		return fmt.Errorf("the window starts at %v after the end of the trace at %v", opts.Start, time.Duration(maxTs-idx.MinTs))
+	}
+	if idx.Version >= 1022 {
+		return cutV2(r, w, idx, start, end)
+	}
+
+	c := &cutter{
+		dec:       encoding.NewContextDecoder(r),
+		enc:       encoding.NewEncoderVersion(w, idx.Version),
+		version:   idx.Version,
+		start:     start,
+		end:       end,
+		state:     state.New(idx.Version),
+		globalP:   math.MaxUint64,
+		outputSeq: make(map[uint64]uint64),
+	}
+	c.dec.SetIndex(idx)
+
+	// Determine the state at the start of the window from the batches that
+	// start before it.
+	for _, b := range idx.Batches {
+		c.globalP = min(c.globalP, uint64(b.P))
+		if b.MinTs >= c.start {
+			continue
+		} else if err := c.dec.Seek(b); err != nil {
+			return err
+		} else if err := c.readState(); err != nil {
+			return err
+		}
+	}
+
+	// Recreate the state and copy the events of the window
+	if err := c.writeState(); err != nil {
+		return err
+	}
+	for _, b := range idx.Batches {
+		if !b.Tables && (b.MaxTs < c.start || b.MinTs >= c.end) {
+			continue
+		} else if err := c.dec.Seek(b); err != nil {
+			return err
+		} else if err := c.copyEvents(); err != nil {
+			return err
+		}
+	}
+	return c.enc.Close()
+}
+
+// cutter holds the state of Cut.
+type cutter struct {
+	dec     *encoding.ContextDecoder
+	enc     *encoding.Encoder
+	version int
+	start   int64 // start of the window in nanoseconds
+	end     int64 // end of the window in nanoseconds
+
+	// state at the start of the window
+	state   *state.State
+	globalP uint64 // P that recreates global state
+	ticks   uint64 // timestamp of the last event before the window
+
+	// output state
+	outputSeq   map[uint64]uint64 // goroutine sequence numbers after the recreated state
+	outputGCSeq uint64            // GC sequence number after the recreated state
+	lastTicks   uint64            // timestamp of the last event in the output batch
+}
+
+// readState updates the state with the events of the current batch that
+// happen before the window.
+func (c *cutter) readState() error {
+	var (
+		ev    encoding.ContextEvent
+		ticks uint64
+	)
+	for {
+		if err := c.dec.Decode(&ev); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// Track the timestamp in ticks and skip events after the start
+		if ev.Type == encoding.EventBatch {
+			batch, err := ev.AsBatch(c.version)
+			if err != nil {
+				return err
+			}
+			ticks = batch.Ts
+			continue
+		} else if delta, ok := ev.TsDelta(c.version); ok {
+			ticks += delta
+		}
+		if ev.Ts == 0 || ev.Ts >= c.start || ev.Type == encoding.EventCPUSample {
+			continue
+		}
+		c.ticks = max(c.ticks, ticks)
+
+		if err := c.state.Update(&ev); err != nil {
+			return err
+		}
+	}
+}
+
+// writeState writes the header of the new trace followed by events that
+// recreate the state at the start of the window. Global state is written to
+// a batch of the P with the lowest id, the state of each P to a batch of that
+// P.
+func (c *cutter) writeState() error {
+	if c.ticks == 0 {
+		// The window starts with the trace, so there is no state to
+		// recreate.
+		return nil
+	}
+
+	// Goroutines are only running if their P is running them
+	s := c.state
+	running := s.Running()
+
+	// Write the global state. Every goroutine that exists is created,
+	// blocked goroutines are marked as waiting.
+	if err := c.encode(encoding.EventBatch, c.globalP, c.ticks); err != nil {
+		return err
+	} else if s.Procs.OK {
+		if err := c.encode(encoding.EventGomaxprocs, 0, s.Procs.Value, 0); err != nil {
+			return err
+		}
+	}
+	for _, id := range state.SortedKeys(s.Gs) {
+		g := s.Gs[id]
+		if g.Status == state.GDead {
+			continue
+		} else if err := c.encode(encoding.EventGoCreate, 0, id, g.Stack, 0); err != nil {
+			return err
+		}
+		c.outputSeq[id] = 1
+		switch {
+		case g.Status == state.GWaiting && g.Syscall:
+			err := c.encode(encoding.EventGoInSyscall, 0, id)
+			if err != nil {
+				return err
+			}
+			c.outputSeq[id]++
+		case g.Status == state.GWaiting:
+			if err := c.encode(encoding.EventGoWaiting, 0, id); err != nil {
+				return err
+			}
+			c.outputSeq[id]++
+		}
+	}
+	if s.GC.Value == 1 {
+		if err := c.encode(encoding.EventGCStart, 0, 0, 0); err != nil {
+			return err
+		}
+		c.outputGCSeq = 1
+	}
+	if s.STW.Value != 0 {
+		if err := c.encode(encoding.EventGCSTWStart, 0, s.STW.Value-1); err != nil {
+			return err
+		}
+	}
+	if s.HeapAlloc.OK {
+		if err := c.encode(encoding.EventHeapAlloc, 0, s.HeapAlloc.Value); err != nil {
+			return err
+		}
+	}
+	if s.HeapGoal.OK {
+		if err := c.encode(encoding.EventHeapGoal, 0, s.HeapGoal.Value); err != nil {
+			return err
+		}
+	}
+
+	// Write the state of every P
+	for _, id := range state.SortedKeys(s.Ps) {
+		p := s.Ps[id]
+		if !p.Running && !p.Sweeping {
+			continue
+		}
+		if err := c.encode(encoding.EventBatch, id, c.ticks); err != nil {
+			return err
+		}
+		if p.Running {
+			if err := c.encode(encoding.EventProcStart, 0, p.Thread); err != nil {
+				return err
+			}
+		}
+		if p.Sweeping {
+			if err := c.encode(encoding.EventGCSweepStart, 0, 0); err != nil {
+				return err
+			}
+		}
+		if p.G != 0 && running[p.G] == id {
+			if err := c.encode(encoding.EventGoStart, 0, p.G, c.outputSeq[p.G]); err != nil {
+				return err
+			}
+			c.outputSeq[p.G]++
+		}
+	}
+	return nil
+}
+
+// copyEvents copies the events of the current batch that belong to the
+// window. The batch header is only written if the batch contains such
+// events. Events without a timestamp, i.e. the frequency, strings and stacks,
+// are always copied.
+func (c *cutter) copyEvents() error {
+	var (
+		ev      encoding.ContextEvent
+		p       uint64
+		ticks   uint64
+		written bool // true if the batch header has been written
+	)
+	for {
+		if err := c.dec.Decode(&ev); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		delta, hasTs := ev.TsDelta(c.version)
+		if ev.Type == encoding.EventBatch {
+			batch, err := ev.AsBatch(c.version)
+			if err != nil {
+				return err
+			}
+			p, ticks = batch.P, batch.Ts
+			continue
+		} else if hasTs {
+			ticks += delta
+			if ev.Ts < c.start || ev.Ts >= c.end {
+				continue
+			}
+		}
+
+		// Start the batch at the first event that is copied
+		if !written {
+			if err := c.encode(encoding.EventBatch, p, ticks); err != nil {
+				return err
+			}
+			written = true
+		}
+		if !hasTs {
+			if err := c.enc.Encode(&ev.Event); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Make the timestamp relative to the previous event that was
+		// written and renumber the goroutine and GC sequence numbers
+		// relative to the recreated state.
+		ev.Args[0] = ticks - c.lastTicks
+		c.lastTicks = ticks
+		if err := c.renumber(&ev.Event); err != nil {
+			return err
+		}
+		if err := c.enc.Encode(&ev.Event); err != nil {
+			return err
+		}
+	}
+}
+
+// renumber rewrites the goroutine or GC sequence number of ev to continue
+// from the recreated state.
+func (c *cutter) renumber(ev *encoding.Event) error {
+	switch ev.Type {
+	case encoding.EventGCStart:
+		i, _ := encoding.ArgIndex(c.version, ev.Type, "Seq")
+		if ev.Args[i] < c.state.GCSeq {
+			return fmt.Errorf("GC with sequence number %d in the window, but %d GCs before it", ev.Args[i], c.state.GCSeq)
+		}
+		ev.Args[i] = ev.Args[i] - c.state.GCSeq + c.outputGCSeq
+	case encoding.EventGoStart, encoding.EventGoStartLabel,
+		encoding.EventGoUnblock, encoding.EventGoSysExit:
+		gi, _ := encoding.ArgIndex(c.version, ev.Type, "G")
+		g, ok := c.state.Gs[ev.Args[gi]]
+		if !ok {
+			// The goroutine was created in the window
+			return nil
+		}
+		i, _ := encoding.ArgIndex(c.version, ev.Type, "GSeq")
+		if ev.Args[i] < g.Seq {
+			return fmt.Errorf("goroutine %d has sequence number %d in the window, but %d before it", ev.Args[gi], ev.Args[i], g.Seq)
+		}
+		ev.Args[i] = ev.Args[i] - g.Seq + c.outputSeq[ev.Args[gi]]
+	}
+	return nil
+}
+
+// encode writes an event of type t with the given arguments. For batches it
+// sets the timestamp of the batch, for all other events the timestamp delta
+// must be the first argument.
+func (c *cutter) encode(t encoding.EventType, args ...uint64) error {
+	if t == encoding.EventBatch {
+		c.lastTicks = args[1]
+	}
+	return c.enc.Encode(&encoding.Event{Type: t, Args: args})
+}
@@ -0,0 +1,221 @@
+package cut
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/felixge/traceutils/internal/tracetest"
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/stretchr/testify/require"
+	exptrace "golang.org/x/exp/trace"
+	"honnef.co/go/gotraceui/trace"
+)
+
+// TestCut tests that cutting a window out of a trace produces a trace that
+// gotraceui can parse and that contains the events of the window.
+func TestCut(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.19", "trace.bin"},
+		{"1.19", "test-encoding-json.trace"},
+		{"1.21", "task.trace"},
+		{"1.21", "fgprof.trace"},
+		{"1.21", "test-encoding-json.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+			want, err := trace.Parse(bytes.NewReader(data), nil)
+			require.NoError(t, err)
+			duration := time.Duration(want.Events[len(want.Events)-1].Ts)
+
+			windows := []struct {
+				Name       string
+				Start, End time.Duration
+			}{
+				{"all", 0, 0},
+				{"start", 0, duration / 3},
+				{"middle", duration / 3, 2 * duration / 3},
+				{"end", 2 * duration / 3, 0},
+			}
+			for _, window := range windows {
+				t.Run(window.Name, func(t *testing.T) {
+					var out bytes.Buffer
+					opts := Options{Start: window.Start, End: window.End}
+					require.NoError(t, Cut(bytes.NewReader(data), &out, opts))
+					got, err := trace.Parse(bytes.NewReader(out.Bytes()), nil)
+					require.NoError(t, err)
+
+					// Every event of the window must be in the new trace,
+					// but state events may be added at the start.
+					counts := make(map[eventKey]int)
+					for _, ev := range got.Events {
+						counts[eventKey{ev.Type, ev.G}]++
+					}
+					for _, ev := range want.Events {
+						ts := time.Duration(ev.Ts)
+						if ts < window.Start || (window.End != 0 && ts >= window.End) {
+							continue
+						}
+						key := eventKey{ev.Type, ev.G}
+						require.Positive(t, counts[key], "missing %s event of g %d at %d", trace.EventDescriptions[ev.Type].Name, ev.G, ev.Ts)
+						counts[key]--
+					}
+					for key, n := range counts {
+						if n > 0 {
+							require.Contains(t, stateEvents, key.Type, "unexpected %s event of g %d", trace.EventDescriptions[key.Type].Name, key.G)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestCutV2 tests that cutting a window out of a go 1.22+ trace produces a
+// trace that the Go trace parser accepts and that contains the events of
+// the window.
+func TestCutV2(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.25", "test-encoding-json.trace"},
+		{"1.26", "generations.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+			idx, err := encoding.BuildIndex(bytes.NewReader(data))
+			require.NoError(t, err)
+			var maxTs int64
+			for _, b := range idx.Batches {
+				maxTs = max(maxTs, b.MaxTs)
+			}
+			duration := time.Duration(maxTs - idx.MinTs)
+			want := tracetest.ReadEvents(t, data)
+
+			windows := []struct {
+				Name       string
+				Start, End time.Duration
+			}{
+				{"all", 0, 0},
+				{"start", 0, duration / 3},
+				{"middle", duration / 3, 2 * duration / 3},
+				{"end", 2 * duration / 3, 0},
+			}
+			for _, window := range windows {
+				t.Run(window.Name, func(t *testing.T) {
+					var out bytes.Buffer
+					opts := Options{Start: window.Start, End: window.End, Index: idx}
+					require.NoError(t, Cut(bytes.NewReader(data), &out, opts))
+					got := tracetest.ReadEvents(t, out.Bytes())
+
+					// Every event of the window must be in the new
+					// trace, but state events may be added at its start.
+					inWindow := func(ev exptrace.Event) bool {
+						ts := time.Duration(int64(ev.Time()) - idx.MinTs)
+						return ts >= window.Start && (window.End == 0 || ts < window.End)
+					}
+					counts := make(map[string]int)
+					for _, ev := range got {
+						counts[eventKeyV2(ev)]++
+					}
+					for _, ev := range want {
+						if key := eventKeyV2(ev); key != "" && inWindow(ev) {
+							require.Positive(t, counts[key], "missing %s", ev)
+							counts[key]--
+						}
+					}
+					if window.Name == "all" {
+						require.Len(t, got, len(want))
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestCutOutside tests that a window that starts after the end of the trace
+// is rejected instead of producing a trace without events.
+func TestCutOutside(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.21", "task.trace"},
+		{"1.26", "generations.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+			idx, err := encoding.BuildIndex(bytes.NewReader(data))
+			require.NoError(t, err)
+			var maxTs int64
+			for _, b := range idx.Batches {
+				maxTs = max(maxTs, b.MaxTs)
+			}
+			duration := time.Duration(maxTs - idx.MinTs)
+
+			opts := Options{Start: duration + time.Second}
+			err = Cut(bytes.NewReader(data), io.Discard, opts)
+			require.ErrorContains(t, err, "after the end of the trace")
+
+			// The last event is still in a window that starts at it
+			opts = Options{Start: duration}
+			require.NoError(t, Cut(bytes.NewReader(data), io.Discard, opts))
+		})
+	}
+}
+
+// eventKeyV2 identifies the events of go 1.22+ traces that are compared by
+// TestCutV2: user annotations, CPU samples and goroutine transitions, except
+// the ones of status events, which are added at the start of the window.
+// The time isn't part of the key, because the parser makes equal timestamps
+// distinct depending on the order of the events. It's empty for all other
+// events.
+func eventKeyV2(ev exptrace.Event) string {
+	switch ev.Kind() {
+	case exptrace.EventLog, exptrace.EventRegionBegin, exptrace.EventRegionEnd,
+		exptrace.EventTaskBegin, exptrace.EventTaskEnd, exptrace.EventStackSample:
+		return fmt.Sprintf("%v %d", ev.Kind(), ev.Goroutine())
+	case exptrace.EventStateTransition:
+		st := ev.StateTransition()
+		if st.Resource.Kind != exptrace.ResourceGoroutine {
+			return ""
+		}
+		from, to := st.Goroutine()
+		if from == exptrace.GoUndetermined || from == to {
+			return ""
+		}
+		return fmt.Sprintf("%v %d %v %v", ev.Kind(), st.Resource.Goroutine(), from, to)
+	}
+	return ""
+}
+
+// eventKey identifies the events that are compared by TestCut.
+type eventKey struct {
+	Type byte
+	G    uint64
+}
+
+// stateEvents are the types of the events that recreate the state at the
+// start of the window.
+var stateEvents = []byte{
+	trace.EvBatch, trace.EvGomaxprocs, trace.EvGoCreate, trace.EvGoWaiting,
+	trace.EvGoInSyscall, trace.EvGCStart, trace.EvSTWStart, trace.EvHeapAlloc,
+	trace.EvHeapGoal, trace.EvProcStart, trace.EvGCSweepStart, trace.EvGoStart,
+}
@@ -0,0 +1,417 @@
+package cut
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/state"
+)
+
+// cutV2 cuts a go 1.22+ trace. Such traces consist of generations with their
+// own string and stack tables and sequence numbers, and the runtime writes
+// the state of every goroutine and P that it touches in a generation. So the
+// window starts with the generation that contains its start, whose state at
+// the start of the window is recreated with status events, and every
+// generation that follows is copied up to the end of the window. The string
+// and stack tables of these generations are kept completely.
+func cutV2(r io.ReadSeeker, w io.Writer, idx *encoding.Index, start, end int64) error {
+	c := &cutterV2{
+		dec:     encoding.NewContextDecoder(r),
+		enc:     encoding.NewEncoderVersion(w, idx.Version),
+		version: idx.Version,
+		start:   start,
+		end:     end,
+		state:   state.NewV2(idx.Version),
+		ps:      make(map[int64]int64),
+	}
+	c.dec.SetIndex(idx)
+
+	// Split the batches into generations and find the generation of the
+	// start of the window. A generation starts with the first event of its
+	// Ms, the tables and statuses without an M are written at its end.
+	var gens [][]encoding.IndexBatch
+	for _, b := range idx.Batches {
+		if len(gens) == 0 || gens[len(gens)-1][0].Gen != b.Gen {
+			gens = append(gens, nil)
+		}
+		gens[len(gens)-1] = append(gens[len(gens)-1], b)
+	}
+	genStart := func(gen []encoding.IndexBatch) int64 {
+		minTs := int64(math.MaxInt64)
+		for _, b := range gen {
+			if b.M >= 0 {
+				minTs = min(minTs, b.MinTs)
+			}
+		}
+		return minTs
+	}
+	first := 0
+	for i, gen := range gens {
+		if genStart(gen) <= c.start {
+			first = i
+		}
+	}
+
+	for i, gen := range gens[first:] {
+		if i > 0 && genStart(gen) >= c.end {
+			break
+		}
+		if i == 0 {
+			// Determine and recreate the state at the start of the window
+			if err := c.readState(gen); err != nil {
+				return err
+			} else if err := c.writeState(gen[0].Gen); err != nil {
+				return err
+			}
+		}
+		for _, b := range gen {
+			if !b.Tables && (b.MaxTs < c.start || b.MinTs >= c.end) {
+				continue
+			} else if err := c.copyBatch(b, i == 0); err != nil {
+				return err
+			}
+		}
+		if c.version >= 1026 {
+			if err := c.enc.Encode(&encoding.Event{Type: encoding.EventV2EndOfGeneration}); err != nil {
+				return err
+			}
+		}
+	}
+	return c.enc.Close()
+}
+
+// cutterV2 holds the state of cutV2.
+type cutterV2 struct {
+	dec     *encoding.ContextDecoder
+	enc     *encoding.Encoder
+	version int
+	start   int64 // start of the window in nanoseconds
+	end     int64 // end of the window in nanoseconds
+
+	// state at the start of the window in its first generation
+	state *state.V2
+	ticks uint64 // timestamp of the last event before the window
+
+	// P of every M in the window of the first generation. The P of the
+	// context of an event can't be used, because the context decoder
+	// doesn't see the events of other Ms in the right order.
+	ps map[int64]int64
+
+	// output batch whose length is only known after its events
+	batch []encoding.Event
+}
+
+// readState updates the state with the events of the generation gen that
+// happen before the window.
+func (c *cutterV2) readState(gen []encoding.IndexBatch) error {
+	var (
+		ms    [][]encoding.ContextEvent
+		index = make(map[int64]int) // index in ms by M
+		ev    encoding.ContextEvent
+	)
+	for _, b := range gen {
+		if b.Tables || b.MinTs >= c.start {
+			continue
+		} else if err := c.dec.Seek(b); err != nil {
+			return err
+		}
+		for {
+			if err := c.dec.Decode(&ev); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			if ev.Type == encoding.EventV2ExperimentalBatch {
+				break
+			} else if _, ok := ev.TsDelta(c.version); !ok || ev.Ts >= c.start {
+				continue
+			}
+			c.ticks = max(c.ticks, ev.Ticks)
+
+			i, ok := index[ev.M]
+			if !ok {
+				i = len(ms)
+				index[ev.M] = i
+				ms = append(ms, nil)
+			}
+			cp := encoding.ContextEvent{Event: encoding.Event{Type: ev.Type, Args: slices.Clone(ev.Args)}, Ts: ev.Ts, Ticks: ev.Ticks, M: ev.M, P: ev.P, G: ev.G}
+			ms[i] = append(ms[i], cp)
+		}
+	}
+	return c.state.UpdateOrdered(ms)
+}
+
+// writeState writes batches with events that recreate the state at the start
+// of the window in generation gen, just like the runtime does when it touches
+// a goroutine or P for the first time in a generation. The Ps and goroutines
+// that are bound to an M are written to a batch of that M, all others to a
+// batch without an M.
+func (c *cutterV2) writeState(gen uint64) error {
+	if c.ticks == 0 {
+		// The window starts with the generation, so there is no state
+		// to recreate.
+		return nil
+	}
+
+	s := c.state
+	boundGs, boundPs := s.Bound()
+	heap := false // true if the heap metrics have been written
+	for _, m := range state.SortedKeys(s.Ms) {
+		p, hasP := -1, false
+		for id, pm := range boundPs {
+			if pm == m {
+				p, hasP = int(id), true
+			}
+		}
+		g, hasG := uint64(0), false
+		for id, gm := range boundGs {
+			if gm == m {
+				g, hasG = id, true
+			}
+		}
+		if !hasP && !hasG {
+			continue
+		}
+
+		c.begin(gen, m)
+		if hasP {
+			ps := s.Ps[uint64(p)]
+			c.add(encoding.EventV2ProcStatus, 0, uint64(p), uint64(ps.Status))
+			if ps.Sweeping {
+				c.add(encoding.EventV2GCSweepActive, 0, uint64(p))
+			}
+			if !heap {
+				heap = true
+				if s.HeapAlloc.OK {
+					c.add(encoding.EventV2HeapAlloc, 0, s.HeapAlloc.Value)
+				}
+				if s.HeapGoal.OK {
+					c.add(encoding.EventV2HeapGoal, 0, s.HeapGoal.Value)
+				}
+			}
+		}
+		if hasG {
+			gs := s.Gs[g]
+			c.add(encoding.EventV2GoStatus, 0, g, uint64(m), uint64(gs.Status))
+			if gs.Assist {
+				c.add(encoding.EventV2GCMarkAssistActive, 0, g)
+			}
+			if gs.STW && hasP && gs.Status == state.V2GRunning {
+				c.add(encoding.EventV2STWBegin, 0, gs.Kind, 0)
+			}
+		}
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+
+	// Write the state of everything else
+	c.begin(gen, -1)
+	for _, id := range state.SortedKeys(s.Ps) {
+		ps := s.Ps[id]
+		if _, ok := boundPs[id]; ok || ps.Status == state.V2PBad {
+			continue
+		}
+		c.add(encoding.EventV2ProcStatus, 0, id, uint64(ps.Status))
+		if ps.Sweeping {
+			c.add(encoding.EventV2GCSweepActive, 0, id)
+		}
+	}
+	for _, id := range state.SortedKeys(s.Gs) {
+		gs := s.Gs[id]
+		if _, ok := boundGs[id]; ok || gs.Status == state.V2GBad {
+			continue
+		}
+		c.add(encoding.EventV2GoStatus, 0, id, math.MaxUint64, uint64(gs.Status))
+		if gs.Assist {
+			c.add(encoding.EventV2GCMarkAssistActive, 0, id)
+		}
+	}
+	if s.GC {
+		c.add(encoding.EventV2GCActive, 0, s.GCSeq)
+	}
+	return c.flush()
+}
+
+// copyBatch copies the events of the batch b that belong to the window. The
+// batch is only written if it contains such events, but tables are always
+// copied. Experimental batches are dropped, because their data can't be cut.
+// If renumber is true, the sequence numbers of the events are made relative
+// to the recreated state.
+func (c *cutterV2) copyBatch(b encoding.IndexBatch, renumber bool) error {
+	if err := c.dec.Seek(b); err != nil {
+		return err
+	}
+
+	var (
+		ev        encoding.ContextEvent
+		lastTicks uint64 // timestamp of the previous event that was copied
+		timed     bool   // true if an event with a timestamp was copied
+	)
+	for {
+		if err := c.dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case ev.Type == encoding.EventV2ExperimentalBatch:
+			return nil
+		case ev.Type == encoding.EventV2EndOfGeneration:
+			// The end of the generation is written by cutV2
+			continue
+		case ev.Type == encoding.EventV2Batch || b.Tables || ev.Ticks == 0:
+			// Headers, tables and the headers of table sections are
+			// kept as they are.
+		case ev.Ts < c.start || ev.Ts >= c.end:
+			continue
+		case ev.Type == encoding.EventV2CPUSample:
+			// CPU samples have an absolute timestamp
+			timed = true
+		default:
+			// Make the timestamp relative to the previous event that
+			// was copied and start the batch at the first one.
+			if !timed {
+				c.batch[0].Args[2], lastTicks = ev.Ticks, ev.Ticks
+				timed = true
+			}
+			ev.Args[0], lastTicks = ev.Ticks-lastTicks, ev.Ticks
+			if renumber {
+				if err := c.renumber(&ev); err != nil {
+					return err
+				} else if err := c.updateP(&ev); err != nil {
+					return err
+				}
+			}
+		}
+		c.batch = append(c.batch, encoding.Event{Type: ev.Type, Args: slices.Clone(ev.Args), Str: slices.Clone(ev.Str)})
+	}
+	if !timed && !b.Tables {
+		c.batch = c.batch[:0]
+		return nil
+	}
+	return c.flush()
+}
+
+// renumber rewrites the goroutine or P sequence number of ev to continue from
+// the recreated state, whose status events reset them to 0.
+func (c *cutterV2) renumber(ev *encoding.ContextEvent) error {
+	var (
+		seq  int
+		prev uint64
+		ok   bool
+	)
+	switch ev.Type {
+	case encoding.EventV2GoStart, encoding.EventV2GoUnblock,
+		encoding.EventV2GoSwitch, encoding.EventV2GoSwitchDestroy:
+		g, _ := encoding.ArgIndex(c.version, ev.Type, "G")
+		seq, _ = encoding.ArgIndex(c.version, ev.Type, "GSeq")
+		var gs *state.V2G
+		if gs, ok = c.state.Gs[ev.Args[g]]; ok {
+			prev = gs.Seq
+		}
+	case encoding.EventV2ProcStart, encoding.EventV2ProcSteal:
+		p, _ := encoding.ArgIndex(c.version, ev.Type, "P")
+		seq, _ = encoding.ArgIndex(c.version, ev.Type, "PSeq")
+		var ps *state.V2P
+		if ps, ok = c.state.Ps[ev.Args[p]]; ok {
+			prev = ps.Seq
+		}
+	case encoding.EventV2GoSyscallBegin:
+		seq, _ = encoding.ArgIndex(c.version, ev.Type, "PSeq")
+		var ps *state.V2P
+		if p := c.heldP(ev.M); p >= 0 {
+			if ps, ok = c.state.Ps[uint64(p)]; ok {
+				prev = ps.Seq
+			}
+		}
+	}
+	if !ok {
+		// There is no sequence number, or the goroutine or P only
+		// appears in the window.
+		return nil
+	} else if ev.Args[seq] <= prev {
+		return fmt.Errorf("%v event with sequence number %d in the window, but %d before it", ev.Type, ev.Args[seq], prev)
+	}
+	ev.Args[seq] -= prev
+	return nil
+}
+
+// heldP returns the P held by the M m at the current event of the window in
+// the first generation.
+func (c *cutterV2) heldP(m int64) int64 {
+	p, ok := c.ps[m]
+	if !ok {
+		p = -1
+		if ms, ok := c.state.Ms[m]; ok {
+			p = ms.P
+		}
+	}
+	return p
+}
+
+// updateP updates the P held by the M of ev, which only changes with events
+// of the M itself until the M enters a syscall.
+func (c *cutterV2) updateP(ev *encoding.ContextEvent) error {
+	switch ev.Type {
+	case encoding.EventV2ProcStart:
+		start, err := ev.AsV2ProcStart(c.version)
+		if err != nil {
+			return err
+		}
+		c.ps[ev.M] = int64(start.P)
+	case encoding.EventV2ProcStatus:
+		status, err := ev.AsV2ProcStatus(c.version)
+		if err != nil {
+			return err
+		}
+		if s := state.V2PStatus(status.Status); s == state.V2PRunning || s == state.V2PSyscall {
+			c.ps[ev.M] = int64(status.P)
+		}
+	case encoding.EventV2ProcSteal:
+		steal, err := ev.AsV2ProcSteal(c.version)
+		if err != nil {
+			return err
+		}
+		if int64(steal.M) == ev.M {
+			c.ps[ev.M] = -1
+		}
+	case encoding.EventV2ProcStop, encoding.EventV2GoDestroySyscall:
+		c.ps[ev.M] = -1
+	}
+	return nil
+}
+
+// begin starts a new output batch of the M m in generation gen at the
+// timestamp of the recreated state.
+func (c *cutterV2) begin(gen uint64, m int64) {
+	c.batch = append(c.batch[:0], encoding.Event{Type: encoding.EventV2Batch, Args: []uint64{gen, uint64(m), c.ticks, 0}})
+}
+
+// add adds an event of type t with the given arguments to the output batch.
+func (c *cutterV2) add(t encoding.EventType, args ...uint64) {
+	c.batch = append(c.batch, encoding.Event{Type: t, Args: args})
+}
+
+// flush writes the output batch with its length if it has any events.
+func (c *cutterV2) flush() error {
+	defer func() { c.batch = c.batch[:0] }()
+	if len(c.batch) <= 1 {
+		return nil
+	}
+	var length int
+	for i := range c.batch[1:] {
+		length += encoding.EncodedSize(c.version, &c.batch[1+i])
+	}
+	c.batch[0].Args[3] = uint64(length)
+	for i := range c.batch {
+		if err := c.enc.Encode(&c.batch[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
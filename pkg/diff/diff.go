@@ -0,0 +1,300 @@
+// Package diff compares the events of two traces, e.g. to check that a tool
+// that rewrites traces only changes what it's supposed to change.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"slices"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+// Kind is the kind of a difference.
+type Kind int
+
+const (
+	// Removed means that an event of the first trace is missing in the
+	// second one.
+	Removed Kind = iota
+	// Inserted means that an event of the second trace is missing in the
+	// first one.
+	Inserted
+	// Changed means that an event has different arguments or a different
+	// string in the second trace.
+	Changed
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case Removed:
+		return "removed"
+	case Inserted:
+		return "inserted"
+	case Changed:
+		return "changed"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Event is an event of one of the compared traces.
+type Event struct {
+	encoding.Event
+	// Index is the index of the event in its trace.
+	Index int
+	// Offset is the byte offset of the event in its trace.
+	Offset int64
+}
+
+// String returns the offset, index, type, args and string of the event.
+func (e *Event) String() string {
+	s := fmt.Sprintf("offset %d, event %d: %v %v", e.Offset, e.Index, e.Type, e.Args)
+	if e.Str != nil {
+		s += fmt.Sprintf(" %q", e.Str)
+	}
+	return s
+}
+
+// Diff is a difference between the traces.
+type Diff struct {
+	Kind Kind
+	// A is the event of the first trace, it's nil for inserted events.
+	A *Event
+	// B is the event of the second trace, it's nil for removed events.
+	B *Event
+}
+
+// String returns the diff prefixed with "-" for removed and "+" for inserted
+// events. Changed events take two lines prefixed with "<" for the event of
+// the first trace and ">" for the one of the second trace.
+func (d Diff) String() string {
+	switch d.Kind {
+	case Removed:
+		return "- " + d.A.String()
+	case Inserted:
+		return "+ " + d.B.String()
+	}
+	return "< " + d.A.String() + "\n> " + d.B.String()
+}
+
+// Result is the result of comparing two traces.
+type Result struct {
+	// Diffs are the differences in the order of the events.
+	Diffs []Diff
+	// Equal is the number of events that are the same in both traces.
+	Equal int
+	// Removed, Inserted and Changed are the number of diffs of each kind.
+	Removed  int
+	Inserted int
+	Changed  int
+}
+
+// Raw compares the events of the traces read from a and b. The events are
+// aligned so that as many of them as possible are equal. The remaining events
+// are aligned by type, events of the same type that have different arguments
+// or strings are reported as changed and the others as removed or inserted.
+// Both traces must have the same version.
+func Raw(a, b io.Reader) (*Result, error) {
+	aEvents, aVersion, err := readEvents(a)
+	if err != nil {
+		return nil, fmt.Errorf("first trace: %w", err)
+	}
+	bEvents, bVersion, err := readEvents(b)
+	if err != nil {
+		return nil, fmt.Errorf("second trace: %w", err)
+	}
+	if aVersion != bVersion {
+		return nil, fmt.Errorf("can't compare traces of version %d and %d", aVersion, bVersion)
+	}
+
+	// Hash the events to speed up the comparisons
+	seed := maphash.MakeSeed()
+	aHashes, bHashes := hashEvents(seed, aEvents), hashEvents(seed, bEvents)
+	equal := func(i, j int) bool {
+		return aHashes[i] == bHashes[j] && equalEvents(&aEvents[i].Event, &bEvents[j].Event)
+	}
+	sameType := func(i, j int) bool {
+		return aEvents[i].Type == bEvents[j].Type
+	}
+
+	res := &Result{}
+	// gap adds the diffs for the events between two equal ones
+	gap := func(a0, a1, b0, b1 int) {
+		i, j := a0, b0
+		pair := func(x, y int) {
+			for ; i < x; i++ {
+				res.add(Diff{Kind: Removed, A: &aEvents[i]})
+			}
+			for ; j < y; j++ {
+				res.add(Diff{Kind: Inserted, B: &bEvents[j]})
+			}
+			res.add(Diff{Kind: Changed, A: &aEvents[x], B: &bEvents[y]})
+			i, j = x+1, y+1
+		}
+		align(a0, a1, b0, b1, sameType, pair)
+		for ; i < a1; i++ {
+			res.add(Diff{Kind: Removed, A: &aEvents[i]})
+		}
+		for ; j < b1; j++ {
+			res.add(Diff{Kind: Inserted, B: &bEvents[j]})
+		}
+	}
+	var i, j int
+	align(0, len(aEvents), 0, len(bEvents), equal, func(x, y int) {
+		gap(i, x, j, y)
+		res.Equal++
+		i, j = x+1, y+1
+	})
+	gap(i, len(aEvents), j, len(bEvents))
+	return res, nil
+}
+
+// add appends d to the diffs and counts it.
+func (r *Result) add(d Diff) {
+	r.Diffs = append(r.Diffs, d)
+	switch d.Kind {
+	case Removed:
+		r.Removed++
+	case Inserted:
+		r.Inserted++
+	case Changed:
+		r.Changed++
+	}
+}
+
+// readEvents decodes all events of the trace read from r.
+func readEvents(r io.Reader) ([]Event, int, error) {
+	var (
+		dec    = encoding.NewDecoder(r)
+		events []Event
+	)
+	for {
+		// The offset is 0 until the 16 byte header has been read
+		ev := Event{Index: len(events), Offset: max(dec.Offset(), 16)}
+		if err := dec.Decode(&ev.Event); err == io.EOF {
+			return events, dec.Version(), nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+		if !encoding.HasData(dec.Version(), ev.Type) {
+			ev.Str = nil
+		}
+		events = append(events, ev)
+	}
+}
+
+// hashEvents returns the hashes of the types, args and strings of events.
+func hashEvents(seed maphash.Seed, events []Event) []uint64 {
+	var h maphash.Hash
+	h.SetSeed(seed)
+	hashes := make([]uint64, len(events))
+	for i, ev := range events {
+		h.Reset()
+		h.WriteByte(byte(ev.Type))
+		for _, arg := range ev.Args {
+			maphash.WriteComparable(&h, arg)
+		}
+		h.Write(ev.Str)
+		hashes[i] = h.Sum64()
+	}
+	return hashes
+}
+
+// equalEvents returns true if a and b have the same type, args and string.
+func equalEvents(a, b *encoding.Event) bool {
+	return a.Type == b.Type && slices.Equal(a.Args, b.Args) && bytes.Equal(a.Str, b.Str)
+}
+
+// align calls match in order for the pairs of indexes of the longest common
+// subsequence of a[a0:a1] and b[b0:b1], where eq reports if a[i] and b[j]
+// are equal. It uses the linear space variant of Myers' O(ND) algorithm, so
+// it's fast if the sequences are similar.
+func align(a0, a1, b0, b1 int, eq func(i, j int) bool, match func(i, j int)) {
+	// Skip the common prefix and suffix
+	for a0 < a1 && b0 < b1 && eq(a0, b0) {
+		match(a0, b0)
+		a0, b0 = a0+1, b0+1
+	}
+	var suffix int
+	for a0 < a1 && b0 < b1 && eq(a1-1, b1-1) {
+		a1, b1, suffix = a1-1, b1-1, suffix+1
+	}
+
+	// Split the rest at the middle snake of an optimal path. If neither is
+	// empty, at least two edits are needed, so both halves are smaller.
+	if a0 < a1 && b0 < b1 {
+		x, y, u, v := middleSnake(a0, a1, b0, b1, eq)
+		align(a0, x, b0, y, eq, match)
+		for i := 0; i < u-x; i++ {
+			match(x+i, y+i)
+		}
+		align(u, a1, v, b1, eq, match)
+	}
+
+	for i := 0; i < suffix; i++ {
+		match(a1+i, b1+i)
+	}
+}
+
+// middleSnake returns the start (x, y) and end (u, v) of the diagonal in the
+// middle of an optimal path from (a0, b0) to (a1, b1) by searching forward
+// from the start and backward from the end at the same time.
+func middleSnake(a0, a1, b0, b1 int, eq func(i, j int) bool) (x, y, u, v int) {
+	var (
+		n, m  = a1 - a0, b1 - b0
+		delta = n - m
+		odd   = delta&1 != 0
+		limit = (n+m+1)/2 + 1
+		// forward and backward hold the furthest x of the paths per
+		// diagonal k at forward[k+limit], backward paths are measured from
+		// the end.
+		forward  = make([]int, 2*limit+1)
+		backward = make([]int, 2*limit+1)
+	)
+	for d := 0; d < limit; d++ {
+		// Extend the forward paths with d edits
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[k-1+limit] < forward[k+1+limit]) {
+				x = forward[k+1+limit]
+			} else {
+				x = forward[k-1+limit] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && eq(a0+x, b0+y) {
+				x, y = x+1, y+1
+			}
+			forward[k+limit] = x
+			// Check if the path overlaps the backward path with d-1 edits
+			// on the same diagonal
+			if odd && k >= delta-(d-1) && k <= delta+(d-1) && x+backward[delta-k+limit] >= n {
+				return a0 + sx, b0 + sy, a0 + x, b0 + y
+			}
+		}
+		// Extend the backward paths with d edits
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[k-1+limit] < backward[k+1+limit]) {
+				x = backward[k+1+limit]
+			} else {
+				x = backward[k-1+limit] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && eq(a1-1-x, b1-1-y) {
+				x, y = x+1, y+1
+			}
+			backward[k+limit] = x
+			// Check if the path overlaps the forward path with d edits on
+			// the same diagonal
+			if !odd && delta-k >= -d && delta-k <= d && x+forward[delta-k+limit] >= n {
+				return a1 - x, b1 - y, a1 - sx, b1 - sy
+			}
+		}
+	}
+	panic("diff: no middle snake")
+}
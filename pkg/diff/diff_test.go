@@ -0,0 +1,185 @@
+package diff
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felixge/traceutils/pkg/anonymize"
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRawEqual tests that the traces in testdata have no differences to
+// themselves.
+func TestRawEqual(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "testdata", "*", "*.trace"))
+	require.NoError(t, err)
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			res, err := Raw(bytes.NewReader(data), bytes.NewReader(data))
+			require.NoError(t, err)
+			require.Empty(t, res.Diffs)
+			require.Positive(t, res.Equal)
+		})
+	}
+}
+
+// TestRaw tests the diffs of modified events.
+func TestRaw(t *testing.T) {
+	data := readTrace(t, "1.21", "task.trace")
+	events := decodeEvents(t, data)
+
+	// Remove the second EventGoCreate, change the second EventString and
+	// insert an EventHeapAlloc after the second EventBatch
+	modified := append([]encoding.Event(nil), events...)
+	goCreate := indexOf(events, encoding.EventGoCreate, 1)
+	str := indexOf(events, encoding.EventString, 1)
+	batch := indexOf(events, encoding.EventBatch, 1)
+	modified[str].Str = []byte("changed")
+	heapAlloc := encoding.Event{Type: encoding.EventHeapAlloc, Args: []uint64{0, 1234}}
+	modified = append(modified[:batch+1], append([]encoding.Event{heapAlloc}, modified[batch+1:]...)...)
+	modified = append(modified[:goCreate+1], modified[goCreate+2:]...)
+	require.Less(t, batch, goCreate)
+	require.Less(t, goCreate, str)
+
+	res, err := Raw(bytes.NewReader(data), bytes.NewReader(encodeEvents(t, modified)))
+	require.NoError(t, err)
+	require.Len(t, res.Diffs, 3)
+	require.Equal(t, Inserted, res.Diffs[0].Kind)
+	require.Equal(t, batch+1, res.Diffs[0].B.Index)
+	require.Equal(t, heapAlloc.Args, res.Diffs[0].B.Args)
+	require.Equal(t, Removed, res.Diffs[1].Kind)
+	require.Equal(t, goCreate, res.Diffs[1].A.Index)
+	require.Equal(t, Changed, res.Diffs[2].Kind)
+	require.Equal(t, str, res.Diffs[2].A.Index)
+	require.Equal(t, str, res.Diffs[2].B.Index)
+	require.Equal(t, "changed", string(res.Diffs[2].B.Str))
+	require.Equal(t, len(events)-2, res.Equal)
+	require.Equal(t, 1, res.Inserted)
+	require.Equal(t, 1, res.Removed)
+	require.Equal(t, 1, res.Changed)
+}
+
+// TestRawAnonymize tests that anonymizing a trace only changes strings.
+func TestRawAnonymize(t *testing.T) {
+	data := readTrace(t, "1.21", "task.trace")
+	var anonymized bytes.Buffer
+	require.NoError(t, anonymize.AnonymizeTrace(bytes.NewReader(data), &anonymized))
+
+	res, err := Raw(bytes.NewReader(data), &anonymized)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Diffs)
+	for _, d := range res.Diffs {
+		require.Equal(t, Changed, d.Kind, d.String())
+		require.Contains(t, []encoding.EventType{encoding.EventString, encoding.EventUserLog}, d.A.Type, d.String())
+		require.Equal(t, d.A.Args, d.B.Args)
+	}
+}
+
+func TestRawVersions(t *testing.T) {
+	a := readTrace(t, "1.21", "task.trace")
+	b := readTrace(t, "1.25", "test-encoding-json.trace")
+	_, err := Raw(bytes.NewReader(a), bytes.NewReader(b))
+	require.EqualError(t, err, "can't compare traces of version 1021 and 1025")
+}
+
+// TestAlign compares the length of the alignment of random sequences with
+// the length of their longest common subsequence.
+func TestAlign(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for n := 0; n < 500; n++ {
+		a := randomSeq(rng, rng.IntN(30))
+		b := randomSeq(rng, rng.IntN(30))
+		eq := func(i, j int) bool { return a[i] == b[j] }
+
+		var pairs int
+		lastI, lastJ := -1, -1
+		align(0, len(a), 0, len(b), eq, func(i, j int) {
+			require.True(t, i > lastI && j > lastJ, "pairs out of order")
+			require.Equal(t, a[i], b[j])
+			lastI, lastJ = i, j
+			pairs++
+		})
+		require.Equal(t, lcsLength(a, b), pairs, "a=%s b=%s", a, b)
+	}
+}
+
+// randomSeq returns a random sequence of n letters out of a small alphabet.
+func randomSeq(rng *rand.Rand, n int) string {
+	seq := make([]byte, n)
+	for i := range seq {
+		seq[i] = "abc"[rng.IntN(3)]
+	}
+	return string(seq)
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b.
+func lcsLength(a, b string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				dp[i][j] = dp[i-1][j-1] + 1
+			} else {
+				dp[i][j] = max(dp[i-1][j], dp[i][j-1])
+			}
+		}
+	}
+	return dp[len(a)][len(b)]
+}
+
+// readTrace reads a trace from the testdata directory.
+func readTrace(t *testing.T, goVersion, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", goVersion, name))
+	require.NoError(t, err)
+	return data
+}
+
+// decodeEvents decodes all events of a 1.21 trace.
+func decodeEvents(t *testing.T, data []byte) []encoding.Event {
+	var events []encoding.Event
+	dec := encoding.NewDecoder(bytes.NewReader(data))
+	for {
+		var ev encoding.Event
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			return events
+		}
+		require.NoError(t, err)
+		events = append(events, ev)
+	}
+}
+
+// encodeEvents encodes events as a 1.21 trace.
+func encodeEvents(t *testing.T, events []encoding.Event) []byte {
+	var out bytes.Buffer
+	enc := encoding.NewEncoderVersion(&out, 1021)
+	for _, ev := range events {
+		require.NoError(t, enc.Encode(&ev))
+	}
+	require.NoError(t, enc.Close())
+	return out.Bytes()
+}
+
+// indexOf returns the index of the nth event of the given type.
+func indexOf(events []encoding.Event, typ encoding.EventType, n int) int {
+	for i, ev := range events {
+		if ev.Type == typ {
+			if n == 0 {
+				return i
+			}
+			n--
+		}
+	}
+	return -1
+}
@@ -0,0 +1,235 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+// bytesPerLine is the number of raw bytes printed per line.
+const bytesPerLine = 16
+
+// Options configures Dump.
+type Options struct {
+	// Start is the offset of the first event that is printed. Events that
+	// start before it are skipped.
+	Start int64
+	// End is the offset after which no more events are printed. 0 means the
+	// end of the trace.
+	End int64
+	// Types are the types of the events that are printed. All events are
+	// printed if Types is empty.
+	Types []encoding.EventType
+}
+
+// Dump prints the raw bytes of the events of the trace of the given size
+// read from r to w, annotated with what they encode. Every event starts
+// with a line that shows its offset, type and, before go 1.22, the argument
+// count bits of its first byte. It's followed by one line per argument,
+// stack frame argument, length and data, e.g.
+//
+//	16  41                                               EventBatch type=1 narg=1 (2 args)
+//	17  00                                                 P=0
+//	18  ee f6 a0 b8 a8 ff 16                               Ts=101131565415278
+//
+// The header of the trace is printed as the first event, unless opts
+// filters it out. If an event can't be decoded, Dump returns the error after
+// printing the events before it.
+func Dump(r io.ReaderAt, size int64, w io.Writer, opts Options) error {
+	var (
+		bw    = bufio.NewWriter(w)
+		dec   = encoding.NewDecoder(io.NewSectionReader(r, 0, size))
+		raw   = bufio.NewReader(io.NewSectionReader(r, 0, size))
+		ev    encoding.Event
+		buf   []byte
+		start int64
+	)
+	defer bw.Flush()
+	for {
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			return bw.Flush()
+		} else if err != nil {
+			bw.Flush()
+			return err
+		}
+		version := dec.Version()
+
+		// Read the raw bytes of the header and the event
+		if start == 0 {
+			buf = slices.Grow(buf[:0], 16)[:16]
+			if _, err := io.ReadFull(raw, buf); err != nil {
+				return err
+			}
+			if match(opts, 0, nil) {
+				d := &dumper{w: bw, offset: 0, raw: buf}
+				d.field(16, "header go %d.%d trace", version/1000, version%1000)
+			}
+			start = 16
+		}
+		end := dec.Offset()
+		buf = slices.Grow(buf[:0], int(end-start))[:end-start]
+		if _, err := io.ReadFull(raw, buf); err != nil {
+			return err
+		}
+
+		if opts.End > 0 && start >= opts.End {
+			return bw.Flush()
+		} else if match(opts, start, &ev) {
+			d := &dumper{w: bw, offset: start, raw: buf, version: version}
+			if err := d.event(&ev); err != nil {
+				bw.Flush()
+				return fmt.Errorf("event at offset %d: %w", start, err)
+			}
+		}
+		start = end
+	}
+}
+
+// match returns true if the event ev at offset is printed. ev is nil for the
+// header of the trace.
+func match(opts Options, offset int64, ev *encoding.Event) bool {
+	if offset < opts.Start || (opts.End > 0 && offset >= opts.End) {
+		return false
+	} else if len(opts.Types) == 0 {
+		return true
+	}
+	return ev != nil && slices.Contains(opts.Types, ev.Type)
+}
+
+// dumper prints the raw bytes of a single event.
+type dumper struct {
+	w       io.Writer
+	version int
+	offset  int64  // offset of the next byte of raw
+	raw     []byte // bytes of the event that are not printed yet
+}
+
+// field prints the next n bytes of the event with a description. The bytes
+// are split into lines of bytesPerLine bytes, the description is printed on
+// the first line.
+func (d *dumper) field(n int, format string, args ...any) {
+	desc := fmt.Sprintf(format, args...)
+	for i := 0; i < n || i == 0; i += bytesPerLine {
+		line := d.raw[i:min(i+bytesPerLine, n)]
+		hex := make([]string, len(line))
+		for j, b := range line {
+			hex[j] = fmt.Sprintf("%02x", b)
+		}
+		fmt.Fprintf(d.w, "%10d  %-*s  %s\n", d.offset+int64(i), bytesPerLine*3-1, strings.Join(hex, " "), desc)
+		desc = ""
+	}
+	d.offset += int64(n)
+	d.raw = d.raw[n:]
+}
+
+// varint prints the next varint of the event and returns its value.
+func (d *dumper) varint(format string, args ...any) (uint64, error) {
+	v, n := binary.Uvarint(d.raw)
+	if n <= 0 {
+		return 0, errors.New("bad varint")
+	}
+	d.field(n, "%s=%d", fmt.Sprintf(format, args...), v)
+	return v, nil
+}
+
+// data prints the length and the bytes of the data of the event. The length
+// has already been printed if it's not -1.
+func (d *dumper) data(length int) error {
+	if length < 0 {
+		v, err := d.varint("  length")
+		if err != nil {
+			return err
+		}
+		length = int(v)
+	}
+	if length > len(d.raw) {
+		return errors.New("data is longer than the event")
+	}
+	d.field(length, "  data=%q", d.raw[:length])
+	return nil
+}
+
+// event prints the event ev whose raw bytes are d.raw.
+func (d *dumper) event(ev *encoding.Event) error {
+	names := encoding.ArgNames(d.version, ev.Type)
+	if d.version >= 1022 {
+		return d.eventV2(ev, names)
+	}
+
+	// The first byte holds the type and the argument count bits. Before go
+	// 1.7 every event had an additional argument that isn't counted.
+	bits := d.raw[0] >> 6
+	nargs := int(bits) + 1
+	if d.version < 1007 {
+		nargs++
+	}
+	if bits == 3 || ev.Type == encoding.EventString {
+		d.field(1, "%v type=%d narg=%d", ev.Type, byte(ev.Type), bits)
+	} else {
+		d.field(1, "%v type=%d narg=%d (%d args)", ev.Type, byte(ev.Type), bits, nargs)
+	}
+
+	switch {
+	case ev.Type == encoding.EventString:
+		if _, err := d.varint("  ID"); err != nil {
+			return err
+		}
+		return d.data(-1)
+	case bits == 3:
+		// The arguments are prefixed with their length in bytes
+		if _, err := d.varint("  args length"); err != nil {
+			return err
+		}
+	}
+	for i := range ev.Args {
+		if _, err := d.varint("  %s", argName(d.version, ev, names, i)); err != nil {
+			return err
+		}
+	}
+	if ev.Type == encoding.EventUserLog {
+		return d.data(-1)
+	}
+	return nil
+}
+
+// eventV2 prints the go 1.22+ event ev whose fixed arguments have the given
+// names.
+func (d *dumper) eventV2(ev *encoding.Event, names []string) error {
+	d.field(1, "%v type=%d", ev.Type, d.raw[0])
+	for i := range ev.Args {
+		if ev.Type == encoding.EventV2ExperimentalBatch && i == 0 {
+			// The experiment id is a single byte
+			d.field(1, "  %s=%d", names[i], d.raw[0])
+		} else if _, err := d.varint("  %s", argName(d.version, ev, names, i)); err != nil {
+			return err
+		}
+	}
+	if ev.Type == encoding.EventV2String || ev.Type == encoding.EventV2ExperimentalBatch {
+		return d.data(-1)
+	}
+	return nil
+}
+
+// argName returns the name of the i-th argument of ev. The arguments after
+// the fixed ones are stack frames for stack events.
+func argName(version int, ev *encoding.Event, names []string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	if ev.Type != encoding.EventStack && ev.Type != encoding.EventV2Stack {
+		return fmt.Sprintf("arg%d", i)
+	}
+	if version < 1007 {
+		// Frames only contain the PC
+		return fmt.Sprintf("frame%d.PC", i-len(names))
+	}
+	frame := (i - len(names)) / 4
+	return fmt.Sprintf("frame%d.%s", frame, []string{"PC", "Func", "File", "Line"}[(i-len(names))%4])
+}
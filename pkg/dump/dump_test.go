@@ -0,0 +1,96 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDump tests that every byte of the traces in testdata is printed exactly
+// once and in order.
+func TestDump(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "testdata", "*", "*.trace"))
+	require.NoError(t, err)
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			var out bytes.Buffer
+			require.NoError(t, Dump(bytes.NewReader(data), int64(len(data)), &out, Options{}))
+
+			var offset int64
+			for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+				lineOffset, raw := parseLine(t, line)
+				require.Equal(t, offset, lineOffset, line)
+				require.Equal(t, data[offset:offset+int64(len(raw))], raw, line)
+				offset += int64(len(raw))
+			}
+			require.Equal(t, int64(len(data)), offset)
+		})
+	}
+}
+
+func TestDumpOptions(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.21", "task.trace"))
+	require.NoError(t, err)
+	dump := func(opts Options) string {
+		var out bytes.Buffer
+		require.NoError(t, Dump(bytes.NewReader(data), int64(len(data)), &out, opts))
+		return out.String()
+	}
+
+	t.Run("Offsets", func(t *testing.T) {
+		out := dump(Options{Start: 25, End: 30})
+		require.Equal(t, strings.Join([]string{
+			"        25  45                                               EventProcStart type=5 narg=1 (2 args)",
+			"        26  10                                                 TsDelta=16",
+			"        27  04                                                 Thread=4",
+			"        28  06                                               EventProcStop type=6 narg=0 (1 args)",
+			"        29  1f                                                 TsDelta=31",
+			"",
+		}, "\n"), out)
+	})
+
+	t.Run("Types", func(t *testing.T) {
+		out := dump(Options{Types: []encoding.EventType{encoding.EventUserLog}})
+		require.NotContains(t, out, "header")
+		require.NotContains(t, out, "EventBatch")
+		require.Contains(t, out, "EventUserLog type=48 narg=3")
+		require.Contains(t, out, "data=\"")
+	})
+}
+
+// TestDumpV2 tests the output for the fields that are special to go 1.22+
+// traces.
+func TestDumpV2(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.25", "test-encoding-json.trace"))
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, Dump(bytes.NewReader(data), int64(len(data)), &out, Options{End: 45}))
+	require.Equal(t, strings.Join([]string{
+		"         0  67 6f 20 31 2e 32 35 20 74 72 61 63 65 00 00 00  header go 1.25 trace",
+		"        16  01                                               EventV2Batch type=1",
+		"        17  01                                                 Gen=1",
+		"        18  ff ff ff ff ff ff ff ff ff 01                      M=18446744073709551615",
+		"        28  b2 dd 8e 8d c1 a8 09                               Ts=40974283943602",
+		"        35  9a 80 80 80 80 80 80 80 80 00                      Size=26",
+		"",
+	}, "\n"), out.String())
+}
+
+// parseLine returns the offset and the raw bytes of a line printed by Dump.
+func parseLine(t *testing.T, line string) (int64, []byte) {
+	offset, err := strconv.ParseInt(strings.TrimSpace(line[:10]), 10, 64)
+	require.NoError(t, err, line)
+	raw, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(line[12:12+bytesPerLine*3-1]), " ", ""))
+	require.NoError(t, err, line)
+	return offset, raw
+}
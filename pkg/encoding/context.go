@@ -0,0 +1,498 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// ContextEvent is a raw event together with the context that is needed to
+// interpret it.
+type ContextEvent struct {
+	Event
+	// Ts is the absolute timestamp of the event in nanoseconds. It's 0 for
+	// events without a timestamp, e.g. EventStack or EventString.
+	Ts int64
+	// Ticks is the absolute timestamp of the event in ticks of the trace
+	// clock, see ContextDecoder.Frequency. It's 0 like Ts.
+	Ticks uint64
+	// M is the id of the thread that recorded the event or -1. Only go 1.22+
+	// traces contain thread ids.
+	M int64
+	// P is the id of the P the event belongs to or -1 if there is none.
+	P int64
+	// G is the id of the goroutine that was running on P (or M for go 1.22+
+	// traces) when the event happened or 0 if there is none.
+	G uint64
+	// Stack is the resolved stack of the event or nil if the event has no
+	// stack.
+	Stack []StackFrame
+	// Strings contains the resolved string arguments of the event keyed by
+	// the name of the argument in the typed view of the event, e.g. "Name"
+	// for an EventUserRegion.
+	Strings map[string]string
+}
+
+// StackFrame is a resolved stack frame. Before go 1.7 frames only contained
+// the PC.
+type StackFrame struct {
+	PC   uint64
+	Func string
+	File string
+	Line uint64
+}
+
+// ContextDecoder decodes events like Decoder, but keeps track of the state
+// of the trace to give each event an absolute timestamp, P, G and resolved
+// string and stack arguments. The events are returned in the order in which
+// they appear in the trace. This is the order of the events within each
+// batch, but the batches of different Ps (or Ms) are not sorted by time.
+type ContextDecoder struct {
+	r     io.ReadSeeker
+	dec   *Decoder
+	err   error
+	start int64  // position of r when Decode was first called
+	idx   *Index // optional index of the trace
+
+	freq    uint64                    // ticks per second
+	strings map[tableKey]string       // string table
+	stacks  map[tableKey][]uint64     // frame args of the stack table
+	frames  map[tableKey][]StackFrame // resolved stacks
+
+	gen uint64            // current generation (go 1.22+)
+	ts  uint64            // timestamp of the last event in ticks
+	m   int64             // current M (go 1.22+)
+	p   int64             // current P (before go 1.22)
+	gs  map[int64]uint64  // goroutine running on each P (before go 1.22)
+	ms  map[int64]*mState // state of each M (go 1.22+)
+}
+
+// tableKey identifies an entry in the string or stack table. Go 1.22+
+// traces have separate tables for every generation, older traces only have
+// generation 0.
+type tableKey struct {
+	gen uint64
+	id  uint64
+}
+
+// mState is the state of an M in a go 1.22+ trace.
+type mState struct {
+	p int64  // P held by the M or -1
+	g uint64 // goroutine running on the M or 0
+}
+
+// Goroutine and P states of go 1.22+ traces. This is copied from
+// src/internal/trace/tracev2/events.go in the Go source tree.
+const (
+	goRunning   = 2
+	goSyscall   = 3
+	procRunning = 1
+	procSyscall = 3
+)
+
+// NewContextDecoder returns a new context decoder that reads from r. The
+// frequency, strings and stacks of a trace may appear after the events that
+// need them, so the first call to Decode reads the whole trace and seeks
+// back to the current position of r.
+func NewContextDecoder(r io.ReadSeeker) *ContextDecoder {
+	return &ContextDecoder{
+		r:       r,
+		strings: make(map[tableKey]string),
+		stacks:  make(map[tableKey][]uint64),
+		frames:  make(map[tableKey][]StackFrame),
+		m:       -1,
+		p:       -1,
+		gs:      make(map[int64]uint64),
+		ms:      make(map[int64]*mState),
+	}
+}
+
+// SetIndex sets the index of the trace that is used to read only the string
+// and stack tables instead of the whole trace and enables Seek. It must be
+// called before the first call to Decode or Seek.
+func (d *ContextDecoder) SetIndex(idx *Index) {
+	d.idx = idx
+}
+
+// Decode decodes the next event and its context into ev or returns an error.
+// It returns io.EOF when there are no more events, or no more events in the
+// batch after a call to Seek.
+func (d *ContextDecoder) Decode(ev *ContextEvent) error {
+	if err := d.init(); err != nil {
+		return err
+	}
+
+	if err := d.dec.Decode(&ev.Event); err != nil {
+		return err
+	}
+
+	// Reset the context of the event
+	ev.Ts, ev.Ticks, ev.M, ev.P, ev.G, ev.Stack = 0, 0, -1, -1, 0, nil
+	clear(ev.Strings)
+
+	// All events with a relative timestamp are relative to the previous
+	// event in the same batch.
+	version := d.dec.Version()
+	if tsDelta, ok := ev.TsDelta(version); ok {
+		d.ts += tsDelta
+		d.setTs(ev, d.ts)
+	}
+
+	// Update the state of the trace
+	var err error
+	if version >= 1022 {
+		err = d.updateV2(version, ev)
+	} else {
+		err = d.updateV1(version, ev)
+	}
+	if err != nil {
+		return err
+	}
+
+	d.resolve(version, ev)
+	return nil
+}
+
+// Seek positions the decoder at the start of the batch b from the index set
+// with SetIndex. Subsequent calls to Decode return the events of b followed
+// by io.EOF. The P and G at the start of the batch are restored from b, but
+// the state of other Ps and Ms isn't, so the context of go 1.22+ events that
+// refer to them, e.g. EventV2ProcSteal, may be incomplete.
+func (d *ContextDecoder) Seek(b IndexBatch) error {
+	if d.idx == nil {
+		return fmt.Errorf("can't seek without an index")
+	} else if err := d.init(); err != nil {
+		return err
+	} else if _, err := d.r.Seek(d.start+b.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Restore the state at the start of the batch. The batch header sets
+	// the rest of it.
+	d.dec = newDecoderAt(io.LimitReader(d.r, b.Size), d.idx.Version, b.Offset)
+	d.gen = b.Gen
+	if d.idx.Version >= 1022 {
+		ms := d.mState(b.M)
+		ms.p, ms.g = b.P, b.G
+	} else {
+		d.gs[b.P] = b.G
+	}
+	return nil
+}
+
+// init reads the tables of the trace when it's called for the first time
+// and returns the first error that occurred.
+func (d *ContextDecoder) init() error {
+	if d.err == nil && d.dec == nil {
+		d.err = d.scan()
+	}
+	return d.err
+}
+
+// Version returns the version of the trace or 0 if Decode hasn't been called
+// yet.
+func (d *ContextDecoder) Version() int {
+	if d.dec == nil {
+		return 0
+	}
+	return d.dec.Version()
+}
+
+// Offset returns the offset of the next event that will be decoded relative
+// to the position of r when Decode was first called.
+func (d *ContextDecoder) Offset() int64 {
+	if d.dec == nil {
+		return 0
+	}
+	return d.dec.Offset()
+}
+
+// String returns the string with the given id. For go 1.22+ traces the
+// string is looked up in the generation of the last decoded event.
+func (d *ContextDecoder) String(id uint64) (string, bool) {
+	s, ok := d.strings[tableKey{d.gen, id}]
+	return s, ok
+}
+
+// Stack returns the stack with the given id or nil if there is no such
+// stack. For go 1.22+ traces the stack is looked up in the generation of the
+// last decoded event. The returned slice must not be modified.
+func (d *ContextDecoder) Stack(id uint64) []StackFrame {
+	key := tableKey{d.gen, id}
+	if frames, ok := d.frames[key]; ok {
+		return frames
+	}
+	args, ok := d.stacks[key]
+	if !ok {
+		return nil
+	}
+
+	n := frameArgs(d.Version())
+	frames := make([]StackFrame, 0, len(args)/n)
+	for i := 0; i+n <= len(args); i += n {
+		frame := StackFrame{PC: args[i]}
+		if n == 4 {
+			frame.Func = d.strings[tableKey{d.gen, args[i+1]}]
+			frame.File = d.strings[tableKey{d.gen, args[i+2]}]
+			frame.Line = args[i+3]
+		}
+		frames = append(frames, frame)
+	}
+	d.frames[key] = frames
+	return frames
+}
+
+// scan reads the frequency, string and stack tables from the trace and
+// creates the decoder for the events.
+func (d *ContextDecoder) scan() error {
+	start, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	d.start = start
+
+	if d.idx != nil {
+		// Only read the batches that contain tables
+		for _, b := range d.idx.Batches {
+			if !b.Tables {
+				continue
+			} else if _, err := d.r.Seek(start+b.Offset, io.SeekStart); err != nil {
+				return err
+			}
+			dec := newDecoderAt(io.LimitReader(d.r, b.Size), d.idx.Version, b.Offset)
+			if err := d.scanTables(dec); err != nil {
+				return err
+			}
+		}
+	} else if err := d.scanTables(NewDecoder(d.r)); err != nil {
+		return err
+	}
+	if d.freq == 0 {
+		return fmt.Errorf("no frequency event")
+	}
+
+	// Go back to the start to decode the events
+	if _, err := d.r.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	d.gen = 0
+	d.dec = NewDecoder(d.r)
+	return nil
+}
+
+// scanTables reads the frequency, string and stack tables from the events
+// returned by dec.
+func (d *ContextDecoder) scanTables(dec *Decoder) error {
+	var ev Event
+	for {
+		if err := dec.Decode(&ev); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch ev.Type {
+		case EventV2Batch:
+			batch, err := ev.AsV2Batch(dec.Version())
+			if err != nil {
+				return err
+			}
+			d.gen = batch.Gen
+		case EventFrequency, EventV2Frequency:
+			// The frequency is the same for all generations
+			if d.freq == 0 {
+				d.freq = ev.Args[0]
+			}
+		case EventString, EventV2String:
+			d.strings[tableKey{d.gen, ev.Args[0]}] = string(ev.Str)
+		case EventStack, EventV2Stack:
+			d.stacks[tableKey{d.gen, ev.Args[0]}] = append([]uint64(nil), ev.Args[2:]...)
+		}
+	}
+}
+
+// updateV1 updates the state for an event of a trace before go 1.22 and sets
+// the context of ev. This follows parseEvents from
+// src/internal/trace/parser.go in the Go source tree.
+func (d *ContextDecoder) updateV1(version int, ev *ContextEvent) error {
+	switch ev.Type {
+	case EventBatch:
+		batch, err := ev.AsBatch(version)
+		if err != nil {
+			return err
+		}
+		// Every batch belongs to one P and has a full timestamp
+		d.p, d.ts = int64(batch.P), batch.Ts
+		d.setTs(ev, batch.Ts)
+	case EventCPUSample:
+		sample, err := ev.AsCPUSample(version)
+		if err != nil {
+			return err
+		}
+		// CPU samples are written by a separate goroutine, the sample itself
+		// knows where and when it was taken.
+		d.setTs(ev, sample.RealTs)
+		ev.P, ev.G = int64(sample.P), sample.G
+		return nil
+	}
+
+	ev.P, ev.G = d.p, d.gs[d.p]
+	switch ev.Type {
+	case EventGoStart, EventGoStartLocal, EventGoStartLabel:
+		g, _ := ev.arg(version, "G")
+		d.gs[d.p], ev.G = g, g
+	case EventGCStart, EventGCDone, EventGCSTWStart, EventGCSTWDone:
+		ev.G = 0
+	case EventGoEnd, EventGoStop, EventGoSched, EventGoPreempt,
+		EventGoSleep, EventGoBlock, EventGoBlockSend, EventGoBlockRecv,
+		EventGoBlockSelect, EventGoBlockSync, EventGoBlockCond, EventGoBlockNet,
+		EventGoSysBlock, EventGoBlockGC:
+		// The goroutine is no longer running after the event
+		d.gs[d.p] = 0
+	case EventGoSysExit, EventGoSysExitLocal, EventGoWaiting, EventGoInSyscall:
+		ev.G, _ = ev.arg(version, "G")
+	}
+	return nil
+}
+
+// updateV2 updates the state for an event of a go 1.22+ trace and sets the
+// context of ev. This is a simplified version of the ordering from
+// src/internal/trace/order.go in the Go source tree.
+func (d *ContextDecoder) updateV2(version int, ev *ContextEvent) error {
+	switch ev.Type {
+	case EventV2Batch:
+		batch, err := ev.AsV2Batch(version)
+		if err != nil {
+			return err
+		}
+		// Every batch belongs to one M and has a full timestamp
+		d.gen, d.m, d.ts = batch.Gen, int64(batch.M), batch.Ts
+		d.setTs(ev, batch.Ts)
+	case EventV2ExperimentalBatch:
+		batch, err := ev.AsV2ExperimentalBatch(version)
+		if err != nil {
+			return err
+		}
+		// The batch data is opaque, so the state isn't affected
+		d.setTs(ev, batch.Ts)
+		ev.M = int64(batch.M)
+		return nil
+	case EventV2CPUSample:
+		sample, err := ev.AsV2CPUSample(version)
+		if err != nil {
+			return err
+		}
+		// CPU samples are written by a separate goroutine, the sample itself
+		// knows where and when it was taken.
+		d.setTs(ev, sample.Ts)
+		ev.M, ev.P, ev.G = int64(sample.M), int64(sample.P), sample.G
+		return nil
+	}
+
+	ms := d.mState(d.m)
+	ev.M, ev.P, ev.G = d.m, ms.p, ms.g
+	switch ev.Type {
+	case EventV2ProcStart:
+		p, _ := ev.arg(version, "P")
+		ms.p = int64(p)
+	case EventV2ProcStop:
+		ms.p = -1
+	case EventV2ProcSteal:
+		steal, err := ev.AsV2ProcSteal(version)
+		if err != nil {
+			return err
+		}
+		if victim := d.ms[int64(steal.M)]; victim != nil && victim.p == int64(steal.P) {
+			victim.p = -1
+		}
+	case EventV2ProcStatus:
+		status, err := ev.AsV2ProcStatus(version)
+		if err != nil {
+			return err
+		}
+		if status.Status == procRunning || status.Status == procSyscall {
+			ms.p = int64(status.P)
+		}
+	case EventV2GoStatus, EventV2GoStatusStack:
+		g, _ := ev.arg(version, "G")
+		m, _ := ev.arg(version, "M")
+		switch status, _ := ev.arg(version, "Status"); status {
+		case goRunning:
+			ms.g = g
+		case goSyscall:
+			// The goroutine may be in a syscall on another M
+			d.mState(int64(m)).g = g
+		}
+	case EventV2GoStart, EventV2GoSwitch, EventV2GoSwitchDestroy:
+		ms.g, _ = ev.arg(version, "G")
+	case EventV2GoCreateSyscall:
+		ms.g, _ = ev.arg(version, "NewG")
+	case EventV2GoStop, EventV2GoBlock, EventV2GoDestroy, EventV2GoSyscallEndBlocked:
+		// The goroutine is no longer running after the event
+		ms.g = 0
+	case EventV2GoDestroySyscall:
+		ms.g, ms.p = 0, -1
+	}
+	return nil
+}
+
+// mState returns the state of the M with the given id.
+func (d *ContextDecoder) mState(m int64) *mState {
+	ms, ok := d.ms[m]
+	if !ok {
+		ms = &mState{p: -1}
+		d.ms[m] = ms
+	}
+	return ms
+}
+
+// resolve sets the stack and strings of ev.
+func (d *ContextDecoder) resolve(version int, ev *ContextEvent) {
+	spec, _ := specFor(version, ev.Type)
+	var i int
+	for _, arg := range spec.args {
+		if !arg.in(version) {
+			continue
+		}
+		id := ev.Args[i]
+		i++
+
+		switch {
+		case arg.ref == refStack && arg.name == "Stack":
+			ev.Stack = d.Stack(id)
+		case arg.ref == refString:
+			if s, ok := d.String(id); ok {
+				if ev.Strings == nil {
+					ev.Strings = make(map[string]string)
+				}
+				ev.Strings[arg.name] = s
+			}
+		}
+	}
+}
+
+// Frequency returns the frequency of the trace clock in ticks per second or 0
+// if the trace has no frequency.
+func (d *ContextDecoder) Frequency() uint64 {
+	d.init()
+	return d.freq
+}
+
+// setTs sets the timestamp of ev to ticks.
+func (d *ContextDecoder) setTs(ev *ContextEvent, ticks uint64) {
+	ev.Ticks, ev.Ts = ticks, d.nanos(ticks)
+}
+
+// nanos converts a timestamp from ticks to nanoseconds.
+func (d *ContextDecoder) nanos(ticks uint64) int64 {
+	hi, lo := bits.Mul64(ticks, 1e9)
+	if hi >= d.freq {
+		return math.MaxInt64
+	}
+	ns, _ := bits.Div64(hi, lo, d.freq)
+	if ns > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(ns)
+}
@@ -0,0 +1,192 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felixge/traceutils/internal/tracetest"
+	"github.com/stretchr/testify/require"
+	exptrace "golang.org/x/exp/trace"
+	"honnef.co/go/gotraceui/trace"
+)
+
+// goCreate is the context of a goroutine creation.
+type goCreate struct {
+	Ts int64
+	P  int64
+	G  int64
+}
+
+// TestContextDecoderV1 checks that the context of goroutine creations
+// matches the one computed by gotraceui's parser.
+func TestContextDecoderV1(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
+	require.NoError(t, err)
+
+	// Collect the goroutine creations seen by gotraceui
+	parsed, err := trace.Parse(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	want := map[uint64]goCreate{}
+	for _, ev := range parsed.Events {
+		if ev.Type == trace.EvGoCreate {
+			want[ev.Args[0]] = goCreate{Ts: int64(ev.Ts), P: int64(ev.P), G: int64(ev.G)}
+		}
+	}
+	require.NotEmpty(t, want)
+
+	// Collect the goroutine creations seen by the context decoder
+	got := map[uint64]goCreate{}
+	minTs := int64(-1)
+	dec := NewContextDecoder(bytes.NewReader(data))
+	for {
+		var ev ContextEvent
+		if err := dec.Decode(&ev); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+		if _, ok := ev.TsDelta(dec.Version()); ok && (minTs == -1 || ev.Ts < minTs) {
+			minTs = ev.Ts
+		}
+		if ev.Type == EventGoCreate {
+			create, err := ev.AsGoCreate(dec.Version())
+			require.NoError(t, err)
+			require.Len(t, ev.Stack, len(dec.Stack(create.Stack)))
+			got[create.NewG] = goCreate{Ts: ev.Ts, P: ev.P, G: int64(ev.G)}
+		}
+	}
+
+	// gotraceui uses timestamps relative to the first event and converts
+	// them using floating point math, allow for rounding differences.
+	require.Len(t, got, len(want))
+	for g, w := range want {
+		c := got[g]
+		require.InDelta(t, w.Ts, c.Ts-minTs, 1, "goroutine %d", g)
+		require.Equal(t, w.P, c.P, "goroutine %d", g)
+		require.Equal(t, w.G, c.G, "goroutine %d", g)
+	}
+}
+
+// TestContextDecoderV2 checks that the context of goroutine creations
+// matches the one computed by x/exp/trace.
+func TestContextDecoderV2(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.25", "test-encoding-json.trace"))
+	require.NoError(t, err)
+
+	// Collect the goroutine creations seen by x/exp/trace
+	want := map[uint64]goCreate{}
+	for _, ev := range tracetest.ReadEvents(t, data) {
+		if ev.Kind() != exptrace.EventStateTransition {
+			continue
+		}
+		st := ev.StateTransition()
+		if st.Resource.Kind != exptrace.ResourceGoroutine {
+			continue
+		} else if from, _ := st.Goroutine(); from != exptrace.GoNotExist {
+			continue
+		}
+		want[uint64(st.Resource.Goroutine())] = goCreate{
+			Ts: int64(ev.Time()),
+			P:  int64(ev.Proc()),
+			G:  int64(ev.Goroutine()),
+		}
+	}
+	require.NotEmpty(t, want)
+
+	// Collect the goroutine creations seen by the context decoder
+	got := map[uint64]goCreate{}
+	dec := NewContextDecoder(bytes.NewReader(data))
+	for {
+		var ev ContextEvent
+		if err := dec.Decode(&ev); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+		switch ev.Type {
+		case EventV2GoCreate, EventV2GoCreateBlocked, EventV2GoCreateSyscall:
+			newG, _ := ev.arg(dec.Version(), "NewG")
+			g := int64(ev.G)
+			if g == 0 {
+				g = int64(exptrace.NoGoroutine)
+			}
+			got[newG] = goCreate{Ts: ev.Ts, P: ev.P, G: g}
+		case EventV2UserRegionBegin:
+			require.NotEmpty(t, ev.Strings["Name"])
+			require.NotEmpty(t, ev.Stack)
+			require.NotEmpty(t, ev.Stack[0].Func)
+			require.NotEmpty(t, ev.Stack[0].File)
+		}
+	}
+
+	// x/exp/trace converts timestamps using floating point math, allow for
+	// rounding differences.
+	require.Len(t, got, len(want))
+	for g, w := range want {
+		c := got[g]
+		require.InDelta(t, w.Ts, c.Ts, 1, "goroutine %d", g)
+		require.Equal(t, w.P, c.P, "goroutine %d", g)
+		require.Equal(t, w.G, c.G, "goroutine %d", g)
+	}
+}
+
+// TestContextDecoderStrings checks that strings and stacks of old traces are
+// resolved.
+func TestContextDecoderStrings(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+		Type      EventType
+		Strings   map[string]string
+	}{
+		{"1.21", "task.trace", EventUserTaskCreate, map[string]string{"Name": "taskCategory"}},
+		{"1.21", "task.trace", EventUserLog, map[string]string{"Key": "logCategory"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace+"/"+test.Type.String(), func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+
+			dec := NewContextDecoder(bytes.NewReader(data))
+			for {
+				var ev ContextEvent
+				if err := dec.Decode(&ev); err != nil {
+					require.Equal(t, io.EOF, err)
+					t.Fatalf("no %v event", test.Type)
+				}
+				if ev.Type == test.Type {
+					require.Equal(t, test.Strings, ev.Strings)
+					require.NotEmpty(t, ev.Stack)
+					require.NotEmpty(t, ev.Stack[0].Func)
+					return
+				}
+			}
+		})
+	}
+}
+
+// TestContextDecoderPC checks that stacks of go 1.5 and 1.6 traces which
+// only contain PCs are resolved.
+func TestContextDecoderPC(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.6", "simple.trace"))
+	require.NoError(t, err)
+
+	var stacks int
+	dec := NewContextDecoder(bytes.NewReader(data))
+	for {
+		var ev ContextEvent
+		if err := dec.Decode(&ev); err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+		require.Empty(t, ev.Strings)
+		if len(ev.Stack) > 0 {
+			stacks++
+			require.NotZero(t, ev.Stack[0].PC)
+			require.Empty(t, ev.Stack[0].Func)
+		}
+	}
+	require.NotZero(t, stacks)
+}
@@ -3,8 +3,11 @@ package encoding
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
+	"slices"
 )
 
 // Decoder decodes runtime/trace events from a reader.
@@ -14,23 +17,25 @@ type Decoder struct {
 	readHeader bool
 	args       []byte // scratch buf
 	version    int
+	limits     Limits
+	start      int64 // offset of the current event
 }
 
 // NewDecoder returns a new decoder that reads from r.
-// Only supporting go 1.19 traces for now.
+// Supports traces produced by go 1.5 and later.
 func NewDecoder(r io.Reader) *Decoder {
-	p := &Decoder{in: newReader(r)}
+	p := &Decoder{in: newReader(r), limits: DefaultLimits}
 	return p
 }
 
-// header is the trace file header.
-var header = func() []byte {
-	header := make([]byte, 16)
-	// Only supporting go 1.19 traces for now
-	// TODO: support older traces
-	copy(header, "go 1.19 trace")
-	return header
-}()
+// newDecoderAt returns a new decoder that reads the events of a trace of the
+// given version from r, which is positioned at offset in the trace. It's
+// used to decode individual batches of an indexed trace.
+func newDecoderAt(r io.Reader, version int, offset int64) *Decoder {
+	d := NewDecoder(r)
+	d.readHeader, d.version, d.in.Offset = true, version, offset
+	return d
+}
 
 // header reads the header and returns an error if it is invalid.
 func (d *Decoder) header() error {
@@ -44,15 +49,23 @@ func (d *Decoder) header() error {
 	} else {
 		d.version = version
 	}
-	switch d.version {
-	case 1019, 1021:
-		break
-	default:
+	if !supportedVersion(d.version) {
 		return fmt.Errorf("unsupported trace file version %v.%v %v", d.version/1000, d.version%1000, d.version)
 	}
 	return nil
 }
 
+// supportedVersion returns true if traces of the given version can be decoded
+// and encoded.
+func supportedVersion(version int) bool {
+	switch version {
+	case 1005, 1007, 1008, 1009, 1010, 1011, 1019, 1021, 1022, 1023, 1025, 1026:
+		return true
+	default:
+		return false
+	}
+}
+
 // parseHeader parses trace header of the form "go 1.7 trace\x00\x00\x00\x00"
 // and returns parsed version as 1007.
 //
@@ -89,15 +102,55 @@ func (d *Decoder) Version() int {
 	return d.version
 }
 
-// Decode parses an event or returns an error.
+// SetLimits sets the limits for decoding a single event. The default is
+// DefaultLimits.
+func (d *Decoder) SetLimits(limits Limits) {
+	d.limits = limits
+}
+
+// Decode parses an event or returns an error. It returns io.EOF if there are
+// no more events. Errors for malformed traces are of type *DecodeError, a
+// trace that ends in the middle of an event returns io.ErrUnexpectedEOF.
 func (d *Decoder) Decode(e *Event) error {
 	if !d.readHeader {
-		if err := d.header(); err != nil {
+		if err := d.header(); err == io.EOF {
 			return err
+		} else if err != nil {
+			return &DecodeError{Offset: 0, Err: err}
 		}
 		d.readHeader = true
 	}
 
+	// Decode the event
+	d.start = d.in.Offset
+	var err error
+	if d.version >= 1022 {
+		// go 1.22+ traces use a different encoding
+		err = d.decodeV2(e)
+	} else {
+		err = d.decodeV1(e)
+	}
+	if err == nil {
+		// Check the number of arguments
+		if err = checkEvent(d.version, e); err != nil {
+			err = fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+		}
+	}
+
+	if err == nil {
+		return nil
+	} else if err == io.EOF && d.in.Offset == d.start {
+		// The trace ended after the last event
+		return err
+	} else if err == io.EOF {
+		// The trace ended in the middle of an event
+		err = io.ErrUnexpectedEOF
+	}
+	return &DecodeError{Offset: d.start, Err: err}
+}
+
+// decodeV1 parses a pre go 1.22 event or returns an error.
+func (d *Decoder) decodeV1(e *Event) error {
 	// Read event type and argument count contained in the first byte
 	firstByte, err := d.in.ReadByte()
 	if err != nil {
@@ -110,8 +163,20 @@ func (d *Decoder) Decode(e *Event) error {
 	e.Args = e.Args[:0]
 	e.Str = e.Str[:0]
 	d.args = d.args[:0]
-	// Decode argument count
+
+	// Check that the event type exists in this version
+	if _, ok := specV1(d.version, e.Type); !ok {
+		return fmt.Errorf("%w %d", ErrInvalidEventType, e.Type)
+	}
+
+	// Decode argument count. Before go 1.7 every event had an additional
+	// argument, so one more argument is inlined.
 	narg := firstByte>>6 + 1
+	inlineArgs := byte(4)
+	if d.version < 1007 {
+		narg++
+		inlineArgs++
+	}
 
 	// Read string event
 	if e.Type == EventString {
@@ -121,22 +186,13 @@ func (d *Decoder) Decode(e *Event) error {
 			return err
 		}
 		e.Args = append(e.Args, id)
-		// Read string length
-		length, err := readVal(d.in)
-		if err != nil {
-			return err
-		}
-		// Allocate e.Str of the correct length
-		for i := uint64(0); i < length; i++ {
-			e.Str = append(e.Str, 0)
-		}
 		// Read string into e.Str
-		if _, err := io.ReadFull(d.in, e.Str); err != nil {
+		if err := d.readData(e); err != nil {
 			return err
 		}
-	} else if narg < 4 {
-		// If the number of arguments is less than 4, the arguments directly
-		// follow the first byte as base-128 varints.
+	} else if narg < inlineArgs {
+		// If the number of arguments is less than inlineArgs, the arguments
+		// directly follow the first byte as base-128 varints.
 		for i := 0; i < int(narg); i++ {
 			// Read argument and add it to e.Args
 			arg, err := readVal(d.in)
@@ -146,19 +202,18 @@ func (d *Decoder) Decode(e *Event) error {
 			e.Args = append(e.Args, arg)
 		}
 	} else {
-		// If the number of arguments is greater than 3, the arguments are
-		// encoded as a base-128 varint length followed by a byte slice of
-		// base-128 varints.
+		// Otherwise the arguments are encoded as a base-128 varint length
+		// followed by a byte slice of base-128 varints.
 
 		// Read length of argument byte slice
 		length, err := readVal(d.in)
 		if err != nil {
 			return err
+		} else if err := d.checkSize(length); err != nil {
+			return err
 		}
 		// Allocate argument byte slice
-		for i := uint64(0); i < length; i++ {
-			d.args = append(d.args, 0)
-		}
+		d.args = slices.Grow(d.args, int(length))[:length]
 		// Read argument byte slice
 		_, err = io.ReadFull(d.in, d.args)
 		if err != nil {
@@ -176,6 +231,8 @@ func (d *Decoder) Decode(e *Event) error {
 				break
 			} else if err != nil {
 				return err
+			} else if err := checkLimit("args", uint64(len(e.Args)+1), d.limits.MaxArgs); err != nil {
+				return err
 			}
 			e.Args = append(e.Args, arg)
 		}
@@ -184,33 +241,131 @@ func (d *Decoder) Decode(e *Event) error {
 	// Read user log event. This is a special case because the string is
 	// encoded as a base-128 varint length followed by a byte slice of bytes.
 	if e.Type == EventUserLog {
-		// Read string length
-		length, err := readVal(d.in)
-		if err != nil {
+		if err := d.readData(e); err != nil {
 			return err
 		}
-		// Allocate e.Str of the correct length
-		for i := uint64(0); i < length; i++ {
-			e.Str = append(e.Str, 0)
+	}
+	return nil
+}
+
+// decodeV2 parses a go 1.22+ event or returns an error.
+//
+// In go 1.22+ traces the first byte holds only the event type, and the
+// number of arguments is fixed for every event type. Batch headers are
+// returned as EventV2Batch events which are followed by the events of the
+// batch. The data of experimental batches is not decoded and returned as
+// e.Str instead.
+func (d *Decoder) decodeV2(e *Event) error {
+	// Read event type
+	typ, err := d.in.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	// Reset event
+	e.Type = EventType(typ) + eventTypeV2Offset
+	e.Args = e.Args[:0]
+	e.Str = e.Str[:0]
+
+	// Lookup the layout of the event
+	spec, ok := specV2(d.version, e.Type)
+	if !ok || typ >= eventTypeV2Offset {
+		return fmt.Errorf("%w %d", ErrInvalidEventType, typ)
+	}
+
+	// Read arguments and add them to e.Args
+	for i, n := 0, spec.nargs(d.version); i < n; i++ {
+		var arg uint64
+		if e.Type == EventV2ExperimentalBatch && i == 0 {
+			// The experiment id is encoded as a single byte rather than a
+			// varint.
+			b, err := d.in.ReadByte()
+			if err != nil {
+				return err
+			}
+			arg = uint64(b)
+		} else if arg, err = readVal(d.in); err != nil {
+			return err
 		}
-		// Read string into e.Str
-		if _, err := io.ReadFull(d.in, e.Str); err != nil {
+		e.Args = append(e.Args, arg)
+	}
+
+	// Read stack frames and add them to e.Args
+	if spec.isStack {
+		nframes := e.Args[1]
+		nargs := uint64(len(e.Args)) + nframes*4
+		if nframes > math.MaxUint64/4 {
+			// Overflow
+			nargs = math.MaxUint64
+		}
+		if err := checkLimit("args", nargs, d.limits.MaxArgs); err != nil {
+			return err
+		}
+		for i := uint64(0); i < nframes*4; i++ {
+			arg, err := readVal(d.in)
+			if err != nil {
+				return err
+			}
+			e.Args = append(e.Args, arg)
+		}
+	}
+
+	// Read data into e.Str
+	if spec.hasData {
+		if err := d.readData(e); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// readVal reads a base-128 varint encoded value from an io.Reader.
+// readData reads a base-128 varint length followed by a byte slice of that
+// length into e.Str.
+func (d *Decoder) readData(e *Event) error {
+	length, err := readVal(d.in)
+	if err != nil {
+		return err
+	} else if err := checkLimit("string length", length, d.limits.MaxStringLen); err != nil {
+		return err
+	} else if err := d.checkSize(length); err != nil {
+		return err
+	}
+	e.Str = slices.Grow(e.Str[:0], int(length))[:length]
+	_, err = io.ReadFull(d.in, e.Str)
+	return err
+}
+
+// checkSize returns an error if reading n more bytes would exceed the
+// maximum event size. Without a limit, the size is still bounded by
+// math.MaxInt so that it can be allocated.
+func (d *Decoder) checkSize(n uint64) error {
+	size := uint64(d.in.Offset-d.start) + n
+	if size < n {
+		// Overflow
+		size = math.MaxUint64
+	}
+	max := d.limits.MaxEventSize
+	if max <= 0 {
+		max = math.MaxInt
+	}
+	return checkLimit("event size", size, max)
+}
+
+// readVal reads a base-128 varint encoded value from an io.Reader. It
+// returns ErrVarintOverflow if the value doesn't fit into an uint64.
 func readVal(r io.ByteReader) (uint64, error) {
 	var val uint64 // decoded value
 	var shift uint // number of bits to shift
-	for {
+	for i := 0; ; i++ {
 		// Read byte
 		b, err := r.ReadByte()
 		if err != nil {
 			return 0, err
 		}
+		// The 10th byte can only hold the highest bit of an uint64
+		if i == binary.MaxVarintLen64-1 && b > 1 {
+			return 0, ErrVarintOverflow
+		}
 		// Decode byte, shifting it left by the number of bits already decoded,
 		// and add it to the decoded value.
 		val |= uint64(b&0x7f) << shift
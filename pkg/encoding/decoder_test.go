@@ -2,6 +2,7 @@ package encoding
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -14,25 +15,39 @@ import (
 // This does not check the correctness of the events, just that we can decode them.
 // The correctness of the events is checked in the TestDecodeEncode test.
 func TestDecoder(t *testing.T) {
-	// Read the test trace.
-	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
-	require.NoError(t, err)
-
-	// Create a decoder
-	dec := NewDecoder(bytes.NewReader(data))
-
-	// Decode each event and count them.
-	var count int
-	for {
-		e := Event{}
-		if err := dec.Decode(&e); err != nil {
-			require.Equal(t, io.EOF, err)
-			break
-		}
-		count++
+	tests := []struct {
+		GoVersion string
+		Trace     string
+		Count     int
+	}{
+		{"1.19", "trace.bin", 151},
+		{"1.25", "test-encoding-json.trace", 25092},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			// Read the test trace.
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+
+			// Create a decoder
+			dec := NewDecoder(bytes.NewReader(data))
+
+			// Decode each event and count them.
+			var count int
+			for {
+				e := Event{}
+				if err := dec.Decode(&e); err != nil {
+					require.Equal(t, io.EOF, err)
+					break
+				}
+				count++
+			}
+
+			// Check that we decoded the correct number of events.
+			require.Equal(t, test.Count, count)
+		})
 	}
-	// Check that we decoded the correct number of events.
-	require.Equal(t, 151, count)
 }
 
 // TestDecodeEncode tests that we can decode and encode a trace.
@@ -40,24 +55,35 @@ func TestDecoder(t *testing.T) {
 // the original.
 func TestDecodeEncode(t *testing.T) {
 	tests := []struct {
-		Trace string
+		GoVersion string
+		Version   int
+		Trace     string
 	}{
-		{"trace.bin"},
-		{"staticcheck.trace"},
+		{"1.6", 1005, "simple.trace"},
+		{"1.7", 1007, "simple.trace"},
+		{"1.9", 1009, "simple.trace"},
+		{"1.10", 1010, "simple.trace"},
+		{"1.11", 1011, "simple.trace"},
+		{"1.18", 1011, "simple.trace"},
+		{"1.19", 1019, "trace.bin"},
+		{"1.19", 1019, "staticcheck.trace"},
+		{"1.21", 1021, "task.trace"},
+		{"1.21", 1021, "test-encoding-json.trace"},
+		{"1.25", 1025, "test-encoding-json.trace"},
 	}
 
 	for _, test := range tests {
-		t.Run(test.Trace, func(t *testing.T) {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
 			// Read the test trace.
-			inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", test.Trace))
+			inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
 			require.NoError(t, err)
 
 			// Create a decoder
 			dec := NewDecoder(bytes.NewReader(inTrace))
 
-			// Create an encoder
+			// Create an encoder that uses the version of the decoder
 			var outTrace bytes.Buffer
-			enc := NewEncoder(&outTrace)
+			enc := NewEncoderFor(&outTrace, dec)
 
 			// Decode and encode each event.
 			for i := 0; ; i++ {
@@ -68,6 +94,7 @@ func TestDecodeEncode(t *testing.T) {
 					break
 				}
 				require.NoError(t, enc.Encode(&e))
+				require.NoError(t, enc.Flush())
 
 				// Check output after each event to understand errors without having to
 				// diff the whole binary output.
@@ -76,12 +103,154 @@ func TestDecodeEncode(t *testing.T) {
 				require.Equal(t, wantEncoded, gotEncoded, "failed to encode event %d: %v", i, e)
 			}
 
+			require.NoError(t, enc.Close())
+
 			// Check that the length of the encoded trace is the same as the original.
 			require.Equal(t, len(inTrace), outTrace.Len())
 			// Check that the encoded trace is the same as the original.
 			require.Equal(t, inTrace, outTrace.Bytes())
 			// Check that the offset is now equal to the size of the input.
 			require.Equal(t, int64(len(inTrace)), dec.Offset())
+			// Check that the decoder detected the right version.
+			require.Equal(t, test.Version, dec.Version())
+		})
+	}
+}
+
+// TestDecoderInvalidEventType tests that event types which don't exist in the
+// version of the trace are rejected.
+func TestDecoderInvalidEventType(t *testing.T) {
+	tests := []struct {
+		Version int
+		Type    EventType
+		Valid   bool
+	}{
+		{1005, EventString, false},
+		{1007, EventString, true},
+		{1011, EventCPUSample, false},
+		{1019, EventCPUSample, true},
+		{1019, EventCount, false},
+		{1022, EventV2GoSwitch, false},
+		{1023, EventV2GoSwitch, true},
+		{1025, EventV2EndOfGeneration, false},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d/%s", test.Version, test.Type), func(t *testing.T) {
+			// Create a trace that contains only the header and the event type.
+			data := header(test.Version)
+			if test.Version >= 1022 {
+				data = append(data, byte(test.Type-eventTypeV2Offset))
+			} else {
+				data = append(data, byte(test.Type))
+			}
+
+			// Decode the event, valid events will fail because of the missing
+			// arguments.
+			dec := NewDecoder(bytes.NewReader(data))
+			err := dec.Decode(&Event{})
+			if test.Valid {
+				require.NotContains(t, fmt.Sprint(err), "invalid event type")
+			} else {
+				require.ErrorContains(t, err, "invalid event type")
+			}
+		})
+	}
+}
+
+// TestDecoderUnsupportedVersion tests that headers of versions no Go release
+// writes are rejected, e.g. go 1.24 writes go 1.23 traces.
+func TestDecoderUnsupportedVersion(t *testing.T) {
+	for _, version := range []int{1006, 1012, 1020, 1024} {
+		t.Run(fmt.Sprint(version), func(t *testing.T) {
+			dec := NewDecoder(bytes.NewReader(header(version)))
+			err := dec.Decode(&Event{})
+			require.ErrorContains(t, err, "unsupported trace file version")
+		})
+	}
+}
+
+// TestDecoderErrors tests that malformed traces return a *DecodeError with
+// the offset of the event that couldn't be decoded.
+func TestDecoderErrors(t *testing.T) {
+	// overflowVarint is a varint that is too large to fit into an uint64.
+	overflowVarint := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}
+	// maxVarint is math.MaxUint64 encoded as a varint.
+	maxVarint := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	// batch is a valid go 1.19 batch event [pid=1, timestamp=2].
+	batch := []byte{byte(EventBatch) | 1<<6, 1, 2}
+	// trace returns a trace of the given version containing events.
+	trace := func(version int, events ...[]byte) []byte {
+		data := header(version)
+		for _, e := range events {
+			data = append(data, e...)
+		}
+		return data
+	}
+
+	tests := []struct {
+		Name   string
+		Data   []byte
+		Limits Limits
+		Offset int64
+		Err    error
+	}{
+		{"truncated header", header(1019)[:8], DefaultLimits, 0, io.ErrUnexpectedEOF},
+		{"truncated event", trace(1019, batch[:2]), DefaultLimits, 16, io.ErrUnexpectedEOF},
+		{"truncated string", trace(1019, []byte{byte(EventString), 1, 5, 'a'}), DefaultLimits, 16, io.ErrUnexpectedEOF},
+		{"varint overflow", trace(1019, []byte{byte(EventBatch) | 1<<6}, overflowVarint), DefaultLimits, 16, ErrVarintOverflow},
+		{"invalid event type", trace(1019, batch, []byte{byte(EventCount)}), DefaultLimits, 19, ErrInvalidEventType},
+		{"wrong arg count", trace(1019, []byte{byte(EventBatch), 1}), DefaultLimits, 16, ErrInvalidEvent},
+		{"huge string", trace(1019, []byte{byte(EventString), 1}, maxVarint), DefaultLimits, 16, ErrLimitExceeded},
+		{"long string", trace(1019, []byte{byte(EventString), 1, 3, 'a', 'b', 'c'}), Limits{MaxStringLen: 2}, 16, ErrLimitExceeded},
+		{"huge args", trace(1019, []byte{byte(EventBatch) | 3<<6}, maxVarint), Limits{}, 16, ErrLimitExceeded},
+		{"many args", trace(1019, []byte{byte(EventBatch) | 3<<6, 4, 1, 2, 3, 4}), Limits{MaxArgs: 3}, 16, ErrLimitExceeded},
+		{"large event", trace(1019, []byte{byte(EventString), 1, 3, 'a', 'b', 'c'}), Limits{MaxEventSize: 5}, 16, ErrLimitExceeded},
+		{"many frames", trace(1025, []byte{byte(EventV2Stack - eventTypeV2Offset), 1, 0xff, 0xff, 0x03}), DefaultLimits, 16, ErrLimitExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			dec := NewDecoder(bytes.NewReader(test.Data))
+			dec.SetLimits(test.Limits)
+			var err error
+			for err == nil {
+				err = dec.Decode(&Event{})
+			}
+
+			var decErr *DecodeError
+			require.ErrorAs(t, err, &decErr)
+			require.Equal(t, test.Offset, decErr.Offset)
+			require.ErrorIs(t, err, test.Err)
 		})
 	}
 }
+
+// FuzzDecoder tests that the decoder doesn't panic or allocate unbounded
+// memory for arbitrary inputs, and that the events it decodes can be encoded.
+func FuzzDecoder(f *testing.F) {
+	traces, err := filepath.Glob(filepath.Join("..", "..", "testdata", "*", "*.trace"))
+	require.NoError(f, err)
+	for _, trace := range traces {
+		data, err := os.ReadFile(trace)
+		require.NoError(f, err)
+		// Use only the beginning of each trace to keep the fuzzer fast.
+		f.Add(data[:min(len(data), 4096)])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dec := NewDecoder(bytes.NewReader(data))
+		enc := NewEncoderFor(io.Discard, dec)
+		for {
+			e := Event{}
+			if err := dec.Decode(&e); err == io.EOF {
+				return
+			} else if err != nil {
+				var decErr *DecodeError
+				require.ErrorAs(t, err, &decErr)
+				return
+			}
+			require.NoError(t, enc.Encode(&e))
+		}
+	})
+}
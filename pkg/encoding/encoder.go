@@ -1,137 +1,261 @@
 package encoding
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 )
 
-// Encoder encodes runtime/trace events to a writer.
+// encoderBufferSize is the number of bytes the encoder buffers before writing
+// them to its writer.
+const encoderBufferSize = 64 * 1024
+
+// errEncoderClosed is returned by Encode after Close was called.
+var errEncoderClosed = errors.New("encoder is closed")
+
+// Encoder encodes runtime/trace events to a writer. The output is buffered,
+// Flush or Close has to be called to write the buffered events.
 type Encoder struct {
-	w             io.Writer    // output writer
-	err           error        // sticky error
-	buf           bytes.Buffer // scratch buf for encoding non-inlined args
-	scratch10     []byte       // scratch buf for encoding varints
-	headerWritten bool         // true if header has been written
+	w             io.Writer // output writer
+	err           error     // sticky error
+	buf           []byte    // buffered output
+	args          []byte    // scratch buf for encoding non-inlined args
+	headerWritten bool      // true if header has been written
+	closed        bool      // true if Close has been called
+	version       int       // trace version, e.g. 1019 for go 1.19
+	dec           *Decoder  // decoder to take the version from, or nil
 }
 
-// NewEncoder returns a new encoder that writes to w.
-// Warning: The encoder is unbuffered, not supplying a buffered writer will
-// result in up to 100x slower performance.
-// TODO: Maybe add a buffered writer to the encoder?
+// NewEncoder returns a new encoder that writes a go 1.19 trace to w.
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w: w, scratch10: make([]byte, 10)}
+	return NewEncoderVersion(w, 1019)
 }
 
-// Encode writes ev to the encoder's writer or returns an error.
+// NewEncoderVersion returns a new encoder that writes a trace of the given
+// version to w. The version uses the same format as Decoder.Version, e.g.
+// 1022 for go 1.22.
+func NewEncoderVersion(w io.Writer, version int) *Encoder {
+	return &Encoder{w: w, buf: make([]byte, 0, encoderBufferSize), version: version}
+}
+
+// NewEncoderFor returns a new encoder that writes a trace with the same
+// version as the trace read by dec to w. The version is taken from dec when
+// the first event is encoded, so at least one event has to be decoded before.
+func NewEncoderFor(w io.Writer, dec *Decoder) *Encoder {
+	return &Encoder{w: w, buf: make([]byte, 0, encoderBufferSize), dec: dec}
+}
+
+// header returns the trace file header for the given version.
+func header(version int) []byte {
+	header := make([]byte, 16)
+	copy(header, fmt.Sprintf("go %d.%d trace", version/1000, version%1000))
+	return header
+}
+
+// Encode writes ev to the encoder's buffer or returns an error. The buffer is
+// written to the encoder's writer when it's full. Events that are not valid
+// for the version of the trace are rejected without writing anything.
 func (e *Encoder) Encode(ev *Event) error {
 	// Return error if any previous call to Encode failed
 	if e.err != nil {
 		return e.err
+	} else if e.closed {
+		return errEncoderClosed
+	}
+
+	// Determine the version of the trace
+	if !e.headerWritten {
+		if err := e.setVersion(); err != nil {
+			return err
+		}
+	}
+
+	// Check the event
+	if err := checkEvent(e.version, ev); err != nil {
+		return err
 	}
 
 	// Write header if not already done
 	if !e.headerWritten {
-		if _, e.err = e.w.Write(header); e.err != nil {
-			return e.err
+		e.buf = append(e.buf, header(e.version)...)
+		e.headerWritten = true
+	}
+
+	// go 1.22+ traces use a different encoding
+	if e.version >= 1022 {
+		e.encodeV2(ev)
+	} else {
+		e.encodeV1(ev)
+	}
+
+	// Write the buffer once it's full
+	if len(e.buf) >= encoderBufferSize {
+		return e.Flush()
+	}
+	return nil
+}
+
+// setVersion determines the version of the trace or returns an error if it's
+// not supported.
+func (e *Encoder) setVersion() error {
+	if e.dec != nil {
+		e.version = e.dec.Version()
+	}
+	if !supportedVersion(e.version) {
+		e.err = fmt.Errorf("unsupported trace file version %d", e.version)
+		return e.err
+	}
+	return nil
+}
+
+// Flush writes the buffered events to the encoder's writer.
+func (e *Encoder) Flush() error {
+	if e.err != nil {
+		return e.err
+	} else if len(e.buf) == 0 {
+		return nil
+	}
+	_, e.err = e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return e.err
+}
+
+// Close writes the header if no events have been encoded and flushes the
+// buffered events. Close doesn't close the encoder's writer. Encode returns an
+// error after Close has been called. An encoder created with NewEncoderFor
+// writes nothing if its decoder didn't read a header, i.e. for empty inputs.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+
+	if !e.headerWritten && e.err == nil && (e.dec == nil || e.dec.Version() != 0) {
+		if err := e.setVersion(); err != nil {
+			return err
 		}
+		e.buf = append(e.buf, header(e.version)...)
 		e.headerWritten = true
 	}
+	return e.Flush()
+}
+
+// EncodedSize returns the number of bytes ev takes up in a trace of the given
+// version. It's needed to compute the length of go 1.22+ batches after
+// changing their events. ev must be valid for the version.
+func EncodedSize(version int, ev *Event) int {
+	e := Encoder{version: version}
+	if version >= 1022 {
+		e.encodeV2(ev)
+	} else {
+		e.encodeV1(ev)
+	}
+	return len(e.buf)
+}
 
-	// Write event type and argument count
+// encodeV1 appends ev to the encoder's buffer using the encoding from before
+// go 1.22.
+func (e *Encoder) encodeV1(ev *Event) {
+	// Write event type and argument count. Before go 1.7 every event had an
+	// additional argument that was not included in the count.
 	narg := len(ev.Args) - 1
-	if narg > 3 {
-		narg = 3
+	if e.version < 1007 {
+		narg--
 	}
-	e.scratch10[0] = byte(ev.Type) | byte(narg)<<6
-	if _, e.err = e.w.Write(e.scratch10[0:1]); e.err != nil {
-		return e.err
+	if narg > 3 || ev.Type == EventStack {
+		// Stacks are always length prefixed, even if they are short.
+		narg = 3
 	}
+	e.buf = append(e.buf, byte(ev.Type)|byte(narg)<<6)
 
 	// Write string event
 	if ev.Type == EventString {
-		// Write string id
-		if e.err = writeVarint(e.w, ev.Args[0], e.scratch10); e.err != nil {
-			return e.err
-		}
-		// Write string length
-		if e.err = writeVarint(e.w, uint64(len(ev.Str)), e.scratch10); e.err != nil {
-			return e.err
-		}
-		// Write string
-		if _, e.err = e.w.Write(ev.Str); e.err != nil {
-			return e.err
-		}
-		return nil
+		// Write string id, length and string
+		e.buf = binary.AppendUvarint(e.buf, ev.Args[0])
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(ev.Str)))
+		e.buf = append(e.buf, ev.Str...)
+		return
 	} else if narg < 3 {
 		// Write inlined arguments
 		for _, arg := range ev.Args {
-			if e.err = writeVarint(e.w, arg, e.scratch10); e.err != nil {
-				return e.err
-			}
+			e.buf = binary.AppendUvarint(e.buf, arg)
 		}
 	} else {
-		// Write the arguments to e.buf to determine their encoded length
-		e.buf.Reset()
+		// Encode the arguments to e.args to determine their encoded length
+		e.args = e.args[:0]
 		for _, arg := range ev.Args {
-			if e.err = writeVarint(&e.buf, arg, e.scratch10); e.err != nil {
-				return e.err
-			}
+			e.args = binary.AppendUvarint(e.args, arg)
 		}
-		if ev.Type == EventStack {
-			// Write the length of the encoded arguments to the e.w
-			// Use writePaddedVarint to produce the same output as encoding/trace does which simplifies testing.
-			if e.err = writePaddedVarint(e.w, uint64(e.buf.Len())); e.err != nil {
-				return e.err
-			}
+		if ev.Type == EventStack && e.version >= 1019 {
+			// Write the length of the encoded arguments.
+			// Use appendPaddedVarint to produce the same output as encoding/trace does which simplifies testing.
+			// The runtime started padding the length in go 1.20 which
+			// still produces go 1.19 traces, so traces from go 1.19 itself
+			// won't be reproduced exactly.
+			e.buf = appendPaddedVarint(e.buf, uint64(len(e.args)))
 		} else {
-			// Write the length of the encoded arguments to the e.w
-			if e.err = writeVarint(e.w, uint64(e.buf.Len()), e.scratch10); e.err != nil {
-				return e.err
-			}
-		}
-		// Write the encoded arguments to e.w
-		if _, e.err = e.w.Write(e.buf.Bytes()); e.err != nil {
-			return e.err
+			// Write the length of the encoded arguments
+			e.buf = binary.AppendUvarint(e.buf, uint64(len(e.args)))
 		}
+		// Write the encoded arguments
+		e.buf = append(e.buf, e.args...)
 	}
 
 	// Write user log event
 	if ev.Type == EventUserLog {
-		// Write string length
-		if e.err = writeVarint(e.w, uint64(len(ev.Str)), e.scratch10); e.err != nil {
-			return e.err
-		}
-		// Write string
-		if _, e.err = e.w.Write(ev.Str); e.err != nil {
-			return e.err
-		}
+		// Write string length and string
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(ev.Str)))
+		e.buf = append(e.buf, ev.Str...)
 	}
-
-	return nil
 }
 
-// writeVarint writes v as a varint to w or returns an error.
-// scratch is a 10 byte buffer used to avoid allocations.
-func writeVarint(w io.Writer, v uint64, scratch []byte) error {
-	n := binary.PutUvarint(scratch, v)
-	_, err := w.Write(scratch[:n])
-	return err
+// encodeV2 appends ev to the encoder's buffer using the go 1.22+ encoding.
+func (e *Encoder) encodeV2(ev *Event) {
+	spec, _ := specV2(e.version, ev.Type)
+
+	// Write event type
+	e.buf = append(e.buf, byte(ev.Type-eventTypeV2Offset))
+
+	// Write arguments and stack frames
+	for i, arg := range ev.Args {
+		if ev.Type == EventV2ExperimentalBatch && i == 0 {
+			// The experiment id is encoded as a single byte rather than a
+			// varint.
+			e.buf = append(e.buf, byte(arg))
+		} else if ev.Type == EventV2Batch && i == 3 {
+			// The runtime reserves 10 bytes for the batch length and fills
+			// them in once the batch is complete. Use appendPaddedVarint to
+			// produce the same output.
+			e.buf = appendPaddedVarint(e.buf, arg)
+		} else {
+			e.buf = binary.AppendUvarint(e.buf, arg)
+		}
+	}
+
+	// Write data
+	if spec.hasData {
+		if ev.Type == EventV2ExperimentalBatch {
+			// Same as the batch length above.
+			e.buf = appendPaddedVarint(e.buf, uint64(len(ev.Str)))
+		} else {
+			e.buf = binary.AppendUvarint(e.buf, uint64(len(ev.Str)))
+		}
+		e.buf = append(e.buf, ev.Str...)
+	}
 }
 
-// writePaddedVarint writes v as a varint to w or returns an error.
-// The varint is padded with 0x80 bytes to 10 bytes.
+// appendPaddedVarint appends v as a varint to buf and returns the extended
+// buffer. The varint is padded with 0x80 bytes to 10 bytes.
 // This is done to produce exactly the same output as encoding/trace does which simplifies testing.
-func writePaddedVarint(w io.Writer, v uint64) error {
-	var buf [10]byte
+func appendPaddedVarint(buf []byte, v uint64) []byte {
 	for i := 0; i < 10; i++ {
 		if i < 10-1 {
-			buf[i] = 0x80 | byte(v)
+			buf = append(buf, 0x80|byte(v))
 		} else {
-			buf[i] = byte(v)
+			buf = append(buf, byte(v))
 		}
 		v >>= 7
 	}
-	_, err := w.Write(buf[:])
-	return err
+	return buf
 }
@@ -0,0 +1,191 @@
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncoderCheckEvent tests that the encoder rejects events that are not
+// valid for the version of the trace.
+func TestEncoderCheckEvent(t *testing.T) {
+	tests := []struct {
+		Version int
+		Event   Event
+		WantErr string
+	}{
+		{1019, Event{Type: EventGCSTWStart, Args: []uint64{1, 0}}, ""},
+		{1009, Event{Type: EventGCSTWStart, Args: []uint64{1, 0}}, "has 2 arguments, want 1"},
+		{1005, Event{Type: EventGoStart, Args: []uint64{1, 2, 3}}, ""},
+		{1007, Event{Type: EventGoStart, Args: []uint64{1, 2}}, "has 2 arguments, want 3"},
+		{1019, Event{Type: EventStack, Args: []uint64{1, 1, 2, 3, 4, 5}}, ""},
+		{1019, Event{Type: EventStack, Args: []uint64{1, 2, 2, 3, 4, 5}}, "has 6 arguments, want 10"},
+		{1005, Event{Type: EventStack, Args: []uint64{1, 2, 3, 4}}, ""},
+		{1011, Event{Type: EventCPUSample, Args: []uint64{1, 2, 3, 4, 5}}, "invalid event type"},
+		{1021, Event{Type: EventUserLog, Args: []uint64{1, 2, 3, 4}, Str: []byte("msg")}, ""},
+		{1021, Event{Type: EventGoEnd, Args: []uint64{1}, Str: []byte("msg")}, "can't have a string"},
+		{1021, Event{Type: EventV2GoDestroy, Args: []uint64{1}}, "invalid event type"},
+		{1025, Event{Type: EventV2GoDestroy, Args: []uint64{1}}, ""},
+		{1025, Event{Type: EventGoEnd, Args: []uint64{1}}, "invalid event type"},
+		{1025, Event{Type: EventV2Stack, Args: []uint64{1, 1, 2, 3, 4, 5}}, ""},
+		{1022, Event{Type: EventV2ClockSnapshot, Args: []uint64{1, 2, 3, 4}}, "invalid event type"},
+		{1020, Event{Type: EventGoEnd, Args: []uint64{1}}, "unsupported trace file version"},
+		{1024, Event{Type: EventV2GoDestroy, Args: []uint64{1}}, "unsupported trace file version"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d/%s", test.Version, test.Event.Type), func(t *testing.T) {
+			var out bytes.Buffer
+			enc := NewEncoderVersion(&out, test.Version)
+			err := enc.Encode(&test.Event)
+			if test.WantErr == "" {
+				require.NoError(t, err)
+				require.NoError(t, enc.Flush())
+				require.Equal(t, header(test.Version), out.Bytes()[:16])
+			} else {
+				require.ErrorContains(t, err, test.WantErr)
+				enc.Flush()
+				require.Equal(t, 0, out.Len())
+			}
+		})
+	}
+}
+
+// TestEncoderClose tests that the encoder buffers its output until Flush or
+// Close and writes the header of traces without events.
+func TestEncoderClose(t *testing.T) {
+	t.Run("buffered", func(t *testing.T) {
+		var out bytes.Buffer
+		enc := NewEncoderVersion(&out, 1021)
+		require.NoError(t, enc.Encode(&Event{Type: EventGoEnd, Args: []uint64{1}}))
+		require.Equal(t, 0, out.Len())
+		require.NoError(t, enc.Close())
+		require.Equal(t, append(header(1021), byte(EventGoEnd), 1), out.Bytes())
+		require.ErrorIs(t, enc.Encode(&Event{Type: EventGoEnd, Args: []uint64{1}}), errEncoderClosed)
+		require.NoError(t, enc.Close())
+	})
+
+	t.Run("no events", func(t *testing.T) {
+		var out bytes.Buffer
+		enc := NewEncoderVersion(&out, 1025)
+		require.NoError(t, enc.Close())
+		require.Equal(t, header(1025), out.Bytes())
+	})
+
+	t.Run("no events for decoder", func(t *testing.T) {
+		var out bytes.Buffer
+		dec := NewDecoder(bytes.NewReader(header(1019)))
+		enc := NewEncoderFor(&out, dec)
+		require.Equal(t, io.EOF, dec.Decode(&Event{}))
+		require.NoError(t, enc.Close())
+		require.Equal(t, header(1019), out.Bytes())
+	})
+
+	t.Run("empty input", func(t *testing.T) {
+		var out bytes.Buffer
+		dec := NewDecoder(bytes.NewReader(nil))
+		enc := NewEncoderFor(&out, dec)
+		require.Equal(t, io.EOF, dec.Decode(&Event{}))
+		require.NoError(t, enc.Close())
+		require.Equal(t, 0, out.Len())
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		enc := NewEncoderVersion(errWriter{}, 1021)
+		for i := 0; i < encoderBufferSize; i++ {
+			if err := enc.Encode(&Event{Type: EventGoEnd, Args: []uint64{1}}); err != nil {
+				require.ErrorIs(t, err, io.ErrShortWrite)
+				require.ErrorIs(t, enc.Close(), io.ErrShortWrite)
+				return
+			}
+		}
+		t.Fatal("full buffer was not written")
+	})
+}
+
+// TestEncodedSize tests that EncodedSize matches the size of the events in
+// traces written by the runtime.
+func TestEncodedSize(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.6", "simple.trace"},
+		{"1.21", "task.trace"},
+		{"1.25", "test-encoding-json.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+
+			dec := NewDecoder(bytes.NewReader(data))
+			for {
+				var ev Event
+				start := dec.Offset()
+				if err := dec.Decode(&ev); err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				if start == 0 {
+					start = 16
+				}
+				require.Equal(t, int(dec.Offset()-start), EncodedSize(dec.Version(), &ev), "%v event at offset %d", ev.Type, start)
+			}
+		})
+	}
+}
+
+// errWriter is an io.Writer that always fails.
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, io.ErrShortWrite }
+
+// BenchmarkEncode measures the speed of encoding the events of a trace.
+func BenchmarkEncode(b *testing.B) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.19", "staticcheck.trace"},
+		{"1.25", "test-encoding-json.trace"},
+	}
+
+	for _, test := range tests {
+		b.Run(test.GoVersion+"/"+test.Trace, func(b *testing.B) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(b, err)
+
+			// Decode the events once
+			var events []Event
+			dec := NewDecoder(bytes.NewReader(data))
+			for {
+				var ev Event
+				if err := dec.Decode(&ev); err == io.EOF {
+					break
+				}
+				require.NoError(b, err)
+				events = append(events, ev)
+			}
+
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				enc := NewEncoderFor(io.Discard, dec)
+				for i := range events {
+					if err := enc.Encode(&events[i]); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := enc.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
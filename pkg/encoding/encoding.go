@@ -1,3 +1,13 @@
 // Package encoding implements the encoding and decoding of the runtime/trace
-// file format. Currently only traces produces by go 1.19 are supported.
+// file format. Traces produced by go 1.5 and later are supported.
+//
+// Go 1.22 introduced a new trace format. Its event types are exposed as the
+// EventV2* constants which don't overlap with the event types of older
+// traces.
+//
+// Decoder returns the raw events of a trace, ContextDecoder additionally
+// tracks the absolute timestamp, P and G of every event and resolves its
+// string and stack arguments. BuildIndex creates an Index of the batches of
+// a trace that lets ContextDecoder seek to the batches of a time window or P.
+// DecodeParallel decodes the batches of a trace on multiple goroutines.
 package encoding
@@ -0,0 +1,41 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidEventType is returned for event types that don't exist in the
+	// version of the trace.
+	ErrInvalidEventType = errors.New("invalid event type")
+	// ErrInvalidEvent is returned for events that have the wrong number of
+	// arguments or an unexpected string.
+	ErrInvalidEvent = errors.New("invalid event")
+	// ErrVarintOverflow is returned for varints that don't fit into 64 bits.
+	ErrVarintOverflow = errors.New("varint overflows 64 bits")
+	// ErrLimitExceeded is returned for events that exceed the Limits of the
+	// Decoder.
+	ErrLimitExceeded = errors.New("limit exceeded")
+)
+
+// DecodeError is returned by Decoder when a trace can't be decoded. Use
+// errors.Is to check for the underlying error, e.g. ErrLimitExceeded or
+// io.ErrUnexpectedEOF.
+type DecodeError struct {
+	// Offset is the offset of the event that couldn't be decoded, as
+	// returned by Decoder.Offset before the call to Decode.
+	Offset int64
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Err, e.Offset)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -1,7 +1,8 @@
 package encoding
 
-// Event represents a single event in the trace.
-// TODO: This is a raw event. We should add structs for each event type.
+// Event represents a single raw event in the trace. The meaning of the args
+// depends on the event type and the trace version, use the As<Type> methods
+// to get a typed view of the event.
 type Event struct {
 	Type EventType
 	Args []uint64
@@ -61,13 +62,78 @@ const (
 	EventGoBlockGC         EventType = 42 // goroutine blocks on GC assist [timestamp, stack]
 	EventGCMarkAssistStart EventType = 43 // GC mark assist start [timestamp, stack]
 	EventGCMarkAssistDone  EventType = 44 // GC mark assist done [timestamp]
-	EventUserTaskCreate    EventType = 45 // trace.NewContext [timestamp, internal task id, internal parent task id, stack, name string]
+	EventUserTaskCreate    EventType = 45 // trace.NewContext [timestamp, internal task id, internal parent task id, name string id, stack]
 	EventUserTaskEnd       EventType = 46 // end of a task [timestamp, internal task id, stack]
-	EventUserRegion        EventType = 47 // trace.WithRegion [timestamp, internal task id, mode(0:start, 1:end), stack, name string]
+	EventUserRegion        EventType = 47 // trace.WithRegion [timestamp, internal task id, mode(0:start, 1:end), name string id, stack]
 	EventUserLog           EventType = 48 // trace.Log [timestamp, internal task id, key string id, stack, value string]
-	EventCPUSample         EventType = 49 // CPU profiling sample [timestamp, stack, real timestamp, real P id (-1 when absent), goroutine id]
+	EventCPUSample         EventType = 49 // CPU profiling sample [timestamp (always 0), real timestamp, real P id (-1 when absent), goroutine id, stack]
 	EventCount             EventType = 50
 	// Byte is used but only 6 bits are available for event type.
 	// The remaining 2 bits are used to specify the number of arguments.
 	// That means, the max event type value is 63.
 )
+
+// eventTypeV2Offset is added to the wire value of go 1.22+ event types to
+// keep them apart from the event types above. Their wire values overlap, but
+// the old format only uses 6 bits for the event type.
+const eventTypeV2Offset = 64
+
+// Event types in go 1.22+ traces, args are given in square brackets.
+// This is copied from src/internal/trace/tracev2/events.go in the Go source
+// tree.
+const (
+	EventV2None                EventType = eventTypeV2Offset + iota // unused
+	EventV2Batch                                                    // start of per-M batch of events [generation, M id, timestamp, batch length]
+	EventV2Stacks                                                   // start of a section of the stack table [...EventV2Stack]
+	EventV2Stack                                                    // stack table entry [stack id, number of frames, array of {PC, func string ID, file string ID, line}]
+	EventV2Strings                                                  // start of a section of the string dictionary [...EventV2String]
+	EventV2String                                                   // string dictionary entry [ID, length, string]
+	EventV2CPUSamples                                               // start of a section of CPU samples [...EventV2CPUSample]
+	EventV2CPUSample                                                // CPU profiling sample [timestamp, M id, P id, goroutine id, stack id]
+	EventV2Frequency                                                // timestamp units per sec [frequency]
+	EventV2ProcsChange                                              // current value of GOMAXPROCS [timestamp, GOMAXPROCS, stack id]
+	EventV2ProcStart                                                // start of P [timestamp, P id, P seq]
+	EventV2ProcStop                                                 // stop of P [timestamp]
+	EventV2ProcSteal                                                // P was stolen [timestamp, P id, P seq, M id]
+	EventV2ProcStatus                                               // P status at the start of a generation [timestamp, P id, status]
+	EventV2GoCreate                                                 // goroutine creation [timestamp, new goroutine id, new stack id, stack id]
+	EventV2GoCreateSyscall                                          // goroutine appears in syscall (cgo callback) [timestamp, new goroutine id]
+	EventV2GoStart                                                  // goroutine starts running [timestamp, goroutine id, goroutine seq]
+	EventV2GoDestroy                                                // goroutine ends [timestamp]
+	EventV2GoDestroySyscall                                         // goroutine ends in syscall (cgo callback) [timestamp]
+	EventV2GoStop                                                   // goroutine yields its time, but is runnable [timestamp, reason string id, stack id]
+	EventV2GoBlock                                                  // goroutine blocks [timestamp, reason string id, stack id]
+	EventV2GoUnblock                                                // goroutine is unblocked [timestamp, goroutine id, goroutine seq, stack id]
+	EventV2GoSyscallBegin                                           // syscall enter [timestamp, P seq, stack id]
+	EventV2GoSyscallEnd                                             // syscall exit [timestamp]
+	EventV2GoSyscallEndBlocked                                      // syscall exit and it blocked at some point [timestamp]
+	EventV2GoStatus                                                 // goroutine status at the start of a generation [timestamp, goroutine id, M id, status]
+	EventV2STWBegin                                                 // STW start [timestamp, kind string id, stack id]
+	EventV2STWEnd                                                   // STW done [timestamp]
+	EventV2GCActive                                                 // GC active [timestamp, seq]
+	EventV2GCBegin                                                  // GC start [timestamp, seq, stack id]
+	EventV2GCEnd                                                    // GC done [timestamp, seq]
+	EventV2GCSweepActive                                            // GC sweep active [timestamp, P id]
+	EventV2GCSweepBegin                                             // GC sweep start [timestamp, stack id]
+	EventV2GCSweepEnd                                               // GC sweep done [timestamp, swept bytes, reclaimed bytes]
+	EventV2GCMarkAssistActive                                       // GC mark assist active [timestamp, goroutine id]
+	EventV2GCMarkAssistBegin                                        // GC mark assist start [timestamp, stack id]
+	EventV2GCMarkAssistEnd                                          // GC mark assist done [timestamp]
+	EventV2HeapAlloc                                                // gcController.heapLive change [timestamp, heap alloc in bytes]
+	EventV2HeapGoal                                                 // gcController.heapGoal() change [timestamp, heap goal in bytes]
+	EventV2GoLabel                                                  // apply string label to current running goroutine [timestamp, label string id]
+	EventV2UserTaskBegin                                            // trace.NewTask [timestamp, internal task id, internal parent task id, name string id, stack id]
+	EventV2UserTaskEnd                                              // end of a task [timestamp, internal task id, stack id]
+	EventV2UserRegionBegin                                          // trace.{Start,With}Region [timestamp, internal task id, name string id, stack id]
+	EventV2UserRegionEnd                                            // trace.{End,With}Region [timestamp, internal task id, name string id, stack id]
+	EventV2UserLog                                                  // trace.Log [timestamp, internal task id, key string id, value string id, stack id]
+	EventV2GoSwitch                                                 // goroutine switch (coroswitch) [timestamp, goroutine id, goroutine seq]
+	EventV2GoSwitchDestroy                                          // goroutine switch and destroy [timestamp, goroutine id, goroutine seq]
+	EventV2GoCreateBlocked                                          // goroutine creation (starts blocked) [timestamp, new goroutine id, new stack id, stack id]
+	EventV2GoStatusStack                                            // goroutine status at the start of a generation, with a stack [timestamp, goroutine id, M id, status, stack id]
+	EventV2ExperimentalBatch                                        // start of extra data [experiment id, generation, M id, timestamp, batch length, batch data]
+	EventV2Sync                                                     // start of a sync batch [...EventV2Frequency|EventV2ClockSnapshot]
+	EventV2ClockSnapshot                                            // snapshot of trace, mono and wall clocks [timestamp, mono, sec, nsec]
+	EventV2EndOfGeneration                                          // in-band end-of-generation signal []
+	EventV2Count
+)
@@ -59,15 +59,80 @@ func _() {
 	_ = x[EventUserLog-48]
 	_ = x[EventCPUSample-49]
 	_ = x[EventCount-50]
+	_ = x[EventV2None-64]
+	_ = x[EventV2Batch-65]
+	_ = x[EventV2Stacks-66]
+	_ = x[EventV2Stack-67]
+	_ = x[EventV2Strings-68]
+	_ = x[EventV2String-69]
+	_ = x[EventV2CPUSamples-70]
+	_ = x[EventV2CPUSample-71]
+	_ = x[EventV2Frequency-72]
+	_ = x[EventV2ProcsChange-73]
+	_ = x[EventV2ProcStart-74]
+	_ = x[EventV2ProcStop-75]
+	_ = x[EventV2ProcSteal-76]
+	_ = x[EventV2ProcStatus-77]
+	_ = x[EventV2GoCreate-78]
+	_ = x[EventV2GoCreateSyscall-79]
+	_ = x[EventV2GoStart-80]
+	_ = x[EventV2GoDestroy-81]
+	_ = x[EventV2GoDestroySyscall-82]
+	_ = x[EventV2GoStop-83]
+	_ = x[EventV2GoBlock-84]
+	_ = x[EventV2GoUnblock-85]
+	_ = x[EventV2GoSyscallBegin-86]
+	_ = x[EventV2GoSyscallEnd-87]
+	_ = x[EventV2GoSyscallEndBlocked-88]
+	_ = x[EventV2GoStatus-89]
+	_ = x[EventV2STWBegin-90]
+	_ = x[EventV2STWEnd-91]
+	_ = x[EventV2GCActive-92]
+	_ = x[EventV2GCBegin-93]
+	_ = x[EventV2GCEnd-94]
+	_ = x[EventV2GCSweepActive-95]
+	_ = x[EventV2GCSweepBegin-96]
+	_ = x[EventV2GCSweepEnd-97]
+	_ = x[EventV2GCMarkAssistActive-98]
+	_ = x[EventV2GCMarkAssistBegin-99]
+	_ = x[EventV2GCMarkAssistEnd-100]
+	_ = x[EventV2HeapAlloc-101]
+	_ = x[EventV2HeapGoal-102]
+	_ = x[EventV2GoLabel-103]
+	_ = x[EventV2UserTaskBegin-104]
+	_ = x[EventV2UserTaskEnd-105]
+	_ = x[EventV2UserRegionBegin-106]
+	_ = x[EventV2UserRegionEnd-107]
+	_ = x[EventV2UserLog-108]
+	_ = x[EventV2GoSwitch-109]
+	_ = x[EventV2GoSwitchDestroy-110]
+	_ = x[EventV2GoCreateBlocked-111]
+	_ = x[EventV2GoStatusStack-112]
+	_ = x[EventV2ExperimentalBatch-113]
+	_ = x[EventV2Sync-114]
+	_ = x[EventV2ClockSnapshot-115]
+	_ = x[EventV2EndOfGeneration-116]
+	_ = x[EventV2Count-117]
 }
 
-const _EventType_name = "EventNoneEventBatchEventFrequencyEventStackEventGomaxprocsEventProcStartEventProcStopEventGCStartEventGCDoneEventGCSTWStartEventGCSTWDoneEventGCSweepStartEventGCSweepDoneEventGoCreateEventGoStartEventGoEndEventGoStopEventGoSchedEventGoPreemptEventGoSleepEventGoBlockEventGoUnblockEventGoBlockSendEventGoBlockRecvEventGoBlockSelectEventGoBlockSyncEventGoBlockCondEventGoBlockNetEventGoSysCallEventGoSysExitEventGoSysBlockEventGoWaitingEventGoInSyscallEventHeapAllocEventHeapGoalEventTimerGoroutineEventFutileWakeupEventStringEventGoStartLocalEventGoUnblockLocalEventGoSysExitLocalEventGoStartLabelEventGoBlockGCEventGCMarkAssistStartEventGCMarkAssistDoneEventUserTaskCreateEventUserTaskEndEventUserRegionEventUserLogEventCPUSampleEventCount"
+const (
+	_EventType_name_0 = "EventNoneEventBatchEventFrequencyEventStackEventGomaxprocsEventProcStartEventProcStopEventGCStartEventGCDoneEventGCSTWStartEventGCSTWDoneEventGCSweepStartEventGCSweepDoneEventGoCreateEventGoStartEventGoEndEventGoStopEventGoSchedEventGoPreemptEventGoSleepEventGoBlockEventGoUnblockEventGoBlockSendEventGoBlockRecvEventGoBlockSelectEventGoBlockSyncEventGoBlockCondEventGoBlockNetEventGoSysCallEventGoSysExitEventGoSysBlockEventGoWaitingEventGoInSyscallEventHeapAllocEventHeapGoalEventTimerGoroutineEventFutileWakeupEventStringEventGoStartLocalEventGoUnblockLocalEventGoSysExitLocalEventGoStartLabelEventGoBlockGCEventGCMarkAssistStartEventGCMarkAssistDoneEventUserTaskCreateEventUserTaskEndEventUserRegionEventUserLogEventCPUSampleEventCount"
+	_EventType_name_1 = "EventV2NoneEventV2BatchEventV2StacksEventV2StackEventV2StringsEventV2StringEventV2CPUSamplesEventV2CPUSampleEventV2FrequencyEventV2ProcsChangeEventV2ProcStartEventV2ProcStopEventV2ProcStealEventV2ProcStatusEventV2GoCreateEventV2GoCreateSyscallEventV2GoStartEventV2GoDestroyEventV2GoDestroySyscallEventV2GoStopEventV2GoBlockEventV2GoUnblockEventV2GoSyscallBeginEventV2GoSyscallEndEventV2GoSyscallEndBlockedEventV2GoStatusEventV2STWBeginEventV2STWEndEventV2GCActiveEventV2GCBeginEventV2GCEndEventV2GCSweepActiveEventV2GCSweepBeginEventV2GCSweepEndEventV2GCMarkAssistActiveEventV2GCMarkAssistBeginEventV2GCMarkAssistEndEventV2HeapAllocEventV2HeapGoalEventV2GoLabelEventV2UserTaskBeginEventV2UserTaskEndEventV2UserRegionBeginEventV2UserRegionEndEventV2UserLogEventV2GoSwitchEventV2GoSwitchDestroyEventV2GoCreateBlockedEventV2GoStatusStackEventV2ExperimentalBatchEventV2SyncEventV2ClockSnapshotEventV2EndOfGenerationEventV2Count"
+)
 
-var _EventType_index = [...]uint16{0, 9, 19, 33, 43, 58, 72, 85, 97, 108, 123, 137, 154, 170, 183, 195, 205, 216, 228, 242, 254, 266, 280, 296, 312, 330, 346, 362, 377, 391, 405, 420, 434, 450, 464, 477, 496, 513, 524, 541, 560, 579, 596, 610, 632, 653, 672, 688, 703, 715, 729, 739}
+var (
+	_EventType_index_0 = [...]uint16{0, 9, 19, 33, 43, 58, 72, 85, 97, 108, 123, 137, 154, 170, 183, 195, 205, 216, 228, 242, 254, 266, 280, 296, 312, 330, 346, 362, 377, 391, 405, 420, 434, 450, 464, 477, 496, 513, 524, 541, 560, 579, 596, 610, 632, 653, 672, 688, 703, 715, 729, 739}
+	_EventType_index_1 = [...]uint16{0, 11, 23, 36, 48, 62, 75, 92, 108, 124, 142, 158, 173, 189, 206, 221, 243, 257, 273, 296, 309, 323, 339, 360, 379, 405, 420, 435, 448, 463, 477, 489, 509, 528, 545, 570, 594, 616, 632, 647, 661, 681, 699, 721, 741, 755, 770, 792, 814, 834, 858, 869, 889, 911, 923}
+)
 
 func (i EventType) String() string {
-	if i >= EventType(len(_EventType_index)-1) {
+	switch {
+	case i <= 50:
+		return _EventType_name_0[_EventType_index_0[i]:_EventType_index_0[i+1]]
+	case 64 <= i && i <= 117:
+		i -= 64
+		return _EventType_name_1[_EventType_index_1[i]:_EventType_index_1[i+1]]
+	default:
 		return "EventType(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _EventType_name[_EventType_index[i]:_EventType_index[i+1]]
 }
@@ -0,0 +1,165 @@
+package encoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// indexFormat is the version of the persisted index format. It must be
+// incremented when the meaning of the fields of Index changes.
+const indexFormat = 2
+
+// Index records the position and context of every batch of a trace, so that
+// the events of a time window or P can be decoded without reading the whole
+// trace. See ContextDecoder.SetIndex and ContextDecoder.Seek.
+type Index struct {
+	// Format is the version of the index format.
+	Format int
+	// Version is the version of the trace.
+	Version int
+	// Size is the size of the trace in bytes. It can be used to detect an
+	// index that doesn't belong to the trace.
+	Size int64
+	// MinTs is the smallest timestamp of all events except batch headers in
+	// nanoseconds. Timestamps relative to it match the ones of gotraceui.
+	MinTs int64
+	// MinTicks is MinTs in ticks of the trace clock.
+	MinTicks uint64
+	// Batches contains the batches of the trace in the order in which they
+	// appear in the trace.
+	Batches []IndexBatch
+}
+
+// IndexBatch describes a single batch of a trace. Batches start with an
+// EventBatch, EventV2Batch or EventV2ExperimentalBatch event and end before
+// the next batch or at the end of the trace.
+type IndexBatch struct {
+	// Offset is the offset of the first event of the batch in the trace.
+	Offset int64
+	// Size is the size of the batch in bytes.
+	Size int64
+	// Gen is the generation of the batch. It's 0 before go 1.22.
+	Gen uint64
+	// M is the M that wrote the batch or -1 before go 1.22.
+	M int64
+	// P is the P at the start of the batch or -1 if there is none.
+	P int64
+	// G is the goroutine running at the start of the batch or 0.
+	G uint64
+	// MinTs and MaxTs are the smallest and largest timestamp of the events
+	// in the batch in nanoseconds. MinTs is the start timestamp of the batch
+	// unless it contains CPU samples, which are taken before they are written.
+	MinTs int64
+	MaxTs int64
+	// Events is the number of events in the batch including the header.
+	Events int
+	// Ps contains the Ps of the events in the batch. Before go 1.22 this is
+	// the P of the batch, but go 1.22+ batches belong to an M which can
+	// acquire multiple Ps.
+	Ps []int64
+	// Tables is true if the batch contains frequency, string or stack
+	// events.
+	Tables bool
+}
+
+// BuildIndex decodes the trace read from r and returns its index. The
+// offsets of the index are relative to the current position of r.
+func BuildIndex(r io.ReadSeeker) (*Index, error) {
+	var (
+		dec = NewContextDecoder(r)
+		idx = &Index{Format: indexFormat, MinTs: math.MaxInt64, MinTicks: math.MaxUint64}
+		b   *IndexBatch
+		ev  ContextEvent
+	)
+	for {
+		// The first event follows the 16 byte header, which isn't read
+		// before the first call to Decode.
+		offset := max(dec.Offset(), 16)
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch ev.Type {
+		case EventBatch, EventV2Batch, EventV2ExperimentalBatch:
+			// The previous batch ends here
+			if b != nil {
+				b.Size = offset - b.Offset
+			}
+			idx.Batches = append(idx.Batches, IndexBatch{
+				Offset: offset,
+				Gen:    dec.gen,
+				M:      ev.M,
+				P:      ev.P,
+				G:      ev.G,
+				MinTs:  ev.Ts,
+				MaxTs:  ev.Ts,
+				Events: 1,
+			})
+			b = &idx.Batches[len(idx.Batches)-1]
+			continue
+		case EventFrequency, EventString, EventStack,
+			EventV2Frequency, EventV2String, EventV2Stack:
+			if b != nil {
+				b.Tables = true
+			}
+		}
+
+		// Traces always start with a batch
+		if b == nil {
+			return nil, fmt.Errorf("%v event outside of a batch at offset %d", ev.Type, offset)
+		}
+		b.Events++
+		if ev.P >= 0 && !slices.Contains(b.Ps, ev.P) {
+			b.Ps = append(b.Ps, ev.P)
+		}
+		if ev.Ts != 0 {
+			b.MinTs, b.MaxTs = min(b.MinTs, ev.Ts), max(b.MaxTs, ev.Ts)
+			idx.MinTs, idx.MinTicks = min(idx.MinTs, ev.Ts), min(idx.MinTicks, ev.Ticks)
+		}
+	}
+	if b != nil {
+		b.Size = dec.Offset() - b.Offset
+	}
+	if idx.MinTs == math.MaxInt64 {
+		idx.MinTs, idx.MinTicks = 0, 0
+	}
+	idx.Version, idx.Size = dec.Version(), dec.Offset()
+	return idx, nil
+}
+
+// ReadIndex reads an index written by Index.Write from r.
+func ReadIndex(r io.Reader) (*Index, error) {
+	var idx Index
+	if err := json.NewDecoder(r).Decode(&idx); err != nil {
+		return nil, err
+	} else if idx.Format != indexFormat {
+		return nil, fmt.Errorf("unsupported index format %d", idx.Format)
+	}
+	return &idx, nil
+}
+
+// Write writes the index to w.
+func (idx *Index) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(idx)
+}
+
+// Overlapping returns the batches that contain events with a timestamp
+// between minTs and maxTs (inclusive) on the P p. A maxTs of -1 means there
+// is no upper limit and a p of -1 matches all Ps.
+func (idx *Index) Overlapping(minTs, maxTs, p int64) []IndexBatch {
+	var batches []IndexBatch
+	for _, b := range idx.Batches {
+		if b.MaxTs < minTs ||
+			(maxTs != -1 && b.MinTs > maxTs) ||
+			(p != -1 && !slices.Contains(b.Ps, p)) {
+			continue
+		}
+		batches = append(batches, b)
+	}
+	return batches
+}
@@ -0,0 +1,171 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// contextOf is the context of an event that is compared between sequential
+// and indexed decoding.
+type contextOf struct {
+	Offset int64
+	Type   EventType
+	Ts     int64
+	M      int64
+	P      int64
+	G      uint64
+	Stack  int
+}
+
+// TestIndex tests that decoding every batch of an index with Seek returns
+// the same events and context as decoding the trace sequentially.
+func TestIndex(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.6", "simple.trace"},
+		{"1.11", "simple.trace"},
+		{"1.19", "trace.bin"},
+		{"1.21", "task.trace"},
+		{"1.25", "test-encoding-json.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+
+			// Decode the trace sequentially
+			var want []contextOf
+			dec := NewContextDecoder(bytes.NewReader(data))
+			for {
+				offset := max(dec.Offset(), 16)
+				var ev ContextEvent
+				if err := dec.Decode(&ev); err != nil {
+					require.Equal(t, io.EOF, err)
+					break
+				}
+				want = append(want, contextOf{offset, ev.Type, ev.Ts, ev.M, ev.P, ev.G, len(ev.Stack)})
+			}
+
+			// Build the index and check that it survives a round trip
+			idx, err := BuildIndex(bytes.NewReader(data))
+			require.NoError(t, err)
+			require.Equal(t, int64(len(data)), idx.Size)
+			require.Equal(t, dec.Version(), idx.Version)
+			var buf bytes.Buffer
+			require.NoError(t, idx.Write(&buf))
+			readIdx, err := ReadIndex(&buf)
+			require.NoError(t, err)
+			require.Equal(t, idx, readIdx)
+			clock := NewContextDecoder(bytes.NewReader(data))
+			require.NotZero(t, clock.Frequency())
+			require.Equal(t, idx.MinTs, clock.nanos(idx.MinTicks))
+
+			// Decode every batch of the index
+			var got []contextOf
+			var events int
+			dec = NewContextDecoder(bytes.NewReader(data))
+			dec.SetIndex(idx)
+			for _, b := range idx.Batches {
+				require.NoError(t, dec.Seek(b))
+				events += b.Events
+				for {
+					offset := dec.Offset()
+					var ev ContextEvent
+					if err := dec.Decode(&ev); err != nil {
+						require.Equal(t, io.EOF, err)
+						break
+					}
+					if ev.Ts != 0 {
+						require.GreaterOrEqual(t, ev.Ts, b.MinTs, "event at offset %d", offset)
+						require.LessOrEqual(t, ev.Ts, b.MaxTs, "event at offset %d", offset)
+					}
+					got = append(got, contextOf{offset, ev.Type, ev.Ts, ev.M, ev.P, ev.G, len(ev.Stack)})
+				}
+				require.Equal(t, b.Offset+b.Size, dec.Offset())
+			}
+			require.Equal(t, len(want), events)
+			require.Len(t, got, len(want))
+			for i := range want {
+				require.Equal(t, want[i], got[i], "event %d", i)
+			}
+		})
+	}
+}
+
+// TestIndexOverlapping tests that the batches of a time window and P contain
+// all the events of that window and P.
+func TestIndexOverlapping(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
+	require.NoError(t, err)
+	idx, err := BuildIndex(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	// Pick a window that contains some of the events after the 1s sleep
+	minTs, maxTs := idx.MinTs+1001000000, idx.MinTs+1001200000
+
+	tests := []struct {
+		Name  string
+		MinTs int64
+		MaxTs int64
+		P     int64
+	}{
+		{"all", 0, -1, -1},
+		{"window", minTs, maxTs, -1},
+		{"p", 0, -1, 1},
+		{"window and p", minTs, maxTs, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			// match returns true if ev belongs to the window and P
+			match := func(ev *ContextEvent) bool {
+				return ev.Ts != 0 && ev.Ts >= test.MinTs && (test.MaxTs == -1 || ev.Ts <= test.MaxTs) &&
+					(test.P == -1 || ev.P == test.P)
+			}
+
+			// Count the matching events in the whole trace
+			var want int
+			dec := NewContextDecoder(bytes.NewReader(data))
+			for {
+				var ev ContextEvent
+				if err := dec.Decode(&ev); err != nil {
+					require.Equal(t, io.EOF, err)
+					break
+				} else if match(&ev) {
+					want++
+				}
+			}
+			require.NotZero(t, want)
+
+			// Count the matching events in the overlapping batches
+			var got int
+			batches := idx.Overlapping(test.MinTs, test.MaxTs, test.P)
+			dec = NewContextDecoder(bytes.NewReader(data))
+			dec.SetIndex(idx)
+			for _, b := range batches {
+				require.NoError(t, dec.Seek(b))
+				for {
+					var ev ContextEvent
+					if err := dec.Decode(&ev); err != nil {
+						require.Equal(t, io.EOF, err)
+						break
+					} else if match(&ev) {
+						got++
+					}
+				}
+			}
+			require.Equal(t, want, got)
+			if test.Name != "all" {
+				require.Less(t, len(batches), len(idx.Batches))
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package encoding
+
+import "fmt"
+
+// Limits bounds the memory a Decoder allocates for a single event, so that
+// corrupted or malicious traces can't cause huge allocations. A limit of 0
+// means no limit.
+type Limits struct {
+	// MaxStringLen is the maximum length of Event.Str.
+	MaxStringLen int
+	// MaxArgs is the maximum number of Event.Args.
+	MaxArgs int
+	// MaxEventSize is the maximum size of a single encoded event in bytes.
+	MaxEventSize int
+}
+
+// DefaultLimits are the limits used by NewDecoder. They are far above the
+// size of the events produced by the Go runtime, which writes events into
+// 64 KiB buffers and limits stacks to a few hundred frames.
+var DefaultLimits = Limits{
+	MaxStringLen: 1 << 20,
+	MaxArgs:      1 << 16,
+	MaxEventSize: 1 << 20,
+}
+
+// checkLimit returns an error if n exceeds max.
+func checkLimit(what string, n uint64, max int) error {
+	if max > 0 && n > uint64(max) {
+		return fmt.Errorf("%w: %s %d > %d", ErrLimitExceeded, what, n, max)
+	}
+	return nil
+}
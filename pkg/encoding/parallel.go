@@ -0,0 +1,371 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// DecodeParallel decodes the trace of the given size read from r on multiple
+// goroutines. The trace is split into frames at batch boundaries by a fast
+// scan that doesn't decode the events. Every frame is passed to decode on
+// one of the workers as a Decoder that returns io.EOF at the end of the
+// frame. first is true for the frame that starts with the first event of the
+// trace, which directly follows the header. The results of decode are passed
+// to merge on the calling goroutine in the order in which the frames appear
+// in the trace, so the result of merging is the same as decoding the trace
+// sequentially. If workers is <= 0, GOMAXPROCS workers are used.
+//
+// Before go 1.22 a frame is a batch and all events that follow it up to the
+// next batch. For go 1.22+ traces every batch and every event outside of a
+// batch is a frame. DecodeParallel returns the first error returned by
+// decode or merge and waits for all workers to stop before returning.
+// Malformed traces result in the same error as for Decoder, as long as
+// decode returns the errors of the Decoder.
+func DecodeParallel[T any](r io.ReaderAt, size int64, workers int, decode func(dec *Decoder, first bool) (T, error), merge func(T) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// Read the header to determine the version of the trace
+	hdr := NewDecoder(io.NewSectionReader(r, 0, size))
+	if err := hdr.header(); err == io.EOF {
+		// Empty traces have no events
+		return nil
+	} else if err != nil {
+		return &DecodeError{Offset: 0, Err: err}
+	}
+	version := hdr.version
+
+	type job struct {
+		i     int
+		frame frame
+	}
+	type result struct {
+		i     int
+		frame frame
+		val   T
+		err   error
+		end   bool // no more frames
+	}
+	var (
+		wg      sync.WaitGroup
+		jobs    = make(chan job)
+		results = make(chan result, workers)
+		// tokens limits the number of frames that are decoded or waiting to
+		// be merged.
+		tokens = make(chan struct{}, 2*workers)
+		done   = make(chan struct{})
+	)
+	defer wg.Wait()
+	defer close(done)
+
+	// Scan the frames and send them to the workers. The end of the scan is
+	// sent as the result after the last frame.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		n := scanFrames(r, size, version, func(i int, f frame) bool {
+			select {
+			case tokens <- struct{}{}:
+			case <-done:
+				return false
+			}
+			select {
+			case jobs <- job{i: i, frame: f}:
+				return true
+			case <-done:
+				return false
+			}
+		})
+		select {
+		case results <- result{i: n, end: true}:
+		case <-done:
+		}
+	}()
+
+	// Decode the frames
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				sr := io.NewSectionReader(r, j.frame.offset, j.frame.size)
+				val, err := decode(newDecoderAt(sr, version, j.frame.offset), j.i == 0)
+				select {
+				case results <- result{i: j.i, frame: j.frame, val: val, err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	// Merge the results in the order of the frames
+	pending := make(map[int]result)
+	for next := 0; ; next++ {
+		res, ok := pending[next]
+		for !ok {
+			res = <-results
+			if ok = res.i == next; !ok {
+				pending[res.i] = res
+			}
+		}
+		delete(pending, next)
+
+		if end := res.frame.offset + res.frame.size; errors.Is(res.err, io.ErrUnexpectedEOF) && end < size {
+			// The size of a go 1.22+ batch doesn't match its events. Decode
+			// the rest of the trace like Decoder, which ignores the size.
+			sr := io.NewSectionReader(r, res.frame.offset, size-res.frame.offset)
+			val, err := decode(newDecoderAt(sr, version, res.frame.offset), res.i == 0)
+			if err != nil {
+				return err
+			}
+			return merge(val)
+		} else if res.err != nil {
+			return res.err
+		} else if res.end {
+			return nil
+		} else if err := merge(res.val); err != nil {
+			return err
+		}
+		<-tokens
+	}
+}
+
+// frame is a part of a trace that can be decoded independently of the rest
+// of the trace.
+type frame struct {
+	offset int64
+	size   int64
+}
+
+// scanFrames splits the events of the trace of the given size read from r
+// into frames and calls emit for each of them. It stops when emit returns
+// false and returns the number of frames. If an event can't be skipped, the
+// rest of the trace is emitted as the last frame, so that decoding it returns
+// the same error as decoding the trace sequentially.
+func scanFrames(r io.ReaderAt, size int64, version int, emit func(i int, f frame) bool) int {
+	const headerSize = 16
+	s := &frameScanner{
+		r:       r,
+		size:    size,
+		buf:     make([]byte, 1<<20),
+		start:   headerSize,
+		version: version,
+	}
+
+	var (
+		n     int   // number of frames
+		start int64 = headerSize
+	)
+	for {
+		offset := s.Offset()
+		isBatch, err := s.skipEvent()
+		if err == io.EOF && s.Offset() == offset {
+			break
+		} else if err != nil {
+			// Let the decoder report the error for the rest of the trace
+			if emit(n, frame{offset: start, size: size - start}) {
+				n++
+			}
+			return n
+		}
+
+		// Start a new frame for every batch before go 1.22 and for every
+		// batch or event outside of a batch for go 1.22+ traces.
+		if (isBatch || version >= 1022) && offset > start {
+			if !emit(n, frame{offset: start, size: offset - start}) {
+				return n
+			}
+			n, start = n+1, offset
+		}
+	}
+	if s.Offset() > start {
+		if !emit(n, frame{offset: start, size: s.Offset() - start}) {
+			return n
+		}
+		n++
+	}
+	return n
+}
+
+// frameScanner skips over the events of a trace without decoding them. It
+// works on its own buffer instead of a bufio.Reader to keep the scan much
+// faster than decoding, and doesn't read the events of go 1.22+ batches at
+// all.
+type frameScanner struct {
+	r       io.ReaderAt
+	size    int64  // size of the trace
+	buf     []byte // buffered part of the trace
+	start   int64  // offset of buf[0] in the trace
+	pos     int    // position of the next byte in buf
+	end     int    // number of valid bytes in buf
+	err     error  // read error
+	version int
+	args    [maxTypedArgs]uint64 // scratch buf
+}
+
+// Offset returns the offset of the next byte in the trace.
+func (s *frameScanner) Offset() int64 {
+	return s.start + int64(s.pos)
+}
+
+// fill reads more of the trace into the buffer and returns false if there is
+// nothing left to read.
+func (s *frameScanner) fill() bool {
+	if s.err != nil {
+		return false
+	}
+	// Move the unread bytes to the front of the buffer
+	k := copy(s.buf, s.buf[s.pos:s.end])
+	s.start, s.pos, s.end = s.start+int64(s.pos), 0, k
+
+	want := min(int64(len(s.buf)-k), s.size-(s.start+int64(k)))
+	if want <= 0 {
+		s.err = io.EOF
+		return false
+	}
+	m, err := s.r.ReadAt(s.buf[k:k+int(want)], s.start+int64(k))
+	s.end += m
+	if m < int(want) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		s.err = err
+	}
+	return m > 0
+}
+
+// ReadByte reads a single byte.
+func (s *frameScanner) ReadByte() (byte, error) {
+	if s.pos == s.end && !s.fill() {
+		return 0, s.err
+	}
+	b := s.buf[s.pos]
+	s.pos++
+	return b, nil
+}
+
+// discard skips n bytes. Bytes that aren't buffered yet are never read.
+func (s *frameScanner) discard(n uint64) error {
+	if n <= uint64(s.end-s.pos) {
+		s.pos += int(n)
+		return nil
+	}
+	if n > uint64(s.size-s.Offset()) {
+		s.start, s.pos, s.end = s.size, 0, 0
+		return io.ErrUnexpectedEOF
+	}
+	s.start, s.pos, s.end = s.Offset()+int64(n), 0, 0
+	return nil
+}
+
+// skipVals skips n base-128 varints. Unlike readVal it doesn't check for
+// overflows, the decoder of the frame reports them.
+func (s *frameScanner) skipVals(n uint64) error {
+	for ; n > 0; n-- {
+		for {
+			if s.pos == s.end && !s.fill() {
+				return s.err
+			}
+			b := s.buf[s.pos]
+			s.pos++
+			if b < 0x80 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// skipData skips a base-128 varint length followed by a byte slice of that
+// length.
+func (s *frameScanner) skipData() error {
+	length, err := readVal(s)
+	if err != nil {
+		return err
+	}
+	return s.discard(length)
+}
+
+// skipEvent skips the next event and returns true if it's the start of a
+// batch. A go 1.22+ EventV2Batch is skipped together with its events. This
+// follows the layout used by Decoder.decodeV1 and Decoder.decodeV2.
+func (s *frameScanner) skipEvent() (bool, error) {
+	if s.version >= 1022 {
+		return s.skipEventV2()
+	}
+
+	firstByte, err := s.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	typ := EventType(firstByte & 0b00111111)
+	if _, ok := specV1(s.version, typ); !ok {
+		return false, fmt.Errorf("%w %d", ErrInvalidEventType, typ)
+	}
+
+	narg := uint64(firstByte>>6 + 1)
+	inlineArgs := uint64(4)
+	if s.version < 1007 {
+		narg++
+		inlineArgs++
+	}
+
+	switch {
+	case typ == EventString:
+		err = s.skipVals(1)
+		if err == nil {
+			err = s.skipData()
+		}
+	case narg < inlineArgs:
+		err = s.skipVals(narg)
+	default:
+		err = s.skipData()
+	}
+	if err == nil && typ == EventUserLog {
+		err = s.skipData()
+	}
+	return typ == EventBatch, err
+}
+
+// skipEventV2 skips the next event of a go 1.22+ trace.
+func (s *frameScanner) skipEventV2() (bool, error) {
+	typ, err := s.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	t := EventType(typ) + eventTypeV2Offset
+	spec, ok := specV2(s.version, t)
+	if !ok || typ >= eventTypeV2Offset {
+		return false, fmt.Errorf("%w %d", ErrInvalidEventType, typ)
+	}
+
+	// Read the fixed arguments
+	args := s.args[:spec.nargs(s.version)]
+	for i := range args {
+		if args[i], err = readVal(s); err != nil {
+			return false, err
+		}
+	}
+
+	switch {
+	case t == EventV2Batch:
+		// Skip the events of the batch
+		batch := Event{Type: t, Args: args}
+		header, err := batch.AsV2Batch(s.version)
+		if err != nil {
+			return false, err
+		}
+		return true, s.discard(header.Size)
+	case spec.isStack:
+		err = s.skipVals(args[1] * 4)
+	case spec.hasData:
+		err = s.skipData()
+	}
+	return t == EventV2ExperimentalBatch, err
+}
@@ -0,0 +1,179 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestDecodeParallel tests that DecodeParallel returns the same events as
+// Decoder.
+func TestDecodeParallel(t *testing.T) {
+	traces, err := filepath.Glob(filepath.Join("..", "..", "testdata", "*", "*.trace"))
+	require.NoError(t, err)
+	traces = append(traces, filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
+
+	for _, trace := range traces {
+		t.Run(trace, func(t *testing.T) {
+			data, err := os.ReadFile(trace)
+			require.NoError(t, err)
+
+			// Decode the trace sequentially
+			var want []Event
+			dec := NewDecoder(bytes.NewReader(data))
+			for {
+				var ev Event
+				if err := dec.Decode(&ev); err != nil {
+					require.Equal(t, io.EOF, err)
+					break
+				}
+				want = append(want, ev)
+			}
+
+			for _, workers := range []int{1, 4} {
+				got, err := decodeParallel(data, workers)
+				require.NoError(t, err)
+				require.Equal(t, want, got)
+			}
+		})
+	}
+}
+
+// TestDecodeParallelErrors tests that DecodeParallel returns the same error
+// as Decoder for truncated traces.
+func TestDecodeParallelErrors(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.19", "trace.bin"},
+		{"1.25", "test-encoding-json.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+			for _, size := range []int{0, 8, len(data) / 2, len(data) - 1} {
+				// Decode the truncated trace sequentially
+				var wantErr error
+				dec := NewDecoder(bytes.NewReader(data[:size]))
+				for wantErr == nil {
+					wantErr = dec.Decode(&Event{})
+				}
+				if wantErr == io.EOF {
+					wantErr = nil
+				}
+
+				_, err := decodeParallel(data[:size], 4)
+				require.Equal(t, wantErr, err, "size %d", size)
+			}
+		})
+	}
+}
+
+// decodeParallel decodes all events of data with DecodeParallel.
+func decodeParallel(data []byte, workers int) ([]Event, error) {
+	var events []Event
+	err := DecodeParallel(bytes.NewReader(data), int64(len(data)), workers, func(dec *Decoder, _ bool) ([]Event, error) {
+		var events []Event
+		for {
+			var ev Event
+			if err := dec.Decode(&ev); err == io.EOF {
+				return events, nil
+			} else if err != nil {
+				return nil, err
+			}
+			events = append(events, ev)
+		}
+	}, func(batch []Event) error {
+		events = append(events, batch...)
+		return nil
+	})
+	return events, err
+}
+
+// BenchmarkDecode measures the speed of decoding a trace sequentially. It
+// serves as the baseline for BenchmarkDecodeParallel.
+func BenchmarkDecode(b *testing.B) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "staticcheck.trace"))
+	require.NoError(b, err)
+	b.SetBytes(int64(len(data)))
+
+	for b.Loop() {
+		dec := NewDecoder(bytes.NewReader(data))
+		var ev Event
+		for {
+			if err := dec.Decode(&ev); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkDecodeParallel measures the speed of decoding a trace with
+// DecodeParallel.
+func BenchmarkDecodeParallel(b *testing.B) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "staticcheck.trace"))
+	require.NoError(b, err)
+	b.SetBytes(int64(len(data)))
+
+	for b.Loop() {
+		err := DecodeParallel(bytes.NewReader(data), int64(len(data)), 0, func(dec *Decoder, _ bool) (int, error) {
+			var ev Event
+			for n := 0; ; n++ {
+				if err := dec.Decode(&ev); err == io.EOF {
+					return n, nil
+				} else if err != nil {
+					return 0, err
+				}
+			}
+		}, func(int) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// FuzzDecodeParallel tests that DecodeParallel returns the same events and
+// errors as Decoder for arbitrary inputs.
+func FuzzDecodeParallel(f *testing.F) {
+	traces, err := filepath.Glob(filepath.Join("..", "..", "testdata", "*", "*.trace"))
+	require.NoError(f, err)
+	for _, trace := range traces {
+		data, err := os.ReadFile(trace)
+		require.NoError(f, err)
+		// Use only the beginning of each trace to keep the fuzzer fast.
+		f.Add(data[:min(len(data), 4096)])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var (
+			want    []Event
+			wantErr error
+		)
+		dec := NewDecoder(bytes.NewReader(data))
+		for {
+			var ev Event
+			if wantErr = dec.Decode(&ev); wantErr == io.EOF {
+				wantErr = nil
+				break
+			} else if wantErr != nil {
+				break
+			}
+			want = append(want, ev)
+		}
+
+		got, err := decodeParallel(data, 4)
+		require.Equal(t, wantErr, err)
+		if err == nil {
+			require.Equal(t, want, got)
+		}
+	})
+}
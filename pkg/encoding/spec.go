@@ -0,0 +1,294 @@
+package encoding
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// eventSpec describes the wire layout of an event type.
+type eventSpec struct {
+	// layout lists the names of the fixed arguments of the event in wire
+	// order, separated by spaces. Arguments that refer to the string or
+	// stack table are suffixed with ":string" or ":stack". Arguments that
+	// were added in a later version are suffixed with "@<version>",
+	// arguments that were removed are suffixed with "<<version>". The names
+	// are used as the field names of the typed event views in typed_gen.go.
+	layout string
+	// minVersion is the first trace version that contains the event.
+	minVersion int
+	// isStack is true if the args are followed by a variable number of
+	// stack frames. The number of frames is given by the second argument.
+	isStack bool
+	// hasData is true if the args are followed by a varint length and a
+	// byte slice of that length which is stored in Event.Str.
+	hasData bool
+	// args is the parsed layout.
+	args []argSpec
+}
+
+// argSpec describes a single argument of an event type.
+type argSpec struct {
+	// name of the argument.
+	name string
+	// ref is the kind of table the argument refers to.
+	ref argRef
+	// minVersion is the first trace version that contains the argument or 0.
+	minVersion int
+	// maxVersion is the first trace version that no longer contains the
+	// argument or 0.
+	maxVersion int
+}
+
+// argRef is the kind of table an argument refers to.
+type argRef int
+
+const (
+	refNone   argRef = iota // not a reference
+	refString               // string id
+	refStack                // stack id
+)
+
+// in returns true if the argument exists in a trace of the given version.
+func (a argSpec) in(version int) bool {
+	return version >= a.minVersion && (a.maxVersion == 0 || version < a.maxVersion)
+}
+
+// nargs returns the number of fixed arguments of the event in a trace of the
+// given version.
+func (s *eventSpec) nargs(version int) int {
+	var n int
+	for _, arg := range s.args {
+		if arg.in(version) {
+			n++
+		}
+	}
+	return n
+}
+
+// frameArgs returns the number of arguments per stack frame in a trace of
+// the given version. Before go 1.7 stack frames only contained the PC.
+func frameArgs(version int) int {
+	if version < 1007 {
+		return 1
+	}
+	return 4
+}
+
+// eventSpecsV1 describes the wire layout of events before go 1.22. This is
+// based on argNum and EventDescriptions from src/internal/trace/parser.go in
+// the Go source tree. Before go 1.7 all timestamped events started with a
+// sequence number delta.
+var eventSpecsV1 = [EventCount]eventSpec{
+	EventBatch:             {layout: "P Seq<1007 Ts", minVersion: 1005},
+	EventFrequency:         {layout: "Freq Unused<1007", minVersion: 1005},
+	EventStack:             {layout: "ID NFrames", minVersion: 1005, isStack: true},
+	EventGomaxprocs:        {layout: "SeqDelta<1007 TsDelta Procs Stack:stack", minVersion: 1005},
+	EventProcStart:         {layout: "SeqDelta<1007 TsDelta Thread", minVersion: 1005},
+	EventProcStop:          {layout: "SeqDelta<1007 TsDelta", minVersion: 1005},
+	EventGCStart:           {layout: "SeqDelta<1007 TsDelta Seq@1007 Stack:stack", minVersion: 1005},
+	EventGCDone:            {layout: "SeqDelta<1007 TsDelta", minVersion: 1005},
+	EventGCSTWStart:        {layout: "SeqDelta<1007 TsDelta Kind@1010", minVersion: 1005},
+	EventGCSTWDone:         {layout: "SeqDelta<1007 TsDelta", minVersion: 1005},
+	EventGCSweepStart:      {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGCSweepDone:       {layout: "SeqDelta<1007 TsDelta Swept@1009 Reclaimed@1009", minVersion: 1005},
+	EventGoCreate:          {layout: "SeqDelta<1007 TsDelta NewG NewStack:stack Stack:stack", minVersion: 1005},
+	EventGoStart:           {layout: "SeqDelta<1007 TsDelta G GSeq@1007", minVersion: 1005},
+	EventGoEnd:             {layout: "SeqDelta<1007 TsDelta", minVersion: 1005},
+	EventGoStop:            {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoSched:           {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoPreempt:         {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoSleep:           {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoBlock:           {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoUnblock:         {layout: "SeqDelta<1007 TsDelta G GSeq@1007 Stack:stack", minVersion: 1005},
+	EventGoBlockSend:       {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoBlockRecv:       {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoBlockSelect:     {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoBlockSync:       {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoBlockCond:       {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoBlockNet:        {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoSysCall:         {layout: "SeqDelta<1007 TsDelta Stack:stack", minVersion: 1005},
+	EventGoSysExit:         {layout: "SeqDelta<1007 TsDelta G GSeq RealTs", minVersion: 1005},
+	EventGoSysBlock:        {layout: "SeqDelta<1007 TsDelta", minVersion: 1005},
+	EventGoWaiting:         {layout: "SeqDelta<1007 TsDelta G", minVersion: 1005},
+	EventGoInSyscall:       {layout: "SeqDelta<1007 TsDelta G", minVersion: 1005},
+	EventHeapAlloc:         {layout: "SeqDelta<1007 TsDelta Mem", minVersion: 1005},
+	EventHeapGoal:          {layout: "SeqDelta<1007 TsDelta Mem", minVersion: 1005},
+	EventTimerGoroutine:    {layout: "G Unused<1007", minVersion: 1005},
+	EventFutileWakeup:      {layout: "SeqDelta<1007 TsDelta", minVersion: 1005},
+	EventString:            {layout: "ID", minVersion: 1007, hasData: true},
+	EventGoStartLocal:      {layout: "TsDelta G", minVersion: 1007},
+	EventGoUnblockLocal:    {layout: "TsDelta G Stack:stack", minVersion: 1007},
+	EventGoSysExitLocal:    {layout: "TsDelta G RealTs", minVersion: 1007},
+	EventGoStartLabel:      {layout: "TsDelta G GSeq Label:string", minVersion: 1008},
+	EventGoBlockGC:         {layout: "TsDelta Stack:stack", minVersion: 1008},
+	EventGCMarkAssistStart: {layout: "TsDelta Stack:stack", minVersion: 1009},
+	EventGCMarkAssistDone:  {layout: "TsDelta", minVersion: 1009},
+	EventUserTaskCreate:    {layout: "TsDelta Task ParentTask Name:string Stack:stack", minVersion: 1011},
+	EventUserTaskEnd:       {layout: "TsDelta Task Stack:stack", minVersion: 1011},
+	EventUserRegion:        {layout: "TsDelta Task Mode Name:string Stack:stack", minVersion: 1011},
+	EventUserLog:           {layout: "TsDelta Task Key:string Stack:stack", minVersion: 1011, hasData: true},
+	EventCPUSample:         {layout: "TsDelta RealTs P G Stack:stack", minVersion: 1019},
+}
+
+// eventSpecsV2 describes the wire layout of go 1.22+ events. This is based
+// on src/internal/trace/tracev2/spec.go in the Go source tree. Events that
+// are missing from this table are invalid.
+var eventSpecsV2 = [EventV2Count - eventTypeV2Offset]eventSpec{
+	EventV2Batch - eventTypeV2Offset:               {layout: "Gen M Ts Size", minVersion: 1022},
+	EventV2Stacks - eventTypeV2Offset:              {layout: "", minVersion: 1022},
+	EventV2Stack - eventTypeV2Offset:               {layout: "ID NFrames", minVersion: 1022, isStack: true},
+	EventV2Strings - eventTypeV2Offset:             {layout: "", minVersion: 1022},
+	EventV2String - eventTypeV2Offset:              {layout: "ID", minVersion: 1022, hasData: true},
+	EventV2CPUSamples - eventTypeV2Offset:          {layout: "", minVersion: 1022},
+	EventV2CPUSample - eventTypeV2Offset:           {layout: "Ts M P G Stack:stack", minVersion: 1022},
+	EventV2Frequency - eventTypeV2Offset:           {layout: "Freq", minVersion: 1022},
+	EventV2ProcsChange - eventTypeV2Offset:         {layout: "TsDelta Procs Stack:stack", minVersion: 1022},
+	EventV2ProcStart - eventTypeV2Offset:           {layout: "TsDelta P PSeq", minVersion: 1022},
+	EventV2ProcStop - eventTypeV2Offset:            {layout: "TsDelta", minVersion: 1022},
+	EventV2ProcSteal - eventTypeV2Offset:           {layout: "TsDelta P PSeq M", minVersion: 1022},
+	EventV2ProcStatus - eventTypeV2Offset:          {layout: "TsDelta P Status", minVersion: 1022},
+	EventV2GoCreate - eventTypeV2Offset:            {layout: "TsDelta NewG NewStack:stack Stack:stack", minVersion: 1022},
+	EventV2GoCreateSyscall - eventTypeV2Offset:     {layout: "TsDelta NewG", minVersion: 1022},
+	EventV2GoStart - eventTypeV2Offset:             {layout: "TsDelta G GSeq", minVersion: 1022},
+	EventV2GoDestroy - eventTypeV2Offset:           {layout: "TsDelta", minVersion: 1022},
+	EventV2GoDestroySyscall - eventTypeV2Offset:    {layout: "TsDelta", minVersion: 1022},
+	EventV2GoStop - eventTypeV2Offset:              {layout: "TsDelta Reason:string Stack:stack", minVersion: 1022},
+	EventV2GoBlock - eventTypeV2Offset:             {layout: "TsDelta Reason:string Stack:stack", minVersion: 1022},
+	EventV2GoUnblock - eventTypeV2Offset:           {layout: "TsDelta G GSeq Stack:stack", minVersion: 1022},
+	EventV2GoSyscallBegin - eventTypeV2Offset:      {layout: "TsDelta PSeq Stack:stack", minVersion: 1022},
+	EventV2GoSyscallEnd - eventTypeV2Offset:        {layout: "TsDelta", minVersion: 1022},
+	EventV2GoSyscallEndBlocked - eventTypeV2Offset: {layout: "TsDelta", minVersion: 1022},
+	EventV2GoStatus - eventTypeV2Offset:            {layout: "TsDelta G M Status", minVersion: 1022},
+	EventV2STWBegin - eventTypeV2Offset:            {layout: "TsDelta Kind:string Stack:stack", minVersion: 1022},
+	EventV2STWEnd - eventTypeV2Offset:              {layout: "TsDelta", minVersion: 1022},
+	EventV2GCActive - eventTypeV2Offset:            {layout: "TsDelta Seq", minVersion: 1022},
+	EventV2GCBegin - eventTypeV2Offset:             {layout: "TsDelta Seq Stack:stack", minVersion: 1022},
+	EventV2GCEnd - eventTypeV2Offset:               {layout: "TsDelta Seq", minVersion: 1022},
+	EventV2GCSweepActive - eventTypeV2Offset:       {layout: "TsDelta P", minVersion: 1022},
+	EventV2GCSweepBegin - eventTypeV2Offset:        {layout: "TsDelta Stack:stack", minVersion: 1022},
+	EventV2GCSweepEnd - eventTypeV2Offset:          {layout: "TsDelta Swept Reclaimed", minVersion: 1022},
+	EventV2GCMarkAssistActive - eventTypeV2Offset:  {layout: "TsDelta G", minVersion: 1022},
+	EventV2GCMarkAssistBegin - eventTypeV2Offset:   {layout: "TsDelta Stack:stack", minVersion: 1022},
+	EventV2GCMarkAssistEnd - eventTypeV2Offset:     {layout: "TsDelta", minVersion: 1022},
+	EventV2HeapAlloc - eventTypeV2Offset:           {layout: "TsDelta Mem", minVersion: 1022},
+	EventV2HeapGoal - eventTypeV2Offset:            {layout: "TsDelta Mem", minVersion: 1022},
+	EventV2GoLabel - eventTypeV2Offset:             {layout: "TsDelta Label:string", minVersion: 1022},
+	EventV2UserTaskBegin - eventTypeV2Offset:       {layout: "TsDelta Task ParentTask Name:string Stack:stack", minVersion: 1022},
+	EventV2UserTaskEnd - eventTypeV2Offset:         {layout: "TsDelta Task Stack:stack", minVersion: 1022},
+	EventV2UserRegionBegin - eventTypeV2Offset:     {layout: "TsDelta Task Name:string Stack:stack", minVersion: 1022},
+	EventV2UserRegionEnd - eventTypeV2Offset:       {layout: "TsDelta Task Name:string Stack:stack", minVersion: 1022},
+	EventV2UserLog - eventTypeV2Offset:             {layout: "TsDelta Task Key:string Value:string Stack:stack", minVersion: 1022},
+	EventV2GoSwitch - eventTypeV2Offset:            {layout: "TsDelta G GSeq", minVersion: 1023},
+	EventV2GoSwitchDestroy - eventTypeV2Offset:     {layout: "TsDelta G GSeq", minVersion: 1023},
+	EventV2GoCreateBlocked - eventTypeV2Offset:     {layout: "TsDelta NewG NewStack:stack Stack:stack", minVersion: 1023},
+	EventV2GoStatusStack - eventTypeV2Offset:       {layout: "TsDelta G M Status Stack:stack", minVersion: 1023},
+	EventV2ExperimentalBatch - eventTypeV2Offset:   {layout: "Experiment Gen M Ts", minVersion: 1023, hasData: true},
+	EventV2Sync - eventTypeV2Offset:                {layout: "", minVersion: 1025},
+	EventV2ClockSnapshot - eventTypeV2Offset:       {layout: "TsDelta Mono Sec Nsec", minVersion: 1025},
+	EventV2EndOfGeneration - eventTypeV2Offset:     {layout: "", minVersion: 1026},
+}
+
+func init() {
+	for i := range eventSpecsV1 {
+		eventSpecsV1[i].args = parseLayout(eventSpecsV1[i].layout)
+	}
+	for i := range eventSpecsV2 {
+		eventSpecsV2[i].args = parseLayout(eventSpecsV2[i].layout)
+	}
+}
+
+// parseLayout parses the layout of an eventSpec. It panics if the layout is
+// malformed.
+func parseLayout(layout string) []argSpec {
+	var args []argSpec
+	for _, field := range strings.Fields(layout) {
+		var (
+			arg        = argSpec{name: field}
+			version    string
+			minVersion bool
+		)
+		if i := strings.IndexAny(field, "@<"); i >= 0 {
+			arg.name, version, minVersion = field[:i], field[i+1:], field[i] == '@'
+		}
+		if name, ref, ok := strings.Cut(arg.name, ":"); ok {
+			arg.name = name
+			switch ref {
+			case "string":
+				arg.ref = refString
+			case "stack":
+				arg.ref = refStack
+			default:
+				panic(fmt.Sprintf("bad event layout %q: unknown reference %q", layout, ref))
+			}
+		}
+		if version != "" {
+			v, err := strconv.Atoi(version)
+			if err != nil {
+				panic(fmt.Sprintf("bad event layout %q: %s", layout, err))
+			} else if minVersion {
+				arg.minVersion = v
+			} else {
+				arg.maxVersion = v
+			}
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// specV1 returns the wire layout of the pre go 1.22 event type t in a trace
+// of the given version. It returns false if t is not valid for the version.
+func specV1(version int, t EventType) (eventSpec, bool) {
+	if t <= EventNone || t >= EventCount {
+		return eventSpec{}, false
+	}
+	spec := eventSpecsV1[t]
+	if spec.minVersion > version {
+		return eventSpec{}, false
+	}
+	return spec, true
+}
+
+// specV2 returns the wire layout of the go 1.22+ event type t in a trace of
+// the given version. It returns false if t is not valid for the version.
+func specV2(version int, t EventType) (eventSpec, bool) {
+	if t <= EventV2None || t >= EventV2Count {
+		return eventSpec{}, false
+	}
+	spec := eventSpecsV2[t-eventTypeV2Offset]
+	if spec.minVersion == 0 || spec.minVersion > version {
+		return eventSpec{}, false
+	}
+	return spec, true
+}
+
+// specFor returns the wire layout of the event type t in a trace of the given
+// version. It returns false if t is not valid for the version.
+func specFor(version int, t EventType) (eventSpec, bool) {
+	if version >= 1022 {
+		return specV2(version, t)
+	}
+	return specV1(version, t)
+}
+
+// checkEvent returns an error if ev is not a valid event for a trace of the
+// given version.
+func checkEvent(version int, ev *Event) error {
+	spec, ok := specFor(version, ev.Type)
+	if !ok {
+		return fmt.Errorf("invalid event type %v for version %d", ev.Type, version)
+	}
+
+	// Stacks are followed by a variable number of frames
+	narg := spec.nargs(version)
+	if spec.isStack && len(ev.Args) >= narg {
+		narg += int(ev.Args[1]) * frameArgs(version)
+	}
+	if len(ev.Args) != narg {
+		return fmt.Errorf("%v has %d arguments, want %d for version %d", ev.Type, len(ev.Args), narg, version)
+	} else if !spec.hasData && len(ev.Str) > 0 {
+		return fmt.Errorf("%v can't have a string for version %d", ev.Type, version)
+	}
+	return nil
+}
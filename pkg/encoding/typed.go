@@ -0,0 +1,149 @@
+package encoding
+
+import "fmt"
+
+//go:generate go test -run TestTypedGenerated -update
+
+// maxTypedArgs is the maximum number of fixed arguments in any event layout.
+const maxTypedArgs = 5
+
+// Frame is a single frame of an EventStack or EventV2Stack event. Before go
+// 1.7 frames only contained the PC.
+type Frame struct {
+	PC   uint64
+	Func uint64 // func string id
+	File uint64 // file string id
+	Line uint64
+}
+
+// typedArgs returns the fixed arguments of e aligned with the layout of the
+// event type t. Arguments that don't exist in the given version are 0. It
+// returns an error if e is not a valid event of type t.
+func (e *Event) typedArgs(version int, t EventType) (args [maxTypedArgs]uint64, err error) {
+	if e.Type != t {
+		return args, fmt.Errorf("can't use %v event as %v", e.Type, t)
+	} else if err := checkEvent(version, e); err != nil {
+		return args, err
+	}
+
+	spec, _ := specFor(version, t)
+	var i int
+	for j, arg := range spec.args {
+		if arg.in(version) {
+			args[j] = e.Args[i]
+			i++
+		}
+	}
+	return args, nil
+}
+
+// frames returns the stack frames of a valid EventStack or EventV2Stack event.
+func (e *Event) frames(version int) []Frame {
+	frames := make([]Frame, 0, e.Args[1])
+	if version < 1007 {
+		for _, pc := range e.Args[2:] {
+			frames = append(frames, Frame{PC: pc})
+		}
+		return frames
+	}
+	for i := 2; i+3 < len(e.Args); i += 4 {
+		frames = append(frames, Frame{
+			PC:   e.Args[i],
+			Func: e.Args[i+1],
+			File: e.Args[i+2],
+			Line: e.Args[i+3],
+		})
+	}
+	return frames
+}
+
+// TsDelta returns the timestamp of e relative to the previous event in the
+// same batch. It returns false if e doesn't have a relative timestamp in a
+// trace of the given version, e.g. for EventBatch, EventStack or EventString.
+func (e *Event) TsDelta(version int) (uint64, bool) {
+	return e.arg(version, "TsDelta")
+}
+
+// arg returns the argument of e with the given name from the event layout. It
+// returns false if e doesn't have the argument in a trace of the given
+// version.
+func (e *Event) arg(version int, name string) (uint64, bool) {
+	i, ok := ArgIndex(version, e.Type, name)
+	if !ok || i >= len(e.Args) {
+		return 0, false
+	}
+	return e.Args[i], true
+}
+
+// ArgIndex returns the index in Event.Args of the argument with the given
+// name of events of type t in a trace of the given version, e.g. 2 for the
+// "GSeq" argument of an EventGoStart since go 1.7. It returns false if there
+// is no such argument.
+func ArgIndex(version int, t EventType, name string) (int, bool) {
+	spec, ok := specFor(version, t)
+	if !ok {
+		return 0, false
+	}
+	var i int
+	for _, arg := range spec.args {
+		if !arg.in(version) {
+			continue
+		} else if arg.name == name {
+			return i, true
+		}
+		i++
+	}
+	return 0, false
+}
+
+// ArgNames returns the names of the fixed arguments of events of type t in a
+// trace of the given version in wire order, e.g. "TsDelta", "NewG",
+// "NewStack" and "Stack" for EventGoCreate. The names match the fields of the
+// typed views. It returns nil if t is not valid for the version.
+func ArgNames(version int, t EventType) []string {
+	spec, ok := specFor(version, t)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, arg := range spec.args {
+		if arg.in(version) {
+			names = append(names, arg.name)
+		}
+	}
+	return names
+}
+
+// RefArgs returns the indexes in Event.Args of the arguments of events of type
+// t that refer to the string table and to the stack table in a trace of the
+// given version, e.g. the "NewStack" and "Stack" arguments of an
+// EventGoCreate. The string ids in the frames of stack events are not
+// included.
+func RefArgs(version int, t EventType) (strings, stacks []int) {
+	spec, ok := specFor(version, t)
+	if !ok {
+		return nil, nil
+	}
+	var i int
+	for _, arg := range spec.args {
+		if !arg.in(version) {
+			continue
+		}
+		switch arg.ref {
+		case refString:
+			strings = append(strings, i)
+		case refStack:
+			stacks = append(stacks, i)
+		}
+		i++
+	}
+	return strings, stacks
+}
+
+// HasData returns true if events of type t are followed by a byte slice that
+// is stored in Event.Str in a trace of the given version, e.g. the string of
+// an EventString or the message of an EventUserLog.
+func HasData(version int, t EventType) bool {
+	spec, ok := specFor(version, t)
+	return ok && spec.hasData
+}
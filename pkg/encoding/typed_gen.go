@@ -0,0 +1,2083 @@
+// Code generated by "go test -run TestTypedGenerated -update"; DO NOT EDIT.
+
+package encoding
+
+// BatchEvent is the typed view of EventBatch.
+type BatchEvent struct {
+	P   uint64
+	Seq uint64 // before go 1.7
+	Ts  uint64
+}
+
+// AsBatch returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventBatch event.
+func (e *Event) AsBatch(version int) (BatchEvent, error) {
+	args, err := e.typedArgs(version, EventBatch)
+	if err != nil {
+		return BatchEvent{}, err
+	}
+	return BatchEvent{
+		P:   args[0],
+		Seq: args[1],
+		Ts:  args[2],
+	}, nil
+}
+
+// FrequencyEvent is the typed view of EventFrequency.
+type FrequencyEvent struct {
+	Freq   uint64
+	Unused uint64 // before go 1.7
+}
+
+// AsFrequency returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventFrequency event.
+func (e *Event) AsFrequency(version int) (FrequencyEvent, error) {
+	args, err := e.typedArgs(version, EventFrequency)
+	if err != nil {
+		return FrequencyEvent{}, err
+	}
+	return FrequencyEvent{
+		Freq:   args[0],
+		Unused: args[1],
+	}, nil
+}
+
+// StackEvent is the typed view of EventStack.
+type StackEvent struct {
+	ID      uint64
+	NFrames uint64
+	Frames  []Frame
+}
+
+// AsStack returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventStack event.
+func (e *Event) AsStack(version int) (StackEvent, error) {
+	args, err := e.typedArgs(version, EventStack)
+	if err != nil {
+		return StackEvent{}, err
+	}
+	return StackEvent{
+		ID:      args[0],
+		NFrames: args[1],
+		Frames:  e.frames(version),
+	}, nil
+}
+
+// GomaxprocsEvent is the typed view of EventGomaxprocs.
+type GomaxprocsEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Procs    uint64
+	Stack    uint64 // stack id
+}
+
+// AsGomaxprocs returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGomaxprocs event.
+func (e *Event) AsGomaxprocs(version int) (GomaxprocsEvent, error) {
+	args, err := e.typedArgs(version, EventGomaxprocs)
+	if err != nil {
+		return GomaxprocsEvent{}, err
+	}
+	return GomaxprocsEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Procs:    args[2],
+		Stack:    args[3],
+	}, nil
+}
+
+// ProcStartEvent is the typed view of EventProcStart.
+type ProcStartEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Thread   uint64
+}
+
+// AsProcStart returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventProcStart event.
+func (e *Event) AsProcStart(version int) (ProcStartEvent, error) {
+	args, err := e.typedArgs(version, EventProcStart)
+	if err != nil {
+		return ProcStartEvent{}, err
+	}
+	return ProcStartEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Thread:   args[2],
+	}, nil
+}
+
+// ProcStopEvent is the typed view of EventProcStop.
+type ProcStopEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+}
+
+// AsProcStop returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventProcStop event.
+func (e *Event) AsProcStop(version int) (ProcStopEvent, error) {
+	args, err := e.typedArgs(version, EventProcStop)
+	if err != nil {
+		return ProcStopEvent{}, err
+	}
+	return ProcStopEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+	}, nil
+}
+
+// GCStartEvent is the typed view of EventGCStart.
+type GCStartEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Seq      uint64 // since go 1.7
+	Stack    uint64 // stack id
+}
+
+// AsGCStart returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGCStart event.
+func (e *Event) AsGCStart(version int) (GCStartEvent, error) {
+	args, err := e.typedArgs(version, EventGCStart)
+	if err != nil {
+		return GCStartEvent{}, err
+	}
+	return GCStartEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Seq:      args[2],
+		Stack:    args[3],
+	}, nil
+}
+
+// GCDoneEvent is the typed view of EventGCDone.
+type GCDoneEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+}
+
+// AsGCDone returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGCDone event.
+func (e *Event) AsGCDone(version int) (GCDoneEvent, error) {
+	args, err := e.typedArgs(version, EventGCDone)
+	if err != nil {
+		return GCDoneEvent{}, err
+	}
+	return GCDoneEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+	}, nil
+}
+
+// GCSTWStartEvent is the typed view of EventGCSTWStart.
+type GCSTWStartEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Kind     uint64 // since go 1.10
+}
+
+// AsGCSTWStart returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGCSTWStart event.
+func (e *Event) AsGCSTWStart(version int) (GCSTWStartEvent, error) {
+	args, err := e.typedArgs(version, EventGCSTWStart)
+	if err != nil {
+		return GCSTWStartEvent{}, err
+	}
+	return GCSTWStartEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Kind:     args[2],
+	}, nil
+}
+
+// GCSTWDoneEvent is the typed view of EventGCSTWDone.
+type GCSTWDoneEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+}
+
+// AsGCSTWDone returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGCSTWDone event.
+func (e *Event) AsGCSTWDone(version int) (GCSTWDoneEvent, error) {
+	args, err := e.typedArgs(version, EventGCSTWDone)
+	if err != nil {
+		return GCSTWDoneEvent{}, err
+	}
+	return GCSTWDoneEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+	}, nil
+}
+
+// GCSweepStartEvent is the typed view of EventGCSweepStart.
+type GCSweepStartEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGCSweepStart returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGCSweepStart event.
+func (e *Event) AsGCSweepStart(version int) (GCSweepStartEvent, error) {
+	args, err := e.typedArgs(version, EventGCSweepStart)
+	if err != nil {
+		return GCSweepStartEvent{}, err
+	}
+	return GCSweepStartEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GCSweepDoneEvent is the typed view of EventGCSweepDone.
+type GCSweepDoneEvent struct {
+	SeqDelta  uint64 // before go 1.7
+	TsDelta   uint64
+	Swept     uint64 // since go 1.9
+	Reclaimed uint64 // since go 1.9
+}
+
+// AsGCSweepDone returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGCSweepDone event.
+func (e *Event) AsGCSweepDone(version int) (GCSweepDoneEvent, error) {
+	args, err := e.typedArgs(version, EventGCSweepDone)
+	if err != nil {
+		return GCSweepDoneEvent{}, err
+	}
+	return GCSweepDoneEvent{
+		SeqDelta:  args[0],
+		TsDelta:   args[1],
+		Swept:     args[2],
+		Reclaimed: args[3],
+	}, nil
+}
+
+// GoCreateEvent is the typed view of EventGoCreate.
+type GoCreateEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	NewG     uint64
+	NewStack uint64 // stack id
+	Stack    uint64 // stack id
+}
+
+// AsGoCreate returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoCreate event.
+func (e *Event) AsGoCreate(version int) (GoCreateEvent, error) {
+	args, err := e.typedArgs(version, EventGoCreate)
+	if err != nil {
+		return GoCreateEvent{}, err
+	}
+	return GoCreateEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		NewG:     args[2],
+		NewStack: args[3],
+		Stack:    args[4],
+	}, nil
+}
+
+// GoStartEvent is the typed view of EventGoStart.
+type GoStartEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	G        uint64
+	GSeq     uint64 // since go 1.7
+}
+
+// AsGoStart returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoStart event.
+func (e *Event) AsGoStart(version int) (GoStartEvent, error) {
+	args, err := e.typedArgs(version, EventGoStart)
+	if err != nil {
+		return GoStartEvent{}, err
+	}
+	return GoStartEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		G:        args[2],
+		GSeq:     args[3],
+	}, nil
+}
+
+// GoEndEvent is the typed view of EventGoEnd.
+type GoEndEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+}
+
+// AsGoEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoEnd event.
+func (e *Event) AsGoEnd(version int) (GoEndEvent, error) {
+	args, err := e.typedArgs(version, EventGoEnd)
+	if err != nil {
+		return GoEndEvent{}, err
+	}
+	return GoEndEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+	}, nil
+}
+
+// GoStopEvent is the typed view of EventGoStop.
+type GoStopEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoStop returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoStop event.
+func (e *Event) AsGoStop(version int) (GoStopEvent, error) {
+	args, err := e.typedArgs(version, EventGoStop)
+	if err != nil {
+		return GoStopEvent{}, err
+	}
+	return GoStopEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoSchedEvent is the typed view of EventGoSched.
+type GoSchedEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoSched returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoSched event.
+func (e *Event) AsGoSched(version int) (GoSchedEvent, error) {
+	args, err := e.typedArgs(version, EventGoSched)
+	if err != nil {
+		return GoSchedEvent{}, err
+	}
+	return GoSchedEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoPreemptEvent is the typed view of EventGoPreempt.
+type GoPreemptEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoPreempt returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoPreempt event.
+func (e *Event) AsGoPreempt(version int) (GoPreemptEvent, error) {
+	args, err := e.typedArgs(version, EventGoPreempt)
+	if err != nil {
+		return GoPreemptEvent{}, err
+	}
+	return GoPreemptEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoSleepEvent is the typed view of EventGoSleep.
+type GoSleepEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoSleep returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoSleep event.
+func (e *Event) AsGoSleep(version int) (GoSleepEvent, error) {
+	args, err := e.typedArgs(version, EventGoSleep)
+	if err != nil {
+		return GoSleepEvent{}, err
+	}
+	return GoSleepEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoBlockEvent is the typed view of EventGoBlock.
+type GoBlockEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoBlock returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoBlock event.
+func (e *Event) AsGoBlock(version int) (GoBlockEvent, error) {
+	args, err := e.typedArgs(version, EventGoBlock)
+	if err != nil {
+		return GoBlockEvent{}, err
+	}
+	return GoBlockEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoUnblockEvent is the typed view of EventGoUnblock.
+type GoUnblockEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	G        uint64
+	GSeq     uint64 // since go 1.7
+	Stack    uint64 // stack id
+}
+
+// AsGoUnblock returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoUnblock event.
+func (e *Event) AsGoUnblock(version int) (GoUnblockEvent, error) {
+	args, err := e.typedArgs(version, EventGoUnblock)
+	if err != nil {
+		return GoUnblockEvent{}, err
+	}
+	return GoUnblockEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		G:        args[2],
+		GSeq:     args[3],
+		Stack:    args[4],
+	}, nil
+}
+
+// GoBlockSendEvent is the typed view of EventGoBlockSend.
+type GoBlockSendEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoBlockSend returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoBlockSend event.
+func (e *Event) AsGoBlockSend(version int) (GoBlockSendEvent, error) {
+	args, err := e.typedArgs(version, EventGoBlockSend)
+	if err != nil {
+		return GoBlockSendEvent{}, err
+	}
+	return GoBlockSendEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoBlockRecvEvent is the typed view of EventGoBlockRecv.
+type GoBlockRecvEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoBlockRecv returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoBlockRecv event.
+func (e *Event) AsGoBlockRecv(version int) (GoBlockRecvEvent, error) {
+	args, err := e.typedArgs(version, EventGoBlockRecv)
+	if err != nil {
+		return GoBlockRecvEvent{}, err
+	}
+	return GoBlockRecvEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoBlockSelectEvent is the typed view of EventGoBlockSelect.
+type GoBlockSelectEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoBlockSelect returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoBlockSelect event.
+func (e *Event) AsGoBlockSelect(version int) (GoBlockSelectEvent, error) {
+	args, err := e.typedArgs(version, EventGoBlockSelect)
+	if err != nil {
+		return GoBlockSelectEvent{}, err
+	}
+	return GoBlockSelectEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoBlockSyncEvent is the typed view of EventGoBlockSync.
+type GoBlockSyncEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoBlockSync returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoBlockSync event.
+func (e *Event) AsGoBlockSync(version int) (GoBlockSyncEvent, error) {
+	args, err := e.typedArgs(version, EventGoBlockSync)
+	if err != nil {
+		return GoBlockSyncEvent{}, err
+	}
+	return GoBlockSyncEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoBlockCondEvent is the typed view of EventGoBlockCond.
+type GoBlockCondEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoBlockCond returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoBlockCond event.
+func (e *Event) AsGoBlockCond(version int) (GoBlockCondEvent, error) {
+	args, err := e.typedArgs(version, EventGoBlockCond)
+	if err != nil {
+		return GoBlockCondEvent{}, err
+	}
+	return GoBlockCondEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoBlockNetEvent is the typed view of EventGoBlockNet.
+type GoBlockNetEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoBlockNet returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoBlockNet event.
+func (e *Event) AsGoBlockNet(version int) (GoBlockNetEvent, error) {
+	args, err := e.typedArgs(version, EventGoBlockNet)
+	if err != nil {
+		return GoBlockNetEvent{}, err
+	}
+	return GoBlockNetEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoSysCallEvent is the typed view of EventGoSysCall.
+type GoSysCallEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Stack    uint64 // stack id
+}
+
+// AsGoSysCall returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoSysCall event.
+func (e *Event) AsGoSysCall(version int) (GoSysCallEvent, error) {
+	args, err := e.typedArgs(version, EventGoSysCall)
+	if err != nil {
+		return GoSysCallEvent{}, err
+	}
+	return GoSysCallEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Stack:    args[2],
+	}, nil
+}
+
+// GoSysExitEvent is the typed view of EventGoSysExit.
+type GoSysExitEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	G        uint64
+	GSeq     uint64
+	RealTs   uint64
+}
+
+// AsGoSysExit returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoSysExit event.
+func (e *Event) AsGoSysExit(version int) (GoSysExitEvent, error) {
+	args, err := e.typedArgs(version, EventGoSysExit)
+	if err != nil {
+		return GoSysExitEvent{}, err
+	}
+	return GoSysExitEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		G:        args[2],
+		GSeq:     args[3],
+		RealTs:   args[4],
+	}, nil
+}
+
+// GoSysBlockEvent is the typed view of EventGoSysBlock.
+type GoSysBlockEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+}
+
+// AsGoSysBlock returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoSysBlock event.
+func (e *Event) AsGoSysBlock(version int) (GoSysBlockEvent, error) {
+	args, err := e.typedArgs(version, EventGoSysBlock)
+	if err != nil {
+		return GoSysBlockEvent{}, err
+	}
+	return GoSysBlockEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+	}, nil
+}
+
+// GoWaitingEvent is the typed view of EventGoWaiting.
+type GoWaitingEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	G        uint64
+}
+
+// AsGoWaiting returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoWaiting event.
+func (e *Event) AsGoWaiting(version int) (GoWaitingEvent, error) {
+	args, err := e.typedArgs(version, EventGoWaiting)
+	if err != nil {
+		return GoWaitingEvent{}, err
+	}
+	return GoWaitingEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		G:        args[2],
+	}, nil
+}
+
+// GoInSyscallEvent is the typed view of EventGoInSyscall.
+type GoInSyscallEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	G        uint64
+}
+
+// AsGoInSyscall returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoInSyscall event.
+func (e *Event) AsGoInSyscall(version int) (GoInSyscallEvent, error) {
+	args, err := e.typedArgs(version, EventGoInSyscall)
+	if err != nil {
+		return GoInSyscallEvent{}, err
+	}
+	return GoInSyscallEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		G:        args[2],
+	}, nil
+}
+
+// HeapAllocEvent is the typed view of EventHeapAlloc.
+type HeapAllocEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Mem      uint64
+}
+
+// AsHeapAlloc returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventHeapAlloc event.
+func (e *Event) AsHeapAlloc(version int) (HeapAllocEvent, error) {
+	args, err := e.typedArgs(version, EventHeapAlloc)
+	if err != nil {
+		return HeapAllocEvent{}, err
+	}
+	return HeapAllocEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Mem:      args[2],
+	}, nil
+}
+
+// HeapGoalEvent is the typed view of EventHeapGoal.
+type HeapGoalEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+	Mem      uint64
+}
+
+// AsHeapGoal returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventHeapGoal event.
+func (e *Event) AsHeapGoal(version int) (HeapGoalEvent, error) {
+	args, err := e.typedArgs(version, EventHeapGoal)
+	if err != nil {
+		return HeapGoalEvent{}, err
+	}
+	return HeapGoalEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+		Mem:      args[2],
+	}, nil
+}
+
+// TimerGoroutineEvent is the typed view of EventTimerGoroutine.
+type TimerGoroutineEvent struct {
+	G      uint64
+	Unused uint64 // before go 1.7
+}
+
+// AsTimerGoroutine returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventTimerGoroutine event.
+func (e *Event) AsTimerGoroutine(version int) (TimerGoroutineEvent, error) {
+	args, err := e.typedArgs(version, EventTimerGoroutine)
+	if err != nil {
+		return TimerGoroutineEvent{}, err
+	}
+	return TimerGoroutineEvent{
+		G:      args[0],
+		Unused: args[1],
+	}, nil
+}
+
+// FutileWakeupEvent is the typed view of EventFutileWakeup.
+type FutileWakeupEvent struct {
+	SeqDelta uint64 // before go 1.7
+	TsDelta  uint64
+}
+
+// AsFutileWakeup returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventFutileWakeup event.
+func (e *Event) AsFutileWakeup(version int) (FutileWakeupEvent, error) {
+	args, err := e.typedArgs(version, EventFutileWakeup)
+	if err != nil {
+		return FutileWakeupEvent{}, err
+	}
+	return FutileWakeupEvent{
+		SeqDelta: args[0],
+		TsDelta:  args[1],
+	}, nil
+}
+
+// StringEvent is the typed view of EventString.
+type StringEvent struct {
+	ID  uint64
+	Str []byte
+}
+
+// AsString returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventString event.
+func (e *Event) AsString(version int) (StringEvent, error) {
+	args, err := e.typedArgs(version, EventString)
+	if err != nil {
+		return StringEvent{}, err
+	}
+	return StringEvent{
+		ID:  args[0],
+		Str: e.Str,
+	}, nil
+}
+
+// GoStartLocalEvent is the typed view of EventGoStartLocal.
+type GoStartLocalEvent struct {
+	TsDelta uint64
+	G       uint64
+}
+
+// AsGoStartLocal returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoStartLocal event.
+func (e *Event) AsGoStartLocal(version int) (GoStartLocalEvent, error) {
+	args, err := e.typedArgs(version, EventGoStartLocal)
+	if err != nil {
+		return GoStartLocalEvent{}, err
+	}
+	return GoStartLocalEvent{
+		TsDelta: args[0],
+		G:       args[1],
+	}, nil
+}
+
+// GoUnblockLocalEvent is the typed view of EventGoUnblockLocal.
+type GoUnblockLocalEvent struct {
+	TsDelta uint64
+	G       uint64
+	Stack   uint64 // stack id
+}
+
+// AsGoUnblockLocal returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoUnblockLocal event.
+func (e *Event) AsGoUnblockLocal(version int) (GoUnblockLocalEvent, error) {
+	args, err := e.typedArgs(version, EventGoUnblockLocal)
+	if err != nil {
+		return GoUnblockLocalEvent{}, err
+	}
+	return GoUnblockLocalEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// GoSysExitLocalEvent is the typed view of EventGoSysExitLocal.
+type GoSysExitLocalEvent struct {
+	TsDelta uint64
+	G       uint64
+	RealTs  uint64
+}
+
+// AsGoSysExitLocal returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoSysExitLocal event.
+func (e *Event) AsGoSysExitLocal(version int) (GoSysExitLocalEvent, error) {
+	args, err := e.typedArgs(version, EventGoSysExitLocal)
+	if err != nil {
+		return GoSysExitLocalEvent{}, err
+	}
+	return GoSysExitLocalEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		RealTs:  args[2],
+	}, nil
+}
+
+// GoStartLabelEvent is the typed view of EventGoStartLabel.
+type GoStartLabelEvent struct {
+	TsDelta uint64
+	G       uint64
+	GSeq    uint64
+	Label   uint64 // string id
+}
+
+// AsGoStartLabel returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoStartLabel event.
+func (e *Event) AsGoStartLabel(version int) (GoStartLabelEvent, error) {
+	args, err := e.typedArgs(version, EventGoStartLabel)
+	if err != nil {
+		return GoStartLabelEvent{}, err
+	}
+	return GoStartLabelEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		GSeq:    args[2],
+		Label:   args[3],
+	}, nil
+}
+
+// GoBlockGCEvent is the typed view of EventGoBlockGC.
+type GoBlockGCEvent struct {
+	TsDelta uint64
+	Stack   uint64 // stack id
+}
+
+// AsGoBlockGC returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGoBlockGC event.
+func (e *Event) AsGoBlockGC(version int) (GoBlockGCEvent, error) {
+	args, err := e.typedArgs(version, EventGoBlockGC)
+	if err != nil {
+		return GoBlockGCEvent{}, err
+	}
+	return GoBlockGCEvent{
+		TsDelta: args[0],
+		Stack:   args[1],
+	}, nil
+}
+
+// GCMarkAssistStartEvent is the typed view of EventGCMarkAssistStart.
+type GCMarkAssistStartEvent struct {
+	TsDelta uint64
+	Stack   uint64 // stack id
+}
+
+// AsGCMarkAssistStart returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGCMarkAssistStart event.
+func (e *Event) AsGCMarkAssistStart(version int) (GCMarkAssistStartEvent, error) {
+	args, err := e.typedArgs(version, EventGCMarkAssistStart)
+	if err != nil {
+		return GCMarkAssistStartEvent{}, err
+	}
+	return GCMarkAssistStartEvent{
+		TsDelta: args[0],
+		Stack:   args[1],
+	}, nil
+}
+
+// GCMarkAssistDoneEvent is the typed view of EventGCMarkAssistDone.
+type GCMarkAssistDoneEvent struct {
+	TsDelta uint64
+}
+
+// AsGCMarkAssistDone returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventGCMarkAssistDone event.
+func (e *Event) AsGCMarkAssistDone(version int) (GCMarkAssistDoneEvent, error) {
+	args, err := e.typedArgs(version, EventGCMarkAssistDone)
+	if err != nil {
+		return GCMarkAssistDoneEvent{}, err
+	}
+	return GCMarkAssistDoneEvent{
+		TsDelta: args[0],
+	}, nil
+}
+
+// UserTaskCreateEvent is the typed view of EventUserTaskCreate.
+type UserTaskCreateEvent struct {
+	TsDelta    uint64
+	Task       uint64
+	ParentTask uint64
+	Name       uint64 // string id
+	Stack      uint64 // stack id
+}
+
+// AsUserTaskCreate returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventUserTaskCreate event.
+func (e *Event) AsUserTaskCreate(version int) (UserTaskCreateEvent, error) {
+	args, err := e.typedArgs(version, EventUserTaskCreate)
+	if err != nil {
+		return UserTaskCreateEvent{}, err
+	}
+	return UserTaskCreateEvent{
+		TsDelta:    args[0],
+		Task:       args[1],
+		ParentTask: args[2],
+		Name:       args[3],
+		Stack:      args[4],
+	}, nil
+}
+
+// UserTaskEndEvent is the typed view of EventUserTaskEnd.
+type UserTaskEndEvent struct {
+	TsDelta uint64
+	Task    uint64
+	Stack   uint64 // stack id
+}
+
+// AsUserTaskEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventUserTaskEnd event.
+func (e *Event) AsUserTaskEnd(version int) (UserTaskEndEvent, error) {
+	args, err := e.typedArgs(version, EventUserTaskEnd)
+	if err != nil {
+		return UserTaskEndEvent{}, err
+	}
+	return UserTaskEndEvent{
+		TsDelta: args[0],
+		Task:    args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// UserRegionEvent is the typed view of EventUserRegion.
+type UserRegionEvent struct {
+	TsDelta uint64
+	Task    uint64
+	Mode    uint64
+	Name    uint64 // string id
+	Stack   uint64 // stack id
+}
+
+// AsUserRegion returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventUserRegion event.
+func (e *Event) AsUserRegion(version int) (UserRegionEvent, error) {
+	args, err := e.typedArgs(version, EventUserRegion)
+	if err != nil {
+		return UserRegionEvent{}, err
+	}
+	return UserRegionEvent{
+		TsDelta: args[0],
+		Task:    args[1],
+		Mode:    args[2],
+		Name:    args[3],
+		Stack:   args[4],
+	}, nil
+}
+
+// UserLogEvent is the typed view of EventUserLog.
+type UserLogEvent struct {
+	TsDelta uint64
+	Task    uint64
+	Key     uint64 // string id
+	Stack   uint64 // stack id
+	Str     []byte
+}
+
+// AsUserLog returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventUserLog event.
+func (e *Event) AsUserLog(version int) (UserLogEvent, error) {
+	args, err := e.typedArgs(version, EventUserLog)
+	if err != nil {
+		return UserLogEvent{}, err
+	}
+	return UserLogEvent{
+		TsDelta: args[0],
+		Task:    args[1],
+		Key:     args[2],
+		Stack:   args[3],
+		Str:     e.Str,
+	}, nil
+}
+
+// CPUSampleEvent is the typed view of EventCPUSample.
+type CPUSampleEvent struct {
+	TsDelta uint64
+	RealTs  uint64
+	P       uint64
+	G       uint64
+	Stack   uint64 // stack id
+}
+
+// AsCPUSample returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventCPUSample event.
+func (e *Event) AsCPUSample(version int) (CPUSampleEvent, error) {
+	args, err := e.typedArgs(version, EventCPUSample)
+	if err != nil {
+		return CPUSampleEvent{}, err
+	}
+	return CPUSampleEvent{
+		TsDelta: args[0],
+		RealTs:  args[1],
+		P:       args[2],
+		G:       args[3],
+		Stack:   args[4],
+	}, nil
+}
+
+// V2BatchEvent is the typed view of EventV2Batch.
+type V2BatchEvent struct {
+	Gen  uint64
+	M    uint64
+	Ts   uint64
+	Size uint64
+}
+
+// AsV2Batch returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2Batch event.
+func (e *Event) AsV2Batch(version int) (V2BatchEvent, error) {
+	args, err := e.typedArgs(version, EventV2Batch)
+	if err != nil {
+		return V2BatchEvent{}, err
+	}
+	return V2BatchEvent{
+		Gen:  args[0],
+		M:    args[1],
+		Ts:   args[2],
+		Size: args[3],
+	}, nil
+}
+
+// V2StacksEvent is the typed view of EventV2Stacks.
+type V2StacksEvent struct {
+}
+
+// AsV2Stacks returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2Stacks event.
+func (e *Event) AsV2Stacks(version int) (V2StacksEvent, error) {
+	_, err := e.typedArgs(version, EventV2Stacks)
+	if err != nil {
+		return V2StacksEvent{}, err
+	}
+	return V2StacksEvent{}, nil
+}
+
+// V2StackEvent is the typed view of EventV2Stack.
+type V2StackEvent struct {
+	ID      uint64
+	NFrames uint64
+	Frames  []Frame
+}
+
+// AsV2Stack returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2Stack event.
+func (e *Event) AsV2Stack(version int) (V2StackEvent, error) {
+	args, err := e.typedArgs(version, EventV2Stack)
+	if err != nil {
+		return V2StackEvent{}, err
+	}
+	return V2StackEvent{
+		ID:      args[0],
+		NFrames: args[1],
+		Frames:  e.frames(version),
+	}, nil
+}
+
+// V2StringsEvent is the typed view of EventV2Strings.
+type V2StringsEvent struct {
+}
+
+// AsV2Strings returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2Strings event.
+func (e *Event) AsV2Strings(version int) (V2StringsEvent, error) {
+	_, err := e.typedArgs(version, EventV2Strings)
+	if err != nil {
+		return V2StringsEvent{}, err
+	}
+	return V2StringsEvent{}, nil
+}
+
+// V2StringEvent is the typed view of EventV2String.
+type V2StringEvent struct {
+	ID  uint64
+	Str []byte
+}
+
+// AsV2String returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2String event.
+func (e *Event) AsV2String(version int) (V2StringEvent, error) {
+	args, err := e.typedArgs(version, EventV2String)
+	if err != nil {
+		return V2StringEvent{}, err
+	}
+	return V2StringEvent{
+		ID:  args[0],
+		Str: e.Str,
+	}, nil
+}
+
+// V2CPUSamplesEvent is the typed view of EventV2CPUSamples.
+type V2CPUSamplesEvent struct {
+}
+
+// AsV2CPUSamples returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2CPUSamples event.
+func (e *Event) AsV2CPUSamples(version int) (V2CPUSamplesEvent, error) {
+	_, err := e.typedArgs(version, EventV2CPUSamples)
+	if err != nil {
+		return V2CPUSamplesEvent{}, err
+	}
+	return V2CPUSamplesEvent{}, nil
+}
+
+// V2CPUSampleEvent is the typed view of EventV2CPUSample.
+type V2CPUSampleEvent struct {
+	Ts    uint64
+	M     uint64
+	P     uint64
+	G     uint64
+	Stack uint64 // stack id
+}
+
+// AsV2CPUSample returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2CPUSample event.
+func (e *Event) AsV2CPUSample(version int) (V2CPUSampleEvent, error) {
+	args, err := e.typedArgs(version, EventV2CPUSample)
+	if err != nil {
+		return V2CPUSampleEvent{}, err
+	}
+	return V2CPUSampleEvent{
+		Ts:    args[0],
+		M:     args[1],
+		P:     args[2],
+		G:     args[3],
+		Stack: args[4],
+	}, nil
+}
+
+// V2FrequencyEvent is the typed view of EventV2Frequency.
+type V2FrequencyEvent struct {
+	Freq uint64
+}
+
+// AsV2Frequency returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2Frequency event.
+func (e *Event) AsV2Frequency(version int) (V2FrequencyEvent, error) {
+	args, err := e.typedArgs(version, EventV2Frequency)
+	if err != nil {
+		return V2FrequencyEvent{}, err
+	}
+	return V2FrequencyEvent{
+		Freq: args[0],
+	}, nil
+}
+
+// V2ProcsChangeEvent is the typed view of EventV2ProcsChange.
+type V2ProcsChangeEvent struct {
+	TsDelta uint64
+	Procs   uint64
+	Stack   uint64 // stack id
+}
+
+// AsV2ProcsChange returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2ProcsChange event.
+func (e *Event) AsV2ProcsChange(version int) (V2ProcsChangeEvent, error) {
+	args, err := e.typedArgs(version, EventV2ProcsChange)
+	if err != nil {
+		return V2ProcsChangeEvent{}, err
+	}
+	return V2ProcsChangeEvent{
+		TsDelta: args[0],
+		Procs:   args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// V2ProcStartEvent is the typed view of EventV2ProcStart.
+type V2ProcStartEvent struct {
+	TsDelta uint64
+	P       uint64
+	PSeq    uint64
+}
+
+// AsV2ProcStart returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2ProcStart event.
+func (e *Event) AsV2ProcStart(version int) (V2ProcStartEvent, error) {
+	args, err := e.typedArgs(version, EventV2ProcStart)
+	if err != nil {
+		return V2ProcStartEvent{}, err
+	}
+	return V2ProcStartEvent{
+		TsDelta: args[0],
+		P:       args[1],
+		PSeq:    args[2],
+	}, nil
+}
+
+// V2ProcStopEvent is the typed view of EventV2ProcStop.
+type V2ProcStopEvent struct {
+	TsDelta uint64
+}
+
+// AsV2ProcStop returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2ProcStop event.
+func (e *Event) AsV2ProcStop(version int) (V2ProcStopEvent, error) {
+	args, err := e.typedArgs(version, EventV2ProcStop)
+	if err != nil {
+		return V2ProcStopEvent{}, err
+	}
+	return V2ProcStopEvent{
+		TsDelta: args[0],
+	}, nil
+}
+
+// V2ProcStealEvent is the typed view of EventV2ProcSteal.
+type V2ProcStealEvent struct {
+	TsDelta uint64
+	P       uint64
+	PSeq    uint64
+	M       uint64
+}
+
+// AsV2ProcSteal returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2ProcSteal event.
+func (e *Event) AsV2ProcSteal(version int) (V2ProcStealEvent, error) {
+	args, err := e.typedArgs(version, EventV2ProcSteal)
+	if err != nil {
+		return V2ProcStealEvent{}, err
+	}
+	return V2ProcStealEvent{
+		TsDelta: args[0],
+		P:       args[1],
+		PSeq:    args[2],
+		M:       args[3],
+	}, nil
+}
+
+// V2ProcStatusEvent is the typed view of EventV2ProcStatus.
+type V2ProcStatusEvent struct {
+	TsDelta uint64
+	P       uint64
+	Status  uint64
+}
+
+// AsV2ProcStatus returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2ProcStatus event.
+func (e *Event) AsV2ProcStatus(version int) (V2ProcStatusEvent, error) {
+	args, err := e.typedArgs(version, EventV2ProcStatus)
+	if err != nil {
+		return V2ProcStatusEvent{}, err
+	}
+	return V2ProcStatusEvent{
+		TsDelta: args[0],
+		P:       args[1],
+		Status:  args[2],
+	}, nil
+}
+
+// V2GoCreateEvent is the typed view of EventV2GoCreate.
+type V2GoCreateEvent struct {
+	TsDelta  uint64
+	NewG     uint64
+	NewStack uint64 // stack id
+	Stack    uint64 // stack id
+}
+
+// AsV2GoCreate returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoCreate event.
+func (e *Event) AsV2GoCreate(version int) (V2GoCreateEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoCreate)
+	if err != nil {
+		return V2GoCreateEvent{}, err
+	}
+	return V2GoCreateEvent{
+		TsDelta:  args[0],
+		NewG:     args[1],
+		NewStack: args[2],
+		Stack:    args[3],
+	}, nil
+}
+
+// V2GoCreateSyscallEvent is the typed view of EventV2GoCreateSyscall.
+type V2GoCreateSyscallEvent struct {
+	TsDelta uint64
+	NewG    uint64
+}
+
+// AsV2GoCreateSyscall returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoCreateSyscall event.
+func (e *Event) AsV2GoCreateSyscall(version int) (V2GoCreateSyscallEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoCreateSyscall)
+	if err != nil {
+		return V2GoCreateSyscallEvent{}, err
+	}
+	return V2GoCreateSyscallEvent{
+		TsDelta: args[0],
+		NewG:    args[1],
+	}, nil
+}
+
+// V2GoStartEvent is the typed view of EventV2GoStart.
+type V2GoStartEvent struct {
+	TsDelta uint64
+	G       uint64
+	GSeq    uint64
+}
+
+// AsV2GoStart returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoStart event.
+func (e *Event) AsV2GoStart(version int) (V2GoStartEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoStart)
+	if err != nil {
+		return V2GoStartEvent{}, err
+	}
+	return V2GoStartEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		GSeq:    args[2],
+	}, nil
+}
+
+// V2GoDestroyEvent is the typed view of EventV2GoDestroy.
+type V2GoDestroyEvent struct {
+	TsDelta uint64
+}
+
+// AsV2GoDestroy returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoDestroy event.
+func (e *Event) AsV2GoDestroy(version int) (V2GoDestroyEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoDestroy)
+	if err != nil {
+		return V2GoDestroyEvent{}, err
+	}
+	return V2GoDestroyEvent{
+		TsDelta: args[0],
+	}, nil
+}
+
+// V2GoDestroySyscallEvent is the typed view of EventV2GoDestroySyscall.
+type V2GoDestroySyscallEvent struct {
+	TsDelta uint64
+}
+
+// AsV2GoDestroySyscall returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoDestroySyscall event.
+func (e *Event) AsV2GoDestroySyscall(version int) (V2GoDestroySyscallEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoDestroySyscall)
+	if err != nil {
+		return V2GoDestroySyscallEvent{}, err
+	}
+	return V2GoDestroySyscallEvent{
+		TsDelta: args[0],
+	}, nil
+}
+
+// V2GoStopEvent is the typed view of EventV2GoStop.
+type V2GoStopEvent struct {
+	TsDelta uint64
+	Reason  uint64 // string id
+	Stack   uint64 // stack id
+}
+
+// AsV2GoStop returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoStop event.
+func (e *Event) AsV2GoStop(version int) (V2GoStopEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoStop)
+	if err != nil {
+		return V2GoStopEvent{}, err
+	}
+	return V2GoStopEvent{
+		TsDelta: args[0],
+		Reason:  args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// V2GoBlockEvent is the typed view of EventV2GoBlock.
+type V2GoBlockEvent struct {
+	TsDelta uint64
+	Reason  uint64 // string id
+	Stack   uint64 // stack id
+}
+
+// AsV2GoBlock returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoBlock event.
+func (e *Event) AsV2GoBlock(version int) (V2GoBlockEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoBlock)
+	if err != nil {
+		return V2GoBlockEvent{}, err
+	}
+	return V2GoBlockEvent{
+		TsDelta: args[0],
+		Reason:  args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// V2GoUnblockEvent is the typed view of EventV2GoUnblock.
+type V2GoUnblockEvent struct {
+	TsDelta uint64
+	G       uint64
+	GSeq    uint64
+	Stack   uint64 // stack id
+}
+
+// AsV2GoUnblock returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoUnblock event.
+func (e *Event) AsV2GoUnblock(version int) (V2GoUnblockEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoUnblock)
+	if err != nil {
+		return V2GoUnblockEvent{}, err
+	}
+	return V2GoUnblockEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		GSeq:    args[2],
+		Stack:   args[3],
+	}, nil
+}
+
+// V2GoSyscallBeginEvent is the typed view of EventV2GoSyscallBegin.
+type V2GoSyscallBeginEvent struct {
+	TsDelta uint64
+	PSeq    uint64
+	Stack   uint64 // stack id
+}
+
+// AsV2GoSyscallBegin returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoSyscallBegin event.
+func (e *Event) AsV2GoSyscallBegin(version int) (V2GoSyscallBeginEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoSyscallBegin)
+	if err != nil {
+		return V2GoSyscallBeginEvent{}, err
+	}
+	return V2GoSyscallBeginEvent{
+		TsDelta: args[0],
+		PSeq:    args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// V2GoSyscallEndEvent is the typed view of EventV2GoSyscallEnd.
+type V2GoSyscallEndEvent struct {
+	TsDelta uint64
+}
+
+// AsV2GoSyscallEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoSyscallEnd event.
+func (e *Event) AsV2GoSyscallEnd(version int) (V2GoSyscallEndEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoSyscallEnd)
+	if err != nil {
+		return V2GoSyscallEndEvent{}, err
+	}
+	return V2GoSyscallEndEvent{
+		TsDelta: args[0],
+	}, nil
+}
+
+// V2GoSyscallEndBlockedEvent is the typed view of EventV2GoSyscallEndBlocked.
+type V2GoSyscallEndBlockedEvent struct {
+	TsDelta uint64
+}
+
+// AsV2GoSyscallEndBlocked returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoSyscallEndBlocked event.
+func (e *Event) AsV2GoSyscallEndBlocked(version int) (V2GoSyscallEndBlockedEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoSyscallEndBlocked)
+	if err != nil {
+		return V2GoSyscallEndBlockedEvent{}, err
+	}
+	return V2GoSyscallEndBlockedEvent{
+		TsDelta: args[0],
+	}, nil
+}
+
+// V2GoStatusEvent is the typed view of EventV2GoStatus.
+type V2GoStatusEvent struct {
+	TsDelta uint64
+	G       uint64
+	M       uint64
+	Status  uint64
+}
+
+// AsV2GoStatus returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoStatus event.
+func (e *Event) AsV2GoStatus(version int) (V2GoStatusEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoStatus)
+	if err != nil {
+		return V2GoStatusEvent{}, err
+	}
+	return V2GoStatusEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		M:       args[2],
+		Status:  args[3],
+	}, nil
+}
+
+// V2STWBeginEvent is the typed view of EventV2STWBegin.
+type V2STWBeginEvent struct {
+	TsDelta uint64
+	Kind    uint64 // string id
+	Stack   uint64 // stack id
+}
+
+// AsV2STWBegin returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2STWBegin event.
+func (e *Event) AsV2STWBegin(version int) (V2STWBeginEvent, error) {
+	args, err := e.typedArgs(version, EventV2STWBegin)
+	if err != nil {
+		return V2STWBeginEvent{}, err
+	}
+	return V2STWBeginEvent{
+		TsDelta: args[0],
+		Kind:    args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// V2STWEndEvent is the typed view of EventV2STWEnd.
+type V2STWEndEvent struct {
+	TsDelta uint64
+}
+
+// AsV2STWEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2STWEnd event.
+func (e *Event) AsV2STWEnd(version int) (V2STWEndEvent, error) {
+	args, err := e.typedArgs(version, EventV2STWEnd)
+	if err != nil {
+		return V2STWEndEvent{}, err
+	}
+	return V2STWEndEvent{
+		TsDelta: args[0],
+	}, nil
+}
+
+// V2GCActiveEvent is the typed view of EventV2GCActive.
+type V2GCActiveEvent struct {
+	TsDelta uint64
+	Seq     uint64
+}
+
+// AsV2GCActive returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCActive event.
+func (e *Event) AsV2GCActive(version int) (V2GCActiveEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCActive)
+	if err != nil {
+		return V2GCActiveEvent{}, err
+	}
+	return V2GCActiveEvent{
+		TsDelta: args[0],
+		Seq:     args[1],
+	}, nil
+}
+
+// V2GCBeginEvent is the typed view of EventV2GCBegin.
+type V2GCBeginEvent struct {
+	TsDelta uint64
+	Seq     uint64
+	Stack   uint64 // stack id
+}
+
+// AsV2GCBegin returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCBegin event.
+func (e *Event) AsV2GCBegin(version int) (V2GCBeginEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCBegin)
+	if err != nil {
+		return V2GCBeginEvent{}, err
+	}
+	return V2GCBeginEvent{
+		TsDelta: args[0],
+		Seq:     args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// V2GCEndEvent is the typed view of EventV2GCEnd.
+type V2GCEndEvent struct {
+	TsDelta uint64
+	Seq     uint64
+}
+
+// AsV2GCEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCEnd event.
+func (e *Event) AsV2GCEnd(version int) (V2GCEndEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCEnd)
+	if err != nil {
+		return V2GCEndEvent{}, err
+	}
+	return V2GCEndEvent{
+		TsDelta: args[0],
+		Seq:     args[1],
+	}, nil
+}
+
+// V2GCSweepActiveEvent is the typed view of EventV2GCSweepActive.
+type V2GCSweepActiveEvent struct {
+	TsDelta uint64
+	P       uint64
+}
+
+// AsV2GCSweepActive returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCSweepActive event.
+func (e *Event) AsV2GCSweepActive(version int) (V2GCSweepActiveEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCSweepActive)
+	if err != nil {
+		return V2GCSweepActiveEvent{}, err
+	}
+	return V2GCSweepActiveEvent{
+		TsDelta: args[0],
+		P:       args[1],
+	}, nil
+}
+
+// V2GCSweepBeginEvent is the typed view of EventV2GCSweepBegin.
+type V2GCSweepBeginEvent struct {
+	TsDelta uint64
+	Stack   uint64 // stack id
+}
+
+// AsV2GCSweepBegin returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCSweepBegin event.
+func (e *Event) AsV2GCSweepBegin(version int) (V2GCSweepBeginEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCSweepBegin)
+	if err != nil {
+		return V2GCSweepBeginEvent{}, err
+	}
+	return V2GCSweepBeginEvent{
+		TsDelta: args[0],
+		Stack:   args[1],
+	}, nil
+}
+
+// V2GCSweepEndEvent is the typed view of EventV2GCSweepEnd.
+type V2GCSweepEndEvent struct {
+	TsDelta   uint64
+	Swept     uint64
+	Reclaimed uint64
+}
+
+// AsV2GCSweepEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCSweepEnd event.
+func (e *Event) AsV2GCSweepEnd(version int) (V2GCSweepEndEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCSweepEnd)
+	if err != nil {
+		return V2GCSweepEndEvent{}, err
+	}
+	return V2GCSweepEndEvent{
+		TsDelta:   args[0],
+		Swept:     args[1],
+		Reclaimed: args[2],
+	}, nil
+}
+
+// V2GCMarkAssistActiveEvent is the typed view of EventV2GCMarkAssistActive.
+type V2GCMarkAssistActiveEvent struct {
+	TsDelta uint64
+	G       uint64
+}
+
+// AsV2GCMarkAssistActive returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCMarkAssistActive event.
+func (e *Event) AsV2GCMarkAssistActive(version int) (V2GCMarkAssistActiveEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCMarkAssistActive)
+	if err != nil {
+		return V2GCMarkAssistActiveEvent{}, err
+	}
+	return V2GCMarkAssistActiveEvent{
+		TsDelta: args[0],
+		G:       args[1],
+	}, nil
+}
+
+// V2GCMarkAssistBeginEvent is the typed view of EventV2GCMarkAssistBegin.
+type V2GCMarkAssistBeginEvent struct {
+	TsDelta uint64
+	Stack   uint64 // stack id
+}
+
+// AsV2GCMarkAssistBegin returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCMarkAssistBegin event.
+func (e *Event) AsV2GCMarkAssistBegin(version int) (V2GCMarkAssistBeginEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCMarkAssistBegin)
+	if err != nil {
+		return V2GCMarkAssistBeginEvent{}, err
+	}
+	return V2GCMarkAssistBeginEvent{
+		TsDelta: args[0],
+		Stack:   args[1],
+	}, nil
+}
+
+// V2GCMarkAssistEndEvent is the typed view of EventV2GCMarkAssistEnd.
+type V2GCMarkAssistEndEvent struct {
+	TsDelta uint64
+}
+
+// AsV2GCMarkAssistEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GCMarkAssistEnd event.
+func (e *Event) AsV2GCMarkAssistEnd(version int) (V2GCMarkAssistEndEvent, error) {
+	args, err := e.typedArgs(version, EventV2GCMarkAssistEnd)
+	if err != nil {
+		return V2GCMarkAssistEndEvent{}, err
+	}
+	return V2GCMarkAssistEndEvent{
+		TsDelta: args[0],
+	}, nil
+}
+
+// V2HeapAllocEvent is the typed view of EventV2HeapAlloc.
+type V2HeapAllocEvent struct {
+	TsDelta uint64
+	Mem     uint64
+}
+
+// AsV2HeapAlloc returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2HeapAlloc event.
+func (e *Event) AsV2HeapAlloc(version int) (V2HeapAllocEvent, error) {
+	args, err := e.typedArgs(version, EventV2HeapAlloc)
+	if err != nil {
+		return V2HeapAllocEvent{}, err
+	}
+	return V2HeapAllocEvent{
+		TsDelta: args[0],
+		Mem:     args[1],
+	}, nil
+}
+
+// V2HeapGoalEvent is the typed view of EventV2HeapGoal.
+type V2HeapGoalEvent struct {
+	TsDelta uint64
+	Mem     uint64
+}
+
+// AsV2HeapGoal returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2HeapGoal event.
+func (e *Event) AsV2HeapGoal(version int) (V2HeapGoalEvent, error) {
+	args, err := e.typedArgs(version, EventV2HeapGoal)
+	if err != nil {
+		return V2HeapGoalEvent{}, err
+	}
+	return V2HeapGoalEvent{
+		TsDelta: args[0],
+		Mem:     args[1],
+	}, nil
+}
+
+// V2GoLabelEvent is the typed view of EventV2GoLabel.
+type V2GoLabelEvent struct {
+	TsDelta uint64
+	Label   uint64 // string id
+}
+
+// AsV2GoLabel returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoLabel event.
+func (e *Event) AsV2GoLabel(version int) (V2GoLabelEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoLabel)
+	if err != nil {
+		return V2GoLabelEvent{}, err
+	}
+	return V2GoLabelEvent{
+		TsDelta: args[0],
+		Label:   args[1],
+	}, nil
+}
+
+// V2UserTaskBeginEvent is the typed view of EventV2UserTaskBegin.
+type V2UserTaskBeginEvent struct {
+	TsDelta    uint64
+	Task       uint64
+	ParentTask uint64
+	Name       uint64 // string id
+	Stack      uint64 // stack id
+}
+
+// AsV2UserTaskBegin returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2UserTaskBegin event.
+func (e *Event) AsV2UserTaskBegin(version int) (V2UserTaskBeginEvent, error) {
+	args, err := e.typedArgs(version, EventV2UserTaskBegin)
+	if err != nil {
+		return V2UserTaskBeginEvent{}, err
+	}
+	return V2UserTaskBeginEvent{
+		TsDelta:    args[0],
+		Task:       args[1],
+		ParentTask: args[2],
+		Name:       args[3],
+		Stack:      args[4],
+	}, nil
+}
+
+// V2UserTaskEndEvent is the typed view of EventV2UserTaskEnd.
+type V2UserTaskEndEvent struct {
+	TsDelta uint64
+	Task    uint64
+	Stack   uint64 // stack id
+}
+
+// AsV2UserTaskEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2UserTaskEnd event.
+func (e *Event) AsV2UserTaskEnd(version int) (V2UserTaskEndEvent, error) {
+	args, err := e.typedArgs(version, EventV2UserTaskEnd)
+	if err != nil {
+		return V2UserTaskEndEvent{}, err
+	}
+	return V2UserTaskEndEvent{
+		TsDelta: args[0],
+		Task:    args[1],
+		Stack:   args[2],
+	}, nil
+}
+
+// V2UserRegionBeginEvent is the typed view of EventV2UserRegionBegin.
+type V2UserRegionBeginEvent struct {
+	TsDelta uint64
+	Task    uint64
+	Name    uint64 // string id
+	Stack   uint64 // stack id
+}
+
+// AsV2UserRegionBegin returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2UserRegionBegin event.
+func (e *Event) AsV2UserRegionBegin(version int) (V2UserRegionBeginEvent, error) {
+	args, err := e.typedArgs(version, EventV2UserRegionBegin)
+	if err != nil {
+		return V2UserRegionBeginEvent{}, err
+	}
+	return V2UserRegionBeginEvent{
+		TsDelta: args[0],
+		Task:    args[1],
+		Name:    args[2],
+		Stack:   args[3],
+	}, nil
+}
+
+// V2UserRegionEndEvent is the typed view of EventV2UserRegionEnd.
+type V2UserRegionEndEvent struct {
+	TsDelta uint64
+	Task    uint64
+	Name    uint64 // string id
+	Stack   uint64 // stack id
+}
+
+// AsV2UserRegionEnd returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2UserRegionEnd event.
+func (e *Event) AsV2UserRegionEnd(version int) (V2UserRegionEndEvent, error) {
+	args, err := e.typedArgs(version, EventV2UserRegionEnd)
+	if err != nil {
+		return V2UserRegionEndEvent{}, err
+	}
+	return V2UserRegionEndEvent{
+		TsDelta: args[0],
+		Task:    args[1],
+		Name:    args[2],
+		Stack:   args[3],
+	}, nil
+}
+
+// V2UserLogEvent is the typed view of EventV2UserLog.
+type V2UserLogEvent struct {
+	TsDelta uint64
+	Task    uint64
+	Key     uint64 // string id
+	Value   uint64 // string id
+	Stack   uint64 // stack id
+}
+
+// AsV2UserLog returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2UserLog event.
+func (e *Event) AsV2UserLog(version int) (V2UserLogEvent, error) {
+	args, err := e.typedArgs(version, EventV2UserLog)
+	if err != nil {
+		return V2UserLogEvent{}, err
+	}
+	return V2UserLogEvent{
+		TsDelta: args[0],
+		Task:    args[1],
+		Key:     args[2],
+		Value:   args[3],
+		Stack:   args[4],
+	}, nil
+}
+
+// V2GoSwitchEvent is the typed view of EventV2GoSwitch.
+type V2GoSwitchEvent struct {
+	TsDelta uint64
+	G       uint64
+	GSeq    uint64
+}
+
+// AsV2GoSwitch returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoSwitch event.
+func (e *Event) AsV2GoSwitch(version int) (V2GoSwitchEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoSwitch)
+	if err != nil {
+		return V2GoSwitchEvent{}, err
+	}
+	return V2GoSwitchEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		GSeq:    args[2],
+	}, nil
+}
+
+// V2GoSwitchDestroyEvent is the typed view of EventV2GoSwitchDestroy.
+type V2GoSwitchDestroyEvent struct {
+	TsDelta uint64
+	G       uint64
+	GSeq    uint64
+}
+
+// AsV2GoSwitchDestroy returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoSwitchDestroy event.
+func (e *Event) AsV2GoSwitchDestroy(version int) (V2GoSwitchDestroyEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoSwitchDestroy)
+	if err != nil {
+		return V2GoSwitchDestroyEvent{}, err
+	}
+	return V2GoSwitchDestroyEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		GSeq:    args[2],
+	}, nil
+}
+
+// V2GoCreateBlockedEvent is the typed view of EventV2GoCreateBlocked.
+type V2GoCreateBlockedEvent struct {
+	TsDelta  uint64
+	NewG     uint64
+	NewStack uint64 // stack id
+	Stack    uint64 // stack id
+}
+
+// AsV2GoCreateBlocked returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoCreateBlocked event.
+func (e *Event) AsV2GoCreateBlocked(version int) (V2GoCreateBlockedEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoCreateBlocked)
+	if err != nil {
+		return V2GoCreateBlockedEvent{}, err
+	}
+	return V2GoCreateBlockedEvent{
+		TsDelta:  args[0],
+		NewG:     args[1],
+		NewStack: args[2],
+		Stack:    args[3],
+	}, nil
+}
+
+// V2GoStatusStackEvent is the typed view of EventV2GoStatusStack.
+type V2GoStatusStackEvent struct {
+	TsDelta uint64
+	G       uint64
+	M       uint64
+	Status  uint64
+	Stack   uint64 // stack id
+}
+
+// AsV2GoStatusStack returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2GoStatusStack event.
+func (e *Event) AsV2GoStatusStack(version int) (V2GoStatusStackEvent, error) {
+	args, err := e.typedArgs(version, EventV2GoStatusStack)
+	if err != nil {
+		return V2GoStatusStackEvent{}, err
+	}
+	return V2GoStatusStackEvent{
+		TsDelta: args[0],
+		G:       args[1],
+		M:       args[2],
+		Status:  args[3],
+		Stack:   args[4],
+	}, nil
+}
+
+// V2ExperimentalBatchEvent is the typed view of EventV2ExperimentalBatch.
+type V2ExperimentalBatchEvent struct {
+	Experiment uint64
+	Gen        uint64
+	M          uint64
+	Ts         uint64
+	Str        []byte
+}
+
+// AsV2ExperimentalBatch returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2ExperimentalBatch event.
+func (e *Event) AsV2ExperimentalBatch(version int) (V2ExperimentalBatchEvent, error) {
+	args, err := e.typedArgs(version, EventV2ExperimentalBatch)
+	if err != nil {
+		return V2ExperimentalBatchEvent{}, err
+	}
+	return V2ExperimentalBatchEvent{
+		Experiment: args[0],
+		Gen:        args[1],
+		M:          args[2],
+		Ts:         args[3],
+		Str:        e.Str,
+	}, nil
+}
+
+// V2SyncEvent is the typed view of EventV2Sync.
+type V2SyncEvent struct {
+}
+
+// AsV2Sync returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2Sync event.
+func (e *Event) AsV2Sync(version int) (V2SyncEvent, error) {
+	_, err := e.typedArgs(version, EventV2Sync)
+	if err != nil {
+		return V2SyncEvent{}, err
+	}
+	return V2SyncEvent{}, nil
+}
+
+// V2ClockSnapshotEvent is the typed view of EventV2ClockSnapshot.
+type V2ClockSnapshotEvent struct {
+	TsDelta uint64
+	Mono    uint64
+	Sec     uint64
+	Nsec    uint64
+}
+
+// AsV2ClockSnapshot returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2ClockSnapshot event.
+func (e *Event) AsV2ClockSnapshot(version int) (V2ClockSnapshotEvent, error) {
+	args, err := e.typedArgs(version, EventV2ClockSnapshot)
+	if err != nil {
+		return V2ClockSnapshotEvent{}, err
+	}
+	return V2ClockSnapshotEvent{
+		TsDelta: args[0],
+		Mono:    args[1],
+		Sec:     args[2],
+		Nsec:    args[3],
+	}, nil
+}
+
+// V2EndOfGenerationEvent is the typed view of EventV2EndOfGeneration.
+type V2EndOfGenerationEvent struct {
+}
+
+// AsV2EndOfGeneration returns the typed view of e for a trace of the given version. It
+// returns an error if e is not a valid EventV2EndOfGeneration event.
+func (e *Event) AsV2EndOfGeneration(version int) (V2EndOfGenerationEvent, error) {
+	_, err := e.typedArgs(version, EventV2EndOfGeneration)
+	if err != nil {
+		return V2EndOfGenerationEvent{}, err
+	}
+	return V2EndOfGenerationEvent{}, nil
+}
@@ -0,0 +1,107 @@
+package encoding
+
+import (
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update generated files")
+
+// TestTypedGenerated checks that typed_gen.go is up to date with the event
+// layouts in spec.go. Run go generate to update it.
+func TestTypedGenerated(t *testing.T) {
+	got, err := os.ReadFile("typed_gen.go")
+	require.NoError(t, err)
+	want := generateTyped(t)
+	if *update {
+		require.NoError(t, os.WriteFile("typed_gen.go", want, 0644))
+		return
+	}
+	require.Equal(t, string(want), string(got), "typed_gen.go is out of date, run go generate")
+}
+
+// forEachSpec calls fn for every event type that has a layout.
+func forEachSpec(fn func(EventType, eventSpec)) {
+	for t := EventNone + 1; t < EventCount; t++ {
+		fn(t, eventSpecsV1[t])
+	}
+	for t := EventV2None + 1; t < EventV2Count; t++ {
+		if spec := eventSpecsV2[t-eventTypeV2Offset]; spec.minVersion != 0 {
+			fn(t, spec)
+		}
+	}
+}
+
+// generateTyped returns the contents of typed_gen.go.
+func generateTyped(t *testing.T) []byte {
+	var b strings.Builder
+	b.WriteString("// Code generated by \"go test -run TestTypedGenerated -update\"; DO NOT EDIT.\n\n")
+	b.WriteString("package encoding\n")
+
+	forEachSpec(func(typ EventType, spec eventSpec) {
+		name := strings.TrimPrefix(typ.String(), "Event")
+		view := name + "Event"
+
+		// Type definition
+		fmt.Fprintf(&b, "\n// %s is the typed view of %v.\n", view, typ)
+		fmt.Fprintf(&b, "type %s struct {\n", view)
+		for _, arg := range spec.args {
+			var comments []string
+			switch arg.ref {
+			case refString:
+				comments = append(comments, "string id")
+			case refStack:
+				comments = append(comments, "stack id")
+			}
+			if arg.minVersion != 0 {
+				comments = append(comments, fmt.Sprintf("since go 1.%d", arg.minVersion-1000))
+			} else if arg.maxVersion != 0 {
+				comments = append(comments, fmt.Sprintf("before go 1.%d", arg.maxVersion-1000))
+			}
+			fmt.Fprintf(&b, "\t%s uint64", arg.name)
+			if len(comments) > 0 {
+				fmt.Fprintf(&b, " // %s", strings.Join(comments, ", "))
+			}
+			b.WriteString("\n")
+		}
+		if spec.isStack {
+			b.WriteString("\tFrames []Frame\n")
+		}
+		if spec.hasData {
+			b.WriteString("\tStr []byte\n")
+		}
+		b.WriteString("}\n")
+
+		// Conversion method
+		fmt.Fprintf(&b, "\n// As%s returns the typed view of e for a trace of the given version. It\n", name)
+		fmt.Fprintf(&b, "// returns an error if e is not a valid %v event.\n", typ)
+		fmt.Fprintf(&b, "func (e *Event) As%s(version int) (%s, error) {\n", name, view)
+		argsVar := "args"
+		if len(spec.args) == 0 {
+			argsVar = "_"
+		}
+		fmt.Fprintf(&b, "\t%s, err := e.typedArgs(version, %v)\n", argsVar, typ)
+		fmt.Fprintf(&b, "\tif err != nil {\n\t\treturn %s{}, err\n\t}\n", view)
+		fmt.Fprintf(&b, "\treturn %s{\n", view)
+		for i, arg := range spec.args {
+			fmt.Fprintf(&b, "\t\t%s: args[%d],\n", arg.name, i)
+		}
+		if spec.isStack {
+			b.WriteString("\t\tFrames: e.frames(version),\n")
+		}
+		if spec.hasData {
+			b.WriteString("\t\tStr: e.Str,\n")
+		}
+		b.WriteString("\t}, nil\n}\n")
+	})
+
+	src, err := format.Source([]byte(b.String()))
+	require.NoError(t, err)
+	return src
+}
@@ -0,0 +1,157 @@
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTypedLayouts checks that the layouts fit into the args returned by
+// typedArgs and that their names are unique.
+func TestTypedLayouts(t *testing.T) {
+	forEachSpec(func(typ EventType, spec eventSpec) {
+		require.LessOrEqual(t, len(spec.args), maxTypedArgs, "%v", typ)
+		seen := map[string]bool{}
+		for _, arg := range spec.args {
+			require.False(t, seen[arg.name], "%v has duplicate arg %s", typ, arg.name)
+			seen[arg.name] = true
+		}
+	})
+}
+
+// TestTyped checks that the typed views can be used for every event of the
+// testdata traces and spot checks some of their values.
+func TestTyped(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+		Check     func(t *testing.T, version int, ev *Event)
+	}{
+		{"1.6", "simple.trace", func(t *testing.T, version int, ev *Event) {
+			switch ev.Type {
+			case EventGCSTWStart:
+				stw, err := ev.AsGCSTWStart(version)
+				require.NoError(t, err)
+				require.Equal(t, ev.Args[0], stw.SeqDelta)
+				require.Equal(t, ev.Args[1], stw.TsDelta)
+				require.Zero(t, stw.Kind)
+			case EventStack:
+				stack, err := ev.AsStack(version)
+				require.NoError(t, err)
+				require.Len(t, stack.Frames, int(stack.NFrames))
+				require.Equal(t, ev.Args[2], stack.Frames[0].PC)
+				require.Zero(t, stack.Frames[0].Func)
+			}
+		}},
+		{"1.19", "trace.bin", func(t *testing.T, version int, ev *Event) {
+			switch ev.Type {
+			case EventGoCreate:
+				create, err := ev.AsGoCreate(version)
+				require.NoError(t, err)
+				require.Equal(t, GoCreateEvent{
+					TsDelta:  ev.Args[0],
+					NewG:     ev.Args[1],
+					NewStack: ev.Args[2],
+					Stack:    ev.Args[3],
+				}, create)
+			case EventString:
+				str, err := ev.AsString(version)
+				require.NoError(t, err)
+				require.Equal(t, ev.Args[0], str.ID)
+				require.Equal(t, ev.Str, str.Str)
+			}
+		}},
+		{"1.25", "test-encoding-json.trace", func(t *testing.T, version int, ev *Event) {
+			switch ev.Type {
+			case EventV2Batch:
+				batch, err := ev.AsV2Batch(version)
+				require.NoError(t, err)
+				require.Equal(t, ev.Args[3], batch.Size)
+			case EventV2Stack:
+				stack, err := ev.AsV2Stack(version)
+				require.NoError(t, err)
+				require.Len(t, stack.Frames, int(stack.NFrames))
+				last := stack.Frames[len(stack.Frames)-1]
+				require.Equal(t, Frame{
+					PC:   ev.Args[len(ev.Args)-4],
+					Func: ev.Args[len(ev.Args)-3],
+					File: ev.Args[len(ev.Args)-2],
+					Line: ev.Args[len(ev.Args)-1],
+				}, last)
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
+			require.NoError(t, err)
+
+			dec := NewDecoder(bytes.NewReader(data))
+			for {
+				var ev Event
+				if err := dec.Decode(&ev); err != nil {
+					require.Equal(t, io.EOF, err)
+					break
+				}
+				_, err := ev.typedArgs(dec.Version(), ev.Type)
+				require.NoError(t, err)
+				test.Check(t, dec.Version(), &ev)
+			}
+		})
+	}
+}
+
+// TestTypedMismatch checks that typed views reject events of the wrong type
+// or with the wrong number of arguments.
+func TestTypedMismatch(t *testing.T) {
+	ev := &Event{Type: EventGoStart, Args: []uint64{1, 2, 3}}
+	_, err := ev.AsGoStart(1019)
+	require.NoError(t, err)
+	_, err = ev.AsGoCreate(1019)
+	require.ErrorContains(t, err, "can't use EventGoStart event as EventGoCreate")
+	ev.Args = ev.Args[:2]
+	_, err = ev.AsGoStart(1019)
+	require.ErrorContains(t, err, "EventGoStart has 2 arguments, want 3")
+}
+
+// TestTsDelta checks that TsDelta finds the timestamp for all versions.
+func TestTsDelta(t *testing.T) {
+	tests := []struct {
+		Version int
+		Event   Event
+		Want    uint64
+		WantOK  bool
+	}{
+		{1005, Event{Type: EventGoEnd, Args: []uint64{1, 2}}, 2, true},
+		{1019, Event{Type: EventGoEnd, Args: []uint64{2}}, 2, true},
+		{1019, Event{Type: EventBatch, Args: []uint64{1, 2}}, 0, false},
+		{1019, Event{Type: EventString, Args: []uint64{1}}, 0, false},
+		{1025, Event{Type: EventV2GoStart, Args: []uint64{3, 1, 2}}, 3, true},
+		{1025, Event{Type: EventV2CPUSample, Args: []uint64{1, 2, 3, 4, 5}}, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d/%s", test.Version, test.Event.Type), func(t *testing.T) {
+			got, ok := test.Event.TsDelta(test.Version)
+			require.Equal(t, test.WantOK, ok)
+			require.Equal(t, test.Want, got)
+		})
+	}
+}
+
+// TestHasData checks that HasData only reports the events with a byte slice.
+func TestHasData(t *testing.T) {
+	require.True(t, HasData(1021, EventString))
+	require.True(t, HasData(1021, EventUserLog))
+	require.False(t, HasData(1021, EventStack))
+	require.True(t, HasData(1025, EventV2String))
+	require.True(t, HasData(1025, EventV2ExperimentalBatch))
+	require.False(t, HasData(1025, EventV2UserLog))
+	require.False(t, HasData(1025, EventString))
+}
@@ -0,0 +1,414 @@
+package filter
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/felixge/traceutils/pkg/breakdown"
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+// Options configures Filter. An event is removed if it matches any of the
+// options.
+type Options struct {
+	// Types are the types of the events to remove. Types that don't exist
+	// in the version of the trace are ignored.
+	Types []encoding.EventType
+	// Ps are the ids of the Ps whose events are removed.
+	Ps []int64
+	// Gs are the ids of the goroutines whose events are removed, i.e. the
+	// events that happen while they are running.
+	Gs []uint64
+	// Dedup merges identical strings and stacks into the first one and
+	// rewrites the references to the others.
+	Dedup bool
+}
+
+// Filter reads a trace from r and writes it to w without the events selected
+// by opts. The timestamp deltas of the remaining events are adjusted, so
+// their timestamps don't change. Strings and stacks that are no longer
+// referenced by any event are removed as well, and so are batches that
+// become empty. It returns a breakdown of the removed events by type.
+//
+// With opts.Dedup, identical strings and stacks are merged as well. They are
+// often left behind by anonymize, which replaces many strings with the same
+// one.
+//
+// Only events with a timestamp can be removed, the structure of the trace
+// and its tables are kept. Removing events that change the state of
+// goroutines or Ps, e.g. all events of a P, can produce traces that go tool
+// trace rejects. Events like EventHeapAlloc, EventCPUSample or EventUserLog
+// can always be removed.
+func Filter(r io.ReadSeeker, w io.Writer, opts Options) (breakdown.EventTypeBreakdown, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &filter{
+		types:     make(map[encoding.EventType]bool),
+		ps:        make(map[int64]bool),
+		gs:        make(map[uint64]bool),
+		dedup:     opts.Dedup,
+		strings:   make(map[tableKey]bool),
+		stacks:    make(map[tableKey]bool),
+		stringIDs: make(map[tableKey]uint64),
+		stackIDs:  make(map[tableKey]uint64),
+		removed:   make(breakdown.EventTypeBreakdown),
+	}
+	for _, t := range opts.Types {
+		if structural[t] {
+			return nil, fmt.Errorf("%v events can't be removed, unreferenced strings and stacks are removed automatically", t)
+		}
+		f.types[t] = true
+	}
+	for _, p := range opts.Ps {
+		f.ps[p] = true
+	}
+	for _, g := range opts.Gs {
+		f.gs[g] = true
+	}
+
+	// Find the strings and stacks that are referenced by the remaining
+	// events, then write them.
+	if err := f.mark(encoding.NewContextDecoder(r)); err != nil {
+		return nil, err
+	} else if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	} else if err := f.write(encoding.NewContextDecoder(r), encoding.NewEncoderVersion(w, f.version)); err != nil {
+		return nil, err
+	}
+	return f.removed, nil
+}
+
+// Compact reads a trace from r and writes it to w with identical strings and
+// stacks merged and the ones that are not referenced removed. It returns a
+// breakdown of the removed strings, stacks and batches by type.
+func Compact(r io.ReadSeeker, w io.Writer) (breakdown.EventTypeBreakdown, error) {
+	return Filter(r, w, Options{Dedup: true})
+}
+
+// filter holds the state of Filter.
+type filter struct {
+	version int
+	types   map[encoding.EventType]bool
+	ps      map[int64]bool
+	gs      map[uint64]bool
+	dedup   bool
+
+	strings   map[tableKey]bool   // referenced strings
+	stacks    map[tableKey]bool   // referenced stacks
+	stringIDs map[tableKey]uint64 // ids of the strings that duplicates are merged into
+	stackIDs  map[tableKey]uint64 // ids of the stacks that duplicates are merged into
+
+	removed breakdown.EventTypeBreakdown
+}
+
+// tableKey identifies an entry in the string or stack table. Go 1.22+
+// traces have separate tables for every generation, older traces only have
+// generation 0.
+type tableKey struct {
+	gen uint64
+	id  uint64
+}
+
+// tableValue is the value of a string or stack table entry in a generation,
+// stacks are formatted with fmt.Sprint.
+type tableValue struct {
+	gen   uint64
+	value string
+}
+
+// mark records the strings and stacks that are referenced by the events
+// that are kept. With dedup it also determines which strings and stacks are
+// merged.
+func (f *filter) mark(dec *encoding.ContextDecoder) error {
+	var (
+		ev         encoding.ContextEvent
+		gen        uint64
+		refStrings = make(map[tableKey]bool)
+		refStacks  = make(map[tableKey]bool)
+		firstIDs   = make(map[tableValue]uint64) // id of the first string or stack with each value
+		stackKeys  []tableKey                    // stacks in the order of the trace
+		frames     = make(map[tableKey][]uint64) // frame args of each stack
+	)
+	for {
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		f.version = dec.Version()
+
+		switch ev.Type {
+		case encoding.EventV2Batch:
+			gen = ev.Args[0]
+		case encoding.EventString, encoding.EventV2String:
+			if !f.dedup {
+				break
+			}
+			value := tableValue{gen, string(ev.Str)}
+			if id, ok := firstIDs[value]; ok {
+				f.stringIDs[tableKey{gen, ev.Args[0]}] = id
+			} else {
+				firstIDs[value] = ev.Args[0]
+			}
+		case encoding.EventStack, encoding.EventV2Stack:
+			key := tableKey{gen, ev.Args[0]}
+			stackKeys = append(stackKeys, key)
+			frames[key] = slices.Clone(ev.Args[2:])
+		}
+		if f.remove(&ev) {
+			continue
+		}
+
+		strings, stacks := encoding.RefArgs(f.version, ev.Type)
+		for _, i := range strings {
+			refStrings[tableKey{gen, ev.Args[i]}] = true
+		}
+		for _, i := range stacks {
+			refStacks[tableKey{gen, ev.Args[i]}] = true
+		}
+	}
+
+	// Merge stacks whose frames are identical once their strings are
+	// merged.
+	for _, key := range stackKeys {
+		f.rewriteFrames(key.gen, frames[key])
+	}
+	if f.dedup {
+		clear(firstIDs)
+		for _, key := range stackKeys {
+			value := tableValue{key.gen, fmt.Sprint(frames[key])}
+			if id, ok := firstIDs[value]; ok {
+				f.stackIDs[key] = id
+			} else {
+				firstIDs[value] = key.id
+			}
+		}
+	}
+
+	// Keep the strings and stacks that are referenced, and the strings of
+	// the frames of these stacks.
+	for key := range refStacks {
+		f.stacks[tableKey{key.gen, f.stackID(key.gen, key.id)}] = true
+	}
+	for key := range refStrings {
+		f.strings[tableKey{key.gen, f.stringID(key.gen, key.id)}] = true
+	}
+	for key := range f.stacks {
+		args := frames[key]
+		for i := 1; i+2 < len(args) && f.version >= 1007; i += 4 {
+			f.strings[tableKey{key.gen, args[i]}] = true
+			f.strings[tableKey{key.gen, args[i+1]}] = true
+		}
+	}
+	return nil
+}
+
+// stringID returns the id of the string that the string id of the
+// generation gen is merged into.
+func (f *filter) stringID(gen, id uint64) uint64 {
+	if first, ok := f.stringIDs[tableKey{gen, id}]; ok {
+		return first
+	}
+	return id
+}
+
+// stackID returns the id of the stack that the stack id of the generation
+// gen is merged into.
+func (f *filter) stackID(gen, id uint64) uint64 {
+	if first, ok := f.stackIDs[tableKey{gen, id}]; ok {
+		return first
+	}
+	return id
+}
+
+// rewriteFrames rewrites the func and file string ids in the frame args of a
+// stack of the generation gen to the strings they are merged into.
+func (f *filter) rewriteFrames(gen uint64, args []uint64) {
+	if f.version < 1007 {
+		// Frames only contain the PC
+		return
+	}
+	for i := 1; i+2 < len(args); i += 4 {
+		args[i] = f.stringID(gen, args[i])
+		args[i+1] = f.stringID(gen, args[i+1])
+	}
+}
+
+// rewrite rewrites the string and stack ids that ev refers to for merged
+// strings and stacks.
+func (f *filter) rewrite(gen uint64, ev *encoding.Event) {
+	strings, stacks := encoding.RefArgs(f.version, ev.Type)
+	for _, i := range strings {
+		ev.Args[i] = f.stringID(gen, ev.Args[i])
+	}
+	for _, i := range stacks {
+		ev.Args[i] = f.stackID(gen, ev.Args[i])
+	}
+	if ev.Type == encoding.EventStack || ev.Type == encoding.EventV2Stack {
+		f.rewriteFrames(gen, ev.Args[2:])
+	}
+}
+
+// structural contains the types of the events that make up the structure of
+// a trace and can't be removed. All other events have a timestamp.
+var structural = map[encoding.EventType]bool{
+	encoding.EventNone:                true,
+	encoding.EventBatch:               true,
+	encoding.EventFrequency:           true,
+	encoding.EventStack:               true,
+	encoding.EventString:              true,
+	encoding.EventV2None:              true,
+	encoding.EventV2Batch:             true,
+	encoding.EventV2Stacks:            true,
+	encoding.EventV2Stack:             true,
+	encoding.EventV2Strings:           true,
+	encoding.EventV2String:            true,
+	encoding.EventV2CPUSamples:        true,
+	encoding.EventV2Frequency:         true,
+	encoding.EventV2ExperimentalBatch: true,
+	encoding.EventV2Sync:              true,
+	encoding.EventV2ClockSnapshot:     true,
+	encoding.EventV2EndOfGeneration:   true,
+}
+
+// remove returns true if ev is removed.
+func (f *filter) remove(ev *encoding.ContextEvent) bool {
+	if structural[ev.Type] {
+		return false
+	}
+	return f.types[ev.Type] || f.ps[ev.P] || f.gs[ev.G]
+}
+
+// write copies the events that are kept. The events of each batch are
+// buffered to drop batches that become empty and to update the length of
+// go 1.22+ batches.
+func (f *filter) write(dec *encoding.ContextDecoder, enc *encoding.Encoder) error {
+	var (
+		ev     encoding.ContextEvent
+		gen    uint64
+		header *encoding.Event  // header of the current batch or nil
+		events []encoding.Event // events of the current batch that are kept
+		n      int              // number of events in the current batch
+		size   int64            // size of the batch header
+		carry  uint64           // timestamp deltas of removed events
+	)
+	flush := func() error {
+		err := f.writeBatch(enc, header, events, n > 0, size)
+		header, events, n, carry = nil, events[:0], 0, 0
+		return err
+	}
+
+	for {
+		start := dec.Offset()
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if start == 0 {
+			// Don't count the header of the trace
+			start = 16
+		}
+		cp := encoding.Event{Type: ev.Type, Args: slices.Clone(ev.Args), Str: slices.Clone(ev.Str)}
+
+		switch ev.Type {
+		case encoding.EventBatch, encoding.EventV2Batch, encoding.EventV2ExperimentalBatch:
+			if err := flush(); err != nil {
+				return err
+			}
+			if ev.Type == encoding.EventV2Batch {
+				gen = ev.Args[0]
+			}
+			if ev.Type != encoding.EventV2ExperimentalBatch {
+				header, size = &cp, dec.Offset()-start
+				continue
+			}
+		case encoding.EventV2EndOfGeneration:
+			// The end of a generation follows the last batch of the
+			// generation instead of being part of it
+			if err := flush(); err != nil {
+				return err
+			} else if err := enc.Encode(&cp); err != nil {
+				return err
+			}
+			continue
+		}
+		n++
+
+		// Remove the event and its timestamp delta
+		delta, hasTs := ev.TsDelta(f.version)
+		if f.remove(&ev) || f.unreferenced(gen, &ev) {
+			f.count(ev.Type, dec.Offset()-start)
+			if hasTs {
+				carry += delta
+			}
+			continue
+		}
+
+		f.rewrite(gen, &cp)
+
+		// CPU samples before go 1.22 always have a timestamp delta of 0
+		if hasTs && ev.Type != encoding.EventCPUSample {
+			i, _ := encoding.ArgIndex(f.version, ev.Type, "TsDelta")
+			cp.Args[i] += carry
+			carry = 0
+		}
+		events = append(events, cp)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writeBatch writes the batch header and the events that are kept of a
+// batch. The header is nil for events before the first batch. A batch whose
+// events have all been removed is dropped, its header is counted as removed.
+func (f *filter) writeBatch(enc *encoding.Encoder, header *encoding.Event, events []encoding.Event, hadEvents bool, size int64) error {
+	if header != nil && hadEvents && len(events) == 0 {
+		f.count(header.Type, size)
+		return nil
+	} else if header != nil {
+		if header.Type == encoding.EventV2Batch {
+			var length int
+			for i := range events {
+				length += encoding.EncodedSize(f.version, &events[i])
+			}
+			header.Args[3] = uint64(length)
+		}
+		if err := enc.Encode(header); err != nil {
+			return err
+		}
+	}
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unreferenced returns true if ev is a string or stack that is not
+// referenced by any event that is kept.
+func (f *filter) unreferenced(gen uint64, ev *encoding.ContextEvent) bool {
+	switch ev.Type {
+	case encoding.EventString, encoding.EventV2String:
+		return !f.strings[tableKey{gen, ev.Args[0]}]
+	case encoding.EventStack, encoding.EventV2Stack:
+		return !f.stacks[tableKey{gen, ev.Args[0]}]
+	}
+	return false
+}
+
+// count adds a removed event of type t with the given size to the breakdown.
+func (f *filter) count(t encoding.EventType, bytes int64) {
+	f.removed[t] = breakdown.EventTypeSummary{
+		EventType: t,
+		Count:     f.removed[t].Count + 1,
+		Bytes:     f.removed[t].Bytes + bytes,
+	}
+}
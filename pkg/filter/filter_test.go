@@ -0,0 +1,264 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/felixge/traceutils/internal/tracetest"
+	"github.com/felixge/traceutils/pkg/anonymize"
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/stretchr/testify/require"
+	"honnef.co/go/gotraceui/trace"
+)
+
+// removeTypes are the event types removed by the tests.
+var removeTypes = []encoding.EventType{
+	encoding.EventHeapAlloc, encoding.EventCPUSample, encoding.EventUserLog,
+	encoding.EventV2HeapAlloc, encoding.EventV2CPUSample, encoding.EventV2UserLog,
+}
+
+// TestFilterV1 tests that removing event types produces a smaller trace that
+// gotraceui can parse and that contains the other events at the same time.
+func TestFilterV1(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.18", "simple.trace"},
+		{"1.19", "trace.bin"},
+		{"1.21", "task.trace"},
+		{"1.21", "fgprof.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data := readTrace(t, test.GoVersion, test.Trace)
+			var out bytes.Buffer
+			removed, err := Filter(bytes.NewReader(data), &out, Options{Types: removeTypes})
+			require.NoError(t, err)
+			require.NotEmpty(t, removed)
+
+			// The trace shrinks by the size of the removed events, minus
+			// the timestamp deltas that grow by the deltas of removed
+			// events.
+			var bytesRemoved int64
+			for _, summary := range removed {
+				bytesRemoved += summary.Bytes
+			}
+			require.Less(t, out.Len(), len(data))
+			require.LessOrEqual(t, int64(len(data)-out.Len()), bytesRemoved)
+
+			// Only the removed events are missing
+			want := parseV1(t, data, true)
+			got := parseV1(t, out.Bytes(), false)
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+// TestFilterV2 tests that removing event types produces a trace that
+// x/exp/trace can parse and that contains the other events at the same time.
+func TestFilterV2(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.25", "test-encoding-json.trace"},
+		{"1.26", "generations.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data := readTrace(t, test.GoVersion, test.Trace)
+			var out bytes.Buffer
+			removed, err := Filter(bytes.NewReader(data), &out, Options{Types: removeTypes})
+			require.NoError(t, err)
+			require.NotZero(t, removed[encoding.EventV2HeapAlloc].Count)
+			require.NotZero(t, removed[encoding.EventV2String].Count)
+			require.Less(t, out.Len(), len(data))
+
+			// x/exp/trace breaks ties between events with the same
+			// timestamp by adjusting their timestamps, so only check that
+			// it can parse the output and compare the events decoded with
+			// their context.
+			tracetest.ReadEvents(t, out.Bytes())
+			require.Equal(t, contextEvents(t, data, true), contextEvents(t, out.Bytes(), false))
+		})
+	}
+}
+
+// TestFilterPG tests that the events of Ps and goroutines are removed.
+func TestFilterPG(t *testing.T) {
+	data := readTrace(t, "1.21", "task.trace")
+	var out bytes.Buffer
+	_, err := Filter(bytes.NewReader(data), &out, Options{Ps: []int64{1}, Gs: []uint64{1}})
+	require.NoError(t, err)
+
+	dec := encoding.NewContextDecoder(bytes.NewReader(out.Bytes()))
+	for {
+		var ev encoding.ContextEvent
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if _, ok := ev.TsDelta(dec.Version()); ok {
+			require.NotEqual(t, int64(1), ev.P, "%v event", ev.Type)
+			require.NotEqual(t, uint64(1), ev.G, "%v event", ev.Type)
+		}
+	}
+}
+
+// TestCompact tests that compacting an anonymized trace merges its identical
+// strings and stacks without changing the stacks of the events.
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.19", "trace.bin"},
+		{"1.21", "task.trace"},
+		{"1.26", "generations.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			var anonymized bytes.Buffer
+			require.NoError(t, anonymize.AnonymizeTrace(bytes.NewReader(readTrace(t, test.GoVersion, test.Trace)), &anonymized))
+			data := anonymized.Bytes()
+
+			var out bytes.Buffer
+			removed, err := Compact(bytes.NewReader(data), &out)
+			require.NoError(t, err)
+			require.NotZero(t, removed[encoding.EventString].Count+removed[encoding.EventV2String].Count)
+			require.Less(t, out.Len(), len(data))
+			if dec := encoding.NewDecoder(bytes.NewReader(data)); dec.Decode(&encoding.Event{}) == nil && dec.Version() >= 1022 {
+				tracetest.ReadEvents(t, out.Bytes())
+			} else {
+				_, err = trace.Parse(bytes.NewReader(out.Bytes()), nil)
+				require.NoError(t, err)
+			}
+
+			// The stacks of the events are unchanged and every string
+			// and stack is unique.
+			want := resolvedStacks(t, data)
+			got := resolvedStacks(t, out.Bytes())
+			require.Equal(t, want, got)
+
+			strings := make(map[tableValue]bool)
+			stacks := make(map[tableValue]bool)
+			dec := encoding.NewDecoder(bytes.NewReader(out.Bytes()))
+			var gen uint64
+			for {
+				var ev encoding.Event
+				err := dec.Decode(&ev)
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				switch ev.Type {
+				case encoding.EventV2Batch:
+					gen = ev.Args[0]
+				case encoding.EventString, encoding.EventV2String:
+					value := tableValue{gen, string(ev.Str)}
+					require.False(t, strings[value], "duplicate string %q", ev.Str)
+					strings[value] = true
+				case encoding.EventStack, encoding.EventV2Stack:
+					value := tableValue{gen, fmt.Sprint(ev.Args[2:])}
+					require.False(t, stacks[value], "duplicate stack %d", ev.Args[0])
+					stacks[value] = true
+				}
+			}
+		})
+	}
+}
+
+// TestFilterErrors tests that events that can't be removed are rejected.
+func TestFilterErrors(t *testing.T) {
+	data := readTrace(t, "1.21", "task.trace")
+	_, err := Filter(bytes.NewReader(data), io.Discard, Options{Types: []encoding.EventType{encoding.EventString}})
+	require.ErrorContains(t, err, "EventString events can't be removed")
+}
+
+// readTrace reads a trace from the testdata directory.
+func readTrace(t *testing.T, goVersion, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", goVersion, name))
+	require.NoError(t, err)
+	return data
+}
+
+// v1Event identifies an event parsed by gotraceui.
+type v1Event struct {
+	Type byte
+	Ts   trace.Timestamp
+	P    int32
+	G    uint64
+}
+
+// parseV1 parses a trace with gotraceui and counts its events. If skip is
+// true, the events of removeTypes are skipped.
+func parseV1(t *testing.T, data []byte, skip bool) map[v1Event]int {
+	parsed, err := trace.Parse(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	events := make(map[v1Event]int)
+	for _, ev := range parsed.Events {
+		if skip && (ev.Type == trace.EvHeapAlloc || ev.Type == trace.EvCPUSample || ev.Type == trace.EvUserLog) {
+			continue
+		}
+		events[v1Event{ev.Type, ev.Ts, ev.P, ev.G}]++
+	}
+	return events
+}
+
+// resolvedStacks decodes the events of a trace and returns their resolved
+// stacks.
+func resolvedStacks(t *testing.T, data []byte) [][]encoding.StackFrame {
+	var stacks [][]encoding.StackFrame
+	dec := encoding.NewContextDecoder(bytes.NewReader(data))
+	for {
+		var ev encoding.ContextEvent
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if ev.Stack != nil {
+			stacks = append(stacks, ev.Stack)
+		}
+	}
+	return stacks
+}
+
+// contextEvent identifies an event decoded by encoding.ContextDecoder.
+type contextEvent struct {
+	Type encoding.EventType
+	Ts   int64
+	M    int64
+	P    int64
+	G    uint64
+}
+
+// contextEvents decodes the events of a trace with their context and counts
+// them. If skip is true, the events of removeTypes are skipped.
+func contextEvents(t *testing.T, data []byte, skip bool) map[contextEvent]int {
+	events := make(map[contextEvent]int)
+	dec := encoding.NewContextDecoder(bytes.NewReader(data))
+	for {
+		var ev encoding.ContextEvent
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if ev.Ts == 0 || (skip && slices.Contains(removeTypes, ev.Type)) {
+			continue
+		}
+		events[contextEvent{ev.Type, ev.Ts, ev.M, ev.P, ev.G}]++
+	}
+	return events
+}
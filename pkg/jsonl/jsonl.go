@@ -0,0 +1,147 @@
+// Package jsonl converts traces to JSON Lines and back, e.g. to process
+// them with jq or to write test traces by hand.
+//
+// The first line is a header with the version of the trace as returned by
+// encoding.Decoder.Version. Every following line holds one event:
+//
+//	{"version":1021}
+//	{"offset":16,"type":"EventBatch","args":[0,101131565415278]}
+//	{"offset":25,"type":"EventProcStart","args":[16,4]}
+//	{"offset":218,"type":"EventString","args":[1],"string":"Not worker"}
+//
+// The byte slice of events like EventString is stored in "string" if it's
+// valid UTF-8, and base64 encoded in "data" otherwise. The offset of the
+// event in the trace is ignored by Import, so it can be omitted.
+package jsonl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+// Header is the first line of a JSON Lines trace.
+type Header struct {
+	Version int `json:"version"`
+}
+
+// Event is a line of a JSON Lines trace after the header.
+type Event struct {
+	Offset int64    `json:"offset"`
+	Type   string   `json:"type"`
+	Args   []uint64 `json:"args"`
+	String *string  `json:"string,omitempty"`
+	Data   []byte   `json:"data,omitempty"`
+}
+
+// Export writes the events of the trace read from r to w as JSON Lines.
+func Export(r io.Reader, w io.Writer) error {
+	var (
+		bw  = bufio.NewWriter(w)
+		enc = json.NewEncoder(bw)
+		dec = encoding.NewDecoder(r)
+		ev  encoding.Event
+	)
+	enc.SetEscapeHTML(false)
+	for i := 0; ; i++ {
+		// The offset is 0 until the 16 byte header has been read
+		offset := max(dec.Offset(), 16)
+		err := dec.Decode(&ev)
+		if i == 0 && dec.Version() != 0 {
+			// The header is written even if the trace has no events
+			if err := enc.Encode(Header{Version: dec.Version()}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		out := Event{Offset: offset, Type: ev.Type.String(), Args: ev.Args}
+		if out.Args == nil {
+			out.Args = []uint64{}
+		}
+		if encoding.HasData(dec.Version(), ev.Type) {
+			if utf8.Valid(ev.Str) {
+				s := string(ev.Str)
+				out.String = &s
+			} else {
+				out.Data = ev.Str
+			}
+		}
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Import encodes the JSON Lines trace read from r as a binary trace and writes
+// it to w.
+func Import(r io.Reader, w io.Writer) error {
+	dec := json.NewDecoder(r)
+	var header Header
+	if err := dec.Decode(&header); err == io.EOF {
+		return errors.New("missing header")
+	} else if err != nil {
+		return fmt.Errorf("header: %w", err)
+	} else if header.Version == 0 {
+		return errors.New("header: missing version")
+	}
+
+	enc := encoding.NewEncoderVersion(w, header.Version)
+	for i := 0; ; i++ {
+		var in Event
+		if err := dec.Decode(&in); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("event %d: %w", i, err)
+		}
+		ev, err := decodeEvent(header.Version, in)
+		if err == nil {
+			err = enc.Encode(&ev)
+		}
+		if err != nil {
+			return fmt.Errorf("event %d: %w", i, err)
+		}
+	}
+	return enc.Close()
+}
+
+// eventTypes maps the names of the event types to their values.
+var eventTypes = func() map[string]encoding.EventType {
+	types := make(map[string]encoding.EventType)
+	for i := 0; i < 256; i++ {
+		types[encoding.EventType(i).String()] = encoding.EventType(i)
+	}
+	return types
+}()
+
+// decodeEvent converts the JSON event in to an event of a trace of the given
+// version.
+func decodeEvent(version int, in Event) (encoding.Event, error) {
+	t, ok := eventTypes[in.Type]
+	if !ok {
+		return encoding.Event{}, fmt.Errorf("unknown event type %q", in.Type)
+	}
+	ev := encoding.Event{Type: t, Args: in.Args}
+	switch {
+	case in.String != nil && in.Data != nil:
+		return ev, errors.New("event has both string and data")
+	case in.String != nil:
+		ev.Str = []byte(*in.String)
+	case in.Data != nil:
+		ev.Str = in.Data
+	}
+	if ev.Str != nil && !encoding.HasData(version, t) {
+		return ev, fmt.Errorf("%v can't have a string", t)
+	}
+	return ev, nil
+}
@@ -0,0 +1,82 @@
+package jsonl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoundTrip tests that exporting and importing the traces in testdata
+// produces identical traces.
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "testdata", "*", "*.trace"))
+	require.NoError(t, err)
+	files = append(files, filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			var exported, imported bytes.Buffer
+			require.NoError(t, Export(bytes.NewReader(data), &exported))
+			require.NoError(t, Import(&exported, &imported))
+			require.Equal(t, data, imported.Bytes())
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.21", "task.trace"))
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, Export(bytes.NewReader(data), &out))
+	lines := strings.Split(out.String(), "\n")
+	require.Equal(t, `{"version":1021}`, lines[0])
+	require.Equal(t, `{"offset":16,"type":"EventBatch","args":[0,101131565415278]}`, lines[1])
+	require.Equal(t, `{"offset":25,"type":"EventProcStart","args":[16,4]}`, lines[2])
+	require.Contains(t, out.String(), `"type":"EventString","args":[1],"string":"Not worker"}`)
+}
+
+func TestImport(t *testing.T) {
+	t.Run("Handwritten", func(t *testing.T) {
+		in := strings.Join([]string{
+			`{"version":1021}`,
+			`{"type":"EventBatch","args":[0,100]}`,
+			`{"type":"EventString","args":[1],"data":"/w=="}`,
+			`{"type":"EventFrequency","args":[15625000]}`,
+		}, "\n")
+		var out, exported bytes.Buffer
+		require.NoError(t, Import(strings.NewReader(in), &out))
+		require.NoError(t, Export(&out, &exported))
+		require.Equal(t, strings.Join([]string{
+			`{"version":1021}`,
+			`{"offset":16,"type":"EventBatch","args":[0,100]}`,
+			`{"offset":19,"type":"EventString","args":[1],"data":"/w=="}`,
+			`{"offset":23,"type":"EventFrequency","args":[15625000]}`,
+			``,
+		}, "\n"), exported.String())
+	})
+
+	tests := []struct {
+		Name string
+		In   string
+		Want string
+	}{
+		{"empty", ``, "missing header"},
+		{"no version", `{"type":"EventBatch","args":[0,100]}`, "header: missing version"},
+		{"unknown type", `{"version":1021}` + "\n" + `{"type":"EventFoo","args":[]}`, `event 0: unknown event type "EventFoo"`},
+		{"wrong version", `{"version":1021}` + "\n" + `{"type":"EventV2Batch","args":[1,2,3,4]}`, "event 0: invalid event type EventV2Batch"},
+		{"args", `{"version":1021}` + "\n" + `{"type":"EventBatch","args":[0]}`, "event 0: EventBatch has 1 arguments, want 2"},
+		{"string", `{"version":1021}` + "\n" + `{"type":"EventBatch","args":[0,1],"string":"foo"}`, "event 0: EventBatch can't have a string"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			err := Import(strings.NewReader(test.In), &bytes.Buffer{})
+			require.ErrorContains(t, err, test.Want)
+		})
+	}
+}
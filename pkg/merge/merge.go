@@ -0,0 +1,529 @@
+package merge
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/state"
+)
+
+// Merge reads consecutive segments of a trace of the same process from the
+// inputs and writes a single trace containing all of them to w. The inputs
+// must have the same version and must be given in the order in which they
+// were recorded. Only traces from go 1.11 and later are supported.
+//
+// The string and stack ids of each input are shifted past the ids of the
+// previous inputs, and the timestamps of each input are rescaled to the
+// frequency of the first one. Every input starts with state events that
+// recreate the goroutines that already existed, so between two inputs the
+// goroutines, Ps, GC and STW phases of the previous input are brought into
+// the state recorded at the start of the next one.
+//
+// Traces from go 1.22 and later are merged by mergeV2, which keeps the
+// tables and frequencies of the generations of each input instead.
+func Merge(inputs []io.ReadSeeker, w io.Writer) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("no inputs")
+	}
+	var version int
+	for i, r := range inputs {
+		v, err := peekVersion(r)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i+1, err)
+		} else if i == 0 {
+			version = v
+		} else if v != version && v != 0 {
+			return fmt.Errorf("input %d has trace version %d, but input 1 has version %d", i+1, v, version)
+		}
+	}
+	if version >= 1022 {
+		return mergeV2(inputs, w, version)
+	}
+
+	// Read the state and tables of all inputs before writing anything to
+	// report errors early.
+	var segments []*segment
+	for i, r := range inputs {
+		var prev *segment
+		if i > 0 {
+			prev = segments[i-1]
+		}
+		s, err := scan(r, i+1, prev)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, s)
+	}
+	first := segments[0]
+	for i, s := range segments {
+		s.outFreq = first.freq
+		if i == 0 {
+			continue
+		}
+		prev := segments[i-1]
+		s.stringOffset = prev.stringOffset + prev.maxString
+		s.stackOffset = prev.stackOffset + prev.maxStack
+		s.gcOffset = prev.gcOffset + prev.state.GCSeq
+		if end := prev.ticks(prev.maxTicks); s.minTicks < end {
+			return fmt.Errorf("input %d overlaps input %d: it starts at tick %d before the end of input %d at tick %d, inputs must be given in the order in which they were recorded", s.input, prev.input, s.minTicks, prev.input, end)
+		}
+	}
+
+	m := &merger{enc: encoding.NewEncoderVersion(w, first.version)}
+	for i, s := range segments {
+		if i > 0 {
+			if err := m.writeTransition(segments[i-1], s); err != nil {
+				return err
+			}
+		}
+		if err := m.copyEvents(s); err != nil {
+			return err
+		}
+	}
+
+	// Only write the frequency of the first input, the timestamps of the
+	// others have been rescaled to it.
+	if err := m.enc.Encode(&encoding.Event{Type: encoding.EventFrequency, Args: []uint64{first.freq}}); err != nil {
+		return err
+	}
+	return m.enc.Close()
+}
+
+// segment holds the information about an input that is needed to merge it.
+type segment struct {
+	r       io.ReadSeeker
+	input   int   // number of the input starting at 1
+	start   int64 // position of r
+	version int
+
+	freq     uint64 // ticks per second
+	outFreq  uint64 // ticks per second of the output
+	minTicks uint64 // timestamp of the first event
+	maxTicks uint64 // timestamp of the last event
+	globalP  uint64 // P with the lowest id
+
+	maxString    uint64 // largest string id
+	maxStack     uint64 // largest stack id
+	stringOffset uint64 // added to the string ids
+	stackOffset  uint64 // added to the stack ids
+	gcOffset     uint64 // added to the GC sequence numbers
+
+	// state at the end of the segment
+	state *state.State
+	// prologue contains the goroutines of the previous segment that are
+	// recreated by state events at the start of this segment.
+	prologue map[uint64]*state.G
+	// outputSeq contains the sequence numbers of the goroutines of the
+	// prologue after the transition from the previous segment.
+	outputSeq map[uint64]uint64
+}
+
+// peekVersion returns the version of the trace r without changing its
+// position, or 0 if r is empty.
+func peekVersion(r io.ReadSeeker) (int, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	dec := encoding.NewDecoder(r)
+	var ev encoding.Event
+	if err := dec.Decode(&ev); err != nil && err != io.EOF {
+		return 0, err
+	}
+	_, err = r.Seek(start, io.SeekStart)
+	return dec.Version(), err
+}
+
+// scan reads the input r to determine its version, frequency, time range,
+// tables and the state at its end. The state events at the start of the input
+// that recreate goroutines of the previous segment are recorded in the
+// prologue.
+func scan(r io.ReadSeeker, input int, prev *segment) (*segment, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	s := &segment{
+		r:         r,
+		input:     input,
+		start:     start,
+		minTicks:  math.MaxUint64,
+		globalP:   math.MaxUint64,
+		prologue:  make(map[uint64]*state.G),
+		outputSeq: make(map[uint64]uint64),
+	}
+
+	var (
+		dec   = encoding.NewContextDecoder(r)
+		ev    encoding.ContextEvent
+		ticks uint64
+	)
+	for {
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("input %d: %w", input, err)
+		}
+		if s.state == nil {
+			s.version = dec.Version()
+			if s.version < 1011 {
+				return nil, fmt.Errorf("input %d: unsupported trace file version %d, only go 1.11 and later traces can be merged", input, s.version)
+			}
+			s.state = state.New(s.version)
+		}
+
+		switch ev.Type {
+		case encoding.EventBatch:
+			batch, err := ev.AsBatch(s.version)
+			if err != nil {
+				return nil, err
+			}
+			ticks = batch.Ts
+			s.globalP = min(s.globalP, batch.P)
+			continue
+		case encoding.EventFrequency:
+			s.freq = ev.Args[0]
+		case encoding.EventString:
+			s.maxString = max(s.maxString, ev.Args[0])
+		case encoding.EventStack:
+			s.maxStack = max(s.maxStack, ev.Args[0])
+		}
+		if delta, ok := ev.TsDelta(s.version); ok && ev.Type != encoding.EventCPUSample {
+			ticks += delta
+			s.minTicks = min(s.minTicks, ticks)
+			s.maxTicks = max(s.maxTicks, ticks)
+		}
+
+		// Goroutines of the previous segment that are created again
+		// belong to the prologue. They may only become waiting before
+		// they are used.
+		if prev != nil {
+			switch ev.Type {
+			case encoding.EventGoCreate:
+				create, err := ev.AsGoCreate(s.version)
+				if err != nil {
+					return nil, err
+				} else if g, ok := prev.state.Gs[create.NewG]; ok && g.Status != state.GDead {
+					s.prologue[create.NewG] = &state.G{Status: state.GRunnable, Seq: 1}
+				}
+			case encoding.EventGoWaiting, encoding.EventGoInSyscall:
+				if g, ok := s.prologue[ev.G]; ok && g.Seq == 1 {
+					g.Status, g.Syscall, g.Seq = state.GWaiting, ev.Type == encoding.EventGoInSyscall, 2
+				}
+			}
+		}
+
+		if err := s.state.Update(&ev); err != nil {
+			return nil, err
+		}
+	}
+	if s.minTicks > s.maxTicks {
+		return nil, fmt.Errorf("input %d contains no events", input)
+	}
+	return s, nil
+}
+
+// ticks rescales the timestamp t of the segment to the frequency of the
+// output. The ticks of the segments come from the same clock, but the
+// runtime measures the frequency separately for each trace, so the
+// timestamps are rescaled relative to the start of the segment to keep them
+// in order.
+func (s *segment) ticks(t uint64) uint64 {
+	if s.freq == s.outFreq {
+		return t
+	} else if t < s.minTicks {
+		return s.minTicks - scale(s.minTicks-t, s.outFreq, s.freq)
+	}
+	return s.minTicks + scale(t-s.minTicks, s.outFreq, s.freq)
+}
+
+// scale returns d * num / denom without overflowing.
+func scale(d, num, denom uint64) uint64 {
+	hi, lo := bits.Mul64(d, num)
+	if hi >= denom {
+		return math.MaxUint64
+	}
+	q, _ := bits.Div64(hi, lo, denom)
+	return q
+}
+
+// merger holds the state of Merge.
+type merger struct {
+	enc       *encoding.Encoder
+	lastTicks uint64 // timestamp of the last event in the output batch
+}
+
+// writeTransition writes the events that bring the goroutines, Ps, GC and
+// STW phases from the state at the end of prev into the state at the start
+// of next. Running goroutines are stopped and all Ps are stopped, because
+// the next segment starts them again. Goroutines that are recreated by next
+// are made runnable or waiting, the others are ended. The events happen
+// between the two segments, on the Ps that were active in prev.
+func (m *merger) writeTransition(prev, next *segment) error {
+	var (
+		s       = prev.state
+		running = s.Running()
+		end     = prev.ticks(prev.maxTicks)
+		ticks   = end + (next.minTicks-end)/2 // between the segments
+		seqs    = make(map[uint64]uint64)
+	)
+	for id, g := range s.Gs {
+		seqs[id] = prev.renumber(id, g.Seq)
+	}
+
+	ps := s.Ps
+	if _, ok := ps[prev.globalP]; !ok {
+		ps[prev.globalP] = &state.P{}
+	}
+	for _, id := range state.SortedKeys(ps) {
+		p := ps[id]
+		onP, ok := running[p.G]
+		hasG := ok && onP == id && p.G != 0
+		if !p.Running && !p.Sweeping && !hasG && id != prev.globalP {
+			continue
+		} else if err := m.encode(encoding.EventBatch, id, ticks); err != nil {
+			return err
+		}
+
+		// Stop the running goroutine
+		if hasG {
+			var err error
+			switch pro, ok := next.prologue[p.G]; {
+			case !ok:
+				err = m.encode(encoding.EventGoEnd, 0)
+			case pro.Status == state.GWaiting && pro.Syscall:
+				err = m.encode(encoding.EventGoSysBlock, 0)
+			case pro.Status == state.GWaiting:
+				err = m.encode(encoding.EventGoBlock, 0, 0)
+			default:
+				err = m.encode(encoding.EventGoSched, 0, 0)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// End the global phases and change the state of the goroutines
+		// that are not running on the P with the lowest id.
+		if id == prev.globalP {
+			if s.GC.Value == 1 {
+				if err := m.encode(encoding.EventGCDone, 0); err != nil {
+					return err
+				}
+			}
+			if s.STW.Value != 0 {
+				if err := m.encode(encoding.EventGCSTWDone, 0); err != nil {
+					return err
+				}
+			}
+			for _, gid := range state.SortedKeys(s.Gs) {
+				if _, ok := running[gid]; ok || s.Gs[gid].Status == state.GDead {
+					continue
+				} else if err := m.writeGoroutine(gid, s.Gs[gid], next.prologue[gid], seqs); err != nil {
+					return err
+				}
+			}
+		}
+
+		if p.Sweeping {
+			if err := m.encode(encoding.EventGCSweepDone, 0, 0, 0); err != nil {
+				return err
+			}
+		}
+		if p.Running {
+			if err := m.encode(encoding.EventProcStop, 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The events of the prologue of next continue from the sequence
+	// numbers after the transition.
+	for id := range next.prologue {
+		next.outputSeq[id] = seqs[id]
+	}
+	return nil
+}
+
+// writeGoroutine writes the events that bring the goroutine id that isn't
+// running from its state g into the state pro from the prologue of the next
+// segment, or ends it if pro is nil. Goroutines are started and unblocked on
+// the current P, which must not run a goroutine. seqs contains the current
+// sequence numbers of the goroutines and is updated.
+func (m *merger) writeGoroutine(id uint64, g *state.G, pro *state.G, seqs map[uint64]uint64) error {
+	waiting := g.Status == state.GWaiting
+	if pro != nil && waiting == (pro.Status == state.GWaiting) {
+		return nil
+	}
+
+	// Unblock waiting goroutines that are runnable or ended next
+	if waiting {
+		if err := m.encode(encoding.EventGoUnblock, 0, id, seqs[id], 0); err != nil {
+			return err
+		}
+		seqs[id]++
+		if pro != nil {
+			return nil
+		}
+	}
+
+	// Start the goroutine to block or end it
+	if err := m.encode(encoding.EventGoStart, 0, id, seqs[id]); err != nil {
+		return err
+	}
+	seqs[id]++
+	switch {
+	case pro == nil:
+		return m.encode(encoding.EventGoEnd, 0)
+	case pro.Syscall:
+		return m.encode(encoding.EventGoSysBlock, 0)
+	default:
+		return m.encode(encoding.EventGoBlock, 0, 0)
+	}
+}
+
+// renumber returns the sequence number in the output for the sequence number
+// seq of the goroutine g in the segment.
+func (s *segment) renumber(g, seq uint64) uint64 {
+	pro, ok := s.prologue[g]
+	if !ok {
+		return seq
+	}
+	return seq - pro.Seq + s.outputSeq[g]
+}
+
+// copyEvents copies the events of the segment s to the output. The events
+// of the prologue that recreate goroutines of the previous segment are
+// dropped. Timestamps, string and stack ids and sequence numbers are
+// rewritten, the frequency is written by Merge.
+func (m *merger) copyEvents(s *segment) error {
+	if _, err := s.r.Seek(s.start, io.SeekStart); err != nil {
+		return err
+	}
+
+	var (
+		dec   = encoding.NewDecoder(s.r)
+		ev    encoding.Event
+		ticks uint64
+	)
+	for {
+		if err := dec.Decode(&ev); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("input %d: %w", s.input, err)
+		}
+
+		switch ev.Type {
+		case encoding.EventBatch:
+			batch, err := ev.AsBatch(s.version)
+			if err != nil {
+				return err
+			}
+			ticks = batch.Ts
+			if err := m.encode(encoding.EventBatch, batch.P, s.ticks(ticks)); err != nil {
+				return err
+			}
+			continue
+		case encoding.EventFrequency:
+			continue
+		case encoding.EventString:
+			ev.Args[0] += s.stringOffset
+		case encoding.EventStack:
+			ev.Args[0] += s.stackOffset
+			for i := 2; i+3 < len(ev.Args); i += 4 {
+				ev.Args[i+1] = s.shiftString(ev.Args[i+1])
+				ev.Args[i+2] = s.shiftString(ev.Args[i+2])
+			}
+		}
+
+		// CPU samples always have a timestamp delta of 0 and use their
+		// real timestamp instead.
+		delta, hasTs := ev.TsDelta(s.version)
+		if hasTs && ev.Type != encoding.EventCPUSample {
+			ticks += delta
+			if s.inPrologue(&ev) {
+				continue
+			}
+			out := s.ticks(ticks)
+			ev.Args[0] = out - m.lastTicks
+			m.lastTicks = out
+		}
+		if err := s.rewrite(&ev); err != nil {
+			return err
+		}
+		if err := m.enc.Encode(&ev); err != nil {
+			return err
+		}
+	}
+}
+
+// inPrologue returns true if ev is a state event that recreates a goroutine
+// of the previous segment.
+func (s *segment) inPrologue(ev *encoding.Event) bool {
+	var name string
+	switch ev.Type {
+	case encoding.EventGoCreate:
+		name = "NewG"
+	case encoding.EventGoWaiting, encoding.EventGoInSyscall:
+		name = "G"
+	default:
+		return false
+	}
+	i, _ := encoding.ArgIndex(s.version, ev.Type, name)
+	_, ok := s.prologue[ev.Args[i]]
+	return ok
+}
+
+// rewrite shifts the string and stack ids of ev, rescales its real timestamp
+// and renumbers its goroutine or GC sequence number.
+func (s *segment) rewrite(ev *encoding.Event) error {
+	strings, stacks := encoding.RefArgs(s.version, ev.Type)
+	for _, i := range strings {
+		ev.Args[i] = s.shiftString(ev.Args[i])
+	}
+	for _, i := range stacks {
+		if ev.Args[i] != 0 {
+			ev.Args[i] += s.stackOffset
+		}
+	}
+	if i, ok := encoding.ArgIndex(s.version, ev.Type, "RealTs"); ok && ev.Args[i] != 0 {
+		ev.Args[i] = s.ticks(ev.Args[i])
+	}
+
+	switch ev.Type {
+	case encoding.EventGCStart:
+		i, _ := encoding.ArgIndex(s.version, ev.Type, "Seq")
+		ev.Args[i] += s.gcOffset
+	case encoding.EventGoStart, encoding.EventGoStartLabel,
+		encoding.EventGoUnblock, encoding.EventGoSysExit:
+		gi, _ := encoding.ArgIndex(s.version, ev.Type, "G")
+		i, _ := encoding.ArgIndex(s.version, ev.Type, "GSeq")
+		if pro, ok := s.prologue[ev.Args[gi]]; ok && ev.Args[i] < pro.Seq {
+			return fmt.Errorf("input %d: goroutine %d has sequence number %d, but %d after the state events", s.input, ev.Args[gi], ev.Args[i], pro.Seq)
+		}
+		ev.Args[i] = s.renumber(ev.Args[gi], ev.Args[i])
+	}
+	return nil
+}
+
+// shiftString returns the string id in the output for the string id id of
+// the segment. The id 0 stands for no string and is kept.
+func (s *segment) shiftString(id uint64) uint64 {
+	if id == 0 {
+		return 0
+	}
+	return id + s.stringOffset
+}
+
+// encode writes an event of type t with the given arguments. For batches it
+// sets the timestamp of the batch, for all other events the timestamp delta
+// must be the first argument.
+func (m *merger) encode(t encoding.EventType, args ...uint64) error {
+	if t == encoding.EventBatch {
+		m.lastTicks = args[1]
+	}
+	return m.enc.Encode(&encoding.Event{Type: t, Args: args})
+}
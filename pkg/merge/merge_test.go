@@ -0,0 +1,242 @@
+package merge
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/felixge/traceutils/internal/tracetest"
+	"github.com/felixge/traceutils/pkg/cut"
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/validate"
+	"github.com/stretchr/testify/require"
+	exptrace "golang.org/x/exp/trace"
+	"honnef.co/go/gotraceui/trace"
+)
+
+// TestMerge tests that merging consecutive segments cut out of a trace
+// produces a trace that gotraceui can parse and that contains the events of
+// all segments.
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.19", "trace.bin"},
+		{"1.19", "test-encoding-json.trace"},
+		{"1.21", "task.trace"},
+		{"1.21", "fgprof.trace"},
+		{"1.21", "test-encoding-json.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data := readTrace(t, test.GoVersion, test.Trace)
+			parsed, err := trace.Parse(bytes.NewReader(data), nil)
+			require.NoError(t, err)
+			duration := time.Duration(parsed.Events[len(parsed.Events)-1].Ts)
+
+			splits := []struct {
+				Name    string
+				Windows [][2]time.Duration
+			}{
+				{"adjacent", [][2]time.Duration{{0, duration / 3}, {duration / 3, 2 * duration / 3}, {2 * duration / 3, 0}}},
+				{"gaps", [][2]time.Duration{{0, duration / 4}, {duration / 2, 3 * duration / 4}, {4 * duration / 5, 0}}},
+			}
+			for _, split := range splits {
+				t.Run(split.Name, func(t *testing.T) {
+					// Cut the segments and count their events
+					var inputs []io.ReadSeeker
+					counts := make(map[eventKey]int)
+					for _, window := range split.Windows {
+						var segment bytes.Buffer
+						opts := cut.Options{Start: window[0], End: window[1]}
+						require.NoError(t, cut.Cut(bytes.NewReader(data), &segment, opts))
+						parsed, err := trace.Parse(bytes.NewReader(segment.Bytes()), nil)
+						require.NoError(t, err)
+						for _, ev := range parsed.Events {
+							counts[eventKey{ev.Type, ev.G}]++
+						}
+						inputs = append(inputs, bytes.NewReader(segment.Bytes()))
+					}
+
+					var out bytes.Buffer
+					require.NoError(t, Merge(inputs, &out))
+					got, err := trace.Parse(bytes.NewReader(out.Bytes()), nil)
+					require.NoError(t, err)
+
+					// Every event of the segments must be in the merged
+					// trace, except for the state events of goroutines
+					// that already exist. Transitions may be added.
+					for _, ev := range got.Events {
+						key := eventKey{ev.Type, ev.G}
+						if counts[key] > 0 {
+							counts[key]--
+						} else {
+							require.Contains(t, transitionEvents, key.Type, "unexpected %s event of g %d", trace.EventDescriptions[key.Type].Name, key.G)
+						}
+					}
+					for key, n := range counts {
+						if n > 0 {
+							require.Contains(t, stateEvents, key.Type, "missing %s event of g %d", trace.EventDescriptions[key.Type].Name, key.G)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestMergeV2 tests that merging consecutive segments cut out of a go 1.22+
+// trace produces a trace that the Go parser accepts, that validate finds no
+// problems in and that contains the events of all segments.
+func TestMergeV2(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.25", "test-encoding-json.trace"},
+		{"1.26", "generations.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data := readTrace(t, test.GoVersion, test.Trace)
+			idx, err := encoding.BuildIndex(bytes.NewReader(data))
+			require.NoError(t, err)
+			var maxTs int64
+			for _, b := range idx.Batches {
+				maxTs = max(maxTs, b.MaxTs)
+			}
+			duration := time.Duration(maxTs - idx.MinTs)
+
+			splits := []struct {
+				Name    string
+				Windows [][2]time.Duration
+			}{
+				{"adjacent", [][2]time.Duration{{0, duration / 3}, {duration / 3, 2 * duration / 3}, {2 * duration / 3, 0}}},
+				{"gaps", [][2]time.Duration{{0, duration / 4}, {duration / 2, 3 * duration / 4}, {4 * duration / 5, 0}}},
+			}
+			for _, split := range splits {
+				t.Run(split.Name, func(t *testing.T) {
+					// Cut the segments and count their events
+					var inputs []io.ReadSeeker
+					counts := make(map[string]int)
+					for _, window := range split.Windows {
+						var segment bytes.Buffer
+						opts := cut.Options{Start: window[0], End: window[1], Index: idx}
+						require.NoError(t, cut.Cut(bytes.NewReader(data), &segment, opts))
+						for _, ev := range tracetest.ReadEvents(t, segment.Bytes()) {
+							if key := eventKeyV2(ev); key != "" {
+								counts[key]++
+							}
+						}
+						inputs = append(inputs, bytes.NewReader(segment.Bytes()))
+					}
+
+					var out bytes.Buffer
+					require.NoError(t, Merge(inputs, &out))
+					problems, err := validate.Validate(bytes.NewReader(out.Bytes()), int64(out.Len()))
+					require.NoError(t, err)
+					require.Empty(t, problems)
+
+					// Every event of the segments must be in the merged
+					// trace, but transitions may be added.
+					for _, ev := range tracetest.ReadEvents(t, out.Bytes()) {
+						if key := eventKeyV2(ev); counts[key] > 0 {
+							counts[key]--
+						}
+					}
+					for key, n := range counts {
+						require.Zero(t, n, "missing %s", key)
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestMergeErrors tests that inputs that can't be merged are rejected.
+func TestMergeErrors(t *testing.T) {
+	go119 := readTrace(t, "1.19", "trace.bin")
+	go121 := readTrace(t, "1.21", "task.trace")
+	go110 := readTrace(t, "1.10", "simple.trace")
+	go125 := readTrace(t, "1.25", "test-encoding-json.trace")
+	go126 := readTrace(t, "1.26", "generations.trace")
+
+	tests := []struct {
+		Name   string
+		Inputs [][]byte
+		Want   string
+	}{
+		{"overlap", [][]byte{go119, go119}, "input 2 overlaps input 1"},
+		{"version", [][]byte{go119, go121}, "input 2 has trace version 1021, but input 1 has version 1019"},
+		{"unsupported", [][]byte{go110}, "unsupported trace file version 1010"},
+		{"empty", [][]byte{go119, nil}, "input 2: no frequency event"},
+		{"overlap v2", [][]byte{go125, go125}, "input 2 overlaps input 1"},
+		{"version v2", [][]byte{go125, go126}, "input 2 has trace version 1026, but input 1 has version 1025"},
+		{"empty v2", [][]byte{go125, nil}, "input 2: no frequency event"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var inputs []io.ReadSeeker
+			for _, data := range test.Inputs {
+				inputs = append(inputs, bytes.NewReader(data))
+			}
+			err := Merge(inputs, &bytes.Buffer{})
+			require.ErrorContains(t, err, test.Want)
+		})
+	}
+}
+
+// readTrace reads a trace from the testdata directory.
+func readTrace(t *testing.T, goVersion, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", goVersion, name))
+	require.NoError(t, err)
+	return data
+}
+
+// eventKeyV2 identifies the events of go 1.22+ traces that are compared by
+// TestMergeV2: user annotations, CPU samples and goroutine transitions,
+// except the ones of status events, which are added at the start of every
+// segment. It's empty for all other events.
+func eventKeyV2(ev exptrace.Event) string {
+	switch ev.Kind() {
+	case exptrace.EventLog, exptrace.EventRegionBegin, exptrace.EventRegionEnd,
+		exptrace.EventTaskBegin, exptrace.EventTaskEnd, exptrace.EventStackSample:
+		return fmt.Sprintf("%v %d", ev.Kind(), ev.Goroutine())
+	case exptrace.EventStateTransition:
+		st := ev.StateTransition()
+		if st.Resource.Kind != exptrace.ResourceGoroutine {
+			return ""
+		}
+		from, to := st.Goroutine()
+		if from == exptrace.GoUndetermined || from == to {
+			return ""
+		}
+		return fmt.Sprintf("%v %d %v %v", ev.Kind(), st.Resource.Goroutine(), from, to)
+	}
+	return ""
+}
+
+// eventKey identifies the events that are compared by TestMerge.
+type eventKey struct {
+	Type byte
+	G    uint64
+}
+
+// stateEvents are the types of the events that recreate goroutines at the
+// start of a segment and may be dropped.
+var stateEvents = []byte{trace.EvGoCreate, trace.EvGoWaiting, trace.EvGoInSyscall}
+
+// transitionEvents are the types of the events that may be added between
+// segments.
+var transitionEvents = []byte{
+	trace.EvGoSched, trace.EvGoBlock, trace.EvGoSysBlock, trace.EvGoEnd,
+	trace.EvGoUnblock, trace.EvGoStart, trace.EvGCDone, trace.EvSTWDone,
+	trace.EvGCSweepDone, trace.EvProcStop,
+}
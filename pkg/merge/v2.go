@@ -0,0 +1,949 @@
+package merge
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/state"
+)
+
+// mergeV2 merges go 1.22+ traces of the given version. Such traces consist of
+// generations with their own string and stack tables, frequency and sequence
+// numbers. The generations of all inputs are copied with consecutive numbers
+// and keep their tables and sync events, so their string and stack ids don't
+// collide and their timestamps keep the frequency they were recorded with.
+// Between two inputs, events in the last generation of the previous one bring
+// its state into the state that the status events of the next one describe.
+// An input that starts less than two ticks after the previous one ends, e.g.
+// the next cut of the same trace, is shifted to make room for these events.
+func mergeV2(inputs []io.ReadSeeker, w io.Writer, version int) error {
+	// Read the state of all inputs before writing anything to report
+	// errors early.
+	var segments []*segmentV2
+	for i, r := range inputs {
+		s, err := scanV2(r, i+1, version)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			prev := segments[i-1]
+			if end := prev.maxTicks - prev.ticksOffset; s.minTicks < end {
+				return fmt.Errorf("input %d overlaps input %d: it starts at tick %d before the end of input %d at tick %d, inputs must be given in the order in which they were recorded", s.input, prev.input, s.minTicks, prev.input, end)
+			}
+			s.genOffset = prev.lastGen + prev.genOffset + 1 - s.firstGen
+			// The transition needs two ticks after prev, e.g. between
+			// consecutive cuts of a trace that share a tick.
+			if s.minTicks < prev.maxTicks+2 {
+				s.ticksOffset = prev.maxTicks + 2 - s.minTicks
+				s.minTicks += s.ticksOffset
+				s.maxTicks += s.ticksOffset
+			}
+		}
+		segments = append(segments, s)
+	}
+
+	m := &mergerV2{enc: encoding.NewEncoderVersion(w, version), version: version}
+	for i, s := range segments {
+		if err := m.copyEvents(s); err != nil {
+			return err
+		}
+		if i+1 < len(segments) {
+			if err := m.writeTransition(s, segments[i+1]); err != nil {
+				return err
+			}
+		}
+		if err := m.endGeneration(); err != nil {
+			return err
+		}
+	}
+	return m.enc.Close()
+}
+
+// segmentV2 holds the information about a go 1.22+ input that is needed to
+// merge it.
+type segmentV2 struct {
+	r       io.ReadSeeker
+	input   int   // number of the input starting at 1
+	start   int64 // position of r
+	version int
+
+	firstGen uint64 // first generation
+	lastGen  uint64 // last generation
+	minTicks uint64 // timestamp of the first event
+	maxTicks uint64 // timestamp of the last event
+
+	genOffset   uint64 // added to the generations
+	gcOffset    uint64 // added to the GC sequence numbers
+	ticksOffset uint64 // added to the timestamps of the batches
+
+	// state at the end of the segment
+	state *state.V2
+	// prologue is the state at the start of the segment.
+	prologue *prologueV2
+	// idle contains the Ps whose abandoned status in the first generation is
+	// written as idle, because the transition from the previous segment
+	// leaves them idle.
+	idle map[uint64]bool
+}
+
+// prologueV2 is the state at the start of a go 1.22+ segment as described by
+// the status events of the first generation in which each goroutine and P
+// appears.
+type prologueV2 struct {
+	gs  map[uint64]*state.V2G // nil for goroutines that are created in the segment
+	ps  map[uint64]*state.V2P
+	gMs map[uint64]int64 // M of the goroutines that are running or in a syscall
+	pMs map[uint64]int64 // M of the Ps that are running or in a syscall
+
+	gc      bool   // true if a GC is running
+	gcSeq   uint64 // sequence number of the first GC event
+	gcKnown bool   // true if the segment has GC events
+}
+
+// binding is the goroutine and P of an M.
+type binding struct {
+	g uint64 // goroutine running or in a syscall on the M or 0
+	p int64  // P held by the M or -1
+}
+
+// bindings returns the goroutine and P of every M given the M of the
+// goroutines gMs and the M of the Ps pMs.
+func bindings(gMs, pMs map[uint64]int64) map[int64]binding {
+	ms := make(map[int64]binding)
+	get := func(m int64) binding {
+		if b, ok := ms[m]; ok {
+			return b
+		}
+		return binding{p: -1}
+	}
+	for g, m := range gMs {
+		b := get(m)
+		b.g = g
+		ms[m] = b
+	}
+	for p, m := range pMs {
+		b := get(m)
+		b.p = int64(p)
+		ms[m] = b
+	}
+	return ms
+}
+
+// scanV2 reads the go 1.22+ input r to determine its generations, time range,
+// the state at its start and the state at its end.
+func scanV2(r io.ReadSeeker, input, version int) (*segmentV2, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	s := &segmentV2{
+		r:        r,
+		input:    input,
+		start:    start,
+		version:  version,
+		minTicks: math.MaxUint64,
+		state:    state.NewV2(version),
+		prologue: &prologueV2{
+			gs:  make(map[uint64]*state.V2G),
+			ps:  make(map[uint64]*state.V2P),
+			gMs: make(map[uint64]int64),
+			pMs: make(map[uint64]int64),
+		},
+		idle: make(map[uint64]bool),
+	}
+
+	var (
+		dec   = encoding.NewContextDecoder(r)
+		ev    encoding.ContextEvent
+		gen   uint64
+		batch bool                      // true after the first batch
+		ms    [][]encoding.ContextEvent // events of the generation by M
+		index = make(map[int64]int)     // index in ms by M
+	)
+	// Update the state and prologue with the events of a generation
+	flush := func() error {
+		if err := s.prologue.add(version, ms); err != nil {
+			return err
+		} else if err := s.state.UpdateOrdered(ms); err != nil {
+			return err
+		}
+		ms = nil
+		clear(index)
+		return nil
+	}
+	for {
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("input %d: %w", input, err)
+		} else if v := dec.Version(); v != version {
+			return nil, fmt.Errorf("input %d has trace version %d, but input 1 has version %d", input, v, version)
+		}
+
+		switch ev.Type {
+		case encoding.EventV2Batch:
+			header, err := ev.AsV2Batch(version)
+			if err != nil {
+				return nil, err
+			}
+			if !batch {
+				s.firstGen, batch = header.Gen, true
+			} else if header.Gen != gen {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			gen, s.lastGen = header.Gen, header.Gen
+			continue
+		case encoding.EventV2CPUSample, encoding.EventV2ClockSnapshot:
+			// The clock snapshot of a cut trace is taken at the start of
+			// the original generation, which can be before the previous
+			// input ends.
+			continue
+		}
+		if _, ok := ev.TsDelta(version); !ok {
+			continue
+		}
+		s.minTicks = min(s.minTicks, ev.Ticks)
+		s.maxTicks = max(s.maxTicks, ev.Ticks)
+
+		i, ok := index[ev.M]
+		if !ok {
+			i = len(ms)
+			index[ev.M] = i
+			ms = append(ms, nil)
+		}
+		cp := encoding.ContextEvent{Event: encoding.Event{Type: ev.Type, Args: slices.Clone(ev.Args)}, Ts: ev.Ts, Ticks: ev.Ticks, M: ev.M, P: ev.P, G: ev.G}
+		ms[i] = append(ms[i], cp)
+	}
+	if s.minTicks > s.maxTicks {
+		return nil, fmt.Errorf("input %d contains no events", input)
+	} else if err := flush(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// add adds the goroutines and Ps of a generation that haven't appeared in
+// earlier generations to the prologue. ms contains the events of the
+// generation grouped by M. Goroutines that are created in the generation
+// are added without a state, and the first GC event of the segment
+// determines the state of the GC.
+func (pro *prologueV2) add(version int, ms [][]encoding.ContextEvent) error {
+	var (
+		gs      = make(map[uint64]bool) // goroutines with a status in the generation
+		ps      = make(map[uint64]bool) // Ps with a status in the generation
+		assists []uint64
+		sweeps  []uint64
+	)
+	for _, evs := range ms {
+		for i := range evs {
+			ev := &evs[i]
+			switch ev.Type {
+			case encoding.EventV2GoStatus, encoding.EventV2GoStatusStack:
+				g, _ := encoding.ArgIndex(version, ev.Type, "G")
+				gm, _ := encoding.ArgIndex(version, ev.Type, "M")
+				status, _ := encoding.ArgIndex(version, ev.Type, "Status")
+				id := ev.Args[g]
+				if _, ok := pro.gs[id]; ok {
+					continue
+				}
+				gs[id] = true
+				pro.gs[id] = &state.V2G{Status: state.V2GStatus(ev.Args[status])}
+				switch pro.gs[id].Status {
+				case state.V2GRunning:
+					pro.gMs[id] = ev.M
+				case state.V2GSyscall:
+					pro.gMs[id] = int64(ev.Args[gm])
+				}
+			case encoding.EventV2GoCreate, encoding.EventV2GoCreateBlocked, encoding.EventV2GoCreateSyscall:
+				g, _ := encoding.ArgIndex(version, ev.Type, "NewG")
+				if _, ok := pro.gs[ev.Args[g]]; !ok {
+					pro.gs[ev.Args[g]] = nil
+				}
+			case encoding.EventV2ProcStatus:
+				status, err := ev.AsV2ProcStatus(version)
+				if err != nil {
+					return err
+				} else if _, ok := pro.ps[status.P]; ok {
+					continue
+				}
+				ps[status.P] = true
+				pro.ps[status.P] = &state.V2P{Status: state.V2PStatus(status.Status)}
+				if s := state.V2PStatus(status.Status); s == state.V2PRunning || s == state.V2PSyscall {
+					pro.pMs[status.P] = ev.M
+				}
+			case encoding.EventV2GCMarkAssistActive:
+				active, err := ev.AsV2GCMarkAssistActive(version)
+				if err != nil {
+					return err
+				}
+				assists = append(assists, active.G)
+			case encoding.EventV2GCSweepActive:
+				active, err := ev.AsV2GCSweepActive(version)
+				if err != nil {
+					return err
+				}
+				sweeps = append(sweeps, active.P)
+			case encoding.EventV2GCActive, encoding.EventV2GCBegin, encoding.EventV2GCEnd:
+				seq, _ := encoding.ArgIndex(version, ev.Type, "Seq")
+				if !pro.gcKnown || ev.Args[seq] < pro.gcSeq {
+					pro.gc, pro.gcSeq, pro.gcKnown = ev.Type != encoding.EventV2GCBegin, ev.Args[seq], true
+				}
+			}
+		}
+	}
+
+	// Mark assists and sweeps are active at the start if they are active
+	// in the generation of the status.
+	for _, g := range assists {
+		if gs[g] {
+			pro.gs[g].Assist = true
+		}
+	}
+	for _, p := range sweeps {
+		if ps[p] {
+			pro.ps[p].Sweeping = true
+		}
+	}
+	return nil
+}
+
+// mergerV2 holds the state of mergeV2.
+type mergerV2 struct {
+	enc     *encoding.Encoder
+	version int
+
+	// output batch whose length is only known after its events
+	batch []encoding.Event
+}
+
+// copyEvents copies the events of the segment s to the output. The
+// generations and GC sequence numbers are shifted, and the ends of the
+// generations are written by mergeV2 after the last one.
+func (m *mergerV2) copyEvents(s *segmentV2) error {
+	if _, err := s.r.Seek(s.start, io.SeekStart); err != nil {
+		return err
+	}
+
+	var (
+		dec = encoding.NewDecoder(s.r)
+		ev  encoding.Event
+		gen = s.firstGen
+	)
+	for {
+		if err := dec.Decode(&ev); err == io.EOF {
+			return m.flush()
+		} else if err != nil {
+			return fmt.Errorf("input %d: %w", s.input, err)
+		}
+
+		switch ev.Type {
+		case encoding.EventV2Batch, encoding.EventV2ExperimentalBatch:
+			if err := m.flush(); err != nil {
+				return err
+			}
+			i, _ := encoding.ArgIndex(s.version, ev.Type, "Gen")
+			if ev.Args[i] != gen {
+				if err := m.endGeneration(); err != nil {
+					return err
+				}
+			}
+			gen = ev.Args[i]
+			ev.Args[i] += s.genOffset
+			ts, _ := encoding.ArgIndex(s.version, ev.Type, "Ts")
+			ev.Args[ts] += s.ticksOffset
+			if ev.Type == encoding.EventV2ExperimentalBatch {
+				// The data of experimental batches is copied as it is
+				if err := m.enc.Encode(&ev); err != nil {
+					return err
+				}
+				continue
+			}
+		case encoding.EventV2EndOfGeneration:
+			continue
+		case encoding.EventV2ProcStatus:
+			p, _ := encoding.ArgIndex(s.version, ev.Type, "P")
+			status, _ := encoding.ArgIndex(s.version, ev.Type, "Status")
+			if gen == s.firstGen && s.idle[ev.Args[p]] && state.V2PStatus(ev.Args[status]) == state.V2PSyscallAbandoned {
+				ev.Args[status] = uint64(state.V2PIdle)
+			}
+		case encoding.EventV2GCActive, encoding.EventV2GCBegin, encoding.EventV2GCEnd:
+			i, _ := encoding.ArgIndex(s.version, ev.Type, "Seq")
+			ev.Args[i] += s.gcOffset
+		}
+		m.batch = append(m.batch, encoding.Event{Type: ev.Type, Args: slices.Clone(ev.Args), Str: slices.Clone(ev.Str)})
+	}
+}
+
+// endGeneration writes the end of the current generation if the version of
+// the output has such events.
+func (m *mergerV2) endGeneration() error {
+	if m.version < 1026 {
+		return nil
+	}
+	return m.enc.Encode(&encoding.Event{Type: encoding.EventV2EndOfGeneration})
+}
+
+// flush writes the output batch with its length if it has any events.
+func (m *mergerV2) flush() error {
+	defer func() { m.batch = m.batch[:0] }()
+	if len(m.batch) <= 1 {
+		return nil
+	}
+	var length int
+	for i := range m.batch[1:] {
+		length += encoding.EncodedSize(m.version, &m.batch[1+i])
+	}
+	m.batch[0].Args[3] = uint64(length)
+	for i := range m.batch {
+		if err := m.enc.Encode(&m.batch[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTransition writes batches to the last generation of prev with events
+// that bring the state at the end of prev into the state at the start of
+// next. The goroutines and Ps that run or are in a syscall at the end of prev
+// are stopped, unless a goroutine stays in a syscall on the same M, and the
+// ones that next starts with are started on their M. All other goroutines are
+// created, unblocked, blocked or destroyed on a free P, which also begins or
+// ends the GC. The GC sequence numbers of next are shifted to continue from
+// the ones of prev.
+func (m *mergerV2) writeTransition(prev, next *segmentV2) error {
+	s, pro := prev.state, next.prologue
+	s.GCSeq += prev.gcOffset
+	gMs, pMs := s.Bound()
+	t := &transition{
+		version: m.version,
+		input:   next.input,
+		gen:     prev.lastGen + prev.genOffset,
+		s:       s,
+		pro:     pro,
+		cur:     bindings(gMs, pMs),
+		next:    bindings(pro.gMs, pro.pMs),
+		batches: make(map[int64][]encoding.Event),
+		ticks:   make(map[int64]uint64),
+		resetGs: make(map[uint64]bool),
+		resetPs: make(map[uint64]bool),
+	}
+
+	// Determine the event that brings the GC into the state at the start of
+	// next and the shift of its sequence numbers. If the GC state of prev is
+	// unknown, next can start a GC with any sequence number.
+	if pro.gcKnown {
+		seq := s.GCSeq
+		switch {
+		case pro.gc && !(s.GCKnown && s.GC):
+			t.gcType, t.gcSeq = encoding.EventV2GCBegin, s.GCSeq+1
+			seq = t.gcSeq
+		case !pro.gc && s.GCKnown && s.GC:
+			t.gcType, t.gcSeq = encoding.EventV2GCEnd, s.GCSeq+1
+			seq = t.gcSeq
+		}
+		if pro.gc || s.GCKnown {
+			next.gcOffset = seq + 1 - pro.gcSeq
+		}
+	}
+
+	// The events happen between the segments, first the ones that stop
+	// goroutines and Ps, then the ones that start them. mergeV2 leaves a
+	// gap of at least two ticks for them.
+	stop := prev.maxTicks + (next.minTicks-prev.maxTicks)/2
+	start := stop + 1
+	if err := t.stop(stop); err != nil {
+		return err
+	} else if err := t.work(start); err != nil {
+		return err
+	} else if err := t.start(start); err != nil {
+		return err
+	}
+
+	// Ps that next starts as abandoned in a syscall are idle now
+	for id, p := range pro.ps {
+		if cur, ok := s.Ps[id]; ok && cur.Status == state.V2PIdle && p.Status == state.V2PSyscallAbandoned {
+			next.idle[id] = true
+		}
+	}
+	// The GC state carries over if next has no GC events
+	if !pro.gcKnown {
+		next.state.GC, next.state.GCSeq, next.state.GCKnown = s.GC, s.GCSeq, s.GCKnown
+	}
+
+	for _, id := range t.order {
+		m.batch = append(m.batch[:0], t.batches[id]...)
+		if err := m.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transition writes the events between two segments and updates the state
+// at the end of the previous segment for them.
+type transition struct {
+	version int
+	input   int    // number of the next input
+	gen     uint64 // generation of the events in the output
+	s       *state.V2
+	pro     *prologueV2
+	cur     map[int64]binding // goroutine and P of the Ms at the end of the previous segment
+	next    map[int64]binding // goroutine and P of the Ms at the start of the next segment
+
+	// event that changes the GC state or 0 if there is none, and its
+	// sequence number
+	gcType encoding.EventType
+	gcSeq  uint64
+
+	// batches of the Ms in the order in which they were started
+	batches map[int64][]encoding.Event
+	order   []int64
+	ticks   map[int64]uint64 // timestamp of the last event of the batches
+
+	// goroutines and Ps whose sequence numbers have been reset by a status
+	// event or that have been created
+	resetGs map[uint64]bool
+	resetPs map[uint64]bool
+}
+
+// emit adds an event of type t with the given arguments after the timestamp
+// delta to the batch of the M m and updates the state for it.
+func (t *transition) emit(m int64, ticks uint64, typ encoding.EventType, args ...uint64) error {
+	if _, ok := t.batches[m]; !ok {
+		t.batches[m] = []encoding.Event{{Type: encoding.EventV2Batch, Args: []uint64{t.gen, uint64(m), ticks, 0}}}
+		t.ticks[m] = ticks
+		t.order = append(t.order, m)
+	}
+	ev := encoding.ContextEvent{
+		Event: encoding.Event{Type: typ, Args: append([]uint64{ticks - t.ticks[m]}, args...)},
+		Ticks: ticks,
+		M:     m,
+	}
+	t.batches[m] = append(t.batches[m], ev.Event)
+	t.ticks[m] = ticks
+	return t.s.Update(&ev)
+}
+
+// kept returns true if the M m keeps its goroutine in a syscall without a P
+// from the end of the previous segment to the start of the next one.
+func (t *transition) kept(m int64) bool {
+	b, ok := t.cur[m]
+	if !ok || b.g == 0 || b.p >= 0 || t.next[m] != b {
+		return false
+	}
+	g, next := t.s.Gs[b.g], t.pro.gs[b.g]
+	return g.Status == state.V2GSyscall && next != nil && next.Status == state.V2GSyscall
+}
+
+// assist returns true if the goroutine g is in a mark assist at the start of
+// the next segment.
+func (t *transition) assist(g uint64) bool {
+	next := t.pro.gs[g]
+	return next != nil && next.Assist
+}
+
+// sweeping returns true if the P p sweeps at the start of the next segment.
+func (t *transition) sweeping(p uint64) bool {
+	next := t.pro.ps[p]
+	return next != nil && next.Sweeping
+}
+
+// stop ends the syscalls of the Ms at the end of the previous segment and
+// stops their goroutines and Ps, except for the kept ones. The STW phases and
+// the mark assists and sweeps that don't continue in the next segment end.
+// The goroutines are stopped into the state at the start of the next
+// segment if they aren't running then.
+func (t *transition) stop(ticks uint64) error {
+	for _, id := range state.SortedKeys(t.cur) {
+		if t.kept(id) {
+			continue
+		}
+		var (
+			b = t.cur[id]
+			g = t.s.Gs[b.g]
+			p *state.V2P
+		)
+		if b.p >= 0 {
+			p = t.s.Ps[uint64(b.p)]
+		}
+
+		if g != nil && g.Status == state.V2GSyscall {
+			typ := encoding.EventV2GoSyscallEndBlocked
+			if p != nil {
+				typ = encoding.EventV2GoSyscallEnd
+			}
+			if err := t.emit(id, ticks, typ); err != nil {
+				return err
+			}
+		}
+		if g != nil && g.Status == state.V2GRunning && p != nil {
+			if g.STW {
+				if err := t.emit(id, ticks, encoding.EventV2STWEnd); err != nil {
+					return err
+				}
+			}
+			if g.Assist && !t.assist(b.g) {
+				if err := t.emit(id, ticks, encoding.EventV2GCMarkAssistEnd); err != nil {
+					return err
+				}
+			}
+			if err := t.stopG(id, ticks, b.g); err != nil {
+				return err
+			}
+		}
+		if p != nil {
+			if p.Sweeping && !t.sweeping(uint64(b.p)) {
+				if err := t.emit(id, ticks, encoding.EventV2GCSweepEnd, 0, 0); err != nil {
+					return err
+				}
+			}
+			if err := t.emit(id, ticks, encoding.EventV2ProcStop); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stopG stops the goroutine g running on the M m into its state at the start
+// of the next segment, or destroys it if it doesn't exist then.
+func (t *transition) stopG(m int64, ticks uint64, g uint64) error {
+	switch next := t.pro.gs[g]; {
+	case next == nil:
+		return t.emit(m, ticks, encoding.EventV2GoDestroy)
+	case next.Status == state.V2GWaiting:
+		return t.emit(m, ticks, encoding.EventV2GoBlock, 0, 0)
+	default:
+		return t.emit(m, ticks, encoding.EventV2GoStop, 0, 0)
+	}
+}
+
+// changes returns true if the goroutine g must be created or changed on the
+// free P. Goroutines that run or are in a syscall at the start of the next
+// segment are only created there and started on their M.
+func (t *transition) changes(g uint64) bool {
+	cur, next := t.s.Gs[g], t.pro.gs[g]
+	if _, ok := t.pro.gMs[g]; ok {
+		return cur == nil
+	}
+	switch {
+	case cur == nil:
+		return next != nil
+	case next == nil:
+		return true
+	}
+	return cur.Status != next.Status || cur.Assist != next.Assist || cur.STW
+}
+
+// work creates and changes the goroutines that don't run at the start of the
+// next segment, changes the sweeps of the Ps that are idle then and changes
+// the state of the GC. This happens on a free P of an M that isn't used
+// otherwise.
+func (t *transition) work(ticks uint64) error {
+	var ps, gs []uint64
+	for _, id := range state.SortedKeys(t.s.Ps) {
+		cur, next := t.s.Ps[id], t.pro.ps[id]
+		if _, ok := t.pro.pMs[id]; ok || next == nil {
+			continue
+		} else if cur.Sweeping != next.Sweeping || (cur.Status == state.V2PSyscallAbandoned && next.Status == state.V2PIdle) {
+			ps = append(ps, id)
+		}
+	}
+	ids := state.SortedKeys(t.s.Gs)
+	for id := range t.pro.gs {
+		if _, ok := t.s.Gs[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		if t.changes(id) {
+			gs = append(gs, id)
+		}
+	}
+	if len(ps) == 0 && len(gs) == 0 && t.gcType == 0 {
+		return nil
+	}
+
+	// Use an M that has no goroutine or P at the start of the next segment
+	m := int64(-1)
+	for _, id := range state.SortedKeys(t.s.Ms) {
+		if _, ok := t.next[id]; !ok && id >= 0 && !t.kept(id) {
+			m = id
+			break
+		}
+		m = max(m, id)
+	}
+	if _, ok := t.next[m]; ok || m < 0 || t.kept(m) {
+		m = max(m, 0) + 1
+		for _, id := range state.SortedKeys(t.next) {
+			m = max(m, id+1)
+		}
+	}
+
+	// Change the sweeps of idle Ps and make abandoned ones idle
+	for _, id := range ps {
+		cur, next := t.s.Ps[id], t.pro.ps[id]
+		if cur.Sweeping == next.Sweeping {
+			if err := t.resetP(m, ticks, id); err != nil {
+				return err
+			} else if err := t.emit(m, ticks, encoding.EventV2ProcSteal, id, cur.Seq+1, uint64(m)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := t.startP(m, ticks, id); err != nil {
+			return err
+		}
+		var err error
+		if next.Sweeping {
+			err = t.emit(m, ticks, encoding.EventV2GCSweepBegin, 0)
+		} else {
+			err = t.emit(m, ticks, encoding.EventV2GCSweepEnd, 0, 0)
+		}
+		if err != nil {
+			return err
+		} else if err := t.emit(m, ticks, encoding.EventV2ProcStop); err != nil {
+			return err
+		}
+	}
+	if len(gs) == 0 && t.gcType == 0 {
+		return nil
+	}
+
+	// Change the goroutines
+	p := t.freeP()
+	if p < 0 {
+		return fmt.Errorf("input %d: no free P to bring the goroutines into their state at the start of the input", t.input)
+	} else if err := t.startP(m, ticks, uint64(p)); err != nil {
+		return err
+	}
+	for _, id := range gs {
+		if err := t.change(m, ticks, id); err != nil {
+			return err
+		}
+	}
+	if t.gcType != 0 {
+		// Run a goroutine that keeps its state to change the GC
+		for _, id := range state.SortedKeys(t.s.Gs) {
+			g := t.s.Gs[id]
+			if _, ok := t.pro.gMs[id]; ok || t.pro.gs[id] == nil || g.Status == state.V2GRunning || g.Status == state.V2GSyscall {
+				continue
+			} else if err := t.run(m, ticks, id); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if t.gcType != 0 {
+		return fmt.Errorf("input %d: no goroutine to bring the GC into its state at the start of the input", t.input)
+	}
+	return t.emit(m, ticks, encoding.EventV2ProcStop)
+}
+
+// change creates the goroutine g on the M m or brings it into its state at
+// the start of the next segment. Goroutines that only need to become
+// runnable are unblocked, all others are run and stopped.
+func (t *transition) change(m int64, ticks uint64, g uint64) error {
+	cur, next := t.s.Gs[g], t.pro.gs[g]
+	_, bound := t.pro.gMs[g]
+	if cur == nil {
+		typ := encoding.EventV2GoCreate
+		if !bound && next.Status == state.V2GWaiting && t.version >= 1023 {
+			typ = encoding.EventV2GoCreateBlocked
+		}
+		if err := t.emit(m, ticks, typ, g, 0, 0); err != nil {
+			return err
+		}
+		t.resetGs[g] = true
+		if cur = t.s.Gs[g]; bound || (cur.Status == next.Status && !next.Assist) {
+			return nil
+		}
+	} else if next != nil && cur.Status == state.V2GWaiting && next.Status == state.V2GRunnable && cur.Assist == next.Assist && !cur.STW {
+		if err := t.resetG(m, ticks, g); err != nil {
+			return err
+		}
+		return t.emit(m, ticks, encoding.EventV2GoUnblock, g, cur.Seq+1, 0)
+	}
+	return t.run(m, ticks, g)
+}
+
+// run starts the goroutine g on the M m, ends its STW phase, changes its mark
+// assist and the GC, and stops it into its state at the start of the next
+// segment.
+func (t *transition) run(m int64, ticks uint64, g uint64) error {
+	if err := t.startG(m, ticks, g); err != nil {
+		return err
+	} else if err := t.changeGC(m, ticks); err != nil {
+		return err
+	} else if err := t.changeAssist(m, ticks, g); err != nil {
+		return err
+	}
+	return t.stopG(m, ticks, g)
+}
+
+// start starts the Ps and goroutines that run or are in a syscall at the
+// start of the next segment on their M. Goroutines in a syscall without a P
+// enter the syscall on a free P, which the M then steals from itself.
+func (t *transition) start(ticks uint64) error {
+	for _, id := range state.SortedKeys(t.next) {
+		if t.kept(id) {
+			continue
+		}
+		b := t.next[id]
+		if b.p >= 0 {
+			p := uint64(b.p)
+			if err := t.startP(id, ticks, p); err != nil {
+				return err
+			}
+			var err error
+			if cur := t.s.Ps[p]; t.sweeping(p) && !cur.Sweeping {
+				err = t.emit(id, ticks, encoding.EventV2GCSweepBegin, 0)
+			} else if !t.sweeping(p) && cur.Sweeping {
+				err = t.emit(id, ticks, encoding.EventV2GCSweepEnd, 0, 0)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if b.g == 0 {
+			continue
+		}
+
+		next := t.pro.gs[b.g]
+		borrowed := int64(-1)
+		if b.p < 0 {
+			if next.Status != state.V2GSyscall {
+				return fmt.Errorf("input %d: goroutine %d runs on M %d without a P", t.input, b.g, id)
+			} else if borrowed = t.freeP(); borrowed < 0 {
+				return fmt.Errorf("input %d: no free P to bring goroutine %d into a syscall", t.input, b.g)
+			} else if err := t.startP(id, ticks, uint64(borrowed)); err != nil {
+				return err
+			}
+		}
+		if err := t.startG(id, ticks, b.g); err != nil {
+			return err
+		} else if err := t.changeAssist(id, ticks, b.g); err != nil {
+			return err
+		}
+		if next.Status == state.V2GSyscall {
+			p := t.s.Ps[uint64(t.s.Ms[id].P)]
+			if err := t.emit(id, ticks, encoding.EventV2GoSyscallBegin, p.Seq+1, 0); err != nil {
+				return err
+			}
+			if borrowed >= 0 {
+				if err := t.emit(id, ticks, encoding.EventV2ProcSteal, uint64(borrowed), p.Seq+1, uint64(id)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// freeP returns the P with the lowest id that is idle or abandoned and not
+// held by an M, or -1 if there is none.
+func (t *transition) freeP() int64 {
+	held := make(map[int64]bool)
+	for _, m := range t.s.Ms {
+		held[m.P] = true
+	}
+	for _, id := range state.SortedKeys(t.s.Ps) {
+		if s := t.s.Ps[id].Status; !held[int64(id)] && (s == state.V2PIdle || s == state.V2PSyscallAbandoned) {
+			return int64(id)
+		}
+	}
+	return -1
+}
+
+// resetP writes the status of the P p on the M m to restart its sequence
+// number, unless this has been done already. Ps without a state are idle.
+func (t *transition) resetP(m int64, ticks uint64, p uint64) error {
+	if t.resetPs[p] {
+		return nil
+	}
+	t.resetPs[p] = true
+	status := t.s.P(p).Status
+	if status == state.V2PBad {
+		status = state.V2PIdle
+	}
+	return t.emit(m, ticks, encoding.EventV2ProcStatus, p, uint64(status))
+}
+
+// startP starts the P p on the M m. Abandoned Ps are stolen first to make
+// them idle.
+func (t *transition) startP(m int64, ticks uint64, p uint64) error {
+	if err := t.resetP(m, ticks, p); err != nil {
+		return err
+	}
+	ps := t.s.P(p)
+	if ps.Status == state.V2PSyscallAbandoned {
+		if err := t.emit(m, ticks, encoding.EventV2ProcSteal, p, ps.Seq+1, uint64(m)); err != nil {
+			return err
+		}
+	}
+	return t.emit(m, ticks, encoding.EventV2ProcStart, p, ps.Seq+1)
+}
+
+// resetG writes the status of the goroutine g on the M m to restart its
+// sequence number, unless this has been done already or g was created by
+// the transition.
+func (t *transition) resetG(m int64, ticks uint64, g uint64) error {
+	if t.resetGs[g] {
+		return nil
+	}
+	t.resetGs[g] = true
+	return t.emit(m, ticks, encoding.EventV2GoStatus, g, math.MaxUint64, uint64(t.s.Gs[g].Status))
+}
+
+// startG starts the goroutine g, which must be runnable or waiting, on the M
+// m.
+func (t *transition) startG(m int64, ticks uint64, g uint64) error {
+	if err := t.resetG(m, ticks, g); err != nil {
+		return err
+	}
+	gs := t.s.Gs[g]
+	if gs.Status == state.V2GWaiting {
+		if err := t.emit(m, ticks, encoding.EventV2GoUnblock, g, gs.Seq+1, 0); err != nil {
+			return err
+		}
+	}
+	return t.emit(m, ticks, encoding.EventV2GoStart, g, gs.Seq+1)
+}
+
+// changeAssist ends the STW phase of the goroutine g running on the M m and
+// begins or ends its mark assist as it is at the start of the next segment.
+func (t *transition) changeAssist(m int64, ticks uint64, g uint64) error {
+	gs := t.s.Gs[g]
+	if gs.STW {
+		if err := t.emit(m, ticks, encoding.EventV2STWEnd); err != nil {
+			return err
+		}
+	}
+	switch assist := t.assist(g); {
+	case assist && !gs.Assist:
+		return t.emit(m, ticks, encoding.EventV2GCMarkAssistBegin, 0)
+	case !assist && gs.Assist:
+		return t.emit(m, ticks, encoding.EventV2GCMarkAssistEnd)
+	}
+	return nil
+}
+
+// changeGC writes the event that changes the state of the GC on the M m if it
+// hasn't been written yet. A goroutine must be running on m.
+func (t *transition) changeGC(m int64, ticks uint64) error {
+	var err error
+	switch t.gcType {
+	case encoding.EventV2GCBegin:
+		err = t.emit(m, ticks, t.gcType, t.gcSeq, 0)
+	case encoding.EventV2GCEnd:
+		err = t.emit(m, ticks, t.gcType, t.gcSeq)
+	}
+	t.gcType = 0
+	return err
+}
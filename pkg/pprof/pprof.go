@@ -193,6 +193,11 @@ func Convert(r io.Reader, w io.Writer, opt Options) error {
 		gStates[g] = s
 	}
 
+	// The running time is split between the CPU samples, without them only
+	// the off-CPU time is known.
+	if cpuSamples == 0 {
+		return p.Write(w)
+	}
 	weight := runningTime / time.Duration(cpuSamples)
 	for _, e := range t.Events {
 		if e.Type != trace.EvCPUSample {
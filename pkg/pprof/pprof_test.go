@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/tracebuilder"
 	"github.com/google/pprof/profile"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -53,3 +56,79 @@ func samplesDuration(samples []*profile.Sample) (d time.Duration) {
 func round(d, precision time.Duration) time.Duration {
 	return d / precision * precision
 }
+
+// TestPPROFWallSynthetic tests edge cases with traces created by
+// tracebuilder.
+func TestPPROFWallSynthetic(t *testing.T) {
+	var (
+		b      = tracebuilder.New()
+		main   = b.Stack(tracebuilder.Frame{Func: "main.main", File: "main.go", Line: 10})
+		worker = b.Stack(tracebuilder.Frame{Func: "main.worker", File: "main.go", Line: 20})
+		recv   = b.Stack(tracebuilder.Frame{Func: "main.recv", File: "main.go", Line: 30})
+	)
+	// Goroutine 1 runs main, goroutine 2 is blocked at the start of the trace
+	// until goroutine 1 unblocks it.
+	b.GoCreate(0, 0, 1, main, 0)
+	b.GoCreate(0, 0, 2, worker, 0)
+	b.GoWaiting(0, 0, 2)
+	b.ProcStart(0, 0, 1)
+	b.GoStart(0, 0, 1)
+	b.CPUSample(0, time.Millisecond, 1, main)
+	b.CPUSample(0, 2*time.Millisecond, 1, 0)
+	b.GoUnblock(0, 10*time.Millisecond, 2, main)
+	b.GoBlock(0, 12*time.Millisecond, encoding.EventGoBlockRecv, recv)
+	b.GoStart(0, 15*time.Millisecond, 2)
+	b.GoEnd(0, 20*time.Millisecond)
+	b.ProcStop(0, 20*time.Millisecond)
+
+	p := convertSynthetic(t, b)
+	// The blocked goroutine is waiting at the stack of its creation
+	assert.Equal(t, 10*time.Millisecond, samplesDuration(samplesWithState(samplesWithFunc(p, "main.worker"), "waiting")))
+	assert.Equal(t, 5*time.Millisecond, samplesDuration(samplesWithState(samplesWithFunc(p, "main.worker"), "runnable")))
+	// The running time of goroutine 1 is split between the CPU samples, the
+	// one without a stack has no locations
+	assert.Equal(t, 6*time.Millisecond, samplesDuration(samplesWithState(samplesWithFunc(p, "main.main"), "running")))
+	var noStack time.Duration
+	for _, s := range samplesWithState(p.Sample, "running") {
+		if len(s.Location) == 0 {
+			noStack += time.Duration(s.Value[0])
+		}
+	}
+	assert.Equal(t, 6*time.Millisecond, noStack)
+}
+
+// TestPPROFWallNoCPUSamples tests that traces without CPU samples only have
+// off-CPU samples.
+func TestPPROFWallNoCPUSamples(t *testing.T) {
+	b := tracebuilder.New()
+	stack := b.Stack(tracebuilder.Frame{Func: "main.main", File: "main.go", Line: 10})
+	b.GoCreate(0, 0, 1, stack, 0)
+	b.ProcStart(0, 0, 1)
+	b.GoStart(0, time.Millisecond, 1)
+	b.GoSched(0, 2*time.Millisecond, stack)
+	b.ProcStop(0, 2*time.Millisecond)
+
+	p := convertSynthetic(t, b)
+	assert.Equal(t, time.Millisecond, samplesDuration(samplesWithState(p.Sample, "runnable")))
+	assert.Empty(t, samplesWithState(p.Sample, "running"))
+}
+
+// convertSynthetic converts the trace of b to a profile.
+func convertSynthetic(t *testing.T, b *tracebuilder.Builder) *profile.Profile {
+	data, err := b.Bytes()
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, Convert(bytes.NewReader(data), &out, Options{}))
+	p, err := profile.Parse(&out)
+	require.NoError(t, err)
+	return p
+}
+
+func samplesWithState(samples []*profile.Sample, state string) (filtered []*profile.Sample) {
+	for _, s := range samples {
+		if slices.Contains(s.Label["state"], state) {
+			filtered = append(filtered, s)
+		}
+	}
+	return
+}
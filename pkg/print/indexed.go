@@ -0,0 +1,485 @@
+package print
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"honnef.co/go/gotraceui/trace"
+)
+
+// IndexedEvents prints the events contained in r that match the given filter
+// to w like Events, but uses idx to only decode the batches that overlap the
+// MinTs, MaxTs and P of the filter. The output for traces before go 1.22 is
+// the same as the one of Events. Unlike Events it supports go 1.22+ traces,
+// whose event arguments are named after the fields of the typed event views
+// of the encoding package.
+func IndexedEvents(r io.ReadSeeker, idx *encoding.Index, w io.Writer, filter EventFilter) error {
+	if idx.Version >= 1022 {
+		return indexedEventsV2(r, idx, w, filter)
+	}
+	return indexedEventsV1(r, idx, w, filter)
+}
+
+// filterTs returns the MinTs and MaxTs of the filter as absolute timestamps.
+// Timestamps of the filter are relative to the first event.
+func filterTs(idx *encoding.Index, filter EventFilter) (int64, int64) {
+	minTs, maxTs := int64(filter.MinTs)+idx.MinTs, int64(filter.MaxTs)
+	if maxTs != -1 {
+		maxTs += idx.MinTs
+	}
+	return minTs, maxTs
+}
+
+// indexedEvent is an event of a trace before go 1.22 converted to the event
+// that the parser of gotraceui returns for it.
+type indexedEvent struct {
+	trace.Event
+	// ts is the absolute timestamp of the event in nanoseconds.
+	ts int64
+}
+
+// indexedEventsV1 prints the events of a trace before go 1.22. They are
+// converted to the events of gotraceui, so they can be printed and filtered
+// like the events of Events.
+func indexedEventsV1(r io.ReadSeeker, idx *encoding.Index, w io.Writer, filter EventFilter) error {
+	minTs, maxTs := filterTs(idx, filter)
+	dec := encoding.NewContextDecoder(r)
+	dec.SetIndex(idx)
+	c := &converter{
+		dec: dec,
+		idx: idx,
+		trace: trace.Trace{
+			Version: idx.Version,
+			Stacks:  make(map[uint32][]uint64),
+			Strings: make(map[uint64]string),
+			PCs:     make(map[uint64]trace.Frame),
+		},
+		logID: math.MaxUint64,
+	}
+
+	// Convert the events of the overlapping batches
+	var events []indexedEvent
+	for _, b := range idx.Overlapping(minTs, maxTs, filter.P) {
+		var err error
+		if events, err = c.convertBatch(events, b); err != nil {
+			return err
+		}
+	}
+	if err := c.restore(events, maxTs); err != nil {
+		return err
+	}
+
+	// Batches of different Ps are not sorted by time
+	slices.SortStableFunc(events, func(a, b indexedEvent) int { return cmp.Compare(a.Ts, b.Ts) })
+	for _, e := range events {
+		if !matchMinTs(e.Event, filter.MinTs) ||
+			!matchMaxTs(e.Event, filter.MaxTs) ||
+			!matchP(e.Event, filter.P) ||
+			!matchG(e.Event, filter.G) ||
+			!matchStackIDs(e.Event, filter.StackIDs) {
+			continue
+		}
+		printEvent(w, c.trace, e.Event)
+		io.WriteString(w, "\n")
+		if filter.Verbose {
+			c.addStacks(e.Event)
+			printStacks(w, c.trace, e.Event)
+		}
+	}
+	return nil
+}
+
+// converter converts the events of a trace before go 1.22 to the events of
+// gotraceui. This follows parseEvent and postProcessTrace from
+// honnef.co/go/gotraceui/trace/parser.go.
+type converter struct {
+	dec *encoding.ContextDecoder
+	idx *encoding.Index
+	// trace contains the strings and stacks of the converted events.
+	trace trace.Trace
+	// logID is the last string id given to the message of an EventUserLog.
+	logID uint64
+}
+
+// ts converts the absolute timestamp ticks to nanoseconds since the first
+// event. Like gotraceui, it uses floating point math to avoid overflows.
+func (c *converter) ts(ticks uint64) trace.Timestamp {
+	freq := 1e9 / float64(c.dec.Frequency())
+	return trace.Timestamp(float64(trace.Timestamp(ticks)-trace.Timestamp(c.idx.MinTicks)) * freq)
+}
+
+// convertBatch appends the converted events of the batch b to events.
+func (c *converter) convertBatch(events []indexedEvent, b encoding.IndexBatch) ([]indexedEvent, error) {
+	if err := c.dec.Seek(b); err != nil {
+		return events, err
+	}
+	// Like gotraceui, keep track of the goroutine running on the P of the
+	// batch instead of using the G of the context, which is 0 for GC events.
+	g := b.G
+	var ev encoding.ContextEvent
+	for {
+		if err := c.dec.Decode(&ev); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		e, ok := c.convert(&ev, g)
+		if !ok {
+			continue
+		}
+		events = append(events, indexedEvent{Event: e, ts: ev.Ts})
+
+		switch e.Type {
+		case trace.EvGoStart, trace.EvGoStartLabel:
+			g = e.G
+		case trace.EvGoEnd, trace.EvGoStop, trace.EvGoSched, trace.EvGoPreempt,
+			trace.EvGoSleep, trace.EvGoBlock, trace.EvGoBlockSend, trace.EvGoBlockRecv,
+			trace.EvGoBlockSelect, trace.EvGoBlockSync, trace.EvGoBlockCond, trace.EvGoBlockNet,
+			trace.EvGoSysBlock, trace.EvGoBlockGC:
+			g = 0
+		}
+	}
+}
+
+// convert converts ev, which happened while the goroutine g was running on
+// its P. It returns false for events that gotraceui doesn't return, e.g.
+// batch headers or strings.
+func (c *converter) convert(ev *encoding.ContextEvent, g uint64) (trace.Event, bool) {
+	switch ev.Type {
+	case encoding.EventBatch, encoding.EventFrequency, encoding.EventStack,
+		encoding.EventString, encoding.EventTimerGoroutine:
+		return trace.Event{}, false
+	}
+
+	// The stack is the last argument, all others except for the timestamp
+	// follow the event description of gotraceui.
+	e := trace.Event{
+		Type: byte(ev.Type),
+		Ts:   c.ts(ev.Ticks),
+		P:    int32(ev.P),
+		G:    g,
+		Link: -1,
+	}
+	var n int
+	for i, name := range encoding.ArgNames(c.idx.Version, ev.Type) {
+		switch {
+		case name == "SeqDelta" || name == "TsDelta":
+		case name == "Stack":
+			e.StkID = uint32(ev.Args[i])
+		case n < len(e.Args):
+			e.Args[n] = ev.Args[i]
+			n++
+		}
+	}
+
+	switch ev.Type {
+	case encoding.EventGoStart, encoding.EventGoStartLocal, encoding.EventGoStartLabel,
+		encoding.EventGoSysExit, encoding.EventGoSysExitLocal,
+		encoding.EventGoWaiting, encoding.EventGoInSyscall:
+		e.G = e.Args[0]
+	case encoding.EventGCStart:
+		e.P = trace.GCP
+	case encoding.EventCPUSample:
+		// CPU samples belong to the P and G in which they were taken
+		e.P, e.G, e.Args[0] = int32(e.Args[1]), e.Args[2], 0
+	case encoding.EventUserTaskCreate:
+		c.addString(e.Args[2])
+	case encoding.EventUserLog:
+		// The message is part of the event, gotraceui gives it a string id
+		c.addString(e.Args[1])
+		c.logID--
+		c.trace.Strings[c.logID] = string(ev.Str)
+		e.Args[3] = c.logID
+	}
+
+	// Local events are only used for ordering
+	switch ev.Type {
+	case encoding.EventGoStartLocal:
+		e.Type = trace.EvGoStart
+	case encoding.EventGoUnblockLocal:
+		e.Type = trace.EvGoUnblock
+	case encoding.EventGoSysExitLocal:
+		e.Type = trace.EvGoSysExit
+	}
+
+	// Syscall exits are moved to a separate P. gotraceui tries to move them
+	// to the real time of the exit, but the change is lost.
+	if e.Type == trace.EvGoSysExit {
+		e.P = trace.SyscallP
+	}
+	return e, true
+}
+
+// restore completes the events with the information that gotraceui gets
+// from earlier events, which may be in batches that weren't converted: The
+// first start of a goroutine gets the stack of its creation, and unblocks of
+// goroutines that were blocked on the network move to trace.NetpollP. The
+// earlier events are read from all batches that start before maxTs.
+func (c *converter) restore(events []indexedEvent, maxTs int64) error {
+	// block is an event after which a goroutine is waiting.
+	type block struct {
+		ts  int64
+		net bool
+	}
+	// goroutine contains the earlier events of a goroutine.
+	type goroutine struct {
+		created    bool
+		stack      uint32 // stack of the creation
+		firstStart int64
+		blocks     []block
+	}
+
+	// Find the goroutines whose earlier events are needed
+	gs := make(map[uint64]*goroutine)
+	for _, e := range events {
+		switch e.Type {
+		case trace.EvGoStart, trace.EvGoStartLabel:
+			gs[e.G] = &goroutine{firstStart: math.MaxInt64}
+		case trace.EvGoUnblock:
+			gs[e.Args[0]] = &goroutine{firstStart: math.MaxInt64}
+		}
+	}
+
+	var ev encoding.ContextEvent
+	for _, b := range c.idx.Batches {
+		if len(gs) == 0 {
+			break
+		} else if maxTs != -1 && b.MinTs > maxTs {
+			continue
+		} else if err := c.dec.Seek(b); err != nil {
+			return err
+		}
+		for {
+			if err := c.dec.Decode(&ev); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			switch ev.Type {
+			case encoding.EventGoCreate:
+				create, err := ev.AsGoCreate(c.idx.Version)
+				if err != nil {
+					return err
+				}
+				if g := gs[create.NewG]; g != nil {
+					g.created, g.stack = true, uint32(create.NewStack)
+				}
+			case encoding.EventGoStart, encoding.EventGoStartLocal, encoding.EventGoStartLabel:
+				if g := gs[ev.G]; g != nil {
+					g.firstStart = min(g.firstStart, ev.Ts)
+				}
+			case encoding.EventGoWaiting, encoding.EventGoInSyscall, encoding.EventGoSysCall,
+				encoding.EventGoSleep, encoding.EventGoBlock, encoding.EventGoBlockSend, encoding.EventGoBlockRecv,
+				encoding.EventGoBlockSelect, encoding.EventGoBlockSync, encoding.EventGoBlockCond, encoding.EventGoBlockNet,
+				encoding.EventGoBlockGC:
+				if g := gs[ev.G]; g != nil {
+					g.blocks = append(g.blocks, block{ts: ev.Ts, net: ev.Type == encoding.EventGoBlockNet})
+				}
+			}
+		}
+	}
+
+	for i := range events {
+		e := &events[i]
+		switch e.Type {
+		case trace.EvGoStart, trace.EvGoStartLabel:
+			if g := gs[e.G]; g.created && g.firstStart == e.ts {
+				e.StkID = g.stack
+			}
+		case trace.EvGoUnblock:
+			// The goroutine was blocked by its last block before the unblock
+			var last block
+			for _, b := range gs[e.Args[0]].blocks {
+				if b.ts <= e.ts && b.ts >= last.ts {
+					last = b
+				}
+			}
+			if last.net {
+				e.P = trace.NetpollP
+			}
+		}
+
+		// Events don't refer to stacks that don't exist or have no frames
+		if e.StkID != 0 && len(c.dec.Stack(uint64(e.StkID))) == 0 {
+			e.StkID = 0
+		}
+	}
+	return nil
+}
+
+// addString adds the string with the given id to the trace.
+func (c *converter) addString(id uint64) {
+	if s, ok := c.dec.String(id); ok {
+		c.trace.Strings[id] = s
+	}
+}
+
+// addStacks adds the stacks of e to the trace.
+func (c *converter) addStacks(e trace.Event) {
+	ids := []uint64{uint64(e.StkID)}
+	for i, arg := range trace.EventDescriptions[e.Type].Args {
+		if arg == "stack" {
+			ids = append(ids, e.Args[i])
+		}
+	}
+	for _, id := range ids {
+		if _, ok := c.trace.Stacks[uint32(id)]; ok {
+			continue
+		}
+		frames := c.dec.Stack(id)
+		if len(frames) == 0 {
+			continue
+		}
+		pcs := make([]uint64, len(frames))
+		for i, frame := range frames {
+			pcs[i] = frame.PC
+			if _, ok := c.trace.PCs[frame.PC]; !ok {
+				c.trace.PCs[frame.PC] = trace.Frame{PC: frame.PC, Fn: frame.Func, File: frame.File, Line: int(frame.Line)}
+			}
+		}
+		c.trace.Stacks[uint32(id)] = pcs
+	}
+}
+
+// indexedEventsV2 prints the events of a go 1.22+ trace. Events only refer to
+// their own stacks.
+func indexedEventsV2(r io.ReadSeeker, idx *encoding.Index, w io.Writer, filter EventFilter) error {
+	minTs, maxTs := filterTs(idx, filter)
+
+	// Decode the overlapping batches and collect the matching events
+	type printedEvent struct {
+		ts   int64
+		text []byte
+	}
+	var (
+		events []printedEvent
+		buf    bytes.Buffer
+		ev     encoding.ContextEvent
+	)
+	dec := encoding.NewContextDecoder(r)
+	dec.SetIndex(idx)
+	for _, b := range idx.Overlapping(minTs, maxTs, filter.P) {
+		if err := dec.Seek(b); err != nil {
+			return err
+		}
+		for {
+			if err := dec.Decode(&ev); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			switch ev.Type {
+			case encoding.EventV2Batch, encoding.EventV2ExperimentalBatch:
+				// Batch headers are not events
+				continue
+			}
+			names := encoding.ArgNames(idx.Version, ev.Type)
+			if ev.Ts == 0 ||
+				ev.Ts < minTs ||
+				(maxTs != -1 && ev.Ts > maxTs) ||
+				(filter.P != -1 && ev.P != filter.P) ||
+				!matchIndexedG(&ev, names, filter.G) ||
+				!matchIndexedStackIDs(&ev, names, filter.StackIDs) {
+				continue
+			}
+
+			buf.Reset()
+			printIndexedEvent(&buf, &ev, names, ev.Ts-idx.MinTs)
+			buf.WriteString("\n")
+			if filter.Verbose {
+				printIndexedStacks(&buf, dec, &ev, names)
+			}
+			events = append(events, printedEvent{ts: ev.Ts, text: bytes.Clone(buf.Bytes())})
+		}
+	}
+
+	// Batches of different Ms are not sorted by time
+	slices.SortStableFunc(events, func(a, b printedEvent) int { return cmp.Compare(a.ts, b.ts) })
+	for _, e := range events {
+		if _, err := w.Write(e.text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchIndexedG returns true if ev is concerning goroutine g or g is -1.
+func matchIndexedG(ev *encoding.ContextEvent, names []string, g int64) bool {
+	if g == -1 || ev.G == uint64(g) {
+		return true
+	}
+	for i, name := range names {
+		if (name == "G" || name == "NewG") && ev.Args[i] == uint64(g) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchIndexedStackIDs returns true if ev refers to one of stackIDs or
+// stackIDs is empty.
+func matchIndexedStackIDs(ev *encoding.ContextEvent, names []string, stackIDs []uint32) bool {
+	if len(stackIDs) == 0 {
+		return true
+	}
+	for i, name := range names {
+		if isStackArg(name) && slices.Contains(stackIDs, uint32(ev.Args[i])) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStackArg returns true if the argument with the given name refers to the
+// stack table.
+func isStackArg(name string) bool {
+	return name == "Stack" || name == "NewStack"
+}
+
+// printIndexedEvent prints a single event with the timestamp ts to w in the
+// same format as trace.Event.String.
+func printIndexedEvent(w io.Writer, ev *encoding.ContextEvent, names []string, ts int64) {
+	// Like gotraceui, don't distinguish between local and global events,
+	// e.g. EventGoStartLocal and EventGoStart.
+	name := strings.TrimSuffix(strings.TrimPrefix(ev.Type.String(), "Event"), "Local")
+	fmt.Fprintf(w, "%d %s p=%d g=%d", ts, name, ev.P, ev.G)
+	for i, name := range names {
+		if name == "TsDelta" || name == "SeqDelta" || i >= len(ev.Args) {
+			continue
+		} else if s, ok := ev.Strings[name]; ok {
+			// Print resolved strings instead of their ids
+			fmt.Fprintf(w, " %s=%s", strings.ToLower(name), s)
+		} else {
+			fmt.Fprintf(w, " %s=%d", strings.ToLower(name), ev.Args[i])
+		}
+	}
+	if len(ev.Str) > 0 {
+		fmt.Fprintf(w, " message=%s", ev.Str)
+	}
+}
+
+// printIndexedStacks prints the stacks of ev to w like printStacks.
+func printIndexedStacks(w io.Writer, dec *encoding.ContextDecoder, ev *encoding.ContextEvent, names []string) {
+	var n int
+	for i, name := range names {
+		if !isStackArg(name) || ev.Args[i] == 0 {
+			continue
+		}
+		if n > 0 {
+			io.WriteString(w, "\n")
+		}
+		n++
+		fmt.Fprintf(w, "stack %d:\n", ev.Args[i])
+		for _, frame := range dec.Stack(ev.Args[i]) {
+			fmt.Fprintf(w, "\t%s()\n\t\t%s:%d\n", frame.Func, frame.File, frame.Line)
+		}
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 
+	"github.com/felixge/traceutils/pkg/encoding"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"honnef.co/go/gotraceui/trace"
@@ -90,6 +92,44 @@ func TestEvents(t *testing.T) {
 	})
 }
 
+// TestIndexedEvents tests that IndexedEvents prints the same output as
+// Events.
+func TestIndexedEvents(t *testing.T) {
+	exampleTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
+	require.NoError(t, err)
+	taskTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.21", "task.trace"))
+	require.NoError(t, err)
+	fgprofTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.21", "fgprof.trace"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name   string
+		Trace  []byte
+		Filter func(*EventFilter)
+	}{
+		{"Default Filter", exampleTrace, func(f *EventFilter) {}},
+		{"Time Filter", exampleTrace, func(f *EventFilter) { f.MinTs, f.MaxTs = 1001000000, 1001200000 }},
+		{"P Filter", exampleTrace, func(f *EventFilter) { f.P = 9 }},
+		{"G Filter", exampleTrace, func(f *EventFilter) { f.G = 1 }},
+		{"Stack Filter", exampleTrace, func(f *EventFilter) { f.StackIDs = []uint32{8, 11} }},
+		{"Verbose Stacks", exampleTrace, func(f *EventFilter) { f.Verbose = true }},
+		{"Task Trace", taskTrace, func(f *EventFilter) { f.Verbose = true }},
+		{"Netpoll", fgprofTrace, func(f *EventFilter) {}},
+		{"Netpoll Time Filter", fgprofTrace, func(f *EventFilter) { f.MinTs, f.MaxTs, f.Verbose = 400000000, 500000000, true }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			f := DefaultEventFilter()
+			test.Filter(&f)
+			want := sortEvents(events(t, test.Trace, f))
+			got := sortEvents(indexedEvents(t, test.Trace, f))
+			require.NotEmpty(t, want)
+			require.Equal(t, want, got)
+		})
+	}
+}
+
 func TestStacks(t *testing.T) {
 	inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
 	require.NoError(t, err)
@@ -123,6 +163,35 @@ func events(t *testing.T, in []byte, filter EventFilter) string {
 	return out.String()
 }
 
+func indexedEvents(t *testing.T, in []byte, filter EventFilter) string {
+	t.Helper()
+	idx, err := encoding.BuildIndex(bytes.NewReader(in))
+	require.NoError(t, err)
+	var out bytes.Buffer
+	err = IndexedEvents(bytes.NewReader(in), idx, &out, filter)
+	require.NoError(t, err)
+	return out.String()
+}
+
+// sortEvents returns the events printed in s together with their stacks in
+// sorted order, because Events prints events with the same timestamp in a
+// random order.
+func sortEvents(s string) []string {
+	var events []string
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if eventLine.MatchString(line) || len(events) == 0 {
+			events = append(events, line)
+		} else {
+			events[len(events)-1] += line
+		}
+	}
+	slices.Sort(events)
+	return events
+}
+
+// eventLine matches the first line of a printed event.
+var eventLine = regexp.MustCompile(`^\d+ \w+ p=-?\d+ g=\d+`)
+
 func stacks(t *testing.T, in []byte, filter StackFilter) string {
 	t.Helper()
 	var out bytes.Buffer
@@ -0,0 +1,592 @@
+package repair
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+// DefaultFrequency is the frequency in ticks per second of the frequency
+// event that is added to traces before go 1.22 that don't have one, unless
+// Options.Frequency is set. It's the frequency of go 1.19+ traces on most
+// platforms.
+const DefaultFrequency = 62500000
+
+// headerSize is the size of the header of a trace.
+const headerSize = 16
+
+// maxCheckEvents is the number of events after a batch header that must be
+// decodable to resume decoding at the header after a batch that can't be
+// decoded. Batches before go 1.22 don't have a length, so their headers are
+// found by trying every offset.
+const maxCheckEvents = 64
+
+// Options configures Repair.
+type Options struct {
+	// Frequency is the frequency in ticks per second used if a trace before
+	// go 1.22 has no frequency event. 0 means DefaultFrequency.
+	Frequency uint64
+}
+
+// Report describes what Repair changed.
+type Report struct {
+	// Discarded are the parts of the input that were dropped, ordered by
+	// offset.
+	Discarded []Discarded
+	// Frequency is the frequency of the frequency event that was added, or
+	// 0 if the trace had one.
+	Frequency uint64
+	// Refs is the number of references to strings and stacks that are not
+	// defined in the repaired trace. They are replaced with 0, i.e. no
+	// string or stack.
+	Refs int
+}
+
+// Discarded is a part of the input that was dropped.
+type Discarded struct {
+	// Offset is the offset of the first byte that was dropped.
+	Offset int64
+	// Size is the number of bytes that were dropped.
+	Size int64
+	// Reason explains why the bytes were dropped.
+	Reason string
+}
+
+// Repair reads the trace of the given size from r and writes the parts that
+// can be decoded to w. It's meant for traces of processes that crashed while
+// writing them, which often end in the middle of an event.
+//
+//   - The events of a batch up to an incomplete or broken event at the end
+//     of the trace are kept.
+//   - A batch that can't be decoded and is followed by another batch is
+//     dropped. Decoding resumes at the next batch, which is found by its
+//     length for go 1.22+ traces or by trying every offset for older ones.
+//     Go 1.22+ parsers reject generations with missing events, so the whole
+//     generation of such a batch is dropped. If the header of the batch
+//     can't be decoded either, the generations before and after it are
+//     dropped.
+//   - Go 1.22+ generations without a frequency event are dropped. Before go
+//     1.25 it's written at the end of a generation. The lengths of the
+//     remaining batches are updated.
+//   - Older traces without a frequency event get one with opts.Frequency,
+//     their timestamps are off by the ratio of the actual frequency to it.
+//   - References to strings and stacks that are missing, e.g. because the
+//     stacks at the end of the trace were never written, are replaced with 0.
+//
+// Events that were never written can't be recovered, so the repaired trace
+// can still contain goroutines that e.g. start running without being
+// unblocked. validate.Validate reports these.
+func Repair(r io.ReaderAt, size int64, w io.Writer, opts Options) (*Report, error) {
+	rp := &repairer{
+		r:         r,
+		size:      size,
+		frequency: opts.Frequency,
+		strings:   make(map[tableKey]bool),
+		stacks:    make(map[tableKey]bool),
+		bad:       make(map[uint64]bool),
+		report:    &Report{},
+	}
+	if rp.frequency == 0 {
+		rp.frequency = DefaultFrequency
+	}
+
+	// Read the header
+	dec := encoding.NewDecoder(io.NewSectionReader(r, 0, size))
+	var ev encoding.Event
+	err := dec.Decode(&ev)
+	var decodeErr *encoding.DecodeError
+	if errors.As(err, &decodeErr) && decodeErr.Offset == 0 {
+		return nil, fmt.Errorf("can't repair trace with invalid header: %w", decodeErr.Err)
+	} else if dec.Version() == 0 {
+		return nil, errors.New("can't repair empty trace")
+	}
+	rp.version = dec.Version()
+	rp.header = make([]byte, headerSize)
+	if _, err := r.ReadAt(rp.header, 0); err != nil {
+		return nil, err
+	}
+
+	// Find the batches that can be decoded, determine the tables and
+	// generations of the remaining ones, then write them.
+	if err := rp.scan(); err != nil {
+		return nil, err
+	} else if err := rp.tables(); err != nil {
+		return nil, err
+	} else if len(rp.batches) == 0 {
+		return nil, errors.New("trace doesn't contain any batch that can be decoded")
+	} else if err := rp.write(encoding.NewEncoderVersion(w, rp.version)); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rp.report.Discarded, func(i, j int) bool {
+		return rp.report.Discarded[i].Offset < rp.report.Discarded[j].Offset
+	})
+	return rp.report, nil
+}
+
+// repairer holds the state of Repair.
+type repairer struct {
+	r         io.ReaderAt
+	size      int64
+	header    []byte
+	version   int
+	frequency uint64
+
+	batches []batch           // batches that are kept in the order of the trace
+	minTs   uint64            // smallest timestamp of the batches that are kept
+	maxTs   uint64            // largest timestamp of the batches that are kept
+	strings map[tableKey]bool // defined strings
+	stacks  map[tableKey]bool // defined stacks
+	freq    bool              // true if the trace has a frequency event
+	bad     map[uint64]bool   // go 1.22+ generations with a batch that was dropped
+	report  *Report
+}
+
+// batch is a batch that is kept.
+type batch struct {
+	start int64  // offset of the batch header
+	end   int64  // offset after the last event that is kept
+	gen   uint64 // generation of go 1.22+ batches
+	ts    uint64 // timestamp of the batch header
+}
+
+// tableKey identifies an entry in the string or stack table. Go 1.22+
+// traces have separate tables for every generation, older traces only have
+// generation 0.
+type tableKey struct {
+	gen uint64
+	id  uint64
+}
+
+// decoderAt returns a decoder for the events that start at offset.
+func (rp *repairer) decoderAt(offset int64) *encoding.Decoder {
+	return encoding.NewDecoder(io.MultiReader(
+		bytes.NewReader(rp.header),
+		io.NewSectionReader(rp.r, offset, rp.size-offset),
+	))
+}
+
+// discard records that the bytes from start to end were dropped.
+func (rp *repairer) discard(start, end int64, format string, args ...any) {
+	rp.report.Discarded = append(rp.report.Discarded, Discarded{
+		Offset: start,
+		Size:   end - start,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+// isBatch returns true if t starts a batch.
+func isBatch(t encoding.EventType) bool {
+	return t == encoding.EventBatch || t == encoding.EventV2Batch || t == encoding.EventV2ExperimentalBatch
+}
+
+// endsBatch returns true if an event of type t follows the last event of a
+// batch. Go 1.26+ traces have the end of a generation after its last batch.
+func endsBatch(t encoding.EventType) bool {
+	return isBatch(t) || t == encoding.EventV2EndOfGeneration
+}
+
+// scan records the batches that can be decoded.
+func (rp *repairer) scan() error {
+	for offset := int64(headerSize); offset < rp.size; {
+		next, err := rp.scanFrom(offset)
+		if err != nil {
+			return err
+		}
+		offset = next
+	}
+	return nil
+}
+
+// scanFrom records the batches starting at offset up to the first one that
+// can't be decoded. It returns the offset of the next batch after it, or the
+// size of the trace.
+func (rp *repairer) scanFrom(offset int64) (int64, error) {
+	var (
+		dec  = rp.decoderAt(offset)
+		ev   encoding.Event
+		b    *batch // current batch or nil
+		end  int64  // end of the current go 1.22+ batch given by its length or -1
+		base = offset - headerSize
+	)
+	for {
+		start := base + dec.Offset()
+		if start == base {
+			start = offset
+		}
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			if b != nil && end >= 0 && end != start {
+				return rp.broken(b, start, start, end, errors.New("batch is longer than the rest of the trace")), nil
+			}
+			rp.keep(b)
+			return rp.size, nil
+		}
+		var decodeErr *encoding.DecodeError
+		if errors.As(err, &decodeErr) {
+			if b == nil {
+				return rp.broken(&batch{start: start, end: start}, start, start+1, -1, decodeErr.Err), nil
+			}
+			return rp.broken(b, start, start+1, end, decodeErr.Err), nil
+		} else if err != nil {
+			return 0, err
+		}
+		evEnd := base + dec.Offset()
+
+		// Check that go 1.22+ batches end where their length says
+		if b != nil && end >= 0 && ((endsBatch(ev.Type) && start != end) || (!endsBatch(ev.Type) && evEnd > end)) {
+			return rp.broken(b, start, b.start+1, end, errors.New("events of the batch don't end at its length")), nil
+		}
+
+		switch ev.Type {
+		case encoding.EventBatch, encoding.EventV2Batch, encoding.EventV2ExperimentalBatch:
+			rp.keep(b)
+			b, end = &batch{start: start}, -1
+			switch ev.Type {
+			case encoding.EventBatch:
+				header, err := ev.AsBatch(rp.version)
+				if err != nil {
+					return 0, err
+				}
+				b.ts = header.Ts
+			case encoding.EventV2Batch:
+				b.gen, b.ts, end = ev.Args[0], ev.Args[2], evEnd+int64(ev.Args[3])
+			case encoding.EventV2ExperimentalBatch:
+				b.gen = ev.Args[1]
+			}
+		case encoding.EventV2EndOfGeneration:
+			// The ends of the generations are written by write
+			rp.keep(b)
+			b, end = nil, -1
+			continue
+		default:
+			if b == nil {
+				return rp.broken(&batch{start: start, end: start}, start, start+1, -1, errors.New("event before the first batch")), nil
+			}
+		}
+		b.end = evEnd
+	}
+}
+
+// keep records that the batch b is kept.
+func (rp *repairer) keep(b *batch) {
+	if b == nil {
+		return
+	} else if len(rp.batches) == 0 || b.ts < rp.minTs {
+		rp.minTs = b.ts
+	}
+	rp.maxTs = max(rp.maxTs, b.ts)
+	rp.batches = append(rp.batches, *b)
+}
+
+// broken handles the batch b whose event at offset is broken because of err.
+// If there is a batch at or after from, b is dropped and the offset of the
+// next batch is returned. Otherwise the events of b before offset are kept
+// and the size of the trace is returned. For go 1.22+ batches, end is the end
+// of b given by its length or -1.
+func (rp *repairer) broken(b *batch, offset, from, end int64, err error) int64 {
+	next := int64(-1)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		// The event doesn't extend to the end of the trace, so there may
+		// be batches after it
+		next = rp.resync(from, end)
+	}
+	if next < 0 {
+		switch {
+		case offset == rp.size:
+			// The trace ends after an event, only the length of the
+			// batch is wrong. It's updated when writing the batch.
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			rp.discard(offset, rp.size, "incomplete event at the end of the trace")
+		default:
+			rp.discard(offset, rp.size, "can't decode event at the end of the trace: %v", err)
+		}
+		if b.end > b.start {
+			rp.keep(b)
+		}
+		return rp.size
+	}
+	rp.discard(b.start, next, "can't decode batch: %v", err)
+	if rp.version >= 1022 {
+		rp.dropGeneration(b, next)
+	}
+	return next
+}
+
+// dropGeneration marks the generation of the go 1.22+ batch b, which is
+// dropped, to be dropped as well. If the header of b couldn't be decoded, the
+// generations of the batch before it and of the batch at next are marked.
+func (rp *repairer) dropGeneration(b *batch, next int64) {
+	if b.end > b.start {
+		rp.bad[b.gen] = true
+		return
+	}
+	if len(rp.batches) > 0 {
+		rp.bad[rp.batches[len(rp.batches)-1].gen] = true
+	}
+	var ev encoding.Event
+	if err := rp.decoderAt(next).Decode(&ev); err == nil && ev.Type == encoding.EventV2Batch {
+		rp.bad[ev.Args[0]] = true
+	}
+}
+
+// resync returns the offset of the first batch at or after from that can be
+// decoded, or -1 if there is none. If hint is not -1, it's the likely offset
+// of the next batch and checked first.
+func (rp *repairer) resync(from, hint int64) int64 {
+	if hint >= from && rp.validBatch(hint) {
+		return hint
+	}
+	br := bufio.NewReader(io.NewSectionReader(rp.r, from, rp.size-from))
+	for offset := from; ; offset++ {
+		c, err := br.ReadByte()
+		if err != nil {
+			return -1
+		}
+		if rp.version >= 1022 && c != byte(encoding.EventV2Batch-encoding.EventV2None) {
+			continue
+		} else if rp.version < 1022 && encoding.EventType(c&0x3f) != encoding.EventBatch {
+			continue
+		}
+		if rp.validBatch(offset) {
+			return offset
+		}
+	}
+}
+
+// validBatch returns true if a batch that can be decoded starts at offset. Go
+// 1.22+ batches must end where their length says, for older batches the
+// first maxCheckEvents events are checked.
+func (rp *repairer) validBatch(offset int64) bool {
+	if offset < headerSize || offset >= rp.size {
+		return false
+	}
+	var (
+		dec  = rp.decoderAt(offset)
+		ev   encoding.Event
+		base = offset - headerSize
+		end  int64
+	)
+	if err := dec.Decode(&ev); err != nil {
+		return false
+	}
+	switch ev.Type {
+	case encoding.EventBatch:
+		batch, err := ev.AsBatch(rp.version)
+		if err != nil || batch.P > maxP {
+			return false
+		} else if len(rp.batches) > 0 && (batch.Ts < rp.minTs || batch.Ts > rp.maxTs+maxGap) {
+			return false
+		}
+		end = rp.size
+	case encoding.EventV2Batch:
+		if end = base + dec.Offset() + int64(ev.Args[3]); end > rp.size {
+			return false
+		}
+	default:
+		return false
+	}
+	for i := 0; rp.version >= 1022 || i < maxCheckEvents; i++ {
+		start := base + dec.Offset()
+		if start == end {
+			break
+		} else if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil || base+dec.Offset() > end {
+			return false
+		} else if ev.Type == encoding.EventBatch {
+			break
+		}
+	}
+	return true
+}
+
+// maxGap is the largest number of ticks between the batches of a trace before
+// go 1.22 and a batch found by resync, a few hours at common frequencies.
+const maxGap = 1 << 40
+
+// maxP is the largest P of batches before go 1.22. The runtime uses Ps
+// starting at 1000000 for events that don't happen on a P.
+const maxP = 1000010
+
+// tables records the strings and stacks that are defined by the batches that
+// are kept and drops the batches of go 1.22+ generations without a frequency
+// event, which parsers reject, and of the generations marked by
+// dropGeneration.
+func (rp *repairer) tables() error {
+	freqs := make(map[uint64]bool) // generations with a frequency event
+	err := rp.each(func(b *batch, ev *encoding.Event) error {
+		switch ev.Type {
+		case encoding.EventFrequency, encoding.EventV2Frequency:
+			rp.freq, freqs[b.gen] = true, true
+		case encoding.EventString, encoding.EventV2String:
+			rp.strings[tableKey{b.gen, ev.Args[0]}] = true
+		case encoding.EventStack, encoding.EventV2Stack:
+			rp.stacks[tableKey{b.gen, ev.Args[0]}] = true
+		}
+		return nil
+	})
+	if err != nil || rp.version < 1022 {
+		return err
+	}
+
+	// Drop the generations without a frequency event or with a batch that
+	// was dropped
+	var (
+		batches []batch
+		dropped = make(map[uint64]*Discarded)
+		order   []uint64
+	)
+	for _, b := range rp.batches {
+		if freqs[b.gen] && !rp.bad[b.gen] {
+			batches = append(batches, b)
+			continue
+		}
+		d, ok := dropped[b.gen]
+		if !ok {
+			reason := fmt.Sprintf("generation %d has no frequency event", b.gen)
+			if rp.bad[b.gen] {
+				reason = fmt.Sprintf("generation %d has a batch that can't be decoded", b.gen)
+			}
+			d = &Discarded{Offset: b.start, Reason: reason}
+			dropped[b.gen] = d
+			order = append(order, b.gen)
+		}
+		d.Size += b.end - b.start
+	}
+	for _, gen := range order {
+		rp.report.Discarded = append(rp.report.Discarded, *dropped[gen])
+	}
+	rp.batches = batches
+	return nil
+}
+
+// each calls fn with the events of the batches that are kept.
+func (rp *repairer) each(fn func(b *batch, ev *encoding.Event) error) error {
+	var ev encoding.Event
+	for i := range rp.batches {
+		b := &rp.batches[i]
+		dec := rp.decoderAt(b.start)
+		base := b.start - headerSize
+		for base+dec.Offset() < b.end || dec.Offset() == 0 {
+			if err := dec.Decode(&ev); err != nil {
+				return err
+			} else if err := fn(b, &ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// write writes the batches that are kept with the references to missing
+// strings and stacks replaced. For go 1.26+ traces, the end of every
+// generation is written after its last batch.
+func (rp *repairer) write(enc *encoding.Encoder) error {
+	var (
+		header *encoding.Event
+		events []encoding.Event
+	)
+	flush := func() error {
+		if header == nil {
+			return nil
+		}
+		if header.Type == encoding.EventV2Batch {
+			var length int
+			for i := range events {
+				length += encoding.EncodedSize(rp.version, &events[i])
+			}
+			header.Args[3] = uint64(length)
+		}
+		if err := enc.Encode(header); err != nil {
+			return err
+		}
+		for i := range events {
+			if err := enc.Encode(&events[i]); err != nil {
+				return err
+			}
+		}
+		header, events = nil, events[:0]
+		return nil
+	}
+
+	endGeneration := func() error {
+		if rp.version < 1026 {
+			return nil
+		}
+		return enc.Encode(&encoding.Event{Type: encoding.EventV2EndOfGeneration})
+	}
+
+	var current *batch
+	err := rp.each(func(b *batch, ev *encoding.Event) error {
+		cp := encoding.Event{Type: ev.Type, Args: slices.Clone(ev.Args), Str: slices.Clone(ev.Str)}
+		if b != current {
+			if err := flush(); err != nil {
+				return err
+			} else if current != nil && b.gen != current.gen {
+				if err := endGeneration(); err != nil {
+					return err
+				}
+			}
+			current, header = b, &cp
+			return nil
+		}
+		rp.replaceRefs(b.gen, &cp)
+		events = append(events, cp)
+		return nil
+	})
+	if err != nil {
+		return err
+	} else if err := flush(); err != nil {
+		return err
+	} else if err := endGeneration(); err != nil {
+		return err
+	}
+
+	// Add the frequency event that is missing
+	if !rp.freq && rp.version < 1022 {
+		freq := encoding.Event{Type: encoding.EventFrequency, Args: []uint64{rp.frequency}}
+		if rp.version < 1007 {
+			freq.Args = append(freq.Args, 0)
+		}
+		if err := enc.Encode(&freq); err != nil {
+			return err
+		}
+		rp.report.Frequency = rp.frequency
+	}
+	return enc.Close()
+}
+
+// replaceRefs replaces the references of ev to strings and stacks of the
+// generation gen that are not defined with 0.
+func (rp *repairer) replaceRefs(gen uint64, ev *encoding.Event) {
+	replace := func(defined map[tableKey]bool, arg *uint64) {
+		if *arg != 0 && !defined[tableKey{gen, *arg}] {
+			*arg = 0
+			rp.report.Refs++
+		}
+	}
+	strings, stacks := encoding.RefArgs(rp.version, ev.Type)
+	for _, i := range strings {
+		replace(rp.strings, &ev.Args[i])
+	}
+	for _, i := range stacks {
+		if rp.version < 1007 && ev.Type == encoding.EventGoCreate && i == len(ev.Args)-2 {
+			// Before go 1.7 the NewStack argument is the PC the goroutine
+			// starts at.
+			continue
+		}
+		replace(rp.stacks, &ev.Args[i])
+	}
+	if (ev.Type == encoding.EventStack || ev.Type == encoding.EventV2Stack) && rp.version >= 1007 {
+		for i := 3; i+1 < len(ev.Args); i += 4 {
+			replace(rp.strings, &ev.Args[i])
+			replace(rp.strings, &ev.Args[i+1])
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package repair
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felixge/traceutils/internal/tracetest"
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/validate"
+	"github.com/stretchr/testify/require"
+	"honnef.co/go/gotraceui/trace"
+)
+
+// TestRepairIntact tests that traces without problems are not changed.
+func TestRepairIntact(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+	}{
+		{"1.6", "simple.trace"},
+		{"1.11", "simple.trace"},
+		{"1.19", "trace.bin"},
+		{"1.21", "task.trace"},
+		{"1.25", "test-encoding-json.trace"},
+		{"1.26", "generations.trace"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data := readTrace(t, test.GoVersion, test.Trace)
+			var out bytes.Buffer
+			report, err := Repair(bytes.NewReader(data), int64(len(data)), &out, Options{})
+			require.NoError(t, err)
+			require.Equal(t, &Report{}, report)
+			require.Equal(t, data, out.Bytes())
+		})
+	}
+}
+
+// TestRepairTruncated tests that traces that end in the middle of an event
+// are repaired, so that they can be decoded and parsed.
+func TestRepairTruncated(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+		Size      int
+		// Frequency is true if the frequency event is missing.
+		Frequency bool
+	}{
+		{"1.19", "trace.bin", 268, true},
+		{"1.19", "trace.bin", 1344, false},
+		{"1.21", "test-encoding-json.trace", 173489, false},
+		{"1.25", "test-encoding-json.trace", 179310, false},
+		{"1.26", "generations.trace", 18000, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data := readTrace(t, test.GoVersion, test.Trace)[:test.Size]
+			var out bytes.Buffer
+			report, err := Repair(bytes.NewReader(data), int64(len(data)), &out, Options{})
+			require.NoError(t, err)
+			require.Len(t, report.Discarded, 1)
+			require.Equal(t, "incomplete event at the end of the trace", report.Discarded[0].Reason)
+			require.Equal(t, int64(len(data)), report.Discarded[0].Offset+report.Discarded[0].Size)
+			if test.Frequency {
+				require.Equal(t, uint64(DefaultFrequency), report.Frequency)
+			} else {
+				require.Zero(t, report.Frequency)
+			}
+			requireValid(t, out.Bytes())
+		})
+	}
+}
+
+// TestRepairCorrupted tests that batches that can't be decoded are dropped
+// and decoding resumes at the next batch.
+func TestRepairCorrupted(t *testing.T) {
+	tests := []struct {
+		GoVersion string
+		Trace     string
+		Offset    int
+	}{
+		{"1.19", "test-encoding-json.trace", 176923},
+		{"1.21", "test-encoding-json.trace", 277583},
+	}
+
+	for _, test := range tests {
+		t.Run(test.GoVersion+"/"+test.Trace, func(t *testing.T) {
+			data := bytes.Clone(readTrace(t, test.GoVersion, test.Trace))
+			copy(data[test.Offset:], bytes.Repeat([]byte{0xff}, 8))
+			var out bytes.Buffer
+			report, err := Repair(bytes.NewReader(data), int64(len(data)), &out, Options{})
+			require.NoError(t, err)
+			require.Len(t, report.Discarded, 1)
+			discarded := report.Discarded[0]
+			require.Contains(t, discarded.Reason, "can't decode batch")
+			require.Less(t, discarded.Offset, int64(test.Offset))
+			require.Greater(t, discarded.Offset+discarded.Size, int64(test.Offset))
+			require.Less(t, discarded.Size, int64(64<<10))
+			requireValid(t, out.Bytes())
+		})
+	}
+}
+
+// TestRepairCorruptedV2 tests that the generation of a go 1.22+ batch that
+// can't be decoded is dropped, since parsers reject generations with missing
+// events.
+func TestRepairCorruptedV2(t *testing.T) {
+	// Corrupt the events of the second batch of generation 1
+	data := bytes.Clone(readTrace(t, "1.26", "generations.trace"))
+	copy(data[2000:], bytes.Repeat([]byte{0xff}, 40))
+	var out bytes.Buffer
+	report, err := Repair(bytes.NewReader(data), int64(len(data)), &out, Options{})
+	require.NoError(t, err)
+	require.Len(t, report.Discarded, 2)
+	require.Equal(t, "generation 1 has a batch that can't be decoded", report.Discarded[0].Reason)
+	discarded := report.Discarded[1]
+	require.Contains(t, discarded.Reason, "can't decode batch")
+	require.Less(t, discarded.Offset, int64(2000))
+	require.Greater(t, discarded.Offset+discarded.Size, int64(2000))
+	requireValid(t, out.Bytes())
+
+	// Only the generations after the corrupted one are left
+	gens := make(map[uint64]bool)
+	dec := encoding.NewDecoder(bytes.NewReader(out.Bytes()))
+	for {
+		var ev encoding.Event
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+		if ev.Type == encoding.EventV2Batch {
+			gens[ev.Args[0]] = true
+		}
+	}
+	require.Equal(t, map[uint64]bool{2: true, 3: true}, gens)
+}
+
+// TestRepairErrors tests that traces without a valid header are rejected.
+func TestRepairErrors(t *testing.T) {
+	data := []byte("not a trace, but long enough")
+	_, err := Repair(bytes.NewReader(data), int64(len(data)), io.Discard, Options{})
+	require.ErrorContains(t, err, "invalid header")
+}
+
+// readTrace reads a trace from the testdata directory.
+func readTrace(t *testing.T, goVersion, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", goVersion, name))
+	require.NoError(t, err)
+	return data
+}
+
+// requireValid checks that a repaired trace has no framing, reference or
+// frequency problems and can be parsed.
+func requireValid(t *testing.T, data []byte) {
+	problems, err := validate.Validate(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	for _, p := range problems {
+		require.False(t, strings.Contains(p.Message, "can't decode") ||
+			strings.Contains(p.Message, "is not defined") ||
+			strings.Contains(p.Message, "no frequency event") ||
+			strings.Contains(p.Message, "batch has a length"), "%s", p)
+	}
+
+	dec := encoding.NewDecoder(bytes.NewReader(data))
+	if dec.Decode(&encoding.Event{}); dec.Version() >= 1022 {
+		tracetest.ReadEvents(t, data)
+		return
+	}
+	_, err = trace.Parse(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+}
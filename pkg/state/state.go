@@ -0,0 +1,241 @@
+// Package state tracks the state of the goroutines, Ps and the GC of go 1.11
+// to 1.21 traces with State and of go 1.22+ traces with V2. It's used to
+// recreate the state of a trace at a point in time with state events, just
+// like the runtime does at the start of a trace or generation.
+package state
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+// GStatus is the status of a goroutine. This is copied from
+// src/internal/trace/order.go in the Go source tree.
+type GStatus int
+
+const (
+	GDead GStatus = iota
+	GRunnable
+	GRunning
+	GWaiting
+)
+
+// G is the state of a goroutine.
+type G struct {
+	Status  GStatus
+	Ts      int64  // timestamp of the last status change
+	Seq     uint64 // sequence number used to order the events of the goroutine
+	Syscall bool   // true if the goroutine is blocked in a syscall
+	Stack   uint64 // creation stack
+}
+
+// P is the state of a P.
+type P struct {
+	Running  bool
+	Thread   uint64
+	G        uint64 // running goroutine or 0
+	Sweeping bool
+}
+
+// Latest is a global value that is changed by events on different Ps.
+type Latest struct {
+	Value uint64
+	Ts    int64 // timestamp of the last change
+	OK    bool  // true if the value has been set
+}
+
+// Set sets the value unless a later change has been seen already, which
+// happens because the batches of different Ps are not sorted by time.
+func (l *Latest) Set(ts int64, value uint64) {
+	if ts >= l.Ts {
+		l.Value, l.Ts, l.OK = value, ts, true
+	}
+}
+
+// State is the state of a trace after the events passed to Update.
+type State struct {
+	Gs        map[uint64]*G // goroutines, ended ones have the status GDead
+	Ps        map[uint64]*P
+	GCSeq     uint64 // number of GCs
+	GC        Latest // GC start (1) or done (0)
+	STW       Latest // kind + 1 of the STW phase or 0 when it's done
+	Procs     Latest // GOMAXPROCS
+	HeapAlloc Latest
+	HeapGoal  Latest
+
+	version int
+}
+
+// New returns the empty state of a trace of the given version.
+func New(version int) *State {
+	return &State{
+		Gs:      make(map[uint64]*G),
+		Ps:      make(map[uint64]*P),
+		version: version,
+	}
+}
+
+// Update updates the state for ev. Events without a timestamp and CPU
+// samples don't change the state. This follows stateTransition from
+// src/internal/trace/order.go in the Go source tree. The sequence number of a
+// goroutine is the number of events that increment it, so it doesn't depend
+// on the order of the batches.
+func (s *State) Update(ev *encoding.ContextEvent) error {
+	if ev.Ts == 0 || ev.Type == encoding.EventCPUSample {
+		return nil
+	}
+
+	p := s.P(uint64(ev.P))
+	switch ev.Type {
+	case encoding.EventProcStart:
+		start, err := ev.AsProcStart(s.version)
+		if err != nil {
+			return err
+		}
+		p.Running, p.Thread = true, start.Thread
+	case encoding.EventProcStop:
+		p.Running = false
+	case encoding.EventGCStart:
+		s.GCSeq++
+		s.GC.Set(ev.Ts, 1)
+	case encoding.EventGCDone:
+		s.GC.Set(ev.Ts, 0)
+	case encoding.EventGCSTWStart:
+		stw, err := ev.AsGCSTWStart(s.version)
+		if err != nil {
+			return err
+		}
+		s.STW.Set(ev.Ts, stw.Kind+1)
+	case encoding.EventGCSTWDone:
+		s.STW.Set(ev.Ts, 0)
+	case encoding.EventGCSweepStart:
+		p.Sweeping = true
+	case encoding.EventGCSweepDone:
+		p.Sweeping = false
+	case encoding.EventGomaxprocs:
+		procs, err := ev.AsGomaxprocs(s.version)
+		if err != nil {
+			return err
+		}
+		s.Procs.Set(ev.Ts, procs.Procs)
+	case encoding.EventHeapAlloc:
+		alloc, err := ev.AsHeapAlloc(s.version)
+		if err != nil {
+			return err
+		}
+		s.HeapAlloc.Set(ev.Ts, alloc.Mem)
+	case encoding.EventHeapGoal:
+		goal, err := ev.AsHeapGoal(s.version)
+		if err != nil {
+			return err
+		}
+		s.HeapGoal.Set(ev.Ts, goal.Mem)
+	case encoding.EventGoCreate:
+		create, err := ev.AsGoCreate(s.version)
+		if err != nil {
+			return err
+		}
+		g := s.G(create.NewG)
+		g.Stack = create.NewStack
+		s.transition(g, ev.Ts, GRunnable, false)
+	case encoding.EventGoWaiting:
+		s.transition(s.G(ev.G), ev.Ts, GWaiting, false)
+	case encoding.EventGoInSyscall:
+		s.transition(s.G(ev.G), ev.Ts, GWaiting, true)
+	case encoding.EventGoStart, encoding.EventGoStartLocal, encoding.EventGoStartLabel:
+		p.G = ev.G
+		s.transition(s.G(ev.G), ev.Ts, GRunning, false)
+	case encoding.EventGoUnblock, encoding.EventGoUnblockLocal,
+		encoding.EventGoSysExit, encoding.EventGoSysExitLocal:
+		// The goroutine of the event is the one that unblocks g
+		i, _ := encoding.ArgIndex(s.version, ev.Type, "G")
+		s.transition(s.G(ev.Args[i]), ev.Ts, GRunnable, false)
+	case encoding.EventGoEnd, encoding.EventGoStop:
+		p.G = 0
+		s.setStatus(s.G(ev.G), ev.Ts, GDead, false)
+	case encoding.EventGoSched, encoding.EventGoPreempt:
+		p.G = 0
+		s.setStatus(s.G(ev.G), ev.Ts, GRunnable, false)
+	case encoding.EventGoSleep, encoding.EventGoBlock, encoding.EventGoBlockSend,
+		encoding.EventGoBlockRecv, encoding.EventGoBlockSelect, encoding.EventGoBlockSync,
+		encoding.EventGoBlockCond, encoding.EventGoBlockNet, encoding.EventGoBlockGC:
+		p.G = 0
+		s.setStatus(s.G(ev.G), ev.Ts, GWaiting, false)
+	case encoding.EventGoSysBlock:
+		p.G = 0
+		s.setStatus(s.G(ev.G), ev.Ts, GWaiting, true)
+	}
+	return nil
+}
+
+// transition sets the status of g and increments its sequence number.
+func (s *State) transition(g *G, ts int64, status GStatus, syscall bool) {
+	g.Seq++
+	s.setStatus(g, ts, status, syscall)
+}
+
+// setStatus sets the status of g unless a later status change has been seen
+// already, which happens because the batches of different Ps are not sorted
+// by time.
+func (s *State) setStatus(g *G, ts int64, status GStatus, syscall bool) {
+	if ts >= g.Ts {
+		g.Status, g.Ts, g.Syscall = status, ts, syscall
+	}
+}
+
+// G returns the state of the goroutine g. The state of goroutine 0, which
+// stands for no goroutine, is discarded. Ended goroutines are kept, so that
+// events on other Ps that happened before their end don't bring them back.
+func (s *State) G(g uint64) *G {
+	if g == 0 {
+		return &G{}
+	}
+	gs, ok := s.Gs[g]
+	if !ok {
+		gs = &G{}
+		s.Gs[g] = gs
+	}
+	return gs
+}
+
+// P returns the state of the P p.
+func (s *State) P(p uint64) *P {
+	ps, ok := s.Ps[p]
+	if !ok {
+		ps = &P{}
+		s.Ps[p] = ps
+	}
+	return ps
+}
+
+// Running returns the goroutines that are running on a P. Goroutines that
+// are running according to their status, but not on any P, are made
+// runnable.
+func (s *State) Running() map[uint64]uint64 {
+	running := make(map[uint64]uint64)
+	for _, id := range SortedKeys(s.Ps) {
+		p := s.Ps[id]
+		if g, ok := s.Gs[p.G]; ok && p.G != 0 && g.Status == GRunning {
+			running[p.G] = id
+		}
+	}
+	for id, g := range s.Gs {
+		if _, ok := running[id]; !ok && g.Status == GRunning {
+			g.Status = GRunnable
+		}
+	}
+	return running
+}
+
+// SortedKeys returns the keys of m in ascending order to write state
+// deterministically.
+func SortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"math"
+	"testing"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStateOrder tests that the status of goroutines is decided by the
+// timestamps of the events rather than by the order in which they are
+// passed to Update, because the batches of different Ps are not sorted by
+// time.
+func TestStateOrder(t *testing.T) {
+	events := []encoding.ContextEvent{
+		{Event: encoding.Event{Type: encoding.EventGoCreate, Args: []uint64{0, 5, 1, 0}}, Ts: 10, P: 0},
+		{Event: encoding.Event{Type: encoding.EventGoStart, Args: []uint64{0, 5, 1}}, Ts: 20, P: 0, G: 5},
+		{Event: encoding.Event{Type: encoding.EventGoBlock, Args: []uint64{0, 0}}, Ts: 30, P: 0, G: 5},
+		{Event: encoding.Event{Type: encoding.EventGoStart, Args: []uint64{0, 5, 3}}, Ts: 50, P: 0, G: 5},
+		{Event: encoding.Event{Type: encoding.EventGoEnd, Args: []uint64{0}}, Ts: 60, P: 0, G: 5},
+		// The unblock happened before the end, but on another P whose
+		// batch comes later.
+		{Event: encoding.Event{Type: encoding.EventGoUnblock, Args: []uint64{0, 5, 2, 0}}, Ts: 40, P: 1, G: 0},
+	}
+
+	s := New(1019)
+	for i := range events {
+		require.NoError(t, s.Update(&events[i]))
+	}
+	require.Equal(t, &G{Status: GDead, Ts: 60, Seq: 4, Stack: 1}, s.Gs[5])
+	require.Equal(t, &P{}, s.Ps[0])
+	require.Empty(t, s.Running())
+}
+
+// TestV2Order tests that the events of go 1.22+ traces are applied once the
+// events they depend on have been applied, because the runtime may write the
+// status of a P or goroutine after an event of another M that needs it.
+func TestV2Order(t *testing.T) {
+	ev := func(m int64, ticks uint64, typ encoding.EventType, args ...uint64) encoding.ContextEvent {
+		return encoding.ContextEvent{Event: encoding.Event{Type: typ, Args: append([]uint64{0}, args...)}, Ts: int64(ticks), Ticks: ticks, M: m, P: -1}
+	}
+	ms := [][]encoding.ContextEvent{
+		{
+			ev(1, 5, encoding.EventV2ProcStart, 0, 1),
+			ev(1, 30, encoding.EventV2GoStart, 5, 2),
+		},
+		{
+			ev(2, 10, encoding.EventV2ProcStatus, 0, uint64(V2PIdle)),
+			ev(2, 20, encoding.EventV2GoUnblock, 5, 1, 0),
+		},
+		{
+			ev(-1, 15, encoding.EventV2GoStatus, 5, math.MaxUint64, uint64(V2GWaiting)),
+		},
+	}
+
+	s := NewV2(1025)
+	require.NoError(t, s.UpdateOrdered(ms))
+	require.Equal(t, &V2P{Status: V2PRunning, Seq: 1}, s.Ps[0])
+	require.Equal(t, &V2G{Status: V2GRunning, Seq: 2}, s.Gs[5])
+	require.Equal(t, &V2M{P: 0, G: 5}, s.Ms[1])
+	gs, ps := s.Bound()
+	require.Equal(t, map[uint64]int64{5: 1}, gs)
+	require.Equal(t, map[uint64]int64{0: 1}, ps)
+}
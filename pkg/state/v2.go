@@ -0,0 +1,393 @@
+package state
+
+import (
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+// V2GStatus is the status of a goroutine in a go 1.22+ trace. This is copied
+// from src/internal/trace/tracev2/events.go in the Go source tree.
+type V2GStatus uint64
+
+const (
+	V2GBad V2GStatus = iota
+	V2GRunnable
+	V2GRunning
+	V2GSyscall
+	V2GWaiting
+)
+
+// V2PStatus is the status of a P in a go 1.22+ trace. This is copied from
+// src/internal/trace/tracev2/events.go in the Go source tree.
+type V2PStatus uint64
+
+const (
+	V2PBad V2PStatus = iota
+	V2PRunning
+	V2PIdle
+	V2PSyscall
+	V2PSyscallAbandoned
+)
+
+// V2G is the state of a goroutine in a go 1.22+ trace.
+type V2G struct {
+	Status V2GStatus
+	Seq    uint64 // sequence number, 0 after the status of the goroutine
+	Assist bool   // true during a GC mark assist
+	STW    bool   // true while the goroutine stops the world
+	Kind   uint64 // kind string id of the STW phase
+}
+
+// V2P is the state of a P in a go 1.22+ trace.
+type V2P struct {
+	Status   V2PStatus
+	Seq      uint64 // sequence number, 0 after the status of the P
+	Sweeping bool
+}
+
+// V2M is the state of an M in a go 1.22+ trace.
+type V2M struct {
+	P int64  // P held by the M or -1
+	G uint64 // goroutine running or in a syscall on the M or 0
+}
+
+// V2 is the state of a go 1.22+ trace after the events passed to Update.
+// Sequence numbers restart in every generation with the status events of the
+// goroutines and Ps, so the events of each generation must be passed to
+// UpdateOrdered separately.
+type V2 struct {
+	Gs        map[uint64]*V2G // goroutines, ended ones are removed
+	Ps        map[uint64]*V2P
+	Ms        map[int64]*V2M
+	GC        bool   // true if a GC is running
+	GCSeq     uint64 // sequence number of the last GC event
+	GCKnown   bool   // true if a GC event has been seen
+	HeapAlloc Latest
+	HeapGoal  Latest
+
+	version int
+}
+
+// NewV2 returns the empty state of a generation of a go 1.22+ trace of the
+// given version.
+func NewV2(version int) *V2 {
+	return &V2{
+		Gs:      make(map[uint64]*V2G),
+		Ps:      make(map[uint64]*V2P),
+		Ms:      make(map[int64]*V2M),
+		version: version,
+	}
+}
+
+// UpdateOrdered passes the events of a generation to Update in the order in
+// which they happened. Every element of ms holds the events of one M in the
+// order of the trace. Like src/internal/trace/order.go in the Go source tree,
+// the next event is the earliest one that is Ready. If none of them is, the
+// earliest event is used, because the events that would make it ready may be
+// missing, e.g. when they happen after a time window.
+func (s *V2) UpdateOrdered(ms [][]encoding.ContextEvent) error {
+	for {
+		next, ready := -1, false
+		for i, evs := range ms {
+			if len(evs) == 0 {
+				continue
+			}
+			r := s.Ready(&evs[0])
+			if next < 0 || (r && !ready) || (r == ready && evs[0].Ticks < ms[next][0].Ticks) {
+				next, ready = i, r
+			}
+		}
+		if next < 0 {
+			return nil
+		} else if err := s.Update(&ms[next][0]); err != nil {
+			return err
+		}
+		ms[next] = ms[next][1:]
+	}
+}
+
+// Ready returns true if the goroutine, P or GC that ev transitions is in the
+// state that ev requires, i.e. all events that happened before ev have been
+// passed to Update.
+func (s *V2) Ready(ev *encoding.ContextEvent) bool {
+	switch ev.Type {
+	case encoding.EventV2GoStart, encoding.EventV2GoUnblock,
+		encoding.EventV2GoSwitch, encoding.EventV2GoSwitchDestroy:
+		g, _ := encoding.ArgIndex(s.version, ev.Type, "G")
+		seq, _ := encoding.ArgIndex(s.version, ev.Type, "GSeq")
+		status := V2GWaiting
+		if ev.Type == encoding.EventV2GoStart {
+			status = V2GRunnable
+		}
+		gs, ok := s.Gs[ev.Args[g]]
+		return ok && gs.Status == status && ev.Args[seq] == gs.Seq+1
+	case encoding.EventV2ProcStart, encoding.EventV2ProcSteal:
+		p, _ := encoding.ArgIndex(s.version, ev.Type, "P")
+		seq, _ := encoding.ArgIndex(s.version, ev.Type, "PSeq")
+		ps, ok := s.Ps[ev.Args[p]]
+		if !ok || ev.Args[seq] != ps.Seq+1 {
+			return false
+		} else if ev.Type == encoding.EventV2ProcStart {
+			return ps.Status == V2PIdle && s.M(ev.M).P < 0
+		}
+		return ps.Status == V2PSyscall || ps.Status == V2PSyscallAbandoned
+	case encoding.EventV2GoSyscallEndBlocked:
+		// The P of the syscall must have been taken away first
+		ps, ok := s.Ps[uint64(s.M(ev.M).P)]
+		return !ok || ps.Status != V2PSyscall
+	case encoding.EventV2GCActive, encoding.EventV2GCBegin, encoding.EventV2GCEnd:
+		seq, _ := encoding.ArgIndex(s.version, ev.Type, "Seq")
+		return !s.GCKnown || ev.Args[seq] == s.GCSeq+1
+	}
+	return true
+}
+
+// Update updates the state for ev, which must be an event of the M ev.M or of
+// no M if it's -1. Events without a timestamp and CPU samples don't change
+// the state. This follows src/internal/trace/order.go in the Go source tree,
+// but it doesn't check whether the transitions are valid.
+func (s *V2) Update(ev *encoding.ContextEvent) error {
+	if ev.Ticks == 0 || ev.Type == encoding.EventV2CPUSample {
+		return nil
+	}
+
+	m := &V2M{P: -1}
+	if ev.M >= 0 {
+		m = s.M(ev.M)
+	}
+	switch ev.Type {
+	case encoding.EventV2ProcStatus:
+		status, err := ev.AsV2ProcStatus(s.version)
+		if err != nil {
+			return err
+		}
+		p := s.P(status.P)
+		p.Status, p.Seq = V2PStatus(status.Status), 0
+		if p.Status == V2PRunning || p.Status == V2PSyscall {
+			m.P = int64(status.P)
+		}
+	case encoding.EventV2ProcStart:
+		start, err := ev.AsV2ProcStart(s.version)
+		if err != nil {
+			return err
+		}
+		p := s.P(start.P)
+		p.Status, p.Seq = V2PRunning, start.PSeq
+		m.P = int64(start.P)
+	case encoding.EventV2ProcStop:
+		s.heldP(m).Status = V2PIdle
+		m.P = -1
+	case encoding.EventV2ProcSteal:
+		steal, err := ev.AsV2ProcSteal(s.version)
+		if err != nil {
+			return err
+		}
+		p := s.P(steal.P)
+		p.Status, p.Seq = V2PIdle, steal.PSeq
+		if victim, ok := s.Ms[int64(steal.M)]; ok && victim.P == int64(steal.P) {
+			victim.P = -1
+		}
+	case encoding.EventV2GoStatus, encoding.EventV2GoStatusStack:
+		g, _ := encoding.ArgIndex(s.version, ev.Type, "G")
+		gm, _ := encoding.ArgIndex(s.version, ev.Type, "M")
+		status, _ := encoding.ArgIndex(s.version, ev.Type, "Status")
+		gs := s.G(ev.Args[g])
+		gs.Status, gs.Seq = V2GStatus(ev.Args[status]), 0
+		switch gs.Status {
+		case V2GRunning:
+			m.G = ev.Args[g]
+		case V2GSyscall:
+			// The goroutine may be in a syscall on another M
+			s.M(int64(ev.Args[gm])).G = ev.Args[g]
+		}
+	case encoding.EventV2GoCreate, encoding.EventV2GoCreateBlocked:
+		g, _ := encoding.ArgIndex(s.version, ev.Type, "NewG")
+		gs := s.G(ev.Args[g])
+		gs.Status, gs.Seq = V2GRunnable, 0
+		if ev.Type == encoding.EventV2GoCreateBlocked {
+			gs.Status = V2GWaiting
+		}
+	case encoding.EventV2GoCreateSyscall:
+		create, err := ev.AsV2GoCreateSyscall(s.version)
+		if err != nil {
+			return err
+		}
+		gs := s.G(create.NewG)
+		gs.Status, gs.Seq = V2GSyscall, 0
+		m.G = create.NewG
+	case encoding.EventV2GoStart:
+		start, err := ev.AsV2GoStart(s.version)
+		if err != nil {
+			return err
+		}
+		gs := s.G(start.G)
+		gs.Status, gs.Seq = V2GRunning, start.GSeq
+		m.G = start.G
+	case encoding.EventV2GoUnblock:
+		unblock, err := ev.AsV2GoUnblock(s.version)
+		if err != nil {
+			return err
+		}
+		gs := s.G(unblock.G)
+		gs.Status, gs.Seq = V2GRunnable, unblock.GSeq
+	case encoding.EventV2GoSwitch, encoding.EventV2GoSwitchDestroy:
+		// The current goroutine blocks or ends and the next one runs
+		g, _ := encoding.ArgIndex(s.version, ev.Type, "G")
+		seq, _ := encoding.ArgIndex(s.version, ev.Type, "GSeq")
+		if ev.Type == encoding.EventV2GoSwitch {
+			s.G(m.G).Status = V2GWaiting
+		} else {
+			delete(s.Gs, m.G)
+		}
+		gs := s.G(ev.Args[g])
+		gs.Status, gs.Seq = V2GRunning, ev.Args[seq]
+		m.G = ev.Args[g]
+	case encoding.EventV2GoStop, encoding.EventV2GoSyscallEndBlocked:
+		s.G(m.G).Status = V2GRunnable
+		m.G = 0
+	case encoding.EventV2GoBlock:
+		s.G(m.G).Status = V2GWaiting
+		m.G = 0
+	case encoding.EventV2GoDestroy:
+		delete(s.Gs, m.G)
+		m.G = 0
+	case encoding.EventV2GoDestroySyscall:
+		// The P of the M is abandoned in the syscall
+		delete(s.Gs, m.G)
+		if m.P >= 0 {
+			s.heldP(m).Status = V2PSyscallAbandoned
+		}
+		m.G, m.P = 0, -1
+	case encoding.EventV2GoSyscallBegin:
+		begin, err := ev.AsV2GoSyscallBegin(s.version)
+		if err != nil {
+			return err
+		}
+		s.G(m.G).Status = V2GSyscall
+		p := s.heldP(m)
+		p.Status, p.Seq = V2PSyscall, begin.PSeq
+	case encoding.EventV2GoSyscallEnd:
+		s.G(m.G).Status = V2GRunning
+		s.heldP(m).Status = V2PRunning
+	case encoding.EventV2GCActive, encoding.EventV2GCBegin, encoding.EventV2GCEnd:
+		seq, _ := encoding.ArgIndex(s.version, ev.Type, "Seq")
+		s.GC, s.GCSeq, s.GCKnown = ev.Type != encoding.EventV2GCEnd, ev.Args[seq], true
+	case encoding.EventV2GCSweepActive:
+		active, err := ev.AsV2GCSweepActive(s.version)
+		if err != nil {
+			return err
+		}
+		s.P(active.P).Sweeping = true
+	case encoding.EventV2GCSweepBegin:
+		s.heldP(m).Sweeping = true
+	case encoding.EventV2GCSweepEnd:
+		s.heldP(m).Sweeping = false
+	case encoding.EventV2GCMarkAssistActive:
+		active, err := ev.AsV2GCMarkAssistActive(s.version)
+		if err != nil {
+			return err
+		}
+		s.G(active.G).Assist = true
+	case encoding.EventV2GCMarkAssistBegin:
+		s.G(m.G).Assist = true
+	case encoding.EventV2GCMarkAssistEnd:
+		s.G(m.G).Assist = false
+	case encoding.EventV2STWBegin:
+		begin, err := ev.AsV2STWBegin(s.version)
+		if err != nil {
+			return err
+		}
+		gs := s.G(m.G)
+		gs.STW, gs.Kind = true, begin.Kind
+	case encoding.EventV2STWEnd:
+		s.G(m.G).STW = false
+	case encoding.EventV2HeapAlloc:
+		alloc, err := ev.AsV2HeapAlloc(s.version)
+		if err != nil {
+			return err
+		}
+		s.HeapAlloc.Set(ev.Ts, alloc.Mem)
+	case encoding.EventV2HeapGoal:
+		goal, err := ev.AsV2HeapGoal(s.version)
+		if err != nil {
+			return err
+		}
+		s.HeapGoal.Set(ev.Ts, goal.Mem)
+	}
+	return nil
+}
+
+// G returns the state of the goroutine g. The state of goroutine 0, which
+// stands for no goroutine, is discarded.
+func (s *V2) G(g uint64) *V2G {
+	if g == 0 {
+		return &V2G{}
+	}
+	gs, ok := s.Gs[g]
+	if !ok {
+		gs = &V2G{}
+		s.Gs[g] = gs
+	}
+	return gs
+}
+
+// P returns the state of the P p.
+func (s *V2) P(p uint64) *V2P {
+	ps, ok := s.Ps[p]
+	if !ok {
+		ps = &V2P{}
+		s.Ps[p] = ps
+	}
+	return ps
+}
+
+// M returns the state of the M m.
+func (s *V2) M(m int64) *V2M {
+	ms, ok := s.Ms[m]
+	if !ok {
+		ms = &V2M{P: -1}
+		s.Ms[m] = ms
+	}
+	return ms
+}
+
+// heldP returns the state of the P held by m. The state is discarded if m
+// doesn't hold a P.
+func (s *V2) heldP(m *V2M) *V2P {
+	if m.P < 0 {
+		return &V2P{}
+	}
+	return s.P(uint64(m.P))
+}
+
+// Bound returns the M of every goroutine that is running or in a syscall on
+// an M and of every P that is held by an M. Goroutines that are running
+// according to their status, but not on any M, are made runnable, and Ps are
+// made idle.
+func (s *V2) Bound() (gs map[uint64]int64, ps map[uint64]int64) {
+	gs, ps = make(map[uint64]int64), make(map[uint64]int64)
+	for _, id := range SortedKeys(s.Ms) {
+		m := s.Ms[id]
+		if g, ok := s.Gs[m.G]; ok && (g.Status == V2GRunning || g.Status == V2GSyscall) {
+			gs[m.G] = id
+		}
+		if p, ok := s.Ps[uint64(m.P)]; ok && m.P >= 0 && (p.Status == V2PRunning || p.Status == V2PSyscall) {
+			ps[uint64(m.P)] = id
+		}
+	}
+	for id, g := range s.Gs {
+		if _, ok := gs[id]; !ok && (g.Status == V2GRunning || g.Status == V2GSyscall) {
+			g.Status = V2GRunnable
+		}
+	}
+	for id, p := range s.Ps {
+		if _, ok := ps[id]; !ok {
+			switch p.Status {
+			case V2PRunning:
+				p.Status = V2PIdle
+			case V2PSyscall:
+				p.Status = V2PSyscallAbandoned
+			}
+		}
+	}
+	return gs, ps
+}
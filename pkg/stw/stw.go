@@ -33,25 +33,41 @@ func Events(r io.Reader) ([]*Event, error) {
 			return nil, err
 		}
 
+		// The new trace format isn't supported yet
+		if dec.Version() >= 1022 {
+			return nil, fmt.Errorf("unsupported trace file version %d", dec.Version())
+		}
+
 		// Extract timestamps and P from event
 		switch ev.Type {
 		case encoding.EventBatch:
+			batch, err := ev.AsBatch(dec.Version())
+			if err != nil {
+				return nil, err
+			}
 			// Every batch belongs to one P
-			lastP = ev.Args[0]
+			lastP = batch.P
 			// Each batch has a full timestamp, the remaining events in the
 			// batch are relative to this timestamp.
-			lastTs = time.Duration(ev.Args[1])
+			lastTs = time.Duration(batch.Ts)
 		case encoding.EventFrequency:
+			freq, err := ev.AsFrequency(dec.Version())
+			if err != nil {
+				return nil, err
+			}
 			// ticksPerSec is used to convert ticks to nanoseconds
-			ticksPerSec = int64(ev.Args[0])
+			ticksPerSec = int64(freq.Freq)
 			if ticksPerSec <= 0 {
 				return nil, fmt.Errorf("negative ticksPerSec: %d", ticksPerSec)
 			}
-		case encoding.EventTimerGoroutine, encoding.EventStack, encoding.EventString:
-			// Ignore these events, their first argument is not a timestamp
 		default:
+			// Ignore events without a timestamp, e.g. EventStack
+			tsDelta, ok := ev.TsDelta(dec.Version())
+			if !ok {
+				break
+			}
 			// All other events are relative to the last timestamp.
-			lastTs += time.Duration(ev.Args[0])
+			lastTs += time.Duration(tsDelta)
 			// Keep track of the minimum timestamp seen.
 			// This is technically wrong. The timestamps from EventBatch are
 			// what should be used. But we're trying to produce the same results
@@ -67,10 +83,15 @@ func Events(r io.Reader) ([]*Event, error) {
 			if worldStopped {
 				return nil, fmt.Errorf("unexpected EventGCSTWStart: %#v", ev)
 			} else {
+				stwStart, err := ev.AsGCSTWStart(dec.Version())
+				if err != nil {
+					return nil, err
+				}
 				// Create a new STW event
 				event := &Event{Start: lastTs, P: lastP}
-				// Determine the type of STW event
-				event.Type, err = eventType(dec.Version(), ev.Args[1])
+				// Determine the type of STW event. Before go 1.10 there
+				// was no kind argument, which implies kind 0.
+				event.Type, err = eventType(dec.Version(), stwStart.Kind)
 				if err != nil {
 					return nil, err
 				}
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/felixge/traceutils/pkg/tracebuilder"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -21,11 +22,37 @@ func TestEvents(t *testing.T) {
 
 	tests := []struct {
 		GoVersion   string
+		Trace       string
 		EventCount  int
 		CheckEvents map[int]testEvent
 	}{
+		{
+			GoVersion:  "1.6",
+			Trace:      "simple.trace",
+			EventCount: 1,
+			CheckEvents: map[int]testEvent{
+				0: {
+					Start:    3511669,
+					Duration: 93342,
+					Type:     MarkTermination,
+				},
+			},
+		},
+		{
+			GoVersion:  "1.9",
+			Trace:      "simple.trace",
+			EventCount: 1,
+			CheckEvents: map[int]testEvent{
+				0: {
+					Start:    3192209,
+					Duration: 2720,
+					Type:     MarkTermination,
+				},
+			},
+		},
 		{
 			GoVersion:  "1.19",
+			Trace:      "test-encoding-json.trace",
 			EventCount: 42,
 			CheckEvents: map[int]testEvent{
 				0: {
@@ -42,6 +69,7 @@ func TestEvents(t *testing.T) {
 		},
 		{
 			GoVersion:  "1.21",
+			Trace:      "test-encoding-json.trace",
 			EventCount: 42,
 			CheckEvents: map[int]testEvent{
 				0: {
@@ -61,7 +89,7 @@ func TestEvents(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.GoVersion, func(t *testing.T) {
 			// Read the test trace.
-			inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, "test-encoding-json.trace"))
+			inTrace, err := os.ReadFile(filepath.Join("..", "..", "testdata", test.GoVersion, test.Trace))
 			require.NoError(t, err)
 
 			// Extract the STW events from the trace
@@ -89,3 +117,100 @@ func TestEvents(t *testing.T) {
 		})
 	}
 }
+
+// TestEventsSynthetic tests edge cases with traces created by tracebuilder.
+func TestEventsSynthetic(t *testing.T) {
+	tests := []struct {
+		Name string
+		// Build adds the events of the trace.
+		Build func(b *tracebuilder.Builder)
+		Want  []Event
+		// WantErr is the expected error if not empty.
+		WantErr string
+	}{
+		{
+			Name: "STW across batches",
+			Build: func(b *tracebuilder.Builder) {
+				b.ProcStart(0, 0, 1)
+				b.STWStart(0, 10*time.Microsecond, 9)
+				b.ProcStart(1, 15*time.Microsecond, 2)
+				b.Batch(0, 20*time.Microsecond)
+				b.STWDone(0, 30*time.Microsecond)
+			},
+			Want: []Event{{Start: 10 * time.Microsecond, End: 30 * time.Microsecond, Type: GOMAXPROCS, P: 0}},
+		},
+		{
+			Name: "STW on other P",
+			Build: func(b *tracebuilder.Builder) {
+				b.ProcStart(0, 0, 1)
+				b.ProcStart(3, 0, 2)
+				b.STWStart(3, 10*time.Microsecond, 1)
+				b.STWDone(3, 20*time.Microsecond)
+				b.STWStart(0, 30*time.Microsecond, 2)
+				b.STWDone(0, 35*time.Microsecond)
+			},
+			Want: []Event{
+				{Start: 10 * time.Microsecond, End: 20 * time.Microsecond, Type: MarkTermination, P: 3},
+				{Start: 30 * time.Microsecond, End: 35 * time.Microsecond, Type: SweepTermination, P: 0},
+			},
+		},
+		{
+			Name: "relative to first event",
+			Build: func(b *tracebuilder.Builder) {
+				b.ProcStart(0, 5*time.Microsecond, 1)
+				b.STWStart(0, 10*time.Microsecond, 0)
+				b.STWDone(0, 20*time.Microsecond)
+			},
+			Want: []Event{{Start: 5 * time.Microsecond, End: 15 * time.Microsecond, Type: Unknown, P: 0}},
+		},
+		{
+			Name: "done on different P",
+			Build: func(b *tracebuilder.Builder) {
+				b.STWStart(0, 10*time.Microsecond, 1)
+				b.STWDone(1, 20*time.Microsecond)
+			},
+			WantErr: "expected P: got=1 want=0",
+		},
+		{
+			Name: "nested STW",
+			Build: func(b *tracebuilder.Builder) {
+				b.STWStart(0, 10*time.Microsecond, 1)
+				b.STWStart(0, 20*time.Microsecond, 1)
+			},
+			WantErr: "unexpected EventGCSTWStart",
+		},
+		{
+			Name: "unknown kind",
+			Build: func(b *tracebuilder.Builder) {
+				b.STWStart(0, 10*time.Microsecond, 100)
+			},
+			WantErr: "unknown STW kind 100",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			b := tracebuilder.New()
+			test.Build(b)
+			data, err := b.Bytes()
+			require.NoError(t, err)
+
+			events, err := Events(bytes.NewReader(data))
+			if test.WantErr != "" {
+				require.ErrorContains(t, err, test.WantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			// The events are in the order of the batches, not in time order
+			sort.Slice(events, func(i, j int) bool {
+				return events[i].Start < events[j].Start
+			})
+			var got []Event
+			for _, e := range events {
+				got = append(got, *e)
+			}
+			require.Equal(t, test.Want, got)
+		})
+	}
+}
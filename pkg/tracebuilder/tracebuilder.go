@@ -0,0 +1,361 @@
+// Package tracebuilder creates synthetic go 1.21 traces for tests.
+//
+// A Builder collects events that happen on Ps at absolute times since the
+// start of the trace. Encode splits them into batches, converts the times to
+// timestamp deltas and writes them along with the frequency, string and
+// stack events they need:
+//
+//	b := tracebuilder.New()
+//	stack := b.Stack(tracebuilder.Frame{Func: "main.main", File: "main.go", Line: 10})
+//	b.ProcStart(0, 0, 1)
+//	b.GoCreate(0, 0, 1, stack, 0)
+//	b.GoStart(0, time.Millisecond, 1)
+//	b.GoEnd(0, 2*time.Millisecond)
+//	b.ProcStop(0, 2*time.Millisecond)
+//	err := b.Encode(w)
+//
+// The builder doesn't check that the events are consistent, e.g. that a
+// goroutine is runnable before it's started, so tests can also create
+// broken traces. It only tracks the sequence numbers of goroutines that
+// go tool trace uses to order events across Ps, in the order in which the
+// events are added.
+package tracebuilder
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+const (
+	// Version is the version of the traces created by a Builder.
+	Version = 1021
+	// Frequency is the number of ticks per second of the traces created by
+	// a Builder, so every tick is a nanosecond.
+	Frequency = int64(time.Second)
+	// startTicks is the timestamp of the start of the trace. Real traces
+	// never start at 0, and some tools treat a timestamp of 0 as unset.
+	startTicks = 1000
+)
+
+// Builder collects the events of a synthetic trace. The zero value is not
+// usable, use New instead.
+type Builder struct {
+	batches []*batch          // all batches in the order they were started
+	current map[uint64]*batch // current batch of each P
+	strs    map[string]uint64 // string ids
+	stacks  map[string]uint64 // stack ids by the string ids of their frames
+	tables  []encoding.Event  // string and stack events
+	pcs     map[Frame]uint64  // fake PCs of the frames
+	seqs    map[uint64]uint64 // sequence numbers of the goroutines
+	err     error             // first error, returned by Encode
+}
+
+// batch is a batch of events of a P.
+type batch struct {
+	p      uint64
+	at     time.Duration
+	events []event
+}
+
+// event is an event at an absolute time.
+type event struct {
+	at time.Duration
+	ev encoding.Event
+}
+
+// Frame is a frame of a stack.
+type Frame struct {
+	Func string
+	File string
+	Line uint64
+}
+
+// New returns an empty Builder.
+func New() *Builder {
+	return &Builder{
+		current: make(map[uint64]*batch),
+		strs:    make(map[string]uint64),
+		stacks:  make(map[string]uint64),
+		pcs:     make(map[Frame]uint64),
+		seqs:    make(map[uint64]uint64),
+	}
+}
+
+// String returns the id of the string s, adding it to the string table if
+// it's not there yet.
+func (b *Builder) String(s string) uint64 {
+	if id, ok := b.strs[s]; ok {
+		return id
+	}
+	id := uint64(len(b.strs) + 1)
+	b.strs[s] = id
+	b.tables = append(b.tables, encoding.Event{Type: encoding.EventString, Args: []uint64{id}, Str: []byte(s)})
+	return id
+}
+
+// Stack returns the id of the stack with the given frames, innermost frame
+// first, adding it to the stack table if it's not there yet. Every distinct
+// frame gets its own fake PC. Use 0 for events without a stack.
+func (b *Builder) Stack(frames ...Frame) uint64 {
+	args := []uint64{0, uint64(len(frames))}
+	for _, f := range frames {
+		pc, ok := b.pcs[f]
+		if !ok {
+			pc = 0x1000 + uint64(len(b.pcs))*0x10
+			b.pcs[f] = pc
+		}
+		args = append(args, pc, b.String(f.Func), b.String(f.File), f.Line)
+	}
+	key := fmt.Sprint(args[1:])
+	if id, ok := b.stacks[key]; ok {
+		return id
+	}
+	id := uint64(len(b.stacks) + 1)
+	b.stacks[key] = id
+	args[0] = id
+	b.tables = append(b.tables, encoding.Event{Type: encoding.EventStack, Args: args})
+	return id
+}
+
+// Batch starts a new batch of events of P p at the given time. Events are
+// added to the current batch of their P, a P's first batch starts with its
+// first event.
+func (b *Builder) Batch(p uint64, at time.Duration) {
+	if at < 0 {
+		b.fail(fmt.Errorf("batch of p %d at negative time %v", p, at))
+		return
+	} else if cur := b.current[p]; cur != nil && at < cur.last() {
+		b.fail(fmt.Errorf("batch of p %d at %v starts before its previous event at %v", p, at, cur.last()))
+		return
+	}
+	bt := &batch{p: p, at: at}
+	b.batches = append(b.batches, bt)
+	b.current[p] = bt
+}
+
+// Event adds an event of type typ on P p at the given time. The args don't
+// include the timestamp delta of the event, which is computed by Encode.
+// Events on the same P must be added in chronological order.
+func (b *Builder) Event(p uint64, at time.Duration, typ encoding.EventType, args ...uint64) {
+	if i, ok := encoding.ArgIndex(Version, typ, "TsDelta"); !ok || i != 0 {
+		b.fail(fmt.Errorf("%v has no timestamp delta", typ))
+		return
+	} else if at < 0 {
+		b.fail(fmt.Errorf("%v on p %d at negative time %v", typ, p, at))
+		return
+	}
+	cur := b.current[p]
+	if cur == nil {
+		b.Batch(p, at)
+		cur = b.current[p]
+	} else if at < cur.last() {
+		b.fail(fmt.Errorf("%v on p %d at %v is before the previous event at %v", typ, p, at, cur.last()))
+		return
+	}
+	ev := encoding.Event{Type: typ, Args: append([]uint64{0}, args...)}
+	cur.events = append(cur.events, event{at: at, ev: ev})
+}
+
+// ProcStart adds an EventProcStart of P p running on the given thread.
+func (b *Builder) ProcStart(p uint64, at time.Duration, thread uint64) {
+	b.Event(p, at, encoding.EventProcStart, thread)
+}
+
+// ProcStop adds an EventProcStop of P p.
+func (b *Builder) ProcStop(p uint64, at time.Duration) {
+	b.Event(p, at, encoding.EventProcStop)
+}
+
+// GoCreate adds an EventGoCreate for the creation of goroutine g with the
+// stack newStack by the goroutine running on P p at stack. The stack is 0
+// for goroutines that exist at the start of the trace.
+func (b *Builder) GoCreate(p uint64, at time.Duration, g, newStack, stack uint64) {
+	b.seqs[g] = 1
+	b.Event(p, at, encoding.EventGoCreate, g, newStack, stack)
+}
+
+// GoWaiting adds an EventGoWaiting for goroutine g that is blocked at the
+// start of the trace. It must directly follow the creation of g.
+func (b *Builder) GoWaiting(p uint64, at time.Duration, g uint64) {
+	b.seqs[g]++
+	b.Event(p, at, encoding.EventGoWaiting, g)
+}
+
+// GoInSyscall adds an EventGoInSyscall for goroutine g that is in a system
+// call at the start of the trace. It must directly follow the creation of g.
+func (b *Builder) GoInSyscall(p uint64, at time.Duration, g uint64) {
+	b.seqs[g]++
+	b.Event(p, at, encoding.EventGoInSyscall, g)
+}
+
+// GoStart adds an EventGoStart for goroutine g starting to run on P p.
+func (b *Builder) GoStart(p uint64, at time.Duration, g uint64) {
+	b.Event(p, at, encoding.EventGoStart, g, b.seqs[g])
+	b.seqs[g]++
+}
+
+// GoEnd adds an EventGoEnd for the goroutine running on P p exiting.
+func (b *Builder) GoEnd(p uint64, at time.Duration) {
+	b.Event(p, at, encoding.EventGoEnd)
+}
+
+// GoSched adds an EventGoSched for the goroutine running on P p yielding at
+// stack.
+func (b *Builder) GoSched(p uint64, at time.Duration, stack uint64) {
+	b.Event(p, at, encoding.EventGoSched, stack)
+}
+
+// GoBlock adds an event of type typ for the goroutine running on P p
+// blocking at stack, e.g. encoding.EventGoBlockRecv.
+func (b *Builder) GoBlock(p uint64, at time.Duration, typ encoding.EventType, stack uint64) {
+	b.Event(p, at, typ, stack)
+}
+
+// GoUnblock adds an EventGoUnblock for goroutine g being unblocked by the
+// goroutine running on P p at stack.
+func (b *Builder) GoUnblock(p uint64, at time.Duration, g, stack uint64) {
+	b.Event(p, at, encoding.EventGoUnblock, g, b.seqs[g], stack)
+	b.seqs[g]++
+}
+
+// GoSysCall adds an EventGoSysCall for the goroutine running on P p entering
+// a system call at stack.
+func (b *Builder) GoSysCall(p uint64, at time.Duration, stack uint64) {
+	b.Event(p, at, encoding.EventGoSysCall, stack)
+}
+
+// GoSysBlock adds an EventGoSysBlock for the goroutine running on P p
+// blocking in a system call.
+func (b *Builder) GoSysBlock(p uint64, at time.Duration) {
+	b.Event(p, at, encoding.EventGoSysBlock)
+}
+
+// GoSysExit adds an EventGoSysExit for goroutine g returning from a blocking
+// system call, which is emitted when g is started again on P p.
+func (b *Builder) GoSysExit(p uint64, at time.Duration, g uint64) {
+	b.Event(p, at, encoding.EventGoSysExit, g, b.seqs[g], ticks(at))
+	b.seqs[g]++
+}
+
+// STWStart adds an EventGCSTWStart for P p stopping the world for the given
+// reason, see runtime.stwReason for the values.
+func (b *Builder) STWStart(p uint64, at time.Duration, kind uint64) {
+	b.Event(p, at, encoding.EventGCSTWStart, kind)
+}
+
+// STWDone adds an EventGCSTWDone for P p starting the world again.
+func (b *Builder) STWDone(p uint64, at time.Duration) {
+	b.Event(p, at, encoding.EventGCSTWDone)
+}
+
+// CPUSample adds an EventCPUSample of goroutine g running on P p at stack.
+// The stack is 0 for samples that the runtime couldn't unwind.
+func (b *Builder) CPUSample(p uint64, at time.Duration, g, stack uint64) {
+	// CPU samples have their own timestamp and no delta
+	cur := b.current[p]
+	if cur == nil {
+		b.Batch(p, at)
+		cur = b.current[p]
+	}
+	ev := encoding.Event{Type: encoding.EventCPUSample, Args: []uint64{0, ticks(at), p, g, stack}}
+	cur.events = append(cur.events, event{at: cur.last(), ev: ev})
+}
+
+// UserTaskCreate adds an EventUserTaskCreate for the task with the given id,
+// parent task and name created at stack by the goroutine running on P p.
+func (b *Builder) UserTaskCreate(p uint64, at time.Duration, task, parent uint64, name string, stack uint64) {
+	b.Event(p, at, encoding.EventUserTaskCreate, task, parent, b.String(name), stack)
+}
+
+// UserTaskEnd adds an EventUserTaskEnd for the end of a task.
+func (b *Builder) UserTaskEnd(p uint64, at time.Duration, task, stack uint64) {
+	b.Event(p, at, encoding.EventUserTaskEnd, task, stack)
+}
+
+// UserRegion adds an EventUserRegion for the start (mode 0) or end (mode 1)
+// of a region of a task.
+func (b *Builder) UserRegion(p uint64, at time.Duration, task, mode uint64, name string, stack uint64) {
+	b.Event(p, at, encoding.EventUserRegion, task, mode, b.String(name), stack)
+}
+
+// UserLog adds an EventUserLog for a message logged for a task.
+func (b *Builder) UserLog(p uint64, at time.Duration, task uint64, key, value string, stack uint64) {
+	b.Event(p, at, encoding.EventUserLog, task, b.String(key), stack)
+	cur := b.current[p]
+	if b.err == nil && cur != nil {
+		cur.events[len(cur.events)-1].ev.Str = []byte(value)
+	}
+}
+
+// Encode writes the trace to w. The batches are written in the order of
+// their start time, followed by the frequency, string and stack events. It
+// returns the first error of the methods that added events, if any.
+func (b *Builder) Encode(w io.Writer) error {
+	if b.err != nil {
+		return b.err
+	}
+	enc := encoding.NewEncoderVersion(w, Version)
+	batches := slices.Clone(b.batches)
+	slices.SortStableFunc(batches, func(a, b *batch) int { return cmp.Compare(a.at, b.at) })
+	for _, bt := range batches {
+		if err := enc.Encode(&encoding.Event{Type: encoding.EventBatch, Args: []uint64{bt.p, ticks(bt.at)}}); err != nil {
+			return err
+		}
+		prev := bt.at
+		for _, e := range bt.events {
+			ev := e.ev
+			if ev.Type != encoding.EventCPUSample {
+				ev.Args = slices.Clone(ev.Args)
+				ev.Args[0] = uint64(e.at - prev)
+				prev = e.at
+			}
+			if err := enc.Encode(&ev); err != nil {
+				return err
+			}
+		}
+	}
+	if err := enc.Encode(&encoding.Event{Type: encoding.EventFrequency, Args: []uint64{uint64(Frequency)}}); err != nil {
+		return err
+	}
+	for i := range b.tables {
+		if err := enc.Encode(&b.tables[i]); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// Bytes returns the encoded trace.
+func (b *Builder) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := b.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fail records err if it's the first error.
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// last returns the time of the last event of the batch.
+func (bt *batch) last() time.Duration {
+	if len(bt.events) == 0 {
+		return bt.at
+	}
+	return bt.events[len(bt.events)-1].at
+}
+
+// ticks converts a time since the start of the trace to a timestamp.
+func ticks(at time.Duration) uint64 {
+	return startTicks + uint64(at)
+}
@@ -0,0 +1,130 @@
+package tracebuilder
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/validate"
+	"github.com/stretchr/testify/require"
+	"honnef.co/go/gotraceui/trace"
+)
+
+// TestBuilder tests that a trace with all kinds of events is valid and can
+// be parsed.
+func TestBuilder(t *testing.T) {
+	b := New()
+	main := b.Stack(Frame{Func: "main.main", File: "main.go", Line: 10})
+	worker := b.Stack(Frame{Func: "main.worker", File: "main.go", Line: 20}, Frame{Func: "runtime.goexit", File: "asm.s", Line: 1})
+	recv := b.Stack(Frame{Func: "main.worker", File: "main.go", Line: 22}, Frame{Func: "runtime.goexit", File: "asm.s", Line: 1})
+
+	// Goroutine 1 runs on P 0, goroutine 2 is blocked at the start of the
+	// trace and goroutine 3 is created by goroutine 1.
+	b.GoCreate(1, 0, 1, main, 0)
+	b.GoCreate(1, 0, 2, worker, 0)
+	b.GoWaiting(1, 0, 2)
+	b.ProcStart(0, time.Microsecond, 1)
+	b.GoStart(0, time.Microsecond, 1)
+	b.UserTaskCreate(0, 2*time.Microsecond, 1, 0, "task", main)
+	b.UserRegion(0, 3*time.Microsecond, 1, 0, "region", main)
+	b.UserLog(0, 4*time.Microsecond, 1, "key", "value", main)
+	b.GoCreate(0, 5*time.Microsecond, 3, worker, main)
+	b.GoUnblock(0, 6*time.Microsecond, 2, main)
+	b.CPUSample(0, 7*time.Microsecond, 1, main)
+	b.STWStart(0, 8*time.Microsecond, 1)
+	b.STWDone(0, 9*time.Microsecond)
+	b.UserRegion(0, 10*time.Microsecond, 1, 1, "region", main)
+	b.UserTaskEnd(0, 11*time.Microsecond, 1, main)
+	b.GoEnd(0, 12*time.Microsecond)
+	b.ProcStop(0, 12*time.Microsecond)
+
+	// Goroutines 2 and 3 run on P 1
+	b.ProcStart(1, 7*time.Microsecond, 2)
+	b.GoStart(1, 7*time.Microsecond, 2)
+	b.GoBlock(1, 8*time.Microsecond, encoding.EventGoBlockRecv, recv)
+	b.GoStart(1, 9*time.Microsecond, 3)
+	b.GoSysCall(1, 10*time.Microsecond, worker)
+	b.GoSched(1, 11*time.Microsecond, worker)
+	b.GoStart(1, 12*time.Microsecond, 3)
+	b.GoEnd(1, 13*time.Microsecond)
+	b.ProcStop(1, 13*time.Microsecond)
+
+	data, err := b.Bytes()
+	require.NoError(t, err)
+	problems, err := validate.Validate(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	parsed, err := trace.Parse(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	require.Equal(t, trace.Timestamp(0), parsed.Events[0].Ts)
+	require.Equal(t, trace.Timestamp(13*time.Microsecond), parsed.Events[len(parsed.Events)-1].Ts)
+	var samples int
+	for _, ev := range parsed.Events {
+		if ev.Type == trace.EvCPUSample {
+			samples++
+			require.Equal(t, trace.Timestamp(7*time.Microsecond), ev.Ts)
+		}
+	}
+	require.Equal(t, 1, samples)
+}
+
+// TestBuilderBatches tests that events are split into the batches started
+// with Batch.
+func TestBuilderBatches(t *testing.T) {
+	b := New()
+	b.ProcStart(0, 0, 1)
+	b.Batch(0, 5)
+	b.ProcStop(0, 10)
+
+	data, err := b.Bytes()
+	require.NoError(t, err)
+	var events []encoding.Event
+	dec := encoding.NewDecoder(bytes.NewReader(data))
+	for {
+		var ev encoding.Event
+		if err := dec.Decode(&ev); err != nil {
+			break
+		}
+		events = append(events, ev)
+	}
+	require.Equal(t, []encoding.Event{
+		{Type: encoding.EventBatch, Args: []uint64{0, startTicks}},
+		{Type: encoding.EventProcStart, Args: []uint64{0, 1}},
+		{Type: encoding.EventBatch, Args: []uint64{0, startTicks + 5}},
+		{Type: encoding.EventProcStop, Args: []uint64{5}},
+		{Type: encoding.EventFrequency, Args: []uint64{uint64(Frequency)}},
+	}, events)
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Build func(b *Builder)
+		Want  string
+	}{
+		{"backwards", func(b *Builder) {
+			b.ProcStart(0, 10, 1)
+			b.ProcStop(0, 5)
+		}, "EventProcStop on p 0 at 5ns is before the previous event at 10ns"},
+		{"batch", func(b *Builder) {
+			b.ProcStart(0, 10, 1)
+			b.Batch(0, 5)
+		}, "batch of p 0 at 5ns starts before its previous event at 10ns"},
+		{"negative", func(b *Builder) {
+			b.ProcStart(0, -1, 1)
+		}, "EventProcStart on p 0 at negative time -1ns"},
+		{"no timestamp", func(b *Builder) {
+			b.Event(0, 0, encoding.EventString, 1)
+		}, "EventString has no timestamp delta"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			b := New()
+			test.Build(b)
+			_, err := b.Bytes()
+			require.EqualError(t, err, test.Want)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package validate
+
+import (
+	"cmp"
+	"math"
+)
+
+// cursor holds the events of an M of a go 1.22+ generation that haven't been
+// ordered yet. The Go trace parser keeps the cursors of all Ms in a min-heap
+// by the time of their next event, its frontier, and the order in which it
+// breaks ties between events with the same time depends on the layout of the
+// heap. The heap functions are copied from
+// src/internal/trace/batchcursor.go in the Go source tree, so the ties are
+// broken the same way.
+type cursor struct {
+	events []mEvent
+}
+
+// time returns the time of the next event of c in nanoseconds.
+func (c *cursor) time() int64 {
+	return c.events[0].Ts
+}
+
+// compare compares the time of the next events of c and d.
+func (c *cursor) compare(d *cursor) int {
+	return cmp.Compare(c.time(), d.time())
+}
+
+func heapInsert(heap []*cursor, c *cursor) []*cursor {
+	// Add the cursor to the end of the heap.
+	heap = append(heap, c)
+
+	// Sift the new entry up to the right place.
+	heapSiftUp(heap, len(heap)-1)
+	return heap
+}
+
+func heapUpdate(heap []*cursor, i int) {
+	// Try to sift up.
+	if heapSiftUp(heap, i) != i {
+		return
+	}
+	// Try to sift down, if sifting up failed.
+	heapSiftDown(heap, i)
+}
+
+func heapRemove(heap []*cursor, i int) []*cursor {
+	// Sift index i up to the root, ignoring actual values.
+	for i > 0 {
+		heap[(i-1)/2], heap[i] = heap[i], heap[(i-1)/2]
+		i = (i - 1) / 2
+	}
+	// Swap the root with the last element, then remove it.
+	heap[0], heap[len(heap)-1] = heap[len(heap)-1], heap[0]
+	heap = heap[:len(heap)-1]
+	// Sift the root down.
+	heapSiftDown(heap, 0)
+	return heap
+}
+
+func heapSiftUp(heap []*cursor, i int) int {
+	for i > 0 && heap[(i-1)/2].time() > heap[i].time() {
+		heap[(i-1)/2], heap[i] = heap[i], heap[(i-1)/2]
+		i = (i - 1) / 2
+	}
+	return i
+}
+
+func heapSiftDown(heap []*cursor, i int) int {
+	for {
+		m := min3(heap, i, 2*i+1, 2*i+2)
+		if m == i {
+			// Heap invariant already applies.
+			break
+		}
+		heap[i], heap[m] = heap[m], heap[i]
+		i = m
+	}
+	return i
+}
+
+func min3(b []*cursor, i0, i1, i2 int) int {
+	minIdx := i0
+	minT := int64(math.MaxInt64)
+	if i0 < len(b) {
+		minT = b[i0].time()
+	}
+	if i1 < len(b) {
+		if t := b[i1].time(); t < minT {
+			minT = t
+			minIdx = i1
+		}
+	}
+	if i2 < len(b) {
+		if t := b[i2].time(); t < minT {
+			minT = t
+			minIdx = i2
+		}
+	}
+	return minIdx
+}
@@ -0,0 +1,641 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/state"
+)
+
+// Problem is a problem found in a trace.
+type Problem struct {
+	// Offset is the offset of the event with the problem in the trace.
+	Offset int64
+	// Index is the index of the event with the problem, the first event
+	// after the header has index 0.
+	Index int
+	// Message describes the problem.
+	Message string
+}
+
+// String returns the problem in a human readable form.
+func (p Problem) String() string {
+	return fmt.Sprintf("offset %d, event %d: %s", p.Offset, p.Index, p.Message)
+}
+
+// Validate checks the trace of the given size read from r and returns the
+// problems it finds, ordered by offset. The error is only set if r can't be
+// read. The checks are:
+//
+//   - Framing: the header, the encoding of the events and their number of
+//     arguments. Decoding stops at the first event that can't be decoded,
+//     the following checks only cover the events before it.
+//   - Batches: the length of go 1.22+ batches and the frequency event.
+//   - References: every string and stack that is referenced is defined, and
+//     only once.
+//   - Timestamps: the events of a P (or M for go 1.22+ traces) don't go back
+//     in time.
+//   - Goroutines: the events of every goroutine are legal transitions of its
+//     state, e.g. only runnable goroutines can start running. The events of
+//     different Ps are merged by timestamp, preferring legal transitions for
+//     events with the same timestamp. This is only checked for traces from
+//     go 1.11 to 1.21.
+//   - Statuses: the events of go 1.22+ traces are ordered like the Go trace
+//     parser orders them within each generation. Every event that changes
+//     the state of a goroutine, P or the GC must have the next sequence
+//     number and find it in the status it requires, and the status events
+//     at the start of a generation must match the state at the end of the
+//     previous one.
+func Validate(r io.ReaderAt, size int64) ([]Problem, error) {
+	v := &validator{
+		strings:    make(map[tableKey]bool),
+		stacks:     make(map[tableKey]bool),
+		stringUses: make(map[tableKey]*use),
+		stackUses:  make(map[tableKey]*use),
+		lastTicks:  make(map[int64]uint64),
+		gs:         make(map[int64]uint64),
+		queues:     make(map[uint64][]gEvent),
+		ms:         make(map[int64][]mEvent),
+		first:      true,
+	}
+	if err := v.decode(encoding.NewDecoder(io.NewSectionReader(r, 0, size))); err != nil {
+		return nil, err
+	}
+	v.checkReferences()
+	v.checkGoroutines()
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		return v.problems[i].Offset < v.problems[j].Offset
+	})
+	return v.problems, nil
+}
+
+// validator holds the state of Validate.
+type validator struct {
+	version  int
+	problems []Problem
+	index    int // index of the current event
+
+	// tables
+	freq       bool              // true if there is a frequency event
+	strings    map[tableKey]bool // defined strings
+	stacks     map[tableKey]bool // defined stacks
+	stringUses map[tableKey]*use // first use of every referenced string
+	stackUses  map[tableKey]*use // first use of every referenced stack
+
+	// current batch
+	gen        uint64 // generation (go 1.22+)
+	p          int64  // P of the batch before go 1.22, M for go 1.22+
+	ticks      uint64 // timestamp of the last event
+	batch      int64  // offset of the go 1.22+ batch header or -1
+	batchIndex int    // index of the go 1.22+ batch header
+	batchData  int64  // offset of the first event of the go 1.22+ batch
+	batchSize  uint64 // length of the go 1.22+ batch
+
+	lastTicks map[int64]uint64 // timestamp of the last event of each P or M
+
+	// goroutine events before go 1.22
+	gs     map[int64]uint64    // goroutine running on each P
+	queues map[uint64][]gEvent // goroutine events of each P in the order of the trace
+
+	// events of go 1.22+
+	v2      *state.V2          // state at the end of the previous generation
+	ms      map[int64][]mEvent // timed events of each M in the current generation
+	mOrder  []int64            // Ms of the current generation in the order of their first batch
+	genFreq uint64             // frequency of the current generation or 0
+	first   bool               // true until the first generation is checked
+}
+
+// tableKey identifies an entry in the string or stack table. Go 1.22+
+// traces have separate tables for every generation, older traces only have
+// generation 0.
+type tableKey struct {
+	gen uint64
+	id  uint64
+}
+
+// use is the first use of a string or stack.
+type use struct {
+	offset int64
+	index  int
+	count  int
+}
+
+// gEvent is an event that changes the state of a goroutine.
+type gEvent struct {
+	offset int64
+	index  int
+	ticks  uint64
+	typ    encoding.EventType
+	g      uint64
+}
+
+// mEvent is a timed event of a go 1.22+ trace with the M of its batch.
+type mEvent struct {
+	offset int64
+	index  int
+	batch  int // index of the batch header
+	encoding.ContextEvent
+}
+
+// add adds a problem with the event at offset.
+func (v *validator) add(offset int64, index int, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Offset: offset, Index: index, Message: fmt.Sprintf(format, args...)})
+}
+
+// decode reads the events from dec and checks them one by one.
+func (v *validator) decode(dec *encoding.Decoder) error {
+	v.batch = -1
+	var ev encoding.Event
+	for {
+		offset := dec.Offset()
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			break
+		}
+		var decodeErr *encoding.DecodeError
+		if errors.As(err, &decodeErr) {
+			v.add(decodeErr.Offset, v.index, "can't decode event: %v", decodeErr.Err)
+			if v.version == 0 {
+				// Not a trace
+				return nil
+			}
+			// The events of the last generation are incomplete
+			v.batch, v.ms = -1, nil
+			break
+		} else if err != nil {
+			return err
+		}
+		if offset == 0 {
+			// Skip the header of the trace
+			offset = 16
+		}
+		v.version = dec.Version()
+		if err := v.event(offset, dec.Offset(), &ev); err != nil {
+			return err
+		}
+		v.index++
+	}
+	if v.version == 0 {
+		return nil
+	}
+	v.endBatch(dec.Offset())
+	v.checkGeneration()
+	if !v.freq {
+		v.add(dec.Offset(), v.index, "no frequency event, the trace may be truncated")
+	}
+	return nil
+}
+
+// event checks the event ev that starts at offset and ends at end.
+func (v *validator) event(offset, end int64, ev *encoding.Event) error {
+	switch ev.Type {
+	case encoding.EventBatch:
+		batch, err := ev.AsBatch(v.version)
+		if err != nil {
+			return err
+		}
+		v.p, v.ticks = int64(batch.P), batch.Ts
+		return nil
+	case encoding.EventV2Batch:
+		batch, err := ev.AsV2Batch(v.version)
+		if err != nil {
+			return err
+		}
+		v.endBatch(offset)
+		if batch.Gen != v.gen {
+			v.checkGeneration()
+		}
+		v.gen, v.p, v.ticks = batch.Gen, int64(batch.M), batch.Ts
+		v.batch, v.batchIndex, v.batchData, v.batchSize = offset, v.index, end, batch.Size
+		return nil
+	case encoding.EventV2ExperimentalBatch:
+		v.endBatch(offset)
+		return nil
+	case encoding.EventV2EndOfGeneration:
+		// Go 1.26+ writes this event between the batches of two
+		// generations.
+		v.endBatch(offset)
+		v.checkGeneration()
+		return nil
+	case encoding.EventFrequency, encoding.EventV2Frequency:
+		v.freq = true
+		if ev.Type == encoding.EventV2Frequency {
+			v.genFreq = ev.Args[0]
+		}
+	case encoding.EventString, encoding.EventV2String:
+		v.define(v.strings, "string", offset, ev.Args[0])
+	case encoding.EventStack, encoding.EventV2Stack:
+		v.define(v.stacks, "stack", offset, ev.Args[0])
+		for i := 2; i+3 < len(ev.Args) && v.version >= 1007; i += 4 {
+			v.use(v.stringUses, offset, ev.Args[i+1])
+			v.use(v.stringUses, offset, ev.Args[i+2])
+		}
+	}
+
+	// Record the strings and stacks the event refers to
+	strings, stacks := encoding.RefArgs(v.version, ev.Type)
+	for _, i := range strings {
+		v.use(v.stringUses, offset, ev.Args[i])
+	}
+	for _, i := range stacks {
+		if v.version < 1007 && ev.Type == encoding.EventGoCreate && i == len(ev.Args)-2 {
+			// Before go 1.7 the NewStack argument is the PC the goroutine
+			// starts at.
+			continue
+		}
+		v.use(v.stackUses, offset, ev.Args[i])
+	}
+
+	// CPU samples before go 1.22 always have a timestamp delta of 0
+	if delta, ok := ev.TsDelta(v.version); ok && ev.Type != encoding.EventCPUSample {
+		v.ticks += delta
+		v.checkTicks(offset, ev.Type)
+	}
+	if v.version >= 1011 && v.version < 1022 {
+		v.goroutineEvent(offset, ev)
+	} else if _, ok := ev.TsDelta(v.version); ok && v.version >= 1022 && v.ms != nil && ev.Type != encoding.EventV2ClockSnapshot {
+		// Clock snapshots belong to the sync batch, which isn't ordered
+		if _, ok := v.ms[v.p]; !ok {
+			v.mOrder = append(v.mOrder, v.p)
+		}
+		cp := encoding.Event{Type: ev.Type, Args: slices.Clone(ev.Args)}
+		v.ms[v.p] = append(v.ms[v.p], mEvent{offset, v.index, v.batchIndex, encoding.ContextEvent{Event: cp, Ticks: v.ticks, M: v.p}})
+	}
+	return nil
+}
+
+// checkTicks checks that the timed event at offset doesn't happen before the
+// previous event of its P or M. The batch headers are not checked themselves,
+// because go 1.19 to 1.21 write the CPU samples of all Ps into batches of P 0
+// that start whenever the samples are flushed.
+func (v *validator) checkTicks(offset int64, typ encoding.EventType) {
+	if v.version >= 1022 && v.p == -1 {
+		// The events of batches without an M, e.g. the goroutine statuses
+		// at the start of a generation, are not ordered.
+		return
+	}
+	what := "P"
+	if v.version >= 1022 {
+		what = "M"
+	}
+	if last, ok := v.lastTicks[v.p]; ok && v.ticks < last {
+		v.add(offset, v.index, "%v event of %s %d at tick %d before the previous event of the %s at tick %d", typ, what, v.p, v.ticks, what, last)
+	}
+	v.lastTicks[v.p] = v.ticks
+}
+
+// endBatch checks the length of the current go 1.22+ batch that ends at
+// offset.
+func (v *validator) endBatch(offset int64) {
+	if v.batch >= 0 && uint64(offset-v.batchData) != v.batchSize {
+		v.add(v.batch, v.batchIndex, "batch has a length of %d bytes, but the next batch starts after %d bytes", v.batchSize, offset-v.batchData)
+	}
+	v.batch = -1
+}
+
+// define records the definition of the string or stack id at offset.
+func (v *validator) define(defined map[tableKey]bool, what string, offset int64, id uint64) {
+	key := tableKey{v.gen, id}
+	if defined[key] {
+		v.add(offset, v.index, "%s %d is defined more than once", what, id)
+	}
+	defined[key] = true
+}
+
+// use records a reference to the string or stack id at offset. The id 0
+// stands for no string or stack.
+func (v *validator) use(uses map[tableKey]*use, offset int64, id uint64) {
+	if id == 0 {
+		return
+	}
+	key := tableKey{v.gen, id}
+	if u, ok := uses[key]; ok {
+		u.count++
+	} else {
+		uses[key] = &use{offset: offset, index: v.index, count: 1}
+	}
+}
+
+// checkReferences reports the strings and stacks that are referenced, but
+// not defined.
+func (v *validator) checkReferences() {
+	for key, u := range v.stringUses {
+		if !v.strings[key] {
+			v.add(u.offset, u.index, "string %d is not defined, it's referenced %d times", key.id, u.count)
+		}
+	}
+	for key, u := range v.stackUses {
+		if !v.stacks[key] {
+			v.add(u.offset, u.index, "stack %d is not defined, it's referenced %d times", key.id, u.count)
+		}
+	}
+}
+
+// transition is the state change of a goroutine caused by an event.
+type transition struct {
+	from state.GStatus
+	to   state.GStatus
+}
+
+// gCreated is the status of goroutines that haven't been created yet. It's
+// distinct from the statuses of the state package.
+const gCreated state.GStatus = -1
+
+// transitions are the state changes of goroutines before go 1.22. These are
+// the transitions that pprof.Convert enforces, plus the end of goroutines.
+var transitions = map[encoding.EventType]transition{
+	encoding.EventGoCreate:       {gCreated, state.GRunnable},
+	encoding.EventGoStart:        {state.GRunnable, state.GRunning},
+	encoding.EventGoStartLocal:   {state.GRunnable, state.GRunning},
+	encoding.EventGoStartLabel:   {state.GRunnable, state.GRunning},
+	encoding.EventGoSysCall:      {state.GRunning, state.GRunning},
+	encoding.EventGoSched:        {state.GRunning, state.GRunnable},
+	encoding.EventGoPreempt:      {state.GRunning, state.GRunnable},
+	encoding.EventGoBlock:        {state.GRunning, state.GWaiting},
+	encoding.EventGoBlockSend:    {state.GRunning, state.GWaiting},
+	encoding.EventGoBlockRecv:    {state.GRunning, state.GWaiting},
+	encoding.EventGoBlockSelect:  {state.GRunning, state.GWaiting},
+	encoding.EventGoBlockSync:    {state.GRunning, state.GWaiting},
+	encoding.EventGoBlockCond:    {state.GRunning, state.GWaiting},
+	encoding.EventGoBlockNet:     {state.GRunning, state.GWaiting},
+	encoding.EventGoBlockGC:      {state.GRunning, state.GWaiting},
+	encoding.EventGoSleep:        {state.GRunning, state.GWaiting},
+	encoding.EventGoSysBlock:     {state.GRunning, state.GWaiting},
+	encoding.EventGoUnblock:      {state.GWaiting, state.GRunnable},
+	encoding.EventGoUnblockLocal: {state.GWaiting, state.GRunnable},
+	encoding.EventGoSysExit:      {state.GWaiting, state.GRunnable},
+	encoding.EventGoSysExitLocal: {state.GWaiting, state.GRunnable},
+	encoding.EventGoWaiting:      {state.GRunnable, state.GWaiting},
+	encoding.EventGoInSyscall:    {state.GRunnable, state.GWaiting},
+	encoding.EventGoEnd:          {state.GRunning, state.GDead},
+	encoding.EventGoStop:         {state.GRunning, state.GDead},
+}
+
+// statusNames are the names of the goroutine statuses used in problems.
+var statusNames = map[state.GStatus]string{
+	gCreated:        "not created",
+	state.GDead:     "dead",
+	state.GRunnable: "runnable",
+	state.GRunning:  "running",
+	state.GWaiting:  "waiting",
+}
+
+// goroutineEvent records the event ev at offset if it changes the state of a
+// goroutine and tracks the goroutine running on the P of the batch.
+func (v *validator) goroutineEvent(offset int64, ev *encoding.Event) {
+	t, ok := transitions[ev.Type]
+	if !ok {
+		return
+	}
+
+	// The goroutine is given by the event or the one running on the P
+	g := v.gs[v.p]
+	if i, ok := encoding.ArgIndex(v.version, ev.Type, "NewG"); ok {
+		g = ev.Args[i]
+	} else if i, ok := encoding.ArgIndex(v.version, ev.Type, "G"); ok {
+		g = ev.Args[i]
+	}
+	switch {
+	case t.to == state.GRunning:
+		v.gs[v.p] = g
+	case t.from == state.GRunning:
+		v.gs[v.p] = 0
+	}
+
+	if g == 0 {
+		v.add(offset, v.index, "%v event on P %d without a running goroutine", ev.Type, v.p)
+		return
+	}
+	v.queues[uint64(v.p)] = append(v.queues[uint64(v.p)], gEvent{offset: offset, index: v.index, ticks: v.ticks, typ: ev.Type, g: g})
+}
+
+// checkGoroutines replays the goroutine events of all Ps ordered by
+// timestamp and reports illegal transitions. Like the parser of go tool
+// trace, the next event is the earliest one that is a legal transition. If
+// there is no such event, the earliest event is reported and its goroutine
+// is moved to the state after the event.
+func (v *validator) checkGoroutines() {
+	statuses := make(map[uint64]state.GStatus)
+	status := func(g uint64) state.GStatus {
+		if s, ok := statuses[g]; ok {
+			return s
+		}
+		return gCreated
+	}
+	ps := state.SortedKeys(v.queues)
+	for {
+		var next, earliest *gEvent
+		var nextP, earliestP uint64
+		for _, p := range ps {
+			queue := v.queues[p]
+			if len(queue) == 0 {
+				continue
+			}
+			ev := &queue[0]
+			if earliest == nil || ev.ticks < earliest.ticks {
+				earliest, earliestP = ev, p
+			}
+			if status(ev.g) == transitions[ev.typ].from && (next == nil || ev.ticks < next.ticks) {
+				next, nextP = ev, p
+			}
+		}
+		if earliest == nil {
+			return
+		} else if next == nil {
+			t := transitions[earliest.typ]
+			v.add(earliest.offset, earliest.index, "%v event for goroutine %d that is %s, but must be %s", earliest.typ, earliest.g, statusNames[status(earliest.g)], statusNames[t.from])
+			next, nextP = earliest, earliestP
+		}
+		statuses[next.g] = transitions[next.typ].to
+		v.queues[nextP] = v.queues[nextP][1:]
+	}
+}
+
+// v2GStatusNames and v2PStatusNames are the names of the go 1.22+ goroutine
+// and P statuses used in problems.
+var (
+	v2GStatusNames = map[state.V2GStatus]string{
+		state.V2GRunnable: "runnable",
+		state.V2GRunning:  "running",
+		state.V2GSyscall:  "in a syscall",
+		state.V2GWaiting:  "waiting",
+	}
+	v2PStatusNames = map[state.V2PStatus]string{
+		state.V2PRunning:          "running",
+		state.V2PIdle:             "idle",
+		state.V2PSyscall:          "in a syscall",
+		state.V2PSyscallAbandoned: "in an abandoned syscall",
+	}
+)
+
+// statusName returns the name of status in names or its number if it's not
+// a valid status.
+func statusName[S ~uint64](names map[S]string, status S) string {
+	if name, ok := names[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("in the invalid status %d", uint64(status))
+}
+
+// checkGeneration replays the events of the current go 1.22+ generation in
+// the order of the Go trace parser and reports the events that it would
+// reject. Like the parser, the next event is the earliest one that is ready,
+// and ties are broken by its frontier of the Ms. If there is no such event,
+// the earliest event is reported and applied anyway, so the following events
+// can still be checked. The state is kept for the next generation.
+func (v *validator) checkGeneration() {
+	if len(v.ms) == 0 {
+		return
+	}
+	defer func() {
+		v.ms, v.mOrder, v.genFreq, v.first = make(map[int64][]mEvent), nil, 0, false
+	}()
+	if v.v2 == nil {
+		v.v2 = state.NewV2(v.version)
+	}
+
+	// The parser converts the timestamps to nanoseconds batch by batch and
+	// compares those.
+	freq := 1.0
+	if v.genFreq != 0 {
+		freq = 1 / (float64(v.genFreq) / 1e9)
+	}
+	ns := func(ticks uint64) int64 { return int64(float64(ticks) * freq) }
+	var frontier []*cursor
+	for _, m := range v.mOrder {
+		evs := v.ms[m]
+		var ts int64
+		for i := range evs {
+			ev := &evs[i]
+			delta, _ := ev.TsDelta(v.version)
+			if i == 0 || ev.batch != evs[i-1].batch {
+				ts = ns(ev.Ticks - delta)
+			}
+			ts += ns(delta)
+			ev.Ts = ts
+		}
+		frontier = heapInsert(frontier, &cursor{events: evs})
+	}
+
+	for len(frontier) > 0 {
+		if v.advance(&frontier, 0, false) {
+			continue
+		}
+		slices.SortFunc(frontier, (*cursor).compare)
+		advanced := false
+		for i := 1; i < len(frontier) && !advanced; i++ {
+			advanced = v.advance(&frontier, i, false)
+		}
+		if !advanced {
+			ev := &frontier[0].events[0]
+			v.add(ev.offset, ev.index, "%s", v.notReady(&ev.ContextEvent))
+			v.advance(&frontier, 0, true)
+		}
+	}
+}
+
+// advance applies the next event of the cursor i of the frontier if it's
+// ready or force is true, and returns true if it was applied.
+func (v *validator) advance(frontier *[]*cursor, i int, force bool) bool {
+	c := (*frontier)[i]
+	ev := &c.events[0]
+	if !force && !v.v2.Ready(&ev.ContextEvent) {
+		return false
+	}
+	v.checkStatus(ev)
+	if err := v.v2.Update(&ev.ContextEvent); err != nil {
+		v.add(ev.offset, ev.index, "%v", err)
+	}
+	c.events = c.events[1:]
+	if len(c.events) > 0 {
+		heapUpdate(*frontier, i)
+	} else {
+		*frontier = heapRemove(*frontier, i)
+	}
+	return true
+}
+
+// notReady describes why the Go trace parser can't order ev, which isn't
+// ready in the current state.
+func (v *validator) notReady(ev *encoding.ContextEvent) string {
+	s := v.v2
+	switch ev.Type {
+	case encoding.EventV2GoStart, encoding.EventV2GoUnblock,
+		encoding.EventV2GoSwitch, encoding.EventV2GoSwitchDestroy:
+		g, _ := encoding.ArgIndex(v.version, ev.Type, "G")
+		seq, _ := encoding.ArgIndex(v.version, ev.Type, "GSeq")
+		want := state.V2GWaiting
+		if ev.Type == encoding.EventV2GoStart {
+			want = state.V2GRunnable
+		}
+		gs, ok := s.Gs[ev.Args[g]]
+		if !ok {
+			return fmt.Sprintf("%v event for goroutine %d that has no status", ev.Type, ev.Args[g])
+		} else if gs.Status != want {
+			return fmt.Sprintf("%v event for goroutine %d that is %s, but must be %s", ev.Type, ev.Args[g], statusName(v2GStatusNames, gs.Status), statusName(v2GStatusNames, want))
+		}
+		return fmt.Sprintf("%v event for goroutine %d with sequence number %d, but the next one is %d", ev.Type, ev.Args[g], ev.Args[seq], gs.Seq+1)
+	case encoding.EventV2ProcStart, encoding.EventV2ProcSteal:
+		p, _ := encoding.ArgIndex(v.version, ev.Type, "P")
+		seq, _ := encoding.ArgIndex(v.version, ev.Type, "PSeq")
+		ps, ok := s.Ps[ev.Args[p]]
+		if !ok {
+			return fmt.Sprintf("%v event for P %d that has no status", ev.Type, ev.Args[p])
+		} else if ev.Args[seq] != ps.Seq+1 {
+			return fmt.Sprintf("%v event for P %d with sequence number %d, but the next one is %d", ev.Type, ev.Args[p], ev.Args[seq], ps.Seq+1)
+		} else if ev.Type == encoding.EventV2ProcSteal {
+			return fmt.Sprintf("%v event for P %d that is %s, but must be in a syscall", ev.Type, ev.Args[p], statusName(v2PStatusNames, ps.Status))
+		} else if ps.Status != state.V2PIdle {
+			return fmt.Sprintf("%v event for P %d that is %s, but must be idle", ev.Type, ev.Args[p], statusName(v2PStatusNames, ps.Status))
+		}
+		return fmt.Sprintf("%v event for P %d on M %d that already holds P %d", ev.Type, ev.Args[p], ev.M, s.M(ev.M).P)
+	case encoding.EventV2GoSyscallEndBlocked:
+		return fmt.Sprintf("%v event on M %d before its P was taken away", ev.Type, ev.M)
+	case encoding.EventV2GCActive, encoding.EventV2GCBegin, encoding.EventV2GCEnd:
+		seq, _ := encoding.ArgIndex(v.version, ev.Type, "Seq")
+		return fmt.Sprintf("%v event with sequence number %d, but the next one is %d", ev.Type, ev.Args[seq], s.GCSeq+1)
+	}
+	return fmt.Sprintf("%v event can't be ordered", ev.Type)
+}
+
+// abandoned returns true if a P that was in a syscall can have the status to,
+// because it was abandoned in the syscall since, like the Go trace parser
+// allows.
+func abandoned(from, to state.V2PStatus) bool {
+	return to == state.V2PSyscallAbandoned && (from == state.V2PSyscall || from == state.V2PSyscallAbandoned)
+}
+
+// checkStatus reports the goroutine and P status events of ev that don't
+// match the state at the end of the previous generation. Goroutines can only
+// appear with a status in the first generation, later they must be created.
+func (v *validator) checkStatus(ev *mEvent) {
+	s := v.v2
+	switch ev.Type {
+	case encoding.EventV2GoStatus, encoding.EventV2GoStatusStack:
+		g, _ := encoding.ArgIndex(v.version, ev.Type, "G")
+		i, _ := encoding.ArgIndex(v.version, ev.Type, "Status")
+		status := state.V2GStatus(ev.Args[i])
+		if _, ok := v2GStatusNames[status]; !ok {
+			v.add(ev.offset, ev.index, "%v event for goroutine %d with the invalid status %d", ev.Type, ev.Args[g], status)
+		} else if gs, ok := s.Gs[ev.Args[g]]; ok && gs.Status != status {
+			v.add(ev.offset, ev.index, "%v event for goroutine %d that is %s, but was %s", ev.Type, ev.Args[g], statusName(v2GStatusNames, status), statusName(v2GStatusNames, gs.Status))
+		} else if !ok && !v.first {
+			v.add(ev.offset, ev.index, "%v event for goroutine %d that wasn't created in a previous generation", ev.Type, ev.Args[g])
+		}
+	case encoding.EventV2ProcStatus:
+		status, err := ev.AsV2ProcStatus(v.version)
+		if err != nil {
+			return
+		}
+		to := state.V2PStatus(status.Status)
+		if _, ok := v2PStatusNames[to]; !ok {
+			v.add(ev.offset, ev.index, "%v event for P %d with the invalid status %d", ev.Type, status.P, to)
+		} else if ps, ok := s.Ps[status.P]; ok && ps.Status != to && !abandoned(ps.Status, to) {
+			v.add(ev.offset, ev.index, "%v event for P %d that is %s, but was %s", ev.Type, status.P, statusName(v2PStatusNames, to), statusName(v2PStatusNames, ps.Status))
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package validate
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felixge/traceutils/internal/tracetest"
+	"github.com/felixge/traceutils/pkg/encoding"
+	"github.com/felixge/traceutils/pkg/state"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidate tests that the traces in testdata have no problems.
+func TestValidate(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "testdata", "*", "*.trace"))
+	require.NoError(t, err)
+	files = append(files, filepath.Join("..", "..", "testdata", "1.19", "trace.bin"))
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			problems, err := Validate(bytes.NewReader(data), int64(len(data)))
+			require.NoError(t, err)
+			require.Empty(t, problems)
+		})
+	}
+}
+
+// TestValidateProblems tests that corrupted traces are reported.
+func TestValidateProblems(t *testing.T) {
+	tests := []struct {
+		Name      string
+		GoVersion string
+		Trace     string
+		// Corrupt modifies the decoded events of the trace.
+		Corrupt func(events []encoding.Event) []encoding.Event
+		Want    string
+	}{
+		{
+			Name:      "undefined stack",
+			GoVersion: "1.21",
+			Trace:     "task.trace",
+			Corrupt: func(events []encoding.Event) []encoding.Event {
+				i := indexOf(events, encoding.EventStack, 0)
+				return append(events[:i], events[i+1:]...)
+			},
+			Want: "is not defined, it's referenced",
+		},
+		{
+			Name:      "duplicate string",
+			GoVersion: "1.21",
+			Trace:     "task.trace",
+			Corrupt: func(events []encoding.Event) []encoding.Event {
+				i := indexOf(events, encoding.EventString, 0)
+				return append(events[:i+1], events[i:]...)
+			},
+			Want: "is defined more than once",
+		},
+		{
+			Name:      "timestamp",
+			GoVersion: "1.21",
+			Trace:     "test-encoding-json.trace",
+			Corrupt: func(events []encoding.Event) []encoding.Event {
+				// Move all batches but the first to the start of the
+				// trace
+				for i := indexOf(events, encoding.EventBatch, 1); i < len(events); i++ {
+					if events[i].Type == encoding.EventBatch {
+						events[i].Args[len(events[i].Args)-1] = 0
+					}
+				}
+				return events
+			},
+			Want: "before the previous event of the P",
+		},
+		{
+			Name:      "goroutine",
+			GoVersion: "1.21",
+			Trace:     "task.trace",
+			Corrupt: func(events []encoding.Event) []encoding.Event {
+				i := indexOf(events, encoding.EventGoCreate, 0)
+				return append(events[:i+1], events[i:]...)
+			},
+			Want: "that is runnable, but must be not created",
+		},
+		{
+			Name:      "batch length",
+			GoVersion: "1.25",
+			Trace:     "test-encoding-json.trace",
+			Corrupt: func(events []encoding.Event) []encoding.Event {
+				i := indexOf(events, encoding.EventV2Batch, 1)
+				events[i].Args[3]++
+				return events
+			},
+			Want: "batch has a length of",
+		},
+		{
+			Name:      "sequence number",
+			GoVersion: "1.25",
+			Trace:     "test-encoding-json.trace",
+			Corrupt: func(events []encoding.Event) []encoding.Event {
+				i := indexOf(events, encoding.EventV2GoStart, 0)
+				events[i].Args[2]++
+				return events
+			},
+			Want: "with sequence number 9, but the next one is 8",
+		},
+		{
+			Name:      "status",
+			GoVersion: "1.26",
+			Trace:     "generations.trace",
+			Corrupt: func(events []encoding.Event) []encoding.Event {
+				// Change the status of a goroutine in the last
+				// generation
+				i := len(events) - 1
+				for events[i].Type != encoding.EventV2GoStatus {
+					i--
+				}
+				events[i].Args[3] = uint64(state.V2GWaiting + state.V2GRunnable - state.V2GStatus(events[i].Args[3]))
+				return events
+			},
+			Want: "that is runnable, but was waiting",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			data := readTrace(t, test.GoVersion, test.Trace)
+			corrupted := encodeEvents(t, data, test.Corrupt)
+			problems, err := Validate(bytes.NewReader(corrupted), int64(len(corrupted)))
+			require.NoError(t, err)
+			require.Contains(t, messages(problems), test.Want)
+		})
+	}
+}
+
+// TestValidateEndOfGeneration tests that the end of generation event that
+// follows the last batch of a generation in go 1.26+ traces doesn't change
+// the length of that batch.
+func TestValidateEndOfGeneration(t *testing.T) {
+	data := readTrace(t, "1.25", "test-encoding-json.trace")
+	var out bytes.Buffer
+	enc := encoding.NewEncoderVersion(&out, 1026)
+	dec := encoding.NewDecoder(bytes.NewReader(data))
+	for {
+		var ev encoding.Event
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, enc.Encode(&ev))
+	}
+	require.NoError(t, enc.Encode(&encoding.Event{Type: encoding.EventV2EndOfGeneration}))
+	require.NoError(t, enc.Close())
+
+	problems, err := Validate(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	require.Empty(t, problems)
+}
+
+// TestValidateTies tests that events of different Ms with the same timestamp
+// are ordered like the Go trace parser orders them. The parser starts with
+// M 2, whose first batch comes first, and accepts the trace, while starting
+// with M 1 would reset the sequence number of P 0 before M 2 starts it.
+func TestValidateTies(t *testing.T) {
+	const version = 1023
+	var (
+		status = func(delta uint64, p uint64, s state.V2PStatus) encoding.Event {
+			return encoding.Event{Type: encoding.EventV2ProcStatus, Args: []uint64{delta, p, uint64(s)}}
+		}
+		start = func(delta uint64, p, seq uint64) encoding.Event {
+			return encoding.Event{Type: encoding.EventV2ProcStart, Args: []uint64{delta, p, seq}}
+		}
+		stop = encoding.Event{Type: encoding.EventV2ProcStop, Args: []uint64{0}}
+	)
+	batches := []struct {
+		M      uint64
+		Ts     uint64
+		Events []encoding.Event
+	}{
+		{^uint64(0), 100, []encoding.Event{{Type: encoding.EventV2Frequency, Args: []uint64{1e9}}}},
+		{2, 100, []encoding.Event{status(0, 0, state.V2PIdle), start(100, 0, 1), stop}},
+		{1, 200, []encoding.Event{status(0, 0, state.V2PIdle), start(100, 0, 1), stop}},
+	}
+
+	var out bytes.Buffer
+	enc := encoding.NewEncoderVersion(&out, version)
+	for _, b := range batches {
+		var size int
+		for i := range b.Events {
+			size += encoding.EncodedSize(version, &b.Events[i])
+		}
+		header := encoding.Event{Type: encoding.EventV2Batch, Args: []uint64{1, b.M, b.Ts, uint64(size)}}
+		require.NoError(t, enc.Encode(&header))
+		for i := range b.Events {
+			require.NoError(t, enc.Encode(&b.Events[i]))
+		}
+	}
+	require.NoError(t, enc.Close())
+	tracetest.ReadEvents(t, out.Bytes())
+
+	problems, err := Validate(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	require.Empty(t, problems)
+}
+
+// TestValidateTruncated tests that truncated traces are reported.
+func TestValidateTruncated(t *testing.T) {
+	data := readTrace(t, "1.21", "test-encoding-json.trace")
+	data = data[:len(data)/4]
+	problems, err := Validate(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Contains(t, messages(problems), "can't decode event")
+	require.Contains(t, messages(problems), "no frequency event")
+}
+
+// messages returns the messages of the problems, one per line.
+func messages(problems []Problem) string {
+	var lines []string
+	for _, p := range problems {
+		lines = append(lines, p.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readTrace reads a trace from the testdata directory.
+func readTrace(t *testing.T, goVersion, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", goVersion, name))
+	require.NoError(t, err)
+	return data
+}
+
+// encodeEvents decodes the events of a trace, passes them to corrupt and
+// encodes the result.
+func encodeEvents(t *testing.T, data []byte, corrupt func([]encoding.Event) []encoding.Event) []byte {
+	var events []encoding.Event
+	dec := encoding.NewDecoder(bytes.NewReader(data))
+	for {
+		var ev encoding.Event
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		events = append(events, ev)
+	}
+
+	var out bytes.Buffer
+	enc := encoding.NewEncoderFor(&out, dec)
+	for _, ev := range corrupt(events) {
+		require.NoError(t, enc.Encode(&ev))
+	}
+	require.NoError(t, enc.Close())
+	return out.Bytes()
+}
+
+// indexOf returns the index of the nth event of the given type.
+func indexOf(events []encoding.Event, typ encoding.EventType, n int) int {
+	for i, ev := range events {
+		if ev.Type == typ {
+			if n == 0 {
+				return i
+			}
+			n--
+		}
+	}
+	return -1
+}
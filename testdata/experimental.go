@@ -0,0 +1,64 @@
+//go:build ignore
+
+// This program adds an experimental batch to every generation of
+// testdata/1.26/generations.trace and writes the result to stdout. The batches
+// belong to the AllocFree experiment and hold a type name like the ones the
+// runtime writes with GODEBUG=traceallocfree=1. A trace recorded with that
+// setting can't be used instead, because it also contains experimental
+// events, which traceutils can't decode. It's used for
+// testdata/1.26/experimental.trace.
+//
+// Run it from the root of the repository.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/felixge/traceutils/pkg/encoding"
+)
+
+func main() {
+	in, err := os.Open("testdata/1.26/generations.trace")
+	if err != nil {
+		panic(err)
+	}
+	defer in.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	dec := encoding.NewDecoder(in)
+	enc := encoding.NewEncoderFor(out, dec)
+	added := make(map[uint64]bool)
+	for {
+		var ev encoding.Event
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			panic(err)
+		}
+		// Add the experimental batch before the first batch of an M in
+		// the generation
+		if batch, err := ev.AsV2Batch(dec.Version()); err == nil && int64(batch.M) >= 0 && !added[batch.Gen] {
+			added[batch.Gen] = true
+			experimental := encoding.Event{
+				Type: encoding.EventV2ExperimentalBatch,
+				Args: []uint64{1, batch.Gen, batch.M, batch.Ts},
+				Str:  []byte("\x01main.secretType"),
+			}
+			if err := enc.Encode(&experimental); err != nil {
+				panic(err)
+			}
+		}
+		if err := enc.Encode(&ev); err != nil {
+			panic(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		panic(err)
+	}
+	if err := out.Flush(); err != nil {
+		panic(err)
+	}
+}
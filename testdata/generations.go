@@ -0,0 +1,52 @@
+//go:build ignore
+
+// This program produces a go 1.22+ trace that spans several generations. The
+// runtime starts a new generation about every second. It's used for the
+// traces in testdata/1.26/.
+
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+func main() {
+	if err := trace.Start(os.Stdout); err != nil {
+		panic(err)
+	}
+	defer trace.Stop()
+
+	// Keep a goroutine blocked for the whole trace, so that its state has
+	// to be carried over from one generation to the next.
+	blocked := make(chan struct{})
+	defer close(blocked)
+	go func() { <-blocked }()
+
+	// Pass values to some goroutines for 2.5 seconds to produce scheduling
+	// and user events in every generation, with a GC in the middle.
+	ctx, task := trace.NewTask(context.Background(), "generations")
+	defer task.End()
+	var wg sync.WaitGroup
+	ch := make(chan int)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range ch {
+				trace.Log(ctx, "value", "received")
+			}
+		}()
+	}
+	time.AfterFunc(1250*time.Millisecond, runtime.GC)
+	for deadline := time.Now().Add(2500 * time.Millisecond); time.Now().Before(deadline); {
+		trace.WithRegion(ctx, "send", func() { ch <- 1 })
+		time.Sleep(20 * time.Millisecond)
+	}
+	close(ch)
+	wg.Wait()
+}
@@ -0,0 +1,50 @@
+//go:build ignore
+// +build ignore
+
+// This program produces a small trace that can be generated by any go version
+// that supports runtime/trace. It's used for the traces in testdata/1.*/.
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+func main() {
+	if err := trace.Start(os.Stdout); err != nil {
+		panic(err)
+	}
+	defer trace.Stop()
+
+	// Pass some values around between goroutines to produce scheduling
+	// events.
+	var wg sync.WaitGroup
+	ch := make(chan int)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range ch {
+				time.Sleep(time.Duration(v) * time.Microsecond)
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+
+	// Allocate some memory and force a GC to produce GC events.
+	for i := 0; i < 100; i++ {
+		sink = append(sink, make([]byte, 1024))
+	}
+	runtime.GC()
+}
+
+// sink keeps allocations alive. runtime.KeepAlive isn't available in go 1.6.
+var sink [][]byte